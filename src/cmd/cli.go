@@ -4,11 +4,14 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"math/big"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/admi-n/solidity-Excavator/src/internal/download"
 )
 
 // Reporter 先不写
@@ -22,23 +25,74 @@ type CLIConfig struct {
 	TargetFile    string // 包含地址/批次的 YAML 路径
 	TargetAddress string // 单个合约地址，当 -t=contract 时使用
 	BlockRange    *BlockRange
-	Chain         string // eth | bsc | arb
+	Chain         string // eth | bsc | arb（链注册表中的链名，下载、扫描与查询都只作用于该链）
 	Concurrency   int
 	Verbose       bool
 	Timeout       time.Duration
 
 	// 下载相关配置
-	Download      bool        // -d 启动下载流程
-	DownloadRange *BlockRange // -d-range 指定下载区块范围（格式 start-end），为空表示从上次继续下载
-	DownloadFile  string      // -file 指定包含地址的 txt 文件（每行一个地址），用于重试下载
+	Download          bool          // -d 启动下载流程
+	DownloadRange     *BlockRange   // -d-range 指定下载区块范围（格式 start-end），为空表示从上次继续下载
+	DownloadFile      string        // -file 指定包含地址的 txt 文件（每行一个地址），用于重试下载
+	DownloadWorkers   int           // -d-workers 并发抓取区块的 worker 数
+	RPCRate           int           // -rpc-rate 每个 RPC 节点每秒请求预算（chains.<chain>.rpc[].rate 可单独覆盖）
+	TraceMode         string        // -trace 工厂合约内部创建的发现方式
+	CreationLookup    string        // -creation-lookup 按地址下载的合约查找创建区块的方式
+	HashStrip         bool          // -hash-strip 计算 code_hash 时去掉 CBOR 元数据尾部
+	Follow            bool          // -follow 持续跟随链头下载
+	Confirmations     uint64        // -confirmations 跟随模式的确认深度
+	PollInterval      time.Duration // -poll 跟随模式在 HTTP RPC 下的轮询间隔
+	RefreshBalances   bool          // -refresh-balances 刷新已存储合约的余额
+	BalanceBatch      int           // -balance-batch 每批刷新的合约数
+	Multicall         bool          // -multicall 通过 Multicall3 批量读取
+	StaleAfter        time.Duration // -stale 只刷新超过该时长未刷新的合约
+	RefreshTokens     bool          // -refresh-tokens 统计已存储合约的代币持仓
+	BackfillActivity  bool          // -backfill-activity 为已下载区间回填 txlast / txcount
+	ActivityForce     bool          // -backfill-activity-force 重新抓取已计入的区块，补计之后才入库的合约
+	RequeueUnverified bool          // -requeue-unverified 重新查询验证状态未确定的未开源合约
+	Recheck           bool          // -recheck 按时间表复查已确认未开源的合约
+	RecheckMinBalance string        // -recheck-min-balance 余额不低于该值（wei）的合约每次都复查
+	RecheckEvery      time.Duration // -recheck-every 跟随模式下复查的间隔
+	RetryFailures     bool          // -retry-failures 重试失败队列中的区块与地址
+	DecodeMetadata    bool          // -decode-metadata 为已入库合约回填字节码 CBOR 元数据列
+	IndexSelectors    bool          // -index-selectors 为已入库代码建立函数选择器索引
+	Classify          bool          // -classify 为已入库合约判断类型标签
+	BackfillCreation  bool          // -backfill-creation 为创建区块为 0 的合约查找创建区块
+
+	// 语料导出/导入
+	ExportDir   string      // -export 导出归档目录
+	ImportDir   string      // -import 导入归档目录
+	CorpusRange *BlockRange // -x-range 只导出/导入该创建区块范围内的合约
+	CorpusOpen  string      // -x-open 只导出/导入已开源（yes）或未开源（no）的合约
+	MinBalance  string      // -x-min-balance 只导出/导入余额不低于该值的合约（wei）
+	ShardSize   int         // -x-shard 每个分片的合约数
+
+	// 函数选择器查询
+	FindSelectors    []string // -sel 查询代码包含全部这些选择器的合约
+	ShowSelectors    string   // -sel-show 列出合约的选择器及文本签名
+	ImportSignatures string   // -sel-import 导入 4byte 风格的签名库
+
+	// 部署者查询
+	Deployer string // -deployer 列出部署者的全部合约
 
 	// 新增：输入文件参数
 	InputFile string // -i 指定输入文件（如复现代码文件）
 
 	Proxy string // 新增：HTTP 代理 (例如 http://127.0.0.1:7897)
 
+	// 链访问的录制与回放
+	RPCRecord  string // -rpc-record 把节点的 JSON-RPC 响应录制到该文件
+	RPCFixture string // -rpc-fixture 回放录制的响应（文件或目录），不连接节点
+
 	// 报告相关参数
 	ReportDir string // -r 指定markdown报告输出目录，默认为reports
+
+	// 目标筛选
+	MinHoldingsUSD float64  // -t-min-holdings 只扫描总持仓不低于该美元价值的合约
+	SortBy         string   // -t-sort 目标与报告排序方式（holdings）
+	SolcVersion    string   // -t-solc 按编译器版本过滤目标（如 <0.8.0）
+	Selectors      []string // -t-selector 只扫描代码包含全部这些选择器的合约
+	Kinds          []string // -t-kind 按合约类型标签过滤（! 前缀表示排除）
 }
 
 // BlockRange 简单的起止区块范围结构
@@ -54,6 +108,16 @@ func (b *BlockRange) String() string {
 	return fmt.Sprintf("%d-%d", b.Start, b.End)
 }
 
+// parseEther 将以 ETH 为单位的十进制数转换为 wei（十进制字符串）
+func parseEther(s string) (string, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || r.Sign() < 0 {
+		return "", fmt.Errorf("invalid ETH amount: %s", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt(big.NewInt(1e18)))
+	return new(big.Int).Quo(r.Num(), r.Denom()).String(), nil
+}
+
 // parseBlockRange 解析类似 "1-220234" 或 "1000-"（开放结束）的字符串并返回 BlockRange。
 func parseBlockRange(s string) (*BlockRange, error) {
 	if strings.TrimSpace(s) == "" {
@@ -91,8 +155,65 @@ func parseBlockRange(s string) (*BlockRange, error) {
 
 // Validate 检查 CLIConfig 的必需/一致性输入。
 func (c *CLIConfig) Validate() error {
+	// 链名统一小写，所有命令都按链区分数据（是否在链注册表中由使用处检查）
+	c.Chain = strings.ToLower(c.Chain)
+	if c.Chain == "" {
+		c.Chain = "eth"
+	}
+	if c.RPCRecord != "" && c.RPCFixture != "" {
+		return errors.New("-rpc-record and -rpc-fixture cannot be combined")
+	}
+
+	// 部署者查询
+	if c.Deployer != "" {
+		if c.Download || c.ExportDir != "" || c.ImportDir != "" || len(c.FindSelectors) > 0 || c.ShowSelectors != "" || c.ImportSignatures != "" {
+			return errors.New("-deployer cannot be combined with other commands")
+		}
+		return nil
+	}
+
+	// 函数选择器查询
+	if len(c.FindSelectors) > 0 || c.ShowSelectors != "" || c.ImportSignatures != "" {
+		n := 0
+		for _, set := range []bool{len(c.FindSelectors) > 0, c.ShowSelectors != "", c.ImportSignatures != ""} {
+			if set {
+				n++
+			}
+		}
+		if n > 1 {
+			return errors.New("-sel, -sel-show and -sel-import cannot be combined")
+		}
+		if c.Download || c.ExportDir != "" || c.ImportDir != "" {
+			return errors.New("-sel/-sel-show/-sel-import cannot be combined with -d, -export or -import")
+		}
+		return nil
+	}
+
+	// 语料导出/导入
+	if c.ExportDir != "" || c.ImportDir != "" {
+		if c.ExportDir != "" && c.ImportDir != "" {
+			return errors.New("-export cannot be combined with -import")
+		}
+		if c.Download {
+			return errors.New("-export/-import cannot be combined with -d")
+		}
+		if c.CorpusOpen != "" && c.CorpusOpen != "yes" && c.CorpusOpen != "no" {
+			return errors.New("-x-open must be: yes | no")
+		}
+		return nil
+	}
+
 	// 如果是下载模式，仅需要下载相关配置
 	if c.Download {
+		if c.Follow && c.DownloadFile != "" {
+			return errors.New("-follow cannot be combined with -file")
+		}
+		if (c.RefreshBalances || c.RefreshTokens || c.BackfillActivity || c.RequeueUnverified || c.RetryFailures || c.DecodeMetadata || c.IndexSelectors || c.Classify || c.BackfillCreation || c.Recheck) && (c.Follow || c.DownloadFile != "") {
+			return errors.New("-refresh-balances/-refresh-tokens/-backfill-activity/-requeue-unverified/-retry-failures/-decode-metadata/-index-selectors/-classify/-backfill-creation/-recheck cannot be combined with -follow or -file")
+		}
+		if c.ActivityForce && !c.BackfillActivity {
+			return errors.New("-backfill-activity-force requires -backfill-activity")
+		}
 		return nil
 	}
 
@@ -105,18 +226,23 @@ func (c *CLIConfig) Validate() error {
 	if c.Mode != "mode1" && c.Mode != "mode2" && c.Mode != "mode3" {
 		return errors.New("-m must be one of: mode1, mode2, mode3")
 	}
-	// 允许 db | file | contract | address
-	if c.TargetSource != "db" && c.TargetSource != "file" && c.TargetSource != "contract" && c.TargetSource != "address" {
-		return errors.New("-t must be one of: db, file, contract, address")
+	// 允许 db | file | contract | address | deployer
+	if c.TargetSource != "db" && c.TargetSource != "file" && c.TargetSource != "contract" && c.TargetSource != "address" && c.TargetSource != "deployer" {
+		return errors.New("-t must be one of: db, file, contract, address, deployer")
 	}
 	if c.TargetSource == "file" && c.TargetFile == "" {
 		return errors.New("-t-file is required when -t=file")
 	}
-	if (c.TargetSource == "contract" || c.TargetSource == "address") && c.TargetAddress == "" {
-		return errors.New("-t-address is required when -t=contract or -t=address")
+	if (c.TargetSource == "contract" || c.TargetSource == "address" || c.TargetSource == "deployer") && c.TargetAddress == "" {
+		return errors.New("-t-address is required when -t=contract, -t=address or -t=deployer")
 	}
-	if c.Chain == "" {
-		c.Chain = "eth" // default
+	if c.SortBy != "" && c.SortBy != "holdings" {
+		return errors.New("-t-sort must be: holdings")
+	}
+	if c.SolcVersion != "" {
+		if _, _, err := download.ParseSolcConstraint(c.SolcVersion); err != nil {
+			return err
+		}
 	}
 	if c.Concurrency <= 0 {
 		c.Concurrency = 4
@@ -139,6 +265,12 @@ func showHelp(topic string) {
 		showTargetHelp()
 	case "c", "chain":
 		showChainHelp()
+	case "export", "import":
+		showCorpusHelp()
+	case "sel", "sel-show", "sel-import":
+		showSelectorHelp()
+	case "db":
+		showDBHelp()
 	default:
 		showGeneralHelp()
 	}
@@ -153,6 +285,11 @@ func showGeneralHelp() {
 	fmt.Println()
 	fmt.Println("主要命令:")
 	fmt.Println("  -d, --download    启动合约下载模式")
+	fmt.Println("  -export <dir>     导出合约语料为归档目录")
+	fmt.Println("  -import <dir>     从归档目录导入合约语料")
+	fmt.Println("  -sel <list>       查询包含指定函数选择器的合约")
+	fmt.Println("  -deployer <addr>  列出部署者的全部合约（含其工厂合约再创建的合约）")
+	fmt.Println("  db <migrate|status|prune>  升级 / 查看数据库表结构版本，清理语料")
 	fmt.Println("  -ai <provider>    指定AI提供商进行扫描")
 	fmt.Println("  -m <mode>         指定扫描模式")
 	fmt.Println("  -s <strategy>     指定扫描策略")
@@ -167,6 +304,9 @@ func showGeneralHelp() {
 	fmt.Println("  excavator -s --help     # 扫描策略帮助")
 	fmt.Println("  excavator -t --help     # 扫描目标帮助")
 	fmt.Println("  excavator -c --help     # 区块链网络帮助")
+	fmt.Println("  excavator -export --help  # 语料导出/导入帮助")
+	fmt.Println("  excavator -sel --help     # 函数选择器查询帮助")
+	fmt.Println("  excavator db --help       # 数据库表结构迁移帮助")
 	fmt.Println()
 	fmt.Println("示例:")
 	fmt.Println("  excavator -ai chatgpt5 -m mode1 -s hourglass-vul -t contract -t-address 0x123... -c eth -r ./")
@@ -186,13 +326,64 @@ func showDownloadHelp() {
 	fmt.Println("选项:")
 	fmt.Println("  -d-range <range>    指定下载区块范围 (格式: start-end)")
 	fmt.Println("  -file <path>        从文件读取合约地址进行下载 (独立模式)")
+	fmt.Println("  -d-workers <n>      并发抓取区块的 worker 数 (默认 4)")
+	fmt.Println("  -rpc-rate <n>       每个 RPC 节点每秒请求预算，可被 chains.<chain>.rpc[].rate 覆盖 (默认 20)")
+	fmt.Println("  -trace <mode>       工厂合约内部创建的发现方式 (默认 auto)")
+	fmt.Println("                        auto   依次尝试 debug -> parity -> logs")
+	fmt.Println("                        debug  debug_traceBlockByNumber + callTracer")
+	fmt.Println("                        parity trace_block (Erigon/Nethermind)")
+	fmt.Println("                        logs   探测区块内发出日志的未知地址（需要归档节点）")
+	fmt.Println("                        off    只处理顶层创建交易")
+	fmt.Println("  -creation-lookup <mode> 按地址下载 (-file / mode1 按需下载) 的合约查找创建区块的方式 (默认 auto)")
+	fmt.Println("                        auto     先查浏览器 getcontractcreation，查不到时在归档节点上二分查找")
+	fmt.Println("                        explorer 只查浏览器")
+	fmt.Println("                        archive  按 eth_getCode 在历史区块上二分查找 (需要归档节点)")
+	fmt.Println("                        off      不查找，创建区块记为 0")
+	fmt.Println("  -hash-strip=<bool>  计算 code_hash 时去掉 CBOR 元数据尾部 (默认 true，同一个库应保持一致)")
+	fmt.Println("  -follow             持续跟随链头下载新区块 (Ctrl+C 退出并保存进度)")
+	fmt.Println("  -confirmations <n>  跟随模式的确认深度 (默认 12)")
+	fmt.Println("  -poll <duration>    跟随模式下节点不支持订阅时的轮询间隔 (默认为链的出块时间)")
+	fmt.Println("  -refresh-balances   刷新已存储合约的余额 (wei 全精度，可配合 -d-range 按创建区块过滤)")
+	fmt.Println("  -balance-batch <n>  每批刷新的合约数 (默认 100)")
+	fmt.Println("  -multicall          通过 Multicall3 批量读取（默认使用批量 JSON-RPC）")
+	fmt.Println("  -stale <duration>   只刷新从未刷新或超过该时长未刷新的合约 (如 24h)")
+	fmt.Println("  -refresh-tokens     通过 Multicall3 统计合约的 ERC-20 持仓 (代币列表见 settings.yaml tokens.<chain>)")
+	fmt.Println("  -backfill-activity  为已下载区间回填 txlast / txcount (默认全部已下载区间，或 -d-range 指定)")
+	fmt.Println("  -backfill-activity-force 重新抓取已计入的区块，为之后才入库的合约补计交互 (已计入的合约不会重复计数)")
+	fmt.Println("  -requeue-unverified 重新查询验证状态未确定的未开源合约 (修正被限流误判为未开源的记录)")
+	fmt.Println("  -recheck            复查已确认未开源的合约：首个合约创建后满 1 天、1 周、1 月各查一次，已验证时改判为已开源")
+	fmt.Println("  -recheck-min-balance <eth> 同哈希合约余额不低于该值时每次复查都查询 (默认 10，0 表示不按余额复查)")
+	fmt.Println("  -recheck-every <duration>  跟随模式下每隔该时长复查一次 (如 1h，默认 0 不复查)")
+	fmt.Println("  -retry-failures     重试失败队列 (download_failures) 中已到重试时间的区块与地址")
+	fmt.Println("  -decode-metadata    为已入库合约回填字节码 CBOR 元数据 (编译器版本、IPFS/Swarm 元数据哈希)，可配合 -d-range")
+	fmt.Println("  -index-selectors    为升级前已入库的代码建立函数选择器索引 (新下载的代码入库时自动建立)")
+	fmt.Println("  -classify           为升级前已入库的合约判断类型标签 (erc20/erc721/erc1155/erc4626/univ2-pair/multisig/proxy/unknown)，可配合 -d-range")
+	fmt.Println("  -backfill-creation  为创建区块为 0 的合约 (升级前按地址下载) 查找创建区块、创建交易与部署者，按 -creation-lookup 方式")
+	fmt.Println("  -c <chain>          下载的链 (默认 eth，RPC 与浏览器 API 见 settings.yaml chains.<chain>)")
 	fmt.Println("  -proxy <url>        使用HTTP代理")
+	fmt.Println("  -rpc-record <file>  把节点的 JSON-RPC 响应录制到文件 (JSON Lines)，用于离线复现")
+	fmt.Println("  -rpc-fixture <path> 回放录制的响应 (文件或目录下全部 .jsonl)，不连接任何节点")
 	fmt.Println()
 	fmt.Println("示例:")
 	fmt.Println("  excavator -d                           # 从上次位置继续下载")
+	fmt.Println("  excavator -d -c bsc -d-range 1000-2000 # 下载 BSC 区块1000-2000")
+	fmt.Println("  excavator -d -follow -confirmations 6  # 持续跟随链头，6 个确认后入库")
+	fmt.Println("  excavator -d -follow -recheck-every 1h # 跟随链头，每小时复查一次未开源合约")
+	fmt.Println("  excavator -d -recheck -recheck-min-balance 50         # 复查到期的未开源合约，余额 >= 50 ETH 的每次都查")
 	fmt.Println("  excavator -d -d-range 1000-2000        # 下载区块1000-2000")
+	fmt.Println("  excavator -d -d-range 1000-2000 -d-workers 16 -rpc-rate 50  # 16 个 worker 并行下载")
 	fmt.Println("  excavator -d -file contracts.txt      # 只下载文件中的合约地址")
+	fmt.Println("  excavator -d -refresh-balances -stale 24h -multicall  # 刷新 24 小时内未刷新的余额")
+	fmt.Println("  excavator -d -backfill-activity -d-range 1000-2000   # 回填区块1000-2000的交互记录")
+	fmt.Println("  excavator -d -backfill-activity -backfill-activity-force -d-range 1000-2000  # 补计之后才入库的合约")
+	fmt.Println("  excavator -d -retry-failures                          # 重试失败队列中到期的区块与地址")
+	fmt.Println("  excavator -d -decode-metadata                         # 回填编译器版本与元数据哈希")
+	fmt.Println("  excavator -d -index-selectors                         # 为已入库代码建立选择器索引")
+	fmt.Println("  excavator -d -classify                                # 为已入库合约判断类型标签")
+	fmt.Println("  excavator -d -backfill-creation -creation-lookup archive  # 在归档节点上补查创建区块")
 	fmt.Println("  excavator -d -file failed.txt -proxy http://127.0.0.1:7897")
+	fmt.Println("  excavator -d -d-range 1000-1010 -rpc-record rpc.jsonl     # 录制节点响应")
+	fmt.Println("  excavator -d -d-range 1000-1010 -rpc-fixture rpc.jsonl    # 离线回放复现")
 }
 
 // showAIHelp 显示AI提供商帮助
@@ -292,11 +483,18 @@ func showTargetHelp() {
 	fmt.Println("  address      扫描单个地址 (同contract)")
 	fmt.Println("  db           扫描数据库中的合约")
 	fmt.Println("  file         扫描文件中的合约地址")
+	fmt.Println("  deployer     扫描部署者的全部合约 (含其工厂合约再创建的合约)")
 	fmt.Println()
 	fmt.Println("相关选项:")
-	fmt.Println("  -t-address <addr>    单个合约地址 (与-t contract/address一起使用)")
+	fmt.Println("  -t-address <addr>    单个合约地址 (与-t contract/address一起使用)，或部署者地址 (与-t deployer一起使用)")
 	fmt.Println("  -t-file <path>        合约地址文件路径 (与-t file一起使用)")
 	fmt.Println("  -t-block <range>      区块范围 (与-t db一起使用)")
+	fmt.Println("  -t-min-holdings <usd> 只扫描总持仓(原生币+代币)不低于该美元价值的合约 (与-t db一起使用)")
+	fmt.Println("  -t-sort holdings      按总持仓从高到低选择目标并排序报告")
+	fmt.Println("  -t-solc <cond>        按字节码元数据中的编译器版本过滤 (如 <0.8.0，与-t db一起使用)")
+	fmt.Println("  -t-selector <list>    只扫描代码包含全部这些函数选择器/签名的合约 (逗号分隔，与-t db一起使用)")
+	fmt.Println("  -t-kind <list>        按合约类型过滤 (逗号分隔，任一命中；!前缀表示排除，与-t db一起使用)")
+	fmt.Println("                        类型: erc20 erc721 erc1155 erc4626 univ2-pair multisig proxy unknown")
 	fmt.Println()
 	fmt.Println("用法:")
 	fmt.Println("  excavator -ai <provider> -m <mode> -s <strategy> -t <target> [目标选项]")
@@ -304,7 +502,12 @@ func showTargetHelp() {
 	fmt.Println("示例:")
 	fmt.Println("  excavator -ai chatgpt5 -m mode1 -s hourglass-vul -t contract -t-address 0x123...")
 	fmt.Println("  excavator -ai deepseek -m mode1 -s hourglass-vul -t db -t-block 1-1000")
+	fmt.Println("  excavator -ai deepseek -m mode1 -s hourglass-vul -t db -t-min-holdings 10000 -t-sort holdings")
+	fmt.Println("  excavator -ai deepseek -m mode1 -s hourglass-vul -t db -t-solc \"<0.8.0\"")
+	fmt.Println("  excavator -ai deepseek -m mode1 -s hourglass-vul -t db -t-selector \"transferOwnership(address)\"")
+	fmt.Println("  excavator -ai deepseek -m mode1 -s hourglass-vul -t db -t-kind erc4626,univ2-pair")
 	fmt.Println("  excavator -ai chatgpt5 -m mode1 -s hourglass-vul -t file -t-file contracts.txt")
+	fmt.Println("  excavator -ai deepseek -m mode1 -s hourglass-vul -t deployer -t-address 0xabc...")
 	fmt.Println("  excavator -ai deepseek -m mode1 -s hourglassvul -t contract -t-address 0x123... -i hourglass.t.sol")
 }
 
@@ -312,13 +515,16 @@ func showTargetHelp() {
 func showChainHelp() {
 	fmt.Println("⛓️  区块链网络 (-c, --chain)")
 	fmt.Println()
-	fmt.Println("功能: 指定要扫描的区块链网络")
+	fmt.Println("功能: 指定下载、扫描与查询的区块链网络，各链数据在数据库中互相独立")
 	fmt.Println()
 	fmt.Println("支持的网络:")
 	fmt.Println("  eth         以太坊主网 (默认)")
 	fmt.Println("  bsc         Binance Smart Chain")
 	fmt.Println("  arb         Arbitrum")
 	fmt.Println()
+	fmt.Println("链注册表 (settings.yaml chains.<chain>): chain_id、rpc（可多个，依次尝试）、explorer_api、")
+	fmt.Println("blockscout_url、native_symbol、block_time；未配置的项使用内置默认值，也可新增其他 EVM 链")
+	fmt.Println()
 	fmt.Println("用法:")
 	fmt.Println("  excavator -ai <provider> -m <mode> -s <strategy> -t <target> -c <chain>")
 	fmt.Println()
@@ -326,6 +532,57 @@ func showChainHelp() {
 	fmt.Println("  excavator -ai chatgpt5 -m mode1 -s hourglass-vul -t contract -t-address 0x123... -c eth")
 	fmt.Println("  excavator -ai deepseek -m mode1 -s hourglass-vul -t db -t-block 1-1000 -c bsc")
 	fmt.Println("  excavator -ai chatgpt5 -m mode1 -s hourglass-vul -t file -t-file contracts.txt -c arb")
+	fmt.Println("  excavator -d -c bsc -follow")
+	fmt.Println("  excavator -sel \"transferOwnership(address)\" -c arb")
+}
+
+// showCorpusHelp 显示语料导出/导入帮助
+func showCorpusHelp() {
+	fmt.Println("📦 语料导出/导入 (-export / -import)")
+	fmt.Println()
+	fmt.Println("功能: 在不同机器间共享已下载的合约语料（合约、代码哈希、元数据、源文件、代理关联、创建字节码与构造参数、代币持仓）")
+	fmt.Println("格式: 目录下的 manifest.json（链、区块区间、数量、分片校验和）+ gzip 压缩的 JSONL 分片")
+	fmt.Println()
+	fmt.Println("用法:")
+	fmt.Println("  excavator -export <dir> [选项]")
+	fmt.Println("  excavator -import <dir> [选项]")
+	fmt.Println()
+	fmt.Println("选项:")
+	fmt.Println("  -c <chain>            语料所属的链 (默认 eth，导入时需与归档一致)")
+	fmt.Println("  -x-range <range>      只导出/导入该创建区块范围内的合约 (格式: start-end)")
+	fmt.Println("  -x-open <yes|no>      只导出/导入已开源 / 未开源的合约")
+	fmt.Println("  -x-min-balance <eth>  只导出/导入余额不低于该值的合约 (单位 ETH)")
+	fmt.Println("  -x-shard <n>          每个分片的合约数 (默认 50000)")
+	fmt.Println()
+	fmt.Println("导入按 upsert 写入，重复导入同一归档结果不变；未按 -x-open / -x-min-balance 过滤时，")
+	fmt.Println("归档中的已下载区间会计入 download_progress，之后 -d 不会重复下载这些区块")
+	fmt.Println()
+	fmt.Println("示例:")
+	fmt.Println("  excavator -export ./corpus-eth")
+	fmt.Println("  excavator -export ./rich -x-min-balance 10 -x-open no")
+	fmt.Println("  excavator -import ./corpus-eth -x-range 15000000-16000000")
+}
+
+// showSelectorHelp 显示函数选择器查询帮助
+func showSelectorHelp() {
+	fmt.Println("🔎 函数选择器查询 (-sel / -sel-show / -sel-import)")
+	fmt.Println()
+	fmt.Println("功能: 按 runtime 字节码分发器中的 4 字节选择器查找合约（未开源合约同样适用）")
+	fmt.Println("索引: 下载时自动提取到 contract_selectors；升级前已入库的代码用 -d -index-selectors 补建")
+	fmt.Println()
+	fmt.Println("用法:")
+	fmt.Println("  excavator -sel <list>          输出代码包含全部选择器的合约地址（每行一个，可直接用作 -d -file / -t file）")
+	fmt.Println("  excavator -sel-show <address>  列出合约的选择器及已知的文本签名")
+	fmt.Println("  excavator -sel-import <file>   导入 4byte 风格的签名库到 function_signatures")
+	fmt.Println()
+	fmt.Println("<list> 为逗号分隔的选择器 (0x 加 8 位十六进制) 或函数签名，签名括号内的逗号不作分隔")
+	fmt.Println("签名库每行一个签名，可带选择器 (如 \"0xa9059cbb transfer(address,uint256)\")，也支持 4byte 导出的 CSV")
+	fmt.Println()
+	fmt.Println("示例:")
+	fmt.Println("  excavator -sel \"transferOwnership(address)\" > owned.txt")
+	fmt.Println("  excavator -sel \"0xa9059cbb,approve(address,uint256)\"")
+	fmt.Println("  excavator -sel-import ./signatures.txt")
+	fmt.Println("  excavator -sel-show 0x123...")
 }
 
 // ParseFlags 解析 os.Args 并返回 CLIConfig 或错误。用于从 main 调用。
@@ -364,7 +621,33 @@ func ParseFlags() (*CLIConfig, error) {
 	// 新增下载相关 flags（不包含 rpc/dbdsn）
 	downloadFlag := fs.Bool("d", false, "启动区块/合约下载流程（从数据库记录的最后区块继续，或使用 -d-range 指定范围）")
 	drange := fs.String("d-range", "", "下载区块范围（format start-end），与 -d 一起使用时覆盖从上次继续的行为")
+	dworkers := fs.Int("d-workers", 4, "下载时并发抓取区块的 worker 数")
+	rpcRate := fs.Int("rpc-rate", 20, "下载时每个 RPC 节点每秒请求预算")
+	hashStrip := fs.Bool("hash-strip", true, "计算 code_hash 时去掉 CBOR 元数据尾部（同一个库应保持一致）")
+	follow := fs.Bool("follow", false, "与 -d 一起使用：持续跟随链头下载新区块")
+	confirmations := fs.Uint64("confirmations", 12, "跟随模式的确认深度")
+	pollInterval := fs.Duration("poll", 0, "跟随模式下节点不支持订阅时的轮询间隔（默认为链的出块时间）")
+	refreshBalances := fs.Bool("refresh-balances", false, "与 -d 一起使用：刷新已存储合约的余额")
+	balanceBatch := fs.Int("balance-batch", 100, "刷新余额时每批的合约数")
+	multicall := fs.Bool("multicall", false, "刷新余额时通过 Multicall3 批量读取")
+	staleAfter := fs.Duration("stale", 0, "刷新余额时只处理超过该时长未刷新的合约（0 表示全部）")
+	refreshTokens := fs.Bool("refresh-tokens", false, "与 -d 一起使用：统计已存储合约的 ERC-20 代币持仓")
+	backfillActivity := fs.Bool("backfill-activity", false, "与 -d 一起使用：为已下载区间回填 txlast / txcount")
+	activityForce := fs.Bool("backfill-activity-force", false, "与 -backfill-activity 一起使用：重新抓取已计入的区块，补计之后才入库的合约")
+	requeueUnverified := fs.Bool("requeue-unverified", false, "与 -d 一起使用：重新查询验证状态未确定的未开源合约")
+	recheck := fs.Bool("recheck", false, "与 -d 一起使用：按 1 天 / 1 周 / 1 月的时间表复查已确认未开源的合约")
+	recheckMinBalance := fs.String("recheck-min-balance", "10", "复查时余额不低于该值（单位 ETH）的合约每次都查询，0 表示不按余额复查")
+	recheckEvery := fs.Duration("recheck-every", 0, "与 -follow 一起使用：每隔该时长复查一次未开源合约（0 表示不复查）")
+	retryFailures := fs.Bool("retry-failures", false, "与 -d 一起使用：重试失败队列中的区块与地址")
+	decodeMetadata := fs.Bool("decode-metadata", false, "与 -d 一起使用：为已入库合约回填字节码 CBOR 元数据（编译器版本、元数据哈希）")
+	indexSelectors := fs.Bool("index-selectors", false, "与 -d 一起使用：为已入库代码建立函数选择器索引")
+	classify := fs.Bool("classify", false, "与 -d 一起使用：为已入库合约判断类型标签（erc20、erc721、proxy 等）")
+	traceMode := fs.String("trace", "auto", "工厂合约内部创建的发现方式: auto | debug | parity | logs | off")
+	creationLookup := fs.String("creation-lookup", "auto", "按地址下载的合约查找创建区块的方式: auto | explorer | archive | off")
+	backfillCreation := fs.Bool("backfill-creation", false, "与 -d 一起使用：为创建区块为 0 的合约查找创建区块、创建交易与部署者")
 	proxy := fs.String("proxy", "", "可选 HTTP 代理，例如 http://127.0.0.1:7897（下载/请求 Etherscan 时生效）")
+	rpcRecord := fs.String("rpc-record", "", "把节点的 JSON-RPC 响应录制到该文件（JSON Lines），供 -rpc-fixture 回放")
+	rpcFixture := fs.String("rpc-fixture", "", "回放录制的 RPC 响应（文件或目录），不连接任何节点")
 
 	ai := fs.String("ai", "", "AI provider to use (e.g. chatgpt5)")
 	mode := fs.String("m", "", "Mode to run: mode1(targeted) | mode2(fuzzy) | mode3(general)")
@@ -373,34 +656,130 @@ func ParseFlags() (*CLIConfig, error) {
 	blockRange := fs.String("t-block", "", "Block range for scanning (format start-end, e.g. 1-220234)")
 	tfile := fs.String("t-file", "", "YAML file path when -t=file; can be a directory for batching")
 	taddress := fs.String("t-address", "", "单个合约地址，当 -t=contract 或 -t=address 时使用")
-	chain := fs.String("c", "eth", "Chain to scan: eth | bsc | arb (default eth)")
+	chain := fs.String("c", "eth", "Chain to download/scan: eth | bsc | arb, or any chain added under chains in settings.yaml (default eth)")
 	concurrency := fs.Int("concurrency", 4, "Worker concurrency")
 	verbose := fs.Bool("v", false, "Verbose output")
 	timeout := fs.Duration("timeout", 120*time.Second, "Per-AI request timeout")
 	fileFlag := fs.String("file", "", "当 -d 一起使用时，从指定 txt 文件读取地址逐条重新下载（每行一个地址）")
 	inputFile := fs.String("i", "", "指定输入文件（如复现代码文件），用于mode1扫描")
 	reportDir := fs.String("r", "reports", "指定markdown报告输出目录，默认为reports")
+	minHoldings := fs.Float64("t-min-holdings", 0, "-t db 时只扫描总持仓不低于该美元价值的合约")
+	sortBy := fs.String("t-sort", "", "目标与报告排序方式: holdings")
+	solcVersion := fs.String("t-solc", "", "-t db 时按编译器版本过滤，如 <0.8.0、>=0.6、=0.7.6")
+	targetSelectors := fs.String("t-selector", "", "-t db 时只扫描代码包含全部这些选择器/函数签名的合约（逗号分隔）")
+	targetKinds := fs.String("t-kind", "", "-t db 时按合约类型过滤（逗号分隔，任一命中；! 前缀表示排除，如 erc20,!proxy）")
+	findSelectors := fs.String("sel", "", "查询代码包含全部这些选择器/函数签名的合约（逗号分隔）")
+	showSelectors := fs.String("sel-show", "", "列出合约的函数选择器及文本签名")
+	importSignatures := fs.String("sel-import", "", "导入 4byte 风格的函数签名库")
+	deployer := fs.String("deployer", "", "列出部署者的全部合约（含其工厂合约再创建的合约）")
+	exportDir := fs.String("export", "", "导出合约语料到指定目录")
+	importDir := fs.String("import", "", "从指定目录导入合约语料")
+	corpusRange := fs.String("x-range", "", "导出/导入时只处理该创建区块范围内的合约（format start-end）")
+	corpusOpen := fs.String("x-open", "", "导出/导入时只处理已开源（yes）或未开源（no）的合约")
+	minBalance := fs.String("x-min-balance", "", "导出/导入时只处理余额不低于该值的合约（单位 ETH）")
+	shardSize := fs.Int("x-shard", 50000, "导出时每个分片的合约数")
 
 	if err := fs.Parse(os.Args[1:]); err != nil {
 		return nil, err
 	}
 
 	cfg := &CLIConfig{
-		AIProvider:    strings.TrimSpace(*ai),
-		Mode:          strings.TrimSpace(*mode),
-		Strategy:      strings.TrimSpace(*strategy),
-		TargetSource:  strings.TrimSpace(*target),
-		TargetFile:    strings.TrimSpace(*tfile),
-		TargetAddress: strings.TrimSpace(*taddress),
-		Chain:         strings.TrimSpace(*chain),
-		Concurrency:   *concurrency,
-		Verbose:       *verbose,
-		Timeout:       *timeout,
-		Download:      *downloadFlag,
-		Proxy:         strings.TrimSpace(*proxy),
-		DownloadFile:  strings.TrimSpace(*fileFlag),
-		InputFile:     strings.TrimSpace(*inputFile),
-		ReportDir:     strings.TrimSpace(*reportDir),
+		AIProvider:        strings.TrimSpace(*ai),
+		Mode:              strings.TrimSpace(*mode),
+		Strategy:          strings.TrimSpace(*strategy),
+		TargetSource:      strings.TrimSpace(*target),
+		TargetFile:        strings.TrimSpace(*tfile),
+		TargetAddress:     strings.TrimSpace(*taddress),
+		Chain:             strings.TrimSpace(*chain),
+		Concurrency:       *concurrency,
+		Verbose:           *verbose,
+		Timeout:           *timeout,
+		Download:          *downloadFlag,
+		Proxy:             strings.TrimSpace(*proxy),
+		RPCRecord:         strings.TrimSpace(*rpcRecord),
+		RPCFixture:        strings.TrimSpace(*rpcFixture),
+		DownloadFile:      strings.TrimSpace(*fileFlag),
+		DownloadWorkers:   *dworkers,
+		RPCRate:           *rpcRate,
+		TraceMode:         strings.ToLower(strings.TrimSpace(*traceMode)),
+		CreationLookup:    strings.ToLower(strings.TrimSpace(*creationLookup)),
+		HashStrip:         *hashStrip,
+		Follow:            *follow,
+		Confirmations:     *confirmations,
+		PollInterval:      *pollInterval,
+		RefreshBalances:   *refreshBalances,
+		BalanceBatch:      *balanceBatch,
+		Multicall:         *multicall,
+		StaleAfter:        *staleAfter,
+		RefreshTokens:     *refreshTokens,
+		BackfillActivity:  *backfillActivity,
+		ActivityForce:     *activityForce,
+		RequeueUnverified: *requeueUnverified,
+		Recheck:           *recheck,
+		RecheckEvery:      *recheckEvery,
+		RetryFailures:     *retryFailures,
+		DecodeMetadata:    *decodeMetadata,
+		IndexSelectors:    *indexSelectors,
+		Classify:          *classify,
+		BackfillCreation:  *backfillCreation,
+		InputFile:         strings.TrimSpace(*inputFile),
+		ReportDir:         strings.TrimSpace(*reportDir),
+		MinHoldingsUSD:    *minHoldings,
+		SortBy:            strings.ToLower(strings.TrimSpace(*sortBy)),
+		SolcVersion:       strings.TrimSpace(*solcVersion),
+		ExportDir:         strings.TrimSpace(*exportDir),
+		ImportDir:         strings.TrimSpace(*importDir),
+		CorpusOpen:        strings.ToLower(strings.TrimSpace(*corpusOpen)),
+		ShardSize:         *shardSize,
+		ShowSelectors:     strings.TrimSpace(*showSelectors),
+		ImportSignatures:  strings.TrimSpace(*importSignatures),
+		Deployer:          strings.TrimSpace(*deployer),
+	}
+
+	if strings.TrimSpace(*findSelectors) != "" {
+		sels, err := download.ParseSelectorList(*findSelectors)
+		if err != nil {
+			return nil, err
+		}
+		cfg.FindSelectors = sels
+	}
+	if strings.TrimSpace(*targetSelectors) != "" {
+		sels, err := download.ParseSelectorList(*targetSelectors)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Selectors = sels
+	}
+	if strings.TrimSpace(*targetKinds) != "" {
+		kinds, err := download.ParseKindList(*targetKinds)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Kinds = kinds
+	}
+
+	if strings.TrimSpace(*corpusRange) != "" {
+		br, err := parseBlockRange(*corpusRange)
+		if err != nil {
+			return nil, err
+		}
+		cfg.CorpusRange = br
+	}
+	if strings.TrimSpace(*minBalance) != "" {
+		wei, err := parseEther(*minBalance)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MinBalance = wei
+	}
+	if strings.TrimSpace(*recheckMinBalance) != "" {
+		wei, err := parseEther(*recheckMinBalance)
+		if err != nil {
+			return nil, err
+		}
+		if wei != "0" {
+			cfg.RecheckMinBalance = wei
+		}
 	}
 
 	// 解析下载区块范围（如果提供）
@@ -441,8 +820,111 @@ func ParseFlags() (*CLIConfig, error) {
 	return cfg, nil
 }
 
+// DBCommand 数据库维护子命令（excavator db <action>），不走扫描/下载的 flag 解析
+type DBCommand struct {
+	Action string // migrate | status | prune
+	Chain  string // -c 清理的链
+
+	// db prune
+	Policies       []string    // -policy 清理策略（见 download.Prune*）
+	DecompiledDays int         // -days decompiled 策略只清理早于该天数的反编译输出
+	BlockRange     *BlockRange // -range 只处理该创建区块范围内的合约
+	BatchSize      int         // -batch selfdestructed 每批 eth_getCode 请求数
+	Apply          bool        // -apply 确认执行，否则只输出预览
+	Compact        bool        // -compact 执行后回收数据库空间
+}
+
+// parseDBCommand 解析 excavator db 之后的参数
+func parseDBCommand(args []string) (*DBCommand, error) {
+	fs := flag.NewFlagSet("db", flag.ContinueOnError)
+	fs.Usage = showDBHelp
+	if len(args) == 0 {
+		showDBHelp()
+		return nil, flag.ErrHelp
+	}
+	action := strings.ToLower(strings.TrimSpace(args[0]))
+	if action == "-h" || action == "--help" || action == "help" {
+		showDBHelp()
+		return nil, flag.ErrHelp
+	}
+
+	chain := fs.String("c", "eth", "清理的链")
+	policy := fs.String("policy", "", "清理策略（逗号分隔）: dup-code | selfdestructed | decompiled")
+	days := fs.Int("days", 30, "decompiled 策略只清理早于该天数写入的反编译输出（0 表示全部）")
+	blockRange := fs.String("range", "", "只处理该创建区块范围内的合约（format start-end）")
+	batch := fs.Int("batch", 100, "selfdestructed 策略每批 eth_getCode 请求的合约数")
+	apply := fs.Bool("apply", false, "确认执行清理（默认只输出将清理的行数与字节数）")
+	compact := fs.Bool("compact", true, "与 -apply 一起使用：清理后回收数据库空间（MySQL OPTIMIZE TABLE，SQLite VACUUM）")
+	if err := fs.Parse(args[1:]); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("db %s: unexpected argument %q", action, fs.Arg(0))
+	}
+
+	c := &DBCommand{
+		Action:         action,
+		Chain:          strings.ToLower(strings.TrimSpace(*chain)),
+		DecompiledDays: *days,
+		BatchSize:      *batch,
+		Apply:          *apply,
+		Compact:        *compact,
+	}
+	if c.Action == "prune" {
+		policies, err := download.ParsePrunePolicies(*policy)
+		if err != nil {
+			return nil, err
+		}
+		c.Policies = policies
+	} else if strings.TrimSpace(*policy) != "" || *apply {
+		return nil, fmt.Errorf("-policy and -apply are only valid for db prune")
+	}
+	if strings.TrimSpace(*blockRange) != "" {
+		br, err := parseBlockRange(*blockRange)
+		if err != nil {
+			return nil, err
+		}
+		c.BlockRange = br
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate 检查子命令
+func (c *DBCommand) Validate() error {
+	if c.Chain == "" {
+		c.Chain = "eth"
+	}
+	switch c.Action {
+	case "migrate", "status":
+		return nil
+	case "prune":
+		if c.DecompiledDays < 0 {
+			return errors.New("-days must be >= 0")
+		}
+		if c.BatchSize <= 0 {
+			return errors.New("-batch must be > 0")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown db command %q, must be one of: migrate, status, prune", c.Action)
+}
+
 // Run 是一个便利包装，解析 flags 并分派到相应处理器。
 func Run() error {
+	if len(os.Args) > 1 && os.Args[1] == "db" {
+		c, err := parseDBCommand(os.Args[2:])
+		if err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil
+			}
+			return err
+		}
+		return ExecuteDB(c)
+	}
+
 	cfg, err := ParseFlags()
 	if err != nil {
 		if errors.Is(err, flag.ErrHelp) {
@@ -463,3 +945,39 @@ func PrintFatal(err error) {
 	fmt.Fprintln(os.Stderr, "错误:", err)
 	os.Exit(1)
 }
+
+// showDBHelp 显示数据库维护命令帮助
+func showDBHelp() {
+	fmt.Println("🗄️  数据库维护 (db)")
+	fmt.Println()
+	fmt.Println("功能: 管理合约库的表结构版本与语料清理。迁移脚本内置在程序中（src/config/migrations/<mysql|sqlite>），")
+	fmt.Println("      已执行的版本记录在 schema_migrations 表；表结构落后时其他命令会拒绝运行，空库首次使用时自动建表")
+	fmt.Println()
+	fmt.Println("用法:")
+	fmt.Println("  excavator db migrate   按顺序执行尚未执行的迁移")
+	fmt.Println("  excavator db status    列出每个迁移是否已执行及执行时间")
+	fmt.Println("  excavator db prune -policy <list> [选项]   清理语料（默认只预览，加 -apply 执行）")
+	fmt.Println()
+	fmt.Println("清理策略 (-policy，逗号分隔):")
+	fmt.Println("  dup-code        零余额、无代币持仓的重复未开源合约：清空 contracts 中的字节码正文，")
+	fmt.Println("                  保留地址 -> code_hash，读取时从 contract_codes 取同哈希的字节码")
+	fmt.Println("  selfdestructed  逐个查询链上代码，删除已自毁的合约及不再被引用的代码、选择器、元数据（需要连接节点）")
+	fmt.Println("  decompiled      清空早于 -days 天写入的反编译输出（dedcode），之后可重新反编译")
+	fmt.Println()
+	fmt.Println("prune 选项:")
+	fmt.Println("  -c <chain>        清理的链 (默认 eth)")
+	fmt.Println("  -days <n>         decompiled 只清理早于 n 天的输出 (默认 30，0 表示全部)")
+	fmt.Println("  -range <range>    只处理该创建区块范围内的合约 (格式: start-end)")
+	fmt.Println("  -batch <n>        selfdestructed 每批 eth_getCode 请求数 (默认 100)")
+	fmt.Println("  -apply            确认执行；不加时只输出每个策略将清理的行数与字节数")
+	fmt.Println("  -compact=false    执行后不回收数据库空间（默认执行 OPTIMIZE TABLE / VACUUM，大库耗时较长）")
+	fmt.Println()
+	fmt.Println("数据库由 settings.yaml 的 database.dsn 选择；引入迁移前按 sql.txt 手工建的库执行 db migrate 时会被识别为版本 1，")
+	fmt.Println("缺少后来新增的列时按 migrations/mysql/0001_init.sql 末尾的升级语句补齐后重试")
+	fmt.Println()
+	fmt.Println("示例:")
+	fmt.Println("  excavator db status")
+	fmt.Println("  excavator db migrate")
+	fmt.Println("  excavator db prune -policy dup-code,decompiled -days 90")
+	fmt.Println("  excavator db prune -policy selfdestructed -c bsc -range 0-5000000 -apply")
+}
@@ -3,39 +3,67 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
 
 	"github.com/admi-n/solidity-Excavator/src/config"
 	"github.com/admi-n/solidity-Excavator/src/internal"
 	"github.com/admi-n/solidity-Excavator/src/internal/download"
 	"github.com/admi-n/solidity-Excavator/src/internal/handler"
+	"github.com/ethereum/go-ethereum/common"
 )
 
 // ExecuteDownload 执行下载命令
 func ExecuteDownload(cfg *CLIConfig) error {
 	fmt.Println("🚀 启动合约下载器...")
 
-	// 初始化 MySQL 数据库连接
-	fmt.Println("📊 正在连接 MySQL 数据库...")
-	db, err := config.InitDB()
+	// 加载配置文件（代币列表等），缺失时使用默认配置
+	if err := config.LoadSettings("src/config/settings.yaml"); err != nil {
+		fmt.Printf("⚠️  警告: 无法加载配置文件: %v，使用默认配置\n", err)
+	}
+
+	// 按 database.dsn 连接合约库（MySQL / SQLite）
+	fmt.Println("📊 正在连接数据库...")
+	store, err := config.InitDB()
 	if err != nil {
 		return fmt.Errorf("初始化数据库失败: %w", err)
 	}
-	defer db.Close()
-	fmt.Println("✅ 数据库连接成功!")
+	defer store.Close()
+	fmt.Printf("✅ 数据库连接成功! (%s)\n", store.Backend())
+
+	if err := download.ValidateTraceMode(cfg.TraceMode); err != nil {
+		return err
+	}
+	if err := download.ValidateCreationLookup(cfg.CreationLookup); err != nil {
+		return err
+	}
 
-	// 创建下载器
-	fmt.Println("🔗 正在创建下载器...")
-	dl, err := download.NewDownloader(db, cfg.Proxy)
+	// 创建下载器（连接 -c 指定链的节点，写入的数据都归属该链）
+	fmt.Printf("🔗 正在创建下载器 (链: %s)...\n", cfg.Chain)
+	dl, err := download.NewDownloader(store, cfg.Chain, cfg.Proxy, download.ChainReaderOptions{
+		Fixture: cfg.RPCFixture,
+		Record:  cfg.RPCRecord,
+	})
 	if err != nil {
 		return fmt.Errorf("创建下载器失败: %w", err)
 	}
 	defer dl.Close()
+	dl.SetPipelineOptions(download.PipelineOptions{
+		Workers:        cfg.DownloadWorkers,
+		RPCRate:        cfg.RPCRate,
+		Trace:          cfg.TraceMode,
+		CreationLookup: cfg.CreationLookup,
+	})
+	dl.SetStripMetadata(cfg.HashStrip)
 
-	// 创建上下文
-	ctx := context.Background()
+	// 创建上下文：Ctrl+C / SIGTERM 时取消，下载器会在落盘 checkpoint 后退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	fmt.Println("\n" + strings.Repeat("=", 50))
 	fmt.Println("开始同步合约数据...")
@@ -57,9 +85,9 @@ func ExecuteDownload(cfg *CLIConfig) error {
 			if line == "" || strings.HasPrefix(line, "#") {
 				continue
 			}
-			// 基本验证：以太坊地址应该是42个字符，以0x开头
-			if len(line) == 42 && strings.HasPrefix(line, "0x") {
-				addrs = append(addrs, line)
+			// 基本验证：以太坊地址应该是42个字符，以0x开头；统一为校验和格式
+			if len(line) == 42 && strings.HasPrefix(line, "0x") && common.IsHexAddress(line) {
+				addrs = append(addrs, common.HexToAddress(line).Hex())
 			} else {
 				fmt.Printf("⚠️  跳过无效地址: %s\n", line)
 			}
@@ -72,10 +100,9 @@ func ExecuteDownload(cfg *CLIConfig) error {
 			return fmt.Errorf("地址文件为空: %s", fpath)
 		}
 
-		// 将未下载成功的地址写入默认失败文件 eoferror.txt
-		failLog := "eoferror.txt"
-		fmt.Printf("🔁 正在根据 %s 重试 %d 个地址，失败将记录到 %s\n", fpath, len(addrs), failLog)
-		if err := dl.DownloadContractsByAddresses(ctx, addrs, failLog); err != nil {
+		// 未下载成功的地址计入失败队列，可用 -d -retry-failures 重试
+		fmt.Printf("🔁 正在根据 %s 下载 %d 个地址，失败将计入失败队列\n", fpath, len(addrs))
+		if err := dl.DownloadContractsByAddresses(ctx, addrs); err != nil {
 			return fmt.Errorf("按地址下载失败: %w", err)
 		}
 
@@ -83,6 +110,185 @@ func ExecuteDownload(cfg *CLIConfig) error {
 		return nil
 	}
 
+	// 刷新已存储合约的余额
+	if cfg.RefreshBalances {
+		opts := download.BalanceRefreshOptions{
+			BatchSize:    cfg.BalanceBatch,
+			UseMulticall: cfg.Multicall,
+			StaleAfter:   cfg.StaleAfter,
+		}
+		if cfg.DownloadRange != nil {
+			opts.BlockRange = &download.BlockRangeRecord{Start: cfg.DownloadRange.Start, End: cfg.DownloadRange.End}
+		}
+		if err := dl.RefreshBalances(ctx, opts); err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("\n⏹️  余额刷新已中断")
+				return nil
+			}
+			return fmt.Errorf("刷新余额失败: %w", err)
+		}
+		fmt.Println("\n🎉 余额刷新完成!")
+		return nil
+	}
+
+	// 统计已存储合约的代币持仓
+	if cfg.RefreshTokens {
+		tokens := config.GetChainTokens(cfg.Chain)
+		opts := download.TokenRefreshOptions{Tokens: tokens.List}
+		if cfg.DownloadRange != nil {
+			opts.BlockRange = &download.BlockRangeRecord{Start: cfg.DownloadRange.Start, End: cfg.DownloadRange.End}
+		}
+		if err := dl.RefreshTokenBalances(ctx, opts); err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("\n⏹️  代币持仓统计已中断")
+				return nil
+			}
+			return fmt.Errorf("统计代币持仓失败: %w", err)
+		}
+		fmt.Println("\n🎉 代币持仓统计完成!")
+		return nil
+	}
+
+	// 重新查询验证状态未确定的未开源合约
+	if cfg.RequeueUnverified {
+		opts := download.RequeueOptions{}
+		if cfg.DownloadRange != nil {
+			opts.BlockRange = &download.BlockRangeRecord{Start: cfg.DownloadRange.Start, End: cfg.DownloadRange.End}
+		}
+		if err := dl.RequeueUnverified(ctx, opts); err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("\n⏹️  重新查询已中断（未处理的合约下次继续）")
+				return nil
+			}
+			return fmt.Errorf("重新查询未开源合约失败: %w", err)
+		}
+		fmt.Println("\n🎉 重新查询完成!")
+		return nil
+	}
+
+	// 按时间表复查已确认未开源的合约
+	if cfg.Recheck {
+		if _, err := dl.RecheckVerification(ctx, download.RecheckOptions{MinBalance: cfg.RecheckMinBalance}); err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("\n⏹️  复查已中断（未复查的合约下次继续）")
+				return nil
+			}
+			return fmt.Errorf("复查未开源合约失败: %w", err)
+		}
+		fmt.Println("\n🎉 复查完成!")
+		return nil
+	}
+
+	// 重试失败队列中的区块与地址
+	if cfg.RetryFailures {
+		if err := dl.RetryFailures(ctx); err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("\n⏹️  失败队列重试已中断（未处理的项下次继续）")
+				return nil
+			}
+			return fmt.Errorf("重试失败队列失败: %w", err)
+		}
+		fmt.Println("\n🎉 失败队列重试完成!")
+		return nil
+	}
+
+	// 为已入库合约回填字节码 CBOR 元数据
+	if cfg.DecodeMetadata {
+		opts := download.DecodeMetadataOptions{}
+		if cfg.DownloadRange != nil {
+			opts.BlockRange = &download.BlockRangeRecord{Start: cfg.DownloadRange.Start, End: cfg.DownloadRange.End}
+		}
+		if err := dl.DecodeStoredMetadata(ctx, opts); err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("\n⏹️  元数据解析已中断（未处理的合约下次继续）")
+				return nil
+			}
+			return fmt.Errorf("解析 CBOR 元数据失败: %w", err)
+		}
+		fmt.Println("\n🎉 CBOR 元数据解析完成!")
+		return nil
+	}
+
+	// 为已入库代码建立函数选择器索引
+	if cfg.IndexSelectors {
+		if err := dl.IndexStoredSelectors(ctx, 0); err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("\n⏹️  选择器索引已中断（未处理的代码下次继续）")
+				return nil
+			}
+			return fmt.Errorf("建立选择器索引失败: %w", err)
+		}
+		fmt.Println("\n🎉 选择器索引完成!")
+		return nil
+	}
+
+	// 为已入库合约判断类型标签
+	if cfg.Classify {
+		opts := download.ClassifyOptions{}
+		if cfg.DownloadRange != nil {
+			opts.BlockRange = &download.BlockRangeRecord{Start: cfg.DownloadRange.Start, End: cfg.DownloadRange.End}
+		}
+		if err := dl.ClassifyStored(ctx, opts); err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("\n⏹️  类型判断已中断（已处理的批次已写入标签）")
+				return nil
+			}
+			return fmt.Errorf("判断合约类型失败: %w", err)
+		}
+		fmt.Println("\n🎉 合约类型判断完成!")
+		return nil
+	}
+
+	// 为创建区块为 0 的合约查找创建区块
+	if cfg.BackfillCreation {
+		if err := dl.BackfillCreations(ctx, 0); err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("\n⏹️  创建区块回填已中断（未回填的合约下次继续）")
+				return nil
+			}
+			return fmt.Errorf("回填创建区块失败: %w", err)
+		}
+		fmt.Println("\n🎉 创建区块回填完成!")
+		return nil
+	}
+
+	// 为已下载区间回填合约交互记录
+	if cfg.BackfillActivity {
+		var err error
+		if cfg.DownloadRange != nil {
+			if cfg.DownloadRange.End == ^uint64(0) {
+				return fmt.Errorf("回填范围的结束区块不能为空")
+			}
+			err = dl.BackfillActivity(ctx, cfg.DownloadRange.Start, cfg.DownloadRange.End, cfg.ActivityForce)
+		} else {
+			err = dl.BackfillDownloadedActivity(ctx, cfg.ActivityForce)
+		}
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("\n⏹️  交互记录回填已中断（已计入的区块下次自动跳过）")
+				return nil
+			}
+			return fmt.Errorf("回填交互记录失败: %w", err)
+		}
+		fmt.Println("\n🎉 交互记录回填完成!")
+		return nil
+	}
+
+	// 持续跟随链头
+	if cfg.Follow {
+		fmt.Println("👀 进入跟随模式 (Ctrl+C 退出)...")
+		if err := dl.Follow(ctx, download.FollowOptions{
+			Confirmations: cfg.Confirmations,
+			PollInterval:  cfg.PollInterval,
+			RecheckEvery:  cfg.RecheckEvery,
+			Recheck:       download.RecheckOptions{MinBalance: cfg.RecheckMinBalance},
+		}); err != nil {
+			return fmt.Errorf("跟随模式失败: %w", err)
+		}
+		fmt.Println("\n👋 跟随模式已退出，进度已保存")
+		return nil
+	}
+
 	// 如果没有指定文件，则按区块范围或从上次继续下载
 	if cfg.DownloadRange != nil {
 		start := cfg.DownloadRange.Start
@@ -92,11 +298,19 @@ func ExecuteDownload(cfg *CLIConfig) error {
 		}
 		fmt.Printf("📥 下载指定区块范围: %d 到 %d\n", start, end)
 		if err := dl.DownloadBlockRange(ctx, start, end); err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("\n⏹️  下载已中断，进度已保存")
+				return nil
+			}
 			return fmt.Errorf("下载失败: %w", err)
 		}
 	} else {
 		fmt.Println("📥 从上次下载位置继续...")
 		if err := dl.DownloadFromLast(ctx); err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("\n⏹️  下载已中断，进度已保存")
+				return nil
+			}
 			return fmt.Errorf("从上次继续下载失败: %w", err)
 		}
 	}
@@ -127,7 +341,15 @@ func ExecuteScan(cfg *CLIConfig) error {
 		Timeout:       cfg.Timeout,
 		InputFile:     cfg.InputFile,
 		Proxy:         cfg.Proxy,
+		RPCFixture:    cfg.RPCFixture,
+		RPCRecord:     cfg.RPCRecord,
 		ReportDir:     cfg.ReportDir,
+
+		MinHoldingsUSD: cfg.MinHoldingsUSD,
+		SortBy:         cfg.SortBy,
+		SolcVersion:    cfg.SolcVersion,
+		Selectors:      cfg.Selectors,
+		Kinds:          cfg.Kinds,
 	}
 	if cfg.BlockRange != nil {
 		internalCfg.BlockRange = &internal.BlockRange{
@@ -157,6 +379,21 @@ func ExecuteScan(cfg *CLIConfig) error {
 
 // Execute 执行主命令逻辑
 func Execute(cfg *CLIConfig) error {
+	// 语料导出/导入
+	if cfg.ExportDir != "" || cfg.ImportDir != "" {
+		return ExecuteCorpus(cfg)
+	}
+
+	// 部署者查询
+	if cfg.Deployer != "" {
+		return ExecuteDeployer(cfg)
+	}
+
+	// 函数选择器查询
+	if len(cfg.FindSelectors) > 0 || cfg.ShowSelectors != "" || cfg.ImportSignatures != "" {
+		return ExecuteSelectors(cfg)
+	}
+
 	// 下载模式优先
 	if cfg.Download {
 		return ExecuteDownload(cfg)
@@ -169,3 +406,292 @@ func Execute(cfg *CLIConfig) error {
 
 	return ExecuteScan(cfg)
 }
+
+// ExecuteCorpus 执行语料导出/导入命令
+func ExecuteCorpus(cfg *CLIConfig) error {
+	fmt.Println("📊 正在连接数据库...")
+	store, err := config.InitDB()
+	if err != nil {
+		return fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	defer store.Close()
+	db := store.DB()
+	fmt.Printf("✅ 数据库连接成功! (%s)\n", store.Backend())
+
+	filter := download.CorpusFilter{MinBalance: cfg.MinBalance}
+	if cfg.CorpusRange != nil {
+		filter.BlockRange = &download.BlockRangeRecord{Start: cfg.CorpusRange.Start, End: cfg.CorpusRange.End}
+	}
+	if cfg.CorpusOpen != "" {
+		open := cfg.CorpusOpen == "yes"
+		filter.OpenSource = &open
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.ExportDir != "" {
+		if _, err := download.ExportCorpus(ctx, db, download.ExportOptions{
+			Dir:       cfg.ExportDir,
+			Chain:     cfg.Chain,
+			Filter:    filter,
+			ShardSize: cfg.ShardSize,
+		}); err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Println("\n⏹️  导出已中断（目录中没有 manifest.json，不能用于导入）")
+				return nil
+			}
+			return fmt.Errorf("导出语料失败: %w", err)
+		}
+		fmt.Printf("\n🎉 语料已导出到 %s\n", cfg.ExportDir)
+		return nil
+	}
+
+	if err := download.ImportCorpus(ctx, db, download.ImportOptions{
+		Dir:    cfg.ImportDir,
+		Chain:  cfg.Chain,
+		Filter: filter,
+	}); err != nil {
+		if errors.Is(err, context.Canceled) {
+			fmt.Println("\n⏹️  导入已中断（重新执行导入即可，已导入的数据不会重复）")
+			return nil
+		}
+		return fmt.Errorf("导入语料失败: %w", err)
+	}
+	fmt.Println("\n🎉 语料导入完成!")
+	return nil
+}
+
+// ExecuteSelectors 执行函数选择器查询 / 签名库导入命令。
+// 查询结果（地址）输出到 stdout，其余信息输出到 stderr，便于重定向为地址文件
+func ExecuteSelectors(cfg *CLIConfig) error {
+	store, err := config.InitDB()
+	if err != nil {
+		return fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	defer store.Close()
+	db := store.DB()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch {
+	case cfg.ImportSignatures != "":
+		imported, skipped, err := download.ImportSignatures(ctx, db, cfg.ImportSignatures)
+		if err != nil {
+			return fmt.Errorf("导入签名库失败: %w", err)
+		}
+		fmt.Printf("🎉 签名库导入完成: %d 条签名，跳过无法解析或选择器不符的行 %d 条\n", imported, skipped)
+		return nil
+
+	case cfg.ShowSelectors != "":
+		sels, err := download.ContractSelectors(ctx, db, cfg.Chain, cfg.ShowSelectors)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("🔎 %s 共 %d 个函数选择器:\n", cfg.ShowSelectors, len(sels))
+		for _, s := range sels {
+			sig := "(未知签名)"
+			if len(s.Signatures) > 0 {
+				sig = strings.Join(s.Signatures, " | ")
+			}
+			fmt.Printf("  %s  %s\n", s.Selector, sig)
+		}
+		return nil
+
+	default:
+		addrs, err := download.FindBySelectors(ctx, db, cfg.Chain, cfg.FindSelectors)
+		if err != nil {
+			return err
+		}
+		for _, a := range addrs {
+			fmt.Println(a)
+		}
+		fmt.Fprintf(os.Stderr, "🔎 共 %d 个合约包含全部选择器 %s\n", len(addrs), strings.Join(cfg.FindSelectors, ", "))
+		return nil
+	}
+}
+
+// ExecuteDeployer 列出部署者的全部合约，地址输出到 stdout（每行一个，可直接用作 -t file / -d -file）
+func ExecuteDeployer(cfg *CLIConfig) error {
+	store, err := config.InitDB()
+	if err != nil {
+		return fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	defer store.Close()
+	db := store.DB()
+
+	addrs, err := download.ContractsByDeployer(context.Background(), db, cfg.Chain, cfg.Deployer)
+	if err != nil {
+		return err
+	}
+	for _, a := range addrs {
+		fmt.Println(a)
+	}
+	fmt.Fprintf(os.Stderr, "🏗️  部署者 %s 共有 %d 个合约\n", cfg.Deployer, len(addrs))
+	return nil
+}
+
+// ExecuteDB 执行数据库维护命令（db migrate / db status / db prune）
+func ExecuteDB(c *DBCommand) error {
+	if err := config.LoadSettings("src/config/settings.yaml"); err != nil {
+		fmt.Printf("⚠️  警告: 无法加载配置文件: %v，使用默认配置\n", err)
+	}
+	if c.Action == "prune" {
+		return ExecutePrune(c)
+	}
+	store, err := config.OpenConfiguredStore()
+	if err != nil {
+		return fmt.Errorf("连接数据库失败: %w", err)
+	}
+	defer store.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch c.Action {
+	case "migrate":
+		applied, err := config.Migrate(ctx, store)
+		for _, m := range applied {
+			fmt.Printf("✅ 已执行 %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("数据库迁移失败: %w", err)
+		}
+		if len(applied) == 0 {
+			fmt.Printf("✅ 表结构已是最新 (%s)\n", store.Backend())
+			return nil
+		}
+		fmt.Printf("🎉 迁移完成 (%s)：执行 %d 个，当前版本 %d\n", store.Backend(), len(applied), applied[len(applied)-1].Version)
+		return nil
+
+	default:
+		statuses, unknown, err := config.SchemaStatus(ctx, store)
+		if err != nil {
+			return err
+		}
+		current, pending := 0, 0
+		fmt.Printf("🗄️  数据库后端: %s\n", store.Backend())
+		for _, s := range statuses {
+			if s.Applied {
+				current = s.Version
+				fmt.Printf("  ✅ %04d_%-24s %s\n", s.Version, s.Name, s.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				pending++
+				fmt.Printf("  ⏳ %04d_%-24s 未执行\n", s.Version, s.Name)
+			}
+		}
+		for _, v := range unknown {
+			fmt.Printf("  ❓ %04d  数据库中存在、程序不认识的版本（由更新的程序执行）\n", v)
+		}
+		switch {
+		case len(unknown) > 0:
+			fmt.Println("⚠️  数据库表结构比程序新，请升级 excavator")
+		case pending > 0:
+			fmt.Printf("⚠️  当前版本 %d，%d 个迁移待执行，请运行 excavator db migrate\n", current, pending)
+		default:
+			fmt.Printf("✅ 表结构已是最新（版本 %d）\n", current)
+		}
+		return nil
+	}
+}
+
+// ExecutePrune 清理语料：先输出每个策略将清理的行数与字节数，加 -apply 时再执行并回收空间
+func ExecutePrune(c *DBCommand) error {
+	fmt.Println("📊 正在连接数据库...")
+	store, err := config.InitDB()
+	if err != nil {
+		return fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	defer store.Close()
+	db := store.DB()
+	fmt.Printf("✅ 数据库连接成功! (%s)\n", store.Backend())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := download.PruneOptions{
+		Chain:          c.Chain,
+		Policies:       c.Policies,
+		DecompiledDays: c.DecompiledDays,
+		BatchSize:      c.BatchSize,
+	}
+	if c.BlockRange != nil {
+		opts.BlockRange = &download.BlockRangeRecord{Start: c.BlockRange.Start, End: c.BlockRange.End}
+	}
+
+	// 只有 selfdestructed 需要查询链上代码
+	var reader download.ChainReader
+	if slices.Contains(c.Policies, download.PruneSelfDestructed) {
+		chainCfg, err := config.GetChain(c.Chain)
+		if err != nil {
+			return err
+		}
+		r, err := download.OpenChainReader(chainCfg, download.ChainReaderOptions{})
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		reader = r
+	}
+
+	plan, err := download.PlanPrune(ctx, db, reader, opts)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			fmt.Println("\n⏹️  已中断，未修改任何数据")
+			return nil
+		}
+		return fmt.Errorf("统计待清理数据失败: %w", err)
+	}
+
+	fmt.Printf("\n🧹 清理预览（%s，%s）:\n", c.Chain, store.Backend())
+	for _, s := range plan.Stats {
+		line := fmt.Sprintf("  %-16s %10d 行  %10s", s.Policy, s.Rows, formatBytes(s.Bytes))
+		if s.Codes > 0 {
+			line += fmt.Sprintf("  （另删除 %d 个不再被引用的代码哈希）", s.Codes)
+		}
+		fmt.Println(line)
+	}
+	total := plan.Total()
+	fmt.Printf("  %-16s %10d 行  %10s\n", "合计", total.Rows, formatBytes(total.Bytes))
+
+	if !c.Apply {
+		fmt.Println("\nℹ️  预览模式，未修改任何数据；确认后加 -apply 执行")
+		return nil
+	}
+	if total.Rows == 0 && total.Codes == 0 {
+		fmt.Println("\n✅ 没有需要清理的数据")
+		return nil
+	}
+
+	fmt.Println("\n🧹 开始清理...")
+	if _, err := download.ApplyPrune(ctx, db, plan); err != nil {
+		if errors.Is(err, context.Canceled) {
+			fmt.Println("\n⏹️  清理已中断（已处理的批次不会回滚，重新执行即可继续）")
+			return nil
+		}
+		return fmt.Errorf("清理失败: %w", err)
+	}
+	if c.Compact {
+		fmt.Println("🗜️  正在回收数据库空间...")
+		if err := store.Compact(ctx); err != nil {
+			return fmt.Errorf("回收空间失败: %w", err)
+		}
+	}
+	fmt.Println("\n🎉 清理完成!")
+	return nil
+}
+
+// formatBytes 以 B/KB/MB/GB 显示字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit && exp < 3; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
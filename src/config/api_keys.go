@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -33,13 +34,30 @@ type Settings struct {
 		DSN string `yaml:"dsn"`
 	} `yaml:"database"`
 
+	// 旧版单 RPC 配置，chains.<name>.rpc 未配置时使用
 	RPC struct {
 		Ethereum string `yaml:"ethereum"`
 		BSC      string `yaml:"bsc"`
 		Arbitrum string `yaml:"arbitrum"`
 	} `yaml:"rpc"`
 
+	// 链注册表，key 为链名（eth | bsc | arb，也可新增），未配置的项使用内置默认值
+	Chains map[string]ChainConfig `yaml:"chains"`
+
 	AI AIConfig `yaml:"ai"`
+
+	// Etherscan API key 池（轮询使用，每个 key 单独限速）
+	Etherscan struct {
+		APIKeys    []string `yaml:"api_keys"`
+		BaseURL    string   `yaml:"base_url"`
+		RatePerKey int      `yaml:"rate_per_key"` // 每个 key 每秒请求数，免费 key 为 5
+	} `yaml:"etherscan"`
+
+	// 源码来源，按 order 依次尝试
+	Sources SourceSettings `yaml:"sources"`
+
+	// 各链需要统计持仓的代币列表，key 为链名（eth | bsc | arb）
+	Tokens map[string]ChainTokens `yaml:"tokens"`
 }
 
 var globalSettings *Settings
@@ -47,7 +65,13 @@ var globalSettings *Settings
 // LoadSettings 加载配置文件
 func LoadSettings(configPath string) error {
 	if configPath == "" {
+		// 未指定时依次尝试 src 目录与仓库根目录下运行时的相对路径
 		configPath = "config/settings.yaml"
+		if _, err := os.Stat(configPath); err != nil {
+			if _, err := os.Stat("src/config/settings.yaml"); err == nil {
+				configPath = "src/config/settings.yaml"
+			}
+		}
 	}
 
 	data, err := os.ReadFile(configPath)
@@ -178,3 +202,93 @@ func GetLocalLLMConfig() (baseURL, model string) {
 
 	return baseURL, model
 }
+
+// GetEtherscanKeys 获取 Etherscan API key 列表：优先环境变量 ETHERSCAN_API_KEYS（逗号分隔），
+// 其次配置文件 etherscan.api_keys，都没有时使用内置的 EtherscanAPIKey
+func GetEtherscanKeys() []string {
+	var keys []string
+	if env := os.Getenv("ETHERSCAN_API_KEYS"); env != "" {
+		keys = strings.Split(env, ",")
+	} else {
+		if globalSettings == nil {
+			LoadSettings("")
+		}
+		if globalSettings != nil {
+			keys = globalSettings.Etherscan.APIKeys
+		}
+	}
+
+	out := make([]string, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		k = strings.TrimSpace(k)
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, k)
+	}
+	if len(out) == 0 && EtherscanAPIKey != "" {
+		out = append(out, EtherscanAPIKey)
+	}
+	return out
+}
+
+// GetEtherscanBaseURL 获取 Etherscan API 地址
+func GetEtherscanBaseURL() string {
+	if globalSettings == nil {
+		LoadSettings("")
+	}
+
+	if globalSettings != nil && globalSettings.Etherscan.BaseURL != "" {
+		return globalSettings.Etherscan.BaseURL
+	}
+
+	return EtherscanBaseURL // 默认值
+}
+
+// GetEtherscanRatePerKey 获取每个 Etherscan key 的每秒请求预算
+func GetEtherscanRatePerKey() int {
+	if globalSettings == nil {
+		LoadSettings("")
+	}
+
+	if globalSettings != nil && globalSettings.Etherscan.RatePerKey > 0 {
+		return globalSettings.Etherscan.RatePerKey
+	}
+
+	return 5 // 免费 key 的限额
+}
+
+// SourceSettings 合约源码来源配置
+type SourceSettings struct {
+	Order         []string `yaml:"order"`          // 依次尝试的来源：etherscan | sourcify | sourcify-local | blockscout
+	SourcifyURL   string   `yaml:"sourcify_url"`   // Sourcify 服务地址
+	SourcifyRepo  string   `yaml:"sourcify_repo"`  // 本地 Sourcify 仓库目录（包含 contracts/full_match 等），用于离线查询
+	BlockscoutURL string   `yaml:"blockscout_url"` // 以太坊主网的 Blockscout 实例地址（可为自建实例），其他链见 chains.<name>.blockscout_url
+}
+
+// GetSourceSettings 获取源码来源配置，未配置的项使用默认值
+func GetSourceSettings() SourceSettings {
+	if globalSettings == nil {
+		LoadSettings("")
+	}
+
+	var s SourceSettings
+	if globalSettings != nil {
+		s = globalSettings.Sources
+	}
+	if len(s.Order) == 0 {
+		s.Order = []string{"etherscan", "sourcify"}
+		if s.SourcifyRepo != "" {
+			s.Order = append([]string{"sourcify-local"}, s.Order...)
+		}
+	}
+	if s.SourcifyURL == "" {
+		s.SourcifyURL = "https://sourcify.dev/server"
+	}
+	if s.BlockscoutURL == "" {
+		s.BlockscoutURL = "https://eth.blockscout.com"
+	}
+	return s
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChainConfig 链注册表中的一条链
+type ChainConfig struct {
+	Name          string        `yaml:"-"`              // 链名（eth | bsc | arb），即 -c 的取值
+	ChainID       uint64        `yaml:"chain_id"`       // EVM chain id，用于 Etherscan v2 的 chainid 参数与 Sourcify 查询
+	RPC           []RPCEndpoint `yaml:"rpc"`            // RPC 节点池，按权重轮询，故障节点自动剔除
+	ExplorerAPI   string        `yaml:"explorer_api"`   // Etherscan 兼容的 API 地址（v2 多链共用一个地址，靠 chainid 区分）
+	BlockscoutURL string        `yaml:"blockscout_url"` // 该链的 Blockscout 实例（可为自建），为空时跳过 blockscout 来源
+	NativeSymbol  string        `yaml:"native_symbol"`  // 原生币符号
+	BlockTime     float64       `yaml:"block_time"`     // 平均出块时间（秒），跟随模式据此决定轮询间隔
+}
+
+// defaultChains 未在 settings.yaml 中配置时使用的内置链信息（公共 RPC 有限速，建议在配置中替换）
+var defaultChains = map[string]ChainConfig{
+	"eth": {
+		ChainID:       1,
+		RPC:           []RPCEndpoint{{URL: RPCURL}},
+		ExplorerAPI:   EtherscanBaseURL,
+		BlockscoutURL: "https://eth.blockscout.com",
+		NativeSymbol:  "ETH",
+		BlockTime:     12,
+	},
+	"bsc": {
+		ChainID:      56,
+		RPC:          []RPCEndpoint{{URL: "https://bsc-dataseed.bnbchain.org"}},
+		ExplorerAPI:  EtherscanBaseURL,
+		NativeSymbol: "BNB",
+		BlockTime:    3,
+	},
+	"arb": {
+		ChainID:       42161,
+		RPC:           []RPCEndpoint{{URL: "https://arb1.arbitrum.io/rpc"}},
+		ExplorerAPI:   EtherscanBaseURL,
+		BlockscoutURL: "https://arbitrum.blockscout.com",
+		NativeSymbol:  "ETH",
+		BlockTime:     0.25,
+	},
+}
+
+// GetChain 获取链配置：settings.yaml 中 chains.<name> 配置的项覆盖内置默认值，
+// rpc 还兼容旧的 rpc.ethereum / rpc.bsc / rpc.arbitrum 写法
+func GetChain(name string) (ChainConfig, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = "eth"
+	}
+
+	if globalSettings == nil {
+		LoadSettings("")
+	}
+
+	out, known := defaultChains[name]
+	if globalSettings != nil {
+		// 旧版 sources.blockscout_url 只对以太坊主网有意义
+		if name == "eth" && globalSettings.Sources.BlockscoutURL != "" {
+			out.BlockscoutURL = globalSettings.Sources.BlockscoutURL
+		}
+		if c, ok := globalSettings.Chains[name]; ok {
+			known = true
+			if c.ChainID > 0 {
+				out.ChainID = c.ChainID
+			}
+			if len(c.RPC) > 0 {
+				out.RPC = c.RPC
+			}
+			if c.ExplorerAPI != "" {
+				out.ExplorerAPI = c.ExplorerAPI
+			}
+			if c.BlockscoutURL != "" {
+				out.BlockscoutURL = c.BlockscoutURL
+			}
+			if c.NativeSymbol != "" {
+				out.NativeSymbol = c.NativeSymbol
+			}
+			if c.BlockTime > 0 {
+				out.BlockTime = c.BlockTime
+			}
+		} else if legacy := legacyRPC(name); legacy != "" {
+			out.RPC = []RPCEndpoint{{URL: legacy}}
+		}
+	}
+	if !known {
+		return ChainConfig{}, fmt.Errorf("未知的链: %s（可选: %s）", name, strings.Join(ChainNames(), " | "))
+	}
+	if out.ChainID == 0 {
+		return ChainConfig{}, fmt.Errorf("链 %s 未配置 chain_id", name)
+	}
+	if len(out.RPC) == 0 {
+		return ChainConfig{}, fmt.Errorf("链 %s 未配置 RPC：请在 settings.yaml 的 chains.%s.rpc 中设置", name, name)
+	}
+	if out.ExplorerAPI == "" {
+		out.ExplorerAPI = GetEtherscanBaseURL()
+	}
+	if out.NativeSymbol == "" {
+		out.NativeSymbol = "ETH"
+	}
+	if out.BlockTime <= 0 {
+		out.BlockTime = 12
+	}
+	out.Name = name
+	return out, nil
+}
+
+// ChainNames 返回已注册的链名（内置与 settings.yaml 中新增的），按名称排序
+func ChainNames() []string {
+	if globalSettings == nil {
+		LoadSettings("")
+	}
+
+	seen := make(map[string]bool)
+	var out []string
+	for name := range defaultChains {
+		seen[name] = true
+		out = append(out, name)
+	}
+	if globalSettings != nil {
+		for name := range globalSettings.Chains {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "" && !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// legacyRPC 旧版 rpc 配置段中对应链的地址
+func legacyRPC(name string) string {
+	switch name {
+	case "eth":
+		return globalSettings.RPC.Ethereum
+	case "bsc":
+		return globalSettings.RPC.BSC
+	case "arb":
+		return globalSettings.RPC.Arbitrum
+	}
+	return ""
+}
@@ -6,11 +6,10 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/admi-n/solidity-Excavator/src/internal"
 	_ "github.com/go-sql-driver/mysql"
 )
 
-// 数据库配置信息 - 直接在这里修改
+// 未配置 database.dsn 时使用的本地 MySQL 连接信息
 const (
 	DBHost     = "localhost"
 	DBPort     = "3306"
@@ -19,8 +18,8 @@ const (
 	DBName     = "solidity_excavator"
 )
 
-// 后续将ethkey和rpc全都做轮询 并且不同链不同rpc
-// RPC 配置信息 - 直接在这里修改
+// 后续将ethkey和rpc全都做轮询
+// 以太坊主网的默认 RPC（链注册表 eth 的内置值），其他链见 chains.go
 const (
 	RPCURL = "https://rpc.ankr.com/eth/f6d5d2fe5359af3a7d15801f0ec73d5d0d997cadfb50ff072f6e18d5bbfe0103"
 )
@@ -33,175 +32,45 @@ const (
 // 全局连接池
 var DBPool *sql.DB
 
-// InitDB 初始化 MySQL 连接池并 ping 验证
-func InitDB() (*sql.DB, error) {
-	// 构建 DSN: username:password@tcp(host:port)/dbname?parseTime=true
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&charset=utf8mb4",
-		DBUser, DBPassword, DBHost, DBPort, DBName)
-
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, fmt.Errorf("InitDB: %w", err)
-	}
-
-	// 设置连接池参数
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
-
-	// 验证连接
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := db.PingContext(ctx); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("InitDB ping failed: %w", err)
-	}
-
-	DBPool = db
-	return db, nil
-}
-
-// GetContracts 从 contracts 表读取记录，limit<=0 表示不限制
-func GetContracts(ctx context.Context, db *sql.DB, limit int) ([]internal.Contract, error) {
-	if db == nil {
-		return nil, fmt.Errorf("GetContracts: db is nil")
-	}
-
-	query := "SELECT address, contract, balance, isopensource, createtime, createblock, txlast, isdecompiled, dedcode FROM contracts" //hello 这里contracts以后改成eth，方便扫其他链子
-	var rows *sql.Rows
-	var err error
-
-	//if limit > 0 {
-	//	query += " LIMIT ?"
-	//	rows, err = db.QueryContext(ctx, query, limit)
-	//} else {
-	//	rows, err = db.QueryContext(ctx, query)
-	//}
-	if limit > 0 {
-		query = fmt.Sprintf("%s LIMIT %d", query, limit)
-		rows, err = db.QueryContext(ctx, query)
-	} else {
-		rows, err = db.QueryContext(ctx, query)
-	}
-
+// InitDB 按 settings.yaml 的 database.dsn 打开合约库（MySQL 或 SQLite），未配置时连接内置的本地 MySQL。
+// 表结构落后于程序时拒绝运行（空库会直接建表），需先执行 excavator db migrate
+func InitDB() (ContractStore, error) {
+	store, err := OpenConfiguredStore()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var out []internal.Contract
-	for rows.Next() {
-		var c internal.Contract
-		var isOpenInt int
-		var isDecompiledInt int
-		var createBlock int64
-		var createTime time.Time
-		var txLast time.Time
-		var balance string
-		var dedCode sql.NullString
-
-		if err := rows.Scan(&c.Address, &c.Code, &balance, &isOpenInt, &createTime, &createBlock, &txLast, &isDecompiledInt, &dedCode); err != nil {
-			return nil, err
-		}
-
-		c.Balance = balance
-		c.IsOpenSource = isOpenInt != 0
-		c.CreateTime = createTime
-		c.CreateBlock = uint64(createBlock)
-		c.TxLast = txLast
-		c.IsDecompiled = isDecompiledInt != 0
-		if dedCode.Valid {
-			c.DedCode = dedCode.String
-		}
-
-		out = append(out, c)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if err := CheckSchema(ctx, store); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("InitDB: %w", err)
 	}
-
-	return out, nil
+	DBPool = store.DB()
+	return store, nil
 }
 
-// GetContractsByAddresses 根据地址数组批量查询
-func GetContractsByAddresses(ctx context.Context, db *sql.DB, addresses []string) ([]internal.Contract, error) {
-	if db == nil {
-		return nil, fmt.Errorf("GetContractsByAddresses: db is nil")
-	}
-	if len(addresses) == 0 {
-		return nil, fmt.Errorf("GetContractsByAddresses: addresses empty")
+// OpenConfiguredStore 按 database.dsn 打开合约库，不检查表结构版本（db migrate / db status 使用）
+func OpenConfiguredStore() (ContractStore, error) {
+	if globalSettings == nil {
+		LoadSettings("")
 	}
-
-	// 构建 IN 查询的占位符
-	placeholders := make([]string, len(addresses))
-	args := make([]interface{}, len(addresses))
-	for i, addr := range addresses {
-		placeholders[i] = "?"
-		args[i] = addr
+	dsn := ""
+	if globalSettings != nil {
+		dsn = globalSettings.Database.DSN
 	}
 
-	query := fmt.Sprintf("SELECT address, contract, balance, isopensource, createtime, createblock, txlast, isdecompiled, dedcode FROM contracts WHERE address IN (%s)",
-		joinStrings(placeholders, ","))
-
-	rows, err := db.QueryContext(ctx, query, args...)
+	store, err := OpenStore(dsn)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var out []internal.Contract
-	for rows.Next() {
-		var c internal.Contract
-		var isOpenInt int
-		var isDecompiledInt int
-		var createBlock int64
-		var createTime time.Time
-		var txLast time.Time
-		var balance string
-		var dedCode sql.NullString
-
-		if err := rows.Scan(&c.Address, &c.Code, &balance, &isOpenInt, &createTime, &createBlock, &txLast, &isDecompiledInt, &dedCode); err != nil {
-			return nil, err
-		}
-
-		c.Balance = balance
-		c.IsOpenSource = isOpenInt != 0
-		c.CreateTime = createTime
-		c.CreateBlock = uint64(createBlock)
-		c.TxLast = txLast
-		c.IsDecompiled = isDecompiledInt != 0
-		if dedCode.Valid {
-			c.DedCode = dedCode.String
-		}
-
-		out = append(out, c)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("InitDB: %w", err)
 	}
-
-	return out, nil
+	return store, nil
 }
 
-// GetRPCURL 返回配置的 RPC URL
+// GetRPCURL 返回以太坊主网的首个 RPC URL（兼容旧调用，按链取配置使用 GetChain）
 func GetRPCURL() (string, error) {
-	if RPCURL == "" {
-		return "", fmt.Errorf("RPC_URL 未配置：请在 config.go 中设置 RPCURL 常量")
-	}
-	return RPCURL, nil
-}
-
-// joinStrings 辅助函数：连接字符串数组
-func joinStrings(strs []string, sep string) string {
-	if len(strs) == 0 {
-		return ""
-	}
-	result := strs[0]
-	for i := 1; i < len(strs); i++ {
-		result += sep + strs[i]
+	c, err := GetChain("eth")
+	if err != nil {
+		return "", err
 	}
-	return result
+	return c.RPC[0].URL, nil
 }
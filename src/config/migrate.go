@@ -0,0 +1,339 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles 各后端的迁移脚本：migrations/<backend>/<版本>_<名称>.sql，版本从 1 开始连续编号。
+// 两个后端的同一版本描述同一次表结构变更，新增列/表时两边各加一个文件
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaOutdated 数据库表结构落后于程序，需要先执行 excavator db migrate
+var ErrSchemaOutdated = errors.New("数据库表结构需要升级，请先执行 excavator db migrate")
+
+// Migration 一次表结构变更
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// MigrationStatus 迁移在当前数据库中的执行情况
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// migrationsTable 记录已执行迁移的表（两种方言通用）
+const migrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INT NOT NULL PRIMARY KEY,
+    name VARCHAR(128) NOT NULL,
+    appliedat DATETIME NOT NULL
+)`
+
+// legacyColumns 引入迁移前手工建的库：按旧版 sql.txt 后来新增的列逐表探测，已有的表都包含这些列才与 0001 一致
+var legacyColumns = []struct {
+	table   string
+	columns string
+}{
+	{"contracts", "chain, factory, creationtx, code_hash, balancetime, txcount, deployer, nonce, solcversion, metahashkind, metahash, experimental"},
+	{"contract_codes", "checked, selectorcount, firstchain"},
+	{"contract_metadata", "provider, matchtype"},
+	{"contract_creations", "chain"},
+	{"contract_proxies", "chain"},
+	{"contract_token_balances", "chain"},
+	{"block_hashes", "chain"},
+	{"activity_blocks", "chain"},
+}
+
+// Migrations 返回后端的全部迁移（按版本升序）
+func Migrations(backend string) ([]Migration, error) {
+	dir := path.Join("migrations", backend)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 迁移脚本失败: %w", backend, err)
+	}
+	var out []Migration
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		num, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("迁移脚本文件名无效: %s（应为 <版本>_<名称>.sql）", e.Name())
+		}
+		data, err := migrationFiles.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Migration{Version: version, Name: name, SQL: string(data)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, m := range out {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("%s 迁移版本不连续: 期望 %d，实际 %d_%s", backend, i+1, m.Version, m.Name)
+		}
+	}
+	return out, nil
+}
+
+// SchemaStatus 返回每个迁移的执行情况，以及数据库中存在、但程序不认识的版本（数据库由更新的程序升级过）
+func SchemaStatus(ctx context.Context, store ContractStore) ([]MigrationStatus, []int, error) {
+	migrations, err := Migrations(store.Backend())
+	if err != nil {
+		return nil, nil, err
+	}
+	applied, err := appliedMigrations(ctx, store)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make([]MigrationStatus, len(migrations))
+	known := make(map[int]bool, len(migrations))
+	for i, m := range migrations {
+		at, ok := applied[m.Version]
+		out[i] = MigrationStatus{Migration: m, Applied: ok, AppliedAt: at}
+		known[m.Version] = true
+	}
+	var unknown []int
+	for v := range applied {
+		if !known[v] {
+			unknown = append(unknown, v)
+		}
+	}
+	sort.Ints(unknown)
+	return out, unknown, nil
+}
+
+// CheckSchema 确认数据库已执行全部迁移：
+// 全新的空库直接建表；有待执行的迁移时返回 ErrSchemaOutdated，数据库版本比程序新时同样拒绝运行
+func CheckSchema(ctx context.Context, store ContractStore) error {
+	empty, err := isEmptyDatabase(ctx, store)
+	if err != nil {
+		return err
+	}
+	if empty {
+		applied, err := Migrate(ctx, store)
+		if err != nil {
+			return err
+		}
+		if n := len(applied); n > 0 {
+			fmt.Printf("🆕 空数据库，已创建表结构（版本 %d）\n", applied[n-1].Version)
+		}
+		return nil
+	}
+
+	statuses, unknown, err := SchemaStatus(ctx, store)
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("数据库表结构版本 %d 比程序支持的版本 %d 新，请升级 excavator", unknown[len(unknown)-1], len(statuses))
+	}
+	var pending []string
+	current := 0
+	for _, s := range statuses {
+		if s.Applied {
+			current = s.Version
+		} else {
+			pending = append(pending, fmt.Sprintf("%04d_%s", s.Version, s.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w（当前版本 %d，待执行: %s）", ErrSchemaOutdated, current, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// Migrate 按版本顺序执行尚未执行的迁移，返回本次执行的迁移。
+// 引入迁移前按 sql.txt 手工建好的库先检查列是否齐全（不全时报错并提示升级语句），0001 全部为 IF NOT EXISTS，只补建缺少的表
+func Migrate(ctx context.Context, store ContractStore) ([]Migration, error) {
+	migrations, err := Migrations(store.Backend())
+	if err != nil {
+		return nil, err
+	}
+	db := store.DB()
+
+	tracked, err := tableExists(ctx, store, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	if !tracked {
+		legacy, err := tableExists(ctx, store, "contracts")
+		if err != nil {
+			return nil, err
+		}
+		if legacy {
+			if err := checkLegacySchema(ctx, store); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if _, err := db.ExecContext(ctx, migrationsTable); err != nil {
+		return nil, fmt.Errorf("创建 schema_migrations 失败: %w", err)
+	}
+	applied, err := appliedMigrations(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := applyMigration(ctx, db, m); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// applyMigration 在一个事务内执行迁移脚本并记录版本。
+// MySQL 的 DDL 会隐式提交，失败时可能只执行了一部分，需按报错修正后重新执行 db migrate
+func applyMigration(ctx context.Context, db *sql.DB, m Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range splitStatements(m.SQL) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("执行迁移 %04d_%s 失败: %w", m.Version, m.Name, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, name, appliedat) VALUES (?, ?, ?)", m.Version, m.Name, time.Now()); err != nil {
+		return fmt.Errorf("记录迁移 %04d_%s 失败: %w", m.Version, m.Name, err)
+	}
+	return tx.Commit()
+}
+
+// checkLegacySchema 确认手工建的旧库已包含 0001 的全部列（缺少的表由 0001 创建）
+func checkLegacySchema(ctx context.Context, store ContractStore) error {
+	for _, t := range legacyColumns {
+		ok, err := tableExists(ctx, store, t.table)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		rows, err := store.DB().QueryContext(ctx, "SELECT "+t.columns+" FROM "+t.table+" LIMIT 0")
+		if err != nil {
+			hint := "执行 migrations/mysql/0001_init.sql 末尾的升级语句"
+			if store.Backend() == BackendSQLite {
+				hint = "按 migrations/sqlite/0001_init.sql 补齐缺少的列"
+			}
+			return fmt.Errorf("已有的 %s 表缺少新版本的列（%v），请先%s，再执行 db migrate", t.table, err, hint)
+		}
+		rows.Close()
+	}
+	return nil
+}
+
+// appliedMigrations 已执行的迁移版本及执行时间，没有 schema_migrations 表时为空
+func appliedMigrations(ctx context.Context, store ContractStore) (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+	ok, err := tableExists(ctx, store, "schema_migrations")
+	if err != nil || !ok {
+		return applied, err
+	}
+	rows, err := store.DB().QueryContext(ctx, "SELECT version, appliedat FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("读取 schema_migrations 失败: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v int
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		applied[v] = at
+	}
+	return applied, rows.Err()
+}
+
+// isEmptyDatabase 既没有迁移记录也没有合约表的库（新建的 SQLite 文件或空的 MySQL 库）
+func isEmptyDatabase(ctx context.Context, store ContractStore) (bool, error) {
+	for _, table := range []string{"schema_migrations", "contracts"} {
+		ok, err := tableExists(ctx, store, table)
+		if err != nil || ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// tableExists 当前库中是否存在该表
+func tableExists(ctx context.Context, store ContractStore, table string) (bool, error) {
+	query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+	if store.Backend() == BackendSQLite {
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	}
+	var n int
+	if err := store.DB().QueryRowContext(ctx, query, table).Scan(&n); err != nil {
+		return false, fmt.Errorf("查询表 %s 是否存在失败: %w", table, err)
+	}
+	return n > 0, nil
+}
+
+// splitStatements 按分号拆分迁移脚本（跳过 -- 注释，忽略字符串字面量中的分号）
+func splitStatements(script string) []string {
+	var out []string
+	var cur strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			out = append(out, s)
+		}
+		cur.Reset()
+	}
+	var quote byte
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		if quote != 0 {
+			cur.WriteByte(c)
+			switch {
+			case c == '\\' && i+1 < len(script):
+				i++
+				cur.WriteByte(script[i])
+			case c == quote:
+				quote = 0
+			}
+			continue
+		}
+		switch {
+		case c == '-' && i+1 < len(script) && script[i+1] == '-':
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			cur.WriteByte('\n')
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			cur.WriteByte(c)
+		case c == ';':
+			flush()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return out
+}
@@ -0,0 +1,268 @@
+-- 0001 初始表结构（与引入迁移前 sql.txt 的最终版本一致）
+-- 由 excavator db migrate 执行，数据库本身需事先创建：
+-- CREATE DATABASE IF NOT EXISTS solidity_excavator DEFAULT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+-- 创建合约表
+CREATE TABLE IF NOT EXISTS contracts (
+    -- 链名（链注册表中的名字，eth / bsc / arb ...），与地址一起作为主键：不同链上的相同地址是不同合约
+    chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名',
+
+    -- 合约地址
+    address VARCHAR(42) NOT NULL COMMENT '合约地址',
+
+    -- 合约代码（十六进制字符串）
+    contract LONGTEXT NOT NULL COMMENT '合约字节码',
+
+    -- 合约余额（以 wei 为单位，全精度）
+    balance DECIMAL(65,0) DEFAULT 0 COMMENT '合约余额（wei）',
+
+    -- 余额最后刷新时间（-d -refresh-balances）
+    balancetime DATETIME NULL COMMENT '余额刷新时间',
+
+    -- 是否开源（0=未开源, 1=已开源）
+    isopensource TINYINT(1) DEFAULT 0 COMMENT '是否开源',
+
+    -- 创建时间
+    createtime DATETIME NOT NULL COMMENT '合约创建时间',
+
+    -- 创建区块号
+    createblock BIGINT UNSIGNED NOT NULL COMMENT '创建区块号',
+
+    -- 最后一次交互时间（作为交易 To 或发出日志，下载时更新，旧区间用 -d -backfill-activity 回填）
+    txlast DATETIME NOT NULL COMMENT '最后交互时间',
+
+    -- 交互次数（涉及该合约的交易数）
+    txcount BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '交互次数',
+
+    -- 是否已反编译（0=未反编译, 1=已反编译）
+    isdecompiled TINYINT(1) DEFAULT 0 COMMENT '是否已反编译',
+
+    -- 反编译后的伪代码
+    dedcode LONGTEXT COMMENT '反编译伪代码',
+
+    -- 工厂合约地址（由合约内部 CREATE/CREATE2 创建时），顶层创建交易为空
+    factory VARCHAR(42) DEFAULT '' COMMENT '工厂合约地址',
+
+    -- 创建交易哈希
+    creationtx VARCHAR(66) DEFAULT '' COMMENT '创建交易哈希',
+
+    -- runtime 字节码哈希（keccak256，默认去掉 CBOR 元数据尾部），关联 contract_codes
+    code_hash CHAR(66) DEFAULT '' COMMENT 'runtime 字节码哈希',
+
+    -- 部署者：顶层创建为交易发送方，内部创建为工厂合约；nonce 为顶层创建交易的 nonce（内部创建为 NULL）
+    deployer VARCHAR(42) DEFAULT '' COMMENT '部署者地址',
+    nonce BIGINT UNSIGNED NULL COMMENT '创建交易 nonce',
+
+    -- 由 runtime 字节码末尾 CBOR 元数据解析的编译信息（每个地址的尾部可能不同，不放在 contract_codes）
+    -- metahashkind 为 NULL 表示尚未解析（见 -d -decode-metadata），空串表示字节码没有元数据哈希
+    solcversion VARCHAR(64) NULL COMMENT '编译器版本（0.5.9 之前不写入）',
+    metahashkind VARCHAR(8) NULL COMMENT '元数据哈希类型：ipfs / bzzr0 / bzzr1',
+    metahash VARCHAR(100) NULL COMMENT '元数据哈希（ipfs 为 base58 CID，bzzr 为十六进制）',
+    experimental TINYINT(1) NOT NULL DEFAULT 0 COMMENT '是否使用 pragma experimental',
+
+    -- 主键与索引
+    PRIMARY KEY (chain, address),
+    INDEX idx_createblock (chain, createblock),
+    INDEX idx_createtime (createtime),
+    INDEX idx_isopensource (isopensource),
+    INDEX idx_isdecompiled (isdecompiled),
+    INDEX idx_factory (factory),
+    INDEX idx_code_hash (code_hash),
+    INDEX idx_balance (balance),
+    INDEX idx_balancetime (balancetime),
+    INDEX idx_txlast (txlast),
+    INDEX idx_deployer (deployer),
+    INDEX idx_solcversion (solcversion),
+    INDEX idx_metahash (metahash)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='智能合约信息表';
+
+-- 按代码哈希去重的字节码/源码表（相同哈希只存一份，下载时复用验证状态与源码；各链共用，
+-- 已开源的源码对所有链复用，未开源的结论只对 firstchain 成立）
+CREATE TABLE IF NOT EXISTS contract_codes (
+    code_hash CHAR(66) PRIMARY KEY COMMENT 'runtime 字节码哈希',
+    bytecode LONGTEXT NOT NULL COMMENT 'runtime 字节码',
+    source LONGTEXT COMMENT '已验证源码（未开源为 NULL）',
+    isopensource TINYINT(1) DEFAULT 0 COMMENT '是否开源',
+    checked TINYINT(1) DEFAULT 0 COMMENT '验证状态是否已由源码来源确定（0 时会重新查询，见 -d -requeue-unverified）',
+    selectorcount INT UNSIGNED NULL COMMENT '分发器中的函数选择器数量（NULL 为尚未建立索引，见 -d -index-selectors）',
+    firstchain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '首个使用该代码的合约所在链',
+    firstaddress VARCHAR(42) NOT NULL COMMENT '首个使用该代码的合约地址',
+    firstblock BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '首次出现的区块号',
+    createdat DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '记录创建时间',
+
+    INDEX idx_isopensource (isopensource)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='去重合约代码表';
+
+-- 合约创建信息：init code 拆分为创建字节码与构造参数（日志探测发现的合约没有 init code，不记录）
+CREATE TABLE IF NOT EXISTS contract_creations (
+    chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名',
+    address VARCHAR(42) NOT NULL COMMENT '合约地址',
+    initcodehash CHAR(66) NOT NULL COMMENT '创建字节码哈希，关联 contract_initcodes',
+    constructorargs LONGTEXT NULL COMMENT 'ABI 编码的构造参数（十六进制）；NULL 表示未能拆分，此时创建字节码为完整 init code',
+
+    PRIMARY KEY (chain, address),
+    INDEX idx_initcodehash (initcodehash)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='合约创建信息表';
+
+-- 按哈希去重的创建字节码（不含构造参数）
+CREATE TABLE IF NOT EXISTS contract_initcodes (
+    initcodehash CHAR(66) PRIMARY KEY COMMENT '创建字节码哈希',
+    initcode LONGTEXT NOT NULL COMMENT '创建字节码'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='去重创建字节码表';
+
+-- 函数选择器索引：runtime 字节码分发器中的 4 字节选择器（按代码哈希，未开源合约同样有）
+CREATE TABLE IF NOT EXISTS contract_selectors (
+    code_hash CHAR(66) NOT NULL COMMENT 'runtime 字节码哈希',
+    selector CHAR(10) NOT NULL COMMENT '函数选择器（0x 加 8 位十六进制）',
+
+    PRIMARY KEY (code_hash, selector),
+    INDEX idx_selector (selector)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='函数选择器索引表';
+
+-- 函数签名库（4byte 风格，-sel-import 导入），同一选择器可能对应多个碰撞签名
+CREATE TABLE IF NOT EXISTS function_signatures (
+    selector CHAR(10) NOT NULL COMMENT '函数选择器',
+    signature VARCHAR(512) NOT NULL COMMENT '文本签名，如 transfer(address,uint256)',
+
+    PRIMARY KEY (selector, signature)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='函数签名库';
+
+-- 已验证合约的 Etherscan 元数据（按代码哈希去重，address 为首个查询到验证结果的地址）
+CREATE TABLE IF NOT EXISTS contract_metadata (
+    code_hash CHAR(66) PRIMARY KEY COMMENT 'runtime 字节码哈希',
+    address VARCHAR(42) NOT NULL COMMENT '验证结果来源地址',
+    contractname VARCHAR(255) DEFAULT '' COMMENT '主合约名',
+    compilerversion VARCHAR(128) DEFAULT '' COMMENT '编译器版本',
+    optimizationused TINYINT(1) DEFAULT 0 COMMENT '是否开启优化',
+    runs INT UNSIGNED DEFAULT 0 COMMENT '优化 runs',
+    evmversion VARCHAR(32) DEFAULT '' COMMENT 'EVM 版本',
+    license VARCHAR(64) DEFAULT '' COMMENT '许可证',
+    constructorargs LONGTEXT COMMENT '构造参数（十六进制）',
+    abi LONGTEXT COMMENT '合约 ABI（JSON）',
+    library TEXT COMMENT '链接库',
+    proxy TINYINT(1) DEFAULT 0 COMMENT 'Etherscan 标记的代理合约',
+    implementation VARCHAR(42) DEFAULT '' COMMENT 'Etherscan 标记的实现合约',
+    swarmsource VARCHAR(255) DEFAULT '' COMMENT 'Swarm 源码地址',
+    language VARCHAR(16) DEFAULT 'Solidity' COMMENT '源码语言',
+    settings LONGTEXT COMMENT 'Standard JSON 编译设置',
+    provider VARCHAR(32) DEFAULT 'etherscan' COMMENT '源码来源：etherscan / sourcify / sourcify-local / blockscout',
+    matchtype VARCHAR(16) DEFAULT 'verified' COMMENT '匹配程度：full / partial / verified / metadata（按元数据哈希找到）',
+    updatedat DATETIME NOT NULL COMMENT '更新时间',
+
+    INDEX idx_address (address),
+    INDEX idx_contractname (contractname),
+    INDEX idx_compilerversion (compilerversion),
+    INDEX idx_provider (provider)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='合约验证元数据表';
+
+-- 已验证合约的源文件（多文件 / Standard JSON 输入拆分后逐个保存）
+CREATE TABLE IF NOT EXISTS contract_sources (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    code_hash CHAR(66) NOT NULL COMMENT 'runtime 字节码哈希',
+    path VARCHAR(512) NOT NULL COMMENT '源文件路径',
+    content LONGTEXT NOT NULL COMMENT '源文件内容',
+
+    UNIQUE KEY uk_code_path (code_hash, path)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='合约源文件表';
+
+-- 代理合约 -> 实现合约关联（EIP-1167 / EIP-1967 / Transparent / Beacon / EIP-1822 / Etherscan 标记）
+CREATE TABLE IF NOT EXISTS contract_proxies (
+    chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名',
+    address VARCHAR(42) NOT NULL COMMENT '代理合约地址',
+    kind VARCHAR(16) NOT NULL COMMENT '代理类型',
+    implementation VARCHAR(42) NOT NULL COMMENT '实现合约地址',
+    beacon VARCHAR(42) DEFAULT '' COMMENT 'beacon 地址',
+    admin VARCHAR(42) DEFAULT '' COMMENT 'admin 地址',
+    detectedat DATETIME NOT NULL COMMENT '识别时间',
+
+    PRIMARY KEY (chain, address),
+    INDEX idx_implementation (implementation),
+    INDEX idx_kind (kind)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='代理合约关联表';
+
+-- 合约持有的 ERC-20 代币（-d -refresh-tokens），只保存非零持仓
+CREATE TABLE IF NOT EXISTS contract_token_balances (
+    chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名',
+    address VARCHAR(42) NOT NULL COMMENT '合约地址',
+    token VARCHAR(42) NOT NULL COMMENT '代币地址',
+    symbol VARCHAR(32) DEFAULT '' COMMENT '代币符号',
+    balance DECIMAL(65,0) NOT NULL DEFAULT 0 COMMENT '持仓数量（最小单位）',
+    valueusd DOUBLE DEFAULT 0 COMMENT '按配置近似价格换算的美元价值',
+    updatedat DATETIME NOT NULL COMMENT '刷新时间',
+
+    PRIMARY KEY (chain, address, token),
+    INDEX idx_token (token),
+    INDEX idx_valueusd (valueusd)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='合约代币持仓表';
+
+-- 跟随模式（-d -follow）记录的最近区块哈希，用于检测链重组
+CREATE TABLE IF NOT EXISTS block_hashes (
+    chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名',
+    blocknumber BIGINT UNSIGNED NOT NULL COMMENT '区块号',
+    blockhash CHAR(66) NOT NULL COMMENT '区块哈希',
+    parenthash CHAR(66) NOT NULL COMMENT '父区块哈希',
+    createdat DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '记录时间',
+
+    PRIMARY KEY (chain, blocknumber)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='已处理区块哈希';
+
+-- 已计入 txlast / txcount 的区块（保证重试与回填不会重复计数）
+CREATE TABLE IF NOT EXISTS activity_blocks (
+    chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名',
+    blocknumber BIGINT UNSIGNED NOT NULL COMMENT '区块号',
+    touched INT UNSIGNED NOT NULL DEFAULT 0 COMMENT '更新的已存储合约数',
+    appliedat DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '计入时间',
+
+    PRIMARY KEY (chain, blocknumber)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='交互统计区块记录';
+
+-- 已下载的区块区间（每条链一组互不重叠的区间，代替旧版的 blocked.json）
+CREATE TABLE IF NOT EXISTS download_progress (
+    chain VARCHAR(16) NOT NULL COMMENT '链名（eth / bsc / arb）',
+    startblock BIGINT UNSIGNED NOT NULL COMMENT '区间起始区块',
+    endblock BIGINT UNSIGNED NOT NULL COMMENT '区间结束区块（含）',
+    updatedat DATETIME NOT NULL COMMENT '更新时间',
+
+    PRIMARY KEY (chain, startblock),
+    INDEX idx_endblock (chain, endblock)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='下载进度表';
+
+-- 下载失败队列（代替旧版的 eoferror.txt），由 -d -retry-failures 按指数退避重试
+CREATE TABLE IF NOT EXISTS download_failures (
+    chain VARCHAR(16) NOT NULL COMMENT '链名（eth / bsc / arb）',
+    kind VARCHAR(16) NOT NULL COMMENT '类型：block / address',
+    target VARCHAR(66) NOT NULL COMMENT '区块号或合约地址',
+    attempts INT UNSIGNED NOT NULL DEFAULT 1 COMMENT '失败次数',
+    lasterror TEXT COMMENT '最近一次错误',
+    nextretry DATETIME NOT NULL COMMENT '下次重试时间',
+    createdat DATETIME NOT NULL COMMENT '首次失败时间',
+    updatedat DATETIME NOT NULL COMMENT '最近失败时间',
+
+    PRIMARY KEY (chain, kind, target),
+    INDEX idx_nextretry (chain, nextretry)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='下载失败队列';
+
+-- 按旧版 sql.txt 手工建表、缺少后来新增列的库：先执行下面的升级语句（只执行缺少的部分），再执行 excavator db migrate
+-- ALTER TABLE contracts ADD COLUMN factory VARCHAR(42) DEFAULT '' COMMENT '工厂合约地址', ADD COLUMN creationtx VARCHAR(66) DEFAULT '' COMMENT '创建交易哈希', ADD INDEX idx_factory (factory);
+-- ALTER TABLE contracts ADD COLUMN code_hash CHAR(66) DEFAULT '' COMMENT 'runtime 字节码哈希', ADD INDEX idx_code_hash (code_hash);
+-- 旧版 balance 为 6 位小数的 ETH 字符串，先换算为 wei 再改列类型：
+-- UPDATE contracts SET balance = CAST(CAST(balance AS DECIMAL(65,18)) * 1000000000000000000 AS DECIMAL(65,0));
+-- ALTER TABLE contracts MODIFY balance DECIMAL(65,0) DEFAULT 0 COMMENT '合约余额（wei）', ADD COLUMN balancetime DATETIME NULL COMMENT '余额刷新时间', ADD INDEX idx_balance (balance), ADD INDEX idx_balancetime (balancetime);
+
+-- ALTER TABLE contracts ADD COLUMN txcount BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '交互次数' AFTER txlast, ADD INDEX idx_txlast (txlast);
+-- ALTER TABLE contract_codes ADD COLUMN checked TINYINT(1) DEFAULT 0 COMMENT '验证状态是否已由 Etherscan 确定' AFTER isopensource;
+-- UPDATE contract_codes SET checked = 1 WHERE isopensource = 1;
+-- ALTER TABLE contract_metadata ADD COLUMN provider VARCHAR(32) DEFAULT 'etherscan' COMMENT '源码来源' AFTER settings, ADD COLUMN matchtype VARCHAR(16) DEFAULT 'verified' COMMENT '匹配程度' AFTER provider, ADD INDEX idx_provider (provider);
+-- ALTER TABLE contracts ADD COLUMN solcversion VARCHAR(64) NULL COMMENT '编译器版本' AFTER code_hash, ADD COLUMN metahashkind VARCHAR(8) NULL COMMENT '元数据哈希类型' AFTER solcversion, ADD COLUMN metahash VARCHAR(100) NULL COMMENT '元数据哈希' AFTER metahashkind, ADD COLUMN experimental TINYINT(1) NOT NULL DEFAULT 0 COMMENT '是否使用 pragma experimental' AFTER metahash, ADD INDEX idx_solcversion (solcversion), ADD INDEX idx_metahash (metahash);
+-- 之后执行 excavator -d -decode-metadata 为已有合约回填
+-- ALTER TABLE contract_codes ADD COLUMN selectorcount INT UNSIGNED NULL COMMENT '函数选择器数量' AFTER checked;
+-- 之后执行 excavator -d -index-selectors 为已有代码建立选择器索引
+-- ALTER TABLE contracts ADD COLUMN deployer VARCHAR(42) DEFAULT '' COMMENT '部署者地址' AFTER creationtx, ADD COLUMN nonce BIGINT UNSIGNED NULL COMMENT '创建交易 nonce' AFTER deployer, ADD INDEX idx_deployer (deployer);
+-- 多链：已有数据都属于以太坊主网（默认值 eth），按链区分的表把 chain 加入主键
+-- ALTER TABLE contracts ADD COLUMN chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名' FIRST, DROP PRIMARY KEY, ADD PRIMARY KEY (chain, address), DROP INDEX idx_createblock, ADD INDEX idx_createblock (chain, createblock);
+-- ALTER TABLE contract_codes ADD COLUMN firstchain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '首个使用该代码的合约所在链' AFTER selectorcount;
+-- ALTER TABLE contract_creations ADD COLUMN chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名' FIRST, DROP PRIMARY KEY, ADD PRIMARY KEY (chain, address);
+-- ALTER TABLE contract_proxies ADD COLUMN chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名' FIRST, DROP PRIMARY KEY, ADD PRIMARY KEY (chain, address);
+-- ALTER TABLE contract_token_balances ADD COLUMN chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名' FIRST, DROP PRIMARY KEY, ADD PRIMARY KEY (chain, address, token);
+-- ALTER TABLE block_hashes ADD COLUMN chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名' FIRST, DROP PRIMARY KEY, ADD PRIMARY KEY (chain, blocknumber);
+-- ALTER TABLE activity_blocks ADD COLUMN chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名' FIRST, DROP PRIMARY KEY, ADD PRIMARY KEY (chain, blocknumber);
@@ -0,0 +1,5 @@
+-- 0002 记录反编译结果的写入时间，db prune -policy decompiled 按它清理旧的反编译输出
+ALTER TABLE contracts ADD COLUMN decompiledat DATETIME NULL COMMENT '反编译结果写入时间' AFTER dedcode, ADD INDEX idx_decompiledat (decompiledat);
+
+-- 已有的反编译结果没有时间，从升级时开始计算
+UPDATE contracts SET decompiledat = NOW() WHERE dedcode IS NOT NULL AND dedcode <> '';
@@ -0,0 +1,9 @@
+-- 0003 合约标签：入库时按 ABI / 选择器判断的合约类型（erc20、erc721、proxy 等），-t db 按 -t-kind 过滤
+CREATE TABLE IF NOT EXISTS contract_tags (
+    chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名',
+    address VARCHAR(42) NOT NULL COMMENT '合约地址',
+    tag VARCHAR(32) NOT NULL COMMENT '标签',
+
+    PRIMARY KEY (chain, address, tag),
+    INDEX idx_chain_tag (chain, tag)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='合约标签表';
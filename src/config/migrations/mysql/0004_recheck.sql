@@ -0,0 +1,4 @@
+-- 0004 未开源代码的复查进度：-d -recheck 按首个合约创建后 1 天、1 周、1 月的时间表重新查询验证状态
+ALTER TABLE contract_codes
+    ADD COLUMN recheckstage TINYINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '已经过的复查时间点个数' AFTER checked,
+    ADD COLUMN recheckedat DATETIME NULL COMMENT '最近一次复查时间' AFTER recheckstage;
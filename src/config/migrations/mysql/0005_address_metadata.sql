@@ -0,0 +1,20 @@
+-- 0005 按地址区分的验证信息：构造参数与 Etherscan 标记的代理 / 实现属于单个地址，
+-- 从按代码哈希去重的 contract_metadata 中移出，同一份代码的不同地址各自保存
+CREATE TABLE IF NOT EXISTS contract_address_metadata (
+    chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名',
+    address VARCHAR(42) NOT NULL COMMENT '合约地址',
+    constructorargs LONGTEXT COMMENT '验证时提交的构造参数（十六进制）',
+    proxy TINYINT(1) DEFAULT 0 COMMENT 'Etherscan 标记的代理合约',
+    implementation VARCHAR(42) DEFAULT '' COMMENT 'Etherscan 标记的实现合约',
+    updatedat DATETIME NOT NULL COMMENT '更新时间',
+
+    PRIMARY KEY (chain, address),
+    INDEX idx_implementation (implementation)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='按地址区分的合约验证信息';
+
+-- 已有的值属于 contract_metadata.address（同一地址可能在多条链上，按代码哈希一致的合约确定链）
+INSERT IGNORE INTO contract_address_metadata (chain, address, constructorargs, proxy, implementation, updatedat)
+SELECT c.chain, c.address, m.constructorargs, m.proxy, m.implementation, m.updatedat
+FROM contract_metadata m JOIN contracts c ON c.address = m.address AND c.code_hash = m.code_hash;
+
+ALTER TABLE contract_metadata DROP COLUMN constructorargs, DROP COLUMN proxy, DROP COLUMN implementation;
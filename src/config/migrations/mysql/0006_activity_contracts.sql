@@ -0,0 +1,11 @@
+-- 0006 按合约记录每个区块计入的交互：重组回滚时据此从幸存合约的 txcount 中扣除孤块的交互并重算 txlast
+CREATE TABLE IF NOT EXISTS activity_contracts (
+    chain VARCHAR(16) NOT NULL DEFAULT 'eth' COMMENT '链名',
+    blocknumber BIGINT UNSIGNED NOT NULL COMMENT '区块号',
+    address VARCHAR(42) NOT NULL COMMENT '合约地址',
+    txcount INT UNSIGNED NOT NULL DEFAULT 0 COMMENT '该区块中涉及合约的交易数',
+    txtime DATETIME NOT NULL COMMENT '区块时间',
+
+    PRIMARY KEY (chain, blocknumber, address),
+    INDEX idx_address (chain, address)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='按合约的区块交互记录';
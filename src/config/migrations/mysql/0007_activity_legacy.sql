@@ -0,0 +1,9 @@
+-- 0007 标记 0006 之前计入的区块：当时没有按合约记录增量，无法判断哪些合约已经计入，
+-- 强制回填（-backfill-activity-force）时跳过这些区块，避免重复计数
+ALTER TABLE activity_blocks
+    ADD COLUMN legacy TINYINT(1) NOT NULL DEFAULT 0 COMMENT '0006 之前计入、没有按合约记录增量的区块' AFTER touched;
+
+UPDATE activity_blocks SET legacy = 1
+WHERE touched > 0 AND NOT EXISTS (
+    SELECT 1 FROM activity_contracts a WHERE a.chain = activity_blocks.chain AND a.blocknumber = activity_blocks.blocknumber
+);
@@ -0,0 +1,190 @@
+-- 0001 初始表结构（与 migrations/mysql/0001_init.sql 一一对应）
+-- 余额以十进制字符串（TEXT）全精度保存，查询中按 CAST(balance AS DECIMAL(65,0)) 比较（见 store_sqlite.go decimal_key）
+-- 地址列使用 COLLATE NOCASE：与 MySQL 默认排序规则一致，大小写不同的同一地址视为相等
+
+CREATE TABLE IF NOT EXISTS contracts (
+    chain TEXT NOT NULL DEFAULT 'eth',
+    address TEXT COLLATE NOCASE NOT NULL,
+    contract TEXT NOT NULL,
+    balance TEXT DEFAULT '0',
+    balancetime DATETIME NULL,
+    isopensource INTEGER DEFAULT 0,
+    createtime DATETIME NOT NULL,
+    createblock INTEGER NOT NULL,
+    txlast DATETIME NOT NULL,
+    txcount INTEGER NOT NULL DEFAULT 0,
+    isdecompiled INTEGER DEFAULT 0,
+    dedcode TEXT,
+    factory TEXT COLLATE NOCASE DEFAULT '',
+    creationtx TEXT DEFAULT '',
+    code_hash TEXT DEFAULT '',
+    deployer TEXT COLLATE NOCASE DEFAULT '',
+    nonce INTEGER NULL,
+    solcversion TEXT NULL,
+    metahashkind TEXT NULL,
+    metahash TEXT NULL,
+    experimental INTEGER NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (chain, address)
+);
+CREATE INDEX IF NOT EXISTS contracts_createblock ON contracts (chain, createblock);
+CREATE INDEX IF NOT EXISTS contracts_createtime ON contracts (createtime);
+CREATE INDEX IF NOT EXISTS contracts_isopensource ON contracts (isopensource);
+CREATE INDEX IF NOT EXISTS contracts_factory ON contracts (factory);
+CREATE INDEX IF NOT EXISTS contracts_code_hash ON contracts (code_hash);
+CREATE INDEX IF NOT EXISTS contracts_balance ON contracts (balance);
+CREATE INDEX IF NOT EXISTS contracts_balancetime ON contracts (balancetime);
+CREATE INDEX IF NOT EXISTS contracts_txlast ON contracts (txlast);
+CREATE INDEX IF NOT EXISTS contracts_deployer ON contracts (deployer);
+CREATE INDEX IF NOT EXISTS contracts_solcversion ON contracts (solcversion);
+CREATE INDEX IF NOT EXISTS contracts_metahash ON contracts (metahash);
+
+CREATE TABLE IF NOT EXISTS contract_codes (
+    code_hash TEXT PRIMARY KEY,
+    bytecode TEXT NOT NULL,
+    source TEXT,
+    isopensource INTEGER DEFAULT 0,
+    checked INTEGER DEFAULT 0,
+    selectorcount INTEGER NULL,
+    firstchain TEXT NOT NULL DEFAULT 'eth',
+    firstaddress TEXT COLLATE NOCASE NOT NULL,
+    firstblock INTEGER NOT NULL DEFAULT 0,
+    createdat DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS contract_codes_isopensource ON contract_codes (isopensource);
+
+CREATE TABLE IF NOT EXISTS contract_creations (
+    chain TEXT NOT NULL DEFAULT 'eth',
+    address TEXT COLLATE NOCASE NOT NULL,
+    initcodehash TEXT NOT NULL,
+    constructorargs TEXT NULL,
+
+    PRIMARY KEY (chain, address)
+);
+CREATE INDEX IF NOT EXISTS contract_creations_initcodehash ON contract_creations (initcodehash);
+
+CREATE TABLE IF NOT EXISTS contract_initcodes (
+    initcodehash TEXT PRIMARY KEY,
+    initcode TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS contract_selectors (
+    code_hash TEXT NOT NULL,
+    selector TEXT NOT NULL,
+
+    PRIMARY KEY (code_hash, selector)
+);
+CREATE INDEX IF NOT EXISTS contract_selectors_selector ON contract_selectors (selector);
+
+CREATE TABLE IF NOT EXISTS function_signatures (
+    selector TEXT NOT NULL,
+    signature TEXT NOT NULL,
+
+    PRIMARY KEY (selector, signature)
+);
+
+CREATE TABLE IF NOT EXISTS contract_metadata (
+    code_hash TEXT PRIMARY KEY,
+    address TEXT COLLATE NOCASE NOT NULL,
+    contractname TEXT DEFAULT '',
+    compilerversion TEXT DEFAULT '',
+    optimizationused INTEGER DEFAULT 0,
+    runs INTEGER DEFAULT 0,
+    evmversion TEXT DEFAULT '',
+    license TEXT DEFAULT '',
+    constructorargs TEXT,
+    abi TEXT,
+    library TEXT,
+    proxy INTEGER DEFAULT 0,
+    implementation TEXT COLLATE NOCASE DEFAULT '',
+    swarmsource TEXT DEFAULT '',
+    language TEXT DEFAULT 'Solidity',
+    settings TEXT,
+    provider TEXT DEFAULT 'etherscan',
+    matchtype TEXT DEFAULT 'verified',
+    updatedat DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS contract_metadata_address ON contract_metadata (address);
+CREATE INDEX IF NOT EXISTS contract_metadata_contractname ON contract_metadata (contractname);
+CREATE INDEX IF NOT EXISTS contract_metadata_compilerversion ON contract_metadata (compilerversion);
+CREATE INDEX IF NOT EXISTS contract_metadata_provider ON contract_metadata (provider);
+
+CREATE TABLE IF NOT EXISTS contract_sources (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code_hash TEXT NOT NULL,
+    path TEXT NOT NULL,
+    content TEXT NOT NULL,
+
+    UNIQUE (code_hash, path)
+);
+
+CREATE TABLE IF NOT EXISTS contract_proxies (
+    chain TEXT NOT NULL DEFAULT 'eth',
+    address TEXT COLLATE NOCASE NOT NULL,
+    kind TEXT NOT NULL,
+    implementation TEXT COLLATE NOCASE NOT NULL,
+    beacon TEXT COLLATE NOCASE DEFAULT '',
+    admin TEXT COLLATE NOCASE DEFAULT '',
+    detectedat DATETIME NOT NULL,
+
+    PRIMARY KEY (chain, address)
+);
+CREATE INDEX IF NOT EXISTS contract_proxies_implementation ON contract_proxies (implementation);
+CREATE INDEX IF NOT EXISTS contract_proxies_kind ON contract_proxies (kind);
+
+CREATE TABLE IF NOT EXISTS contract_token_balances (
+    chain TEXT NOT NULL DEFAULT 'eth',
+    address TEXT COLLATE NOCASE NOT NULL,
+    token TEXT COLLATE NOCASE NOT NULL,
+    symbol TEXT DEFAULT '',
+    balance TEXT NOT NULL DEFAULT '0',
+    valueusd REAL DEFAULT 0,
+    updatedat DATETIME NOT NULL,
+
+    PRIMARY KEY (chain, address, token)
+);
+CREATE INDEX IF NOT EXISTS contract_token_balances_token ON contract_token_balances (token);
+CREATE INDEX IF NOT EXISTS contract_token_balances_valueusd ON contract_token_balances (valueusd);
+
+CREATE TABLE IF NOT EXISTS block_hashes (
+    chain TEXT NOT NULL DEFAULT 'eth',
+    blocknumber INTEGER NOT NULL,
+    blockhash TEXT NOT NULL,
+    parenthash TEXT NOT NULL,
+    createdat DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (chain, blocknumber)
+);
+
+CREATE TABLE IF NOT EXISTS activity_blocks (
+    chain TEXT NOT NULL DEFAULT 'eth',
+    blocknumber INTEGER NOT NULL,
+    touched INTEGER NOT NULL DEFAULT 0,
+    appliedat DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (chain, blocknumber)
+);
+
+CREATE TABLE IF NOT EXISTS download_progress (
+    chain TEXT NOT NULL,
+    startblock INTEGER NOT NULL,
+    endblock INTEGER NOT NULL,
+    updatedat DATETIME NOT NULL,
+
+    PRIMARY KEY (chain, startblock)
+);
+CREATE INDEX IF NOT EXISTS download_progress_endblock ON download_progress (chain, endblock);
+
+CREATE TABLE IF NOT EXISTS download_failures (
+    chain TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    target TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    lasterror TEXT,
+    nextretry DATETIME NOT NULL,
+    createdat DATETIME NOT NULL,
+    updatedat DATETIME NOT NULL,
+
+    PRIMARY KEY (chain, kind, target)
+);
+CREATE INDEX IF NOT EXISTS download_failures_nextretry ON download_failures (chain, nextretry);
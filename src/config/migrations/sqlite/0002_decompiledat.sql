@@ -0,0 +1,6 @@
+-- 0002 记录反编译结果的写入时间（与 migrations/mysql/0002_decompiledat.sql 对应）
+ALTER TABLE contracts ADD COLUMN decompiledat DATETIME NULL;
+CREATE INDEX IF NOT EXISTS contracts_decompiledat ON contracts (decompiledat);
+
+-- 已有的反编译结果没有时间，从升级时开始计算
+UPDATE contracts SET decompiledat = datetime('now', 'localtime') WHERE dedcode IS NOT NULL AND dedcode <> '';
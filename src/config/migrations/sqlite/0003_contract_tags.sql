@@ -0,0 +1,9 @@
+-- 0003 合约标签（与 migrations/mysql/0003_contract_tags.sql 对应）
+CREATE TABLE IF NOT EXISTS contract_tags (
+    chain TEXT NOT NULL DEFAULT 'eth',
+    address TEXT COLLATE NOCASE NOT NULL,
+    tag TEXT NOT NULL,
+
+    PRIMARY KEY (chain, address, tag)
+);
+CREATE INDEX IF NOT EXISTS contract_tags_chain_tag ON contract_tags (chain, tag);
@@ -0,0 +1,3 @@
+-- 0004 未开源代码的复查进度（与 migrations/mysql/0004_recheck.sql 对应）
+ALTER TABLE contract_codes ADD COLUMN recheckstage INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE contract_codes ADD COLUMN recheckedat DATETIME NULL;
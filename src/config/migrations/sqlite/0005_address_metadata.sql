@@ -0,0 +1,20 @@
+-- 0005 按地址区分的验证信息（与 migrations/mysql/0005_address_metadata.sql 对应）
+CREATE TABLE IF NOT EXISTS contract_address_metadata (
+    chain TEXT NOT NULL DEFAULT 'eth',
+    address TEXT COLLATE NOCASE NOT NULL,
+    constructorargs TEXT,
+    proxy INTEGER DEFAULT 0,
+    implementation TEXT COLLATE NOCASE DEFAULT '',
+    updatedat DATETIME NOT NULL,
+
+    PRIMARY KEY (chain, address)
+);
+CREATE INDEX IF NOT EXISTS contract_address_metadata_implementation ON contract_address_metadata (implementation);
+
+INSERT OR IGNORE INTO contract_address_metadata (chain, address, constructorargs, proxy, implementation, updatedat)
+SELECT c.chain, c.address, m.constructorargs, m.proxy, m.implementation, m.updatedat
+FROM contract_metadata m JOIN contracts c ON c.address = m.address AND c.code_hash = m.code_hash;
+
+ALTER TABLE contract_metadata DROP COLUMN constructorargs;
+ALTER TABLE contract_metadata DROP COLUMN proxy;
+ALTER TABLE contract_metadata DROP COLUMN implementation;
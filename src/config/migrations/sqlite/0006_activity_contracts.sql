@@ -0,0 +1,11 @@
+-- 0006 按合约记录每个区块计入的交互（与 migrations/mysql/0006_activity_contracts.sql 对应）
+CREATE TABLE IF NOT EXISTS activity_contracts (
+    chain TEXT NOT NULL DEFAULT 'eth',
+    blocknumber INTEGER NOT NULL,
+    address TEXT COLLATE NOCASE NOT NULL,
+    txcount INTEGER NOT NULL DEFAULT 0,
+    txtime DATETIME NOT NULL,
+
+    PRIMARY KEY (chain, blocknumber, address)
+);
+CREATE INDEX IF NOT EXISTS activity_contracts_address ON activity_contracts (chain, address);
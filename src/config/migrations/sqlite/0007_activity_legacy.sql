@@ -0,0 +1,7 @@
+-- 0007 标记 0006 之前计入的区块（与 migrations/mysql/0007_activity_legacy.sql 对应）
+ALTER TABLE activity_blocks ADD COLUMN legacy INTEGER NOT NULL DEFAULT 0;
+
+UPDATE activity_blocks SET legacy = 1
+WHERE touched > 0 AND NOT EXISTS (
+    SELECT 1 FROM activity_contracts a WHERE a.chain = activity_blocks.chain AND a.blocknumber = activity_blocks.blocknumber
+);
@@ -1,4 +1,39 @@
 package config
 
-//这里可以做轮询,然后不同链
-//eth  bsc  优先
+import (
+	"fmt"
+	"net/url"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RPCEndpoint 链的一个 RPC 节点。settings.yaml 中既可以直接写 URL 字符串，
+// 也可以写成 {url, weight, rate, timeout}，下载器按权重轮询并按健康状况剔除/恢复
+type RPCEndpoint struct {
+	URL     string  `yaml:"url"`
+	Weight  int     `yaml:"weight"`  // 加权轮询的权重，默认 1
+	Rate    int     `yaml:"rate"`    // 该节点每秒请求数，0 为 -rpc-rate 的值
+	Timeout float64 `yaml:"timeout"` // 单次请求超时（秒），超时换下一个节点；0 为默认 60 秒
+}
+
+// UnmarshalYAML 兼容纯字符串写法
+func (e *RPCEndpoint) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		e.URL = value.Value
+		return nil
+	}
+	type plain RPCEndpoint
+	if err := value.Decode((*plain)(e)); err != nil {
+		return fmt.Errorf("解析 RPC 节点配置失败: %w", err)
+	}
+	return nil
+}
+
+// Name 日志中使用的节点名：只保留协议与主机，URL 路径里常带有 API key
+func (e RPCEndpoint) Name() string {
+	u, err := url.Parse(e.URL)
+	if err != nil || u.Host == "" {
+		return "rpc"
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlStore MySQL 后端（表结构见 migrations/mysql）
+type mysqlStore struct {
+	sqlStore
+}
+
+// defaultMySQLDSN 未配置 database.dsn 时使用的本地 MySQL
+func defaultMySQLDSN() string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", DBUser, DBPassword, DBHost, DBPort, DBName)
+}
+
+// openMySQLStore 连接 MySQL 并 ping 验证；DSN 为 go-sql-driver 格式，
+// 未指定时补上 parseTime=true 与 charset=utf8mb4
+func openMySQLStore(dsn string) (*mysqlStore, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("解析 MySQL DSN 失败: %w", err)
+	}
+	cfg.ParseTime = true
+	if cfg.Params == nil {
+		cfg.Params = make(map[string]string)
+	}
+	if _, ok := cfg.Params["charset"]; !ok {
+		cfg.Params["charset"] = "utf8mb4"
+	}
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("打开 MySQL 失败: %w", err)
+	}
+
+	// 设置连接池参数
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	// 验证连接
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("连接 MySQL %s@%s 失败: %w", cfg.User, cfg.Addr, err)
+	}
+	return &mysqlStore{sqlStore{db: db, backend: BackendMySQL}}, nil
+}
+
+// compactTables db prune 可能删除或清空大字段的表
+var compactTables = []string{
+	"contracts", "contract_codes", "contract_selectors", "contract_metadata", "contract_sources",
+	"contract_creations", "contract_proxies", "contract_token_balances", "contract_tags", "contract_address_metadata",
+	"activity_contracts",
+}
+
+// Compact 重建表以回收 InnoDB 中删除数据占用的空间（大表耗时较长）
+func (s *mysqlStore) Compact(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, "OPTIMIZE TABLE "+strings.Join(compactTables, ", "))
+	if err != nil {
+		return fmt.Errorf("OPTIMIZE TABLE 失败: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
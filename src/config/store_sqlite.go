@@ -0,0 +1,333 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteDriverName 翻译 MySQL 方言的 SQLite 驱动
+const sqliteDriverName = "excavator-sqlite"
+
+// sqliteDSNParams 打开 SQLite 时的默认参数：WAL 允许读写并发，写事务开始即加锁并等待，避免升级锁时的 SQLITE_BUSY
+const sqliteDSNParams = "_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate&_time_format=sqlite"
+
+func init() {
+	// MySQL 的 SUBSTRING_INDEX（编译器版本比较用到），SQLite 没有内置
+	sqlite.MustRegisterDeterministicScalarFunction("substring_index", 3, substringIndex)
+	// CAST(x AS DECIMAL(65,0)) 的替代：余额按 TEXT 全精度保存，比较时转为等长的补零字符串
+	sqlite.MustRegisterDeterministicScalarFunction("decimal_key", 1, decimalKey)
+
+	db, err := sql.Open("sqlite", "")
+	if err != nil {
+		panic(err)
+	}
+	base := db.Driver()
+	db.Close()
+	sql.Register(sqliteDriverName, &sqliteDriver{base: base})
+}
+
+// sqliteStore SQLite 后端（纯 Go，单文件数据库，适合单机与离线使用）
+type sqliteStore struct {
+	sqlStore
+	path string
+}
+
+// openSQLiteStore 打开（不存在则创建）SQLite 数据库，表结构由迁移创建（见 migrate.go）
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("SQLite 数据库路径为空")
+	}
+	dsn := path
+	if !strings.HasPrefix(path, "file:") {
+		if dir := filepath.Dir(path); dir != "" {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return nil, fmt.Errorf("创建数据库目录失败: %w", err)
+			}
+		}
+		dsn = "file:" + path
+	}
+	if strings.Contains(dsn, "?") {
+		dsn += "&" + sqliteDSNParams
+	} else {
+		dsn += "?" + sqliteDSNParams
+	}
+
+	db, err := sql.Open(sqliteDriverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("打开 SQLite 失败: %w", err)
+	}
+	db.SetMaxOpenConns(8)
+	db.SetMaxIdleConns(8)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("打开 SQLite %s 失败: %w", path, err)
+	}
+	return &sqliteStore{sqlStore: sqlStore{db: db, backend: BackendSQLite}, path: path}, nil
+}
+
+// Compact VACUUM 重写数据库文件以回收空闲页，并截断 WAL
+func (s *sqliteStore) Compact(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, "VACUUM"); err != nil {
+		return fmt.Errorf("VACUUM 失败: %w", err)
+	}
+	_, err := s.db.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)")
+	return err
+}
+
+// Close 合并 WAL 后关闭
+func (s *sqliteStore) Close() error {
+	s.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	return s.db.Close()
+}
+
+// MySQL 方言 -> SQLite 的改写规则（只覆盖本项目用到的写法）
+var (
+	reInsertIgnore = regexp.MustCompile(`(?i)\bINSERT\s+IGNORE\s+INTO\b`)
+	reOnDuplicate  = regexp.MustCompile(`(?i)\bON\s+DUPLICATE\s+KEY\s+UPDATE\b`)
+	reValuesColumn = regexp.MustCompile(`(?i)\bVALUES\((\w+)\)`)
+	reNow          = regexp.MustCompile(`(?i)\bNOW\(\)`)
+	reGreatest     = regexp.MustCompile(`(?i)\bGREATEST\(`)
+	reLeast        = regexp.MustCompile(`(?i)\bLEAST\(`)
+	reIf           = regexp.MustCompile(`(?i)\bIF\(`)
+	reForUpdate    = regexp.MustCompile(`(?i)\s+FOR\s+UPDATE\b`)
+	reCastUnsigned = regexp.MustCompile(`(?i)\bAS\s+UNSIGNED\)`)
+	reCastChar     = regexp.MustCompile(`(?i)\bAS\s+CHAR\)`)
+	reDateAdd      = regexp.MustCompile(`(?i)\bDATE_ADD\(`)
+	reCast         = regexp.MustCompile(`(?i)\bCAST\(`)
+	reAsDecimal    = regexp.MustCompile(`(?is)^(.+)\s+AS\s+DECIMAL\(\s*65\s*,\s*0\s*\)\s*$`)
+	reInterval     = regexp.MustCompile(`(?is)^\s*INTERVAL\s+(.+)\s+(SECOND|MINUTE|HOUR|DAY)\s*$`)
+)
+
+// translateMySQL 把按 MySQL 方言书写的语句改写为 SQLite 语法：
+// INSERT IGNORE、ON DUPLICATE KEY UPDATE / VALUES(col)、NOW()、DATE_ADD、GREATEST/LEAST、IF、FOR UPDATE、CAST 类型。
+// 余额比较写作 CAST(x AS DECIMAL(65,0))，改写为 decimal_key(x)，两侧都需转换
+func translateMySQL(query string) string {
+	query = reInsertIgnore.ReplaceAllString(query, "INSERT OR IGNORE INTO")
+	query = reOnDuplicate.ReplaceAllString(query, "ON CONFLICT DO UPDATE SET")
+	query = reValuesColumn.ReplaceAllString(query, "excluded.$1")
+	query = reNow.ReplaceAllString(query, "datetime('now', 'localtime')")
+	query = rewriteDateAdd(query)
+	query = reGreatest.ReplaceAllString(query, "MAX(")
+	query = reLeast.ReplaceAllString(query, "MIN(")
+	query = reIf.ReplaceAllString(query, "IIF(")
+	query = reForUpdate.ReplaceAllString(query, "")
+	query = reCastUnsigned.ReplaceAllString(query, "AS INTEGER)")
+	query = reCastChar.ReplaceAllString(query, "AS TEXT)")
+	query = rewriteCastDecimal(query)
+	return query
+}
+
+// rewriteCastDecimal CAST(x AS DECIMAL(65,0)) -> decimal_key(x)（x 可以嵌套括号），其他 CAST 保持不变
+func rewriteCastDecimal(query string) string {
+	from := 0
+	for {
+		loc := reCast.FindStringIndex(query[from:])
+		if loc == nil {
+			return query
+		}
+		start, open := from+loc[0], from+loc[1]-1
+		end := matchParen(query, open)
+		if end < 0 {
+			return query
+		}
+		m := reAsDecimal.FindStringSubmatch(query[open+1 : end])
+		if m == nil {
+			from = open + 1
+			continue
+		}
+		expr := "decimal_key(" + strings.TrimSpace(m[1]) + ")"
+		query = query[:start] + expr + query[end+1:]
+		from = start + len("decimal_key(")
+	}
+}
+
+// rewriteDateAdd DATE_ADD(t, INTERVAL n UNIT) -> datetime(t, n || ' units')（参数可以嵌套括号）
+func rewriteDateAdd(query string) string {
+	for {
+		loc := reDateAdd.FindStringIndex(query)
+		if loc == nil {
+			return query
+		}
+		open := loc[1] - 1
+		end := matchParen(query, open)
+		if end < 0 {
+			return query
+		}
+		inner := query[open+1 : end]
+		comma := topLevelComma(inner)
+		if comma < 0 {
+			return query
+		}
+		m := reInterval.FindStringSubmatch(inner[comma+1:])
+		if m == nil {
+			return query
+		}
+		expr := fmt.Sprintf("datetime(%s, (%s) || ' %ss')", strings.TrimSpace(inner[:comma]), m[1], strings.ToLower(m[2]))
+		query = query[:loc[0]] + expr + query[end+1:]
+	}
+}
+
+// matchParen 返回与 open 处左括号匹配的右括号位置（不考虑字符串字面量中的括号）
+func matchParen(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// topLevelComma 返回不在括号内的第一个逗号位置
+func topLevelComma(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// substringIndex MySQL SUBSTRING_INDEX(str, delim, count)
+func substringIndex(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	if args[0] == nil || args[1] == nil || args[2] == nil {
+		return nil, nil
+	}
+	str := fmt.Sprint(args[0])
+	if b, ok := args[0].([]byte); ok {
+		str = string(b)
+	}
+	delim := fmt.Sprint(args[1])
+	count, ok := args[2].(int64)
+	if !ok {
+		return nil, fmt.Errorf("substring_index: count 必须为整数")
+	}
+	if delim == "" || count == 0 {
+		return "", nil
+	}
+	parts := strings.Split(str, delim)
+	if count > 0 {
+		if int(count) >= len(parts) {
+			return str, nil
+		}
+		return strings.Join(parts[:count], delim), nil
+	}
+	if int(-count) >= len(parts) {
+		return str, nil
+	}
+	return strings.Join(parts[len(parts)+int(count):], delim), nil
+}
+
+// decimalKeyWidth uint256 的最大十进制位数
+const decimalKeyWidth = 78
+
+// decimalKey 把非负整数（TEXT、INTEGER，或旧库 NUMERIC 列中的 REAL）转为 78 位补零字符串，按字符串比较即按数值比较；
+// 无法解析或为负数时按 0 处理
+func decimalKey(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	n := new(big.Int)
+	switch v := args[0].(type) {
+	case nil:
+		return nil, nil
+	case int64:
+		n.SetInt64(v)
+	case float64:
+		big.NewFloat(v).Int(n)
+	default:
+		str := fmt.Sprint(v)
+		if b, ok := v.([]byte); ok {
+			str = string(b)
+		}
+		str = strings.TrimSpace(str)
+		if _, ok := n.SetString(str, 10); !ok {
+			if f, _, err := big.ParseFloat(str, 10, 256, big.ToZero); err == nil {
+				f.Int(n)
+			} else {
+				n.SetInt64(0)
+			}
+		}
+	}
+	if n.Sign() < 0 {
+		n.SetInt64(0)
+	}
+	return fmt.Sprintf("%0*s", decimalKeyWidth, n.String()), nil
+}
+
+// sqliteDriver 包装 modernc.org/sqlite 驱动，执行前翻译 MySQL 方言
+type sqliteDriver struct {
+	base driver.Driver
+}
+
+// sqliteBaseConn modernc.org/sqlite 连接实现的接口
+type sqliteBaseConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+// Open 实现 driver.Driver
+func (d *sqliteDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.base.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	bc, ok := c.(sqliteBaseConn)
+	if !ok {
+		c.Close()
+		return nil, fmt.Errorf("SQLite 驱动连接类型不受支持: %T", c)
+	}
+	return sqliteConn{bc}, nil
+}
+
+// sqliteConn 翻译语句后转交底层连接
+type sqliteConn struct {
+	sqliteBaseConn
+}
+
+func (c sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.sqliteBaseConn.Prepare(translateMySQL(query))
+}
+
+func (c sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.sqliteBaseConn.PrepareContext(ctx, translateMySQL(query))
+}
+
+func (c sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.sqliteBaseConn.ExecContext(ctx, translateMySQL(query), args)
+}
+
+func (c sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.sqliteBaseConn.QueryContext(ctx, translateMySQL(query), args)
+}
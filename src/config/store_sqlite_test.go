@@ -0,0 +1,173 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// translateCases 取自 internal/download 中实际执行的语句，覆盖 translateMySQL 的每条改写规则
+var translateCases = []struct {
+	name string
+	in   string
+	want string
+}{
+	{
+		name: "insert ignore (activity.go)",
+		in:   "INSERT IGNORE INTO activity_blocks (chain, blocknumber, touched) VALUES (?, ?, 0)",
+		want: "INSERT OR IGNORE INTO activity_blocks (chain, blocknumber, touched) VALUES (?, ?, 0)",
+	},
+	{
+		name: "on duplicate key update with values(col) (follow.go saveBlockHash)",
+		in: `
+	INSERT INTO block_hashes (chain, blocknumber, blockhash, parenthash)
+	VALUES (?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE blockhash = VALUES(blockhash), parenthash = VALUES(parenthash)
+	`,
+		want: `
+	INSERT INTO block_hashes (chain, blocknumber, blockhash, parenthash)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT DO UPDATE SET blockhash = excluded.blockhash, parenthash = excluded.parenthash
+	`,
+	},
+	{
+		name: "now, date_add with nested least (failures.go recordFailure)",
+		in: `
+	INSERT INTO download_failures (chain, kind, target, attempts, lasterror, nextretry, createdat, updatedat)
+	VALUES (?, ?, ?, 1, ?, DATE_ADD(NOW(), INTERVAL ? SECOND), NOW(), NOW())
+	ON DUPLICATE KEY UPDATE
+		nextretry = DATE_ADD(NOW(), INTERVAL FLOOR(LEAST(? * POW(2, attempts), ?)) SECOND),
+		attempts = attempts + 1,
+		lasterror = VALUES(lasterror),
+		updatedat = VALUES(updatedat)
+	`,
+		want: `
+	INSERT INTO download_failures (chain, kind, target, attempts, lasterror, nextretry, createdat, updatedat)
+	VALUES (?, ?, ?, 1, ?, datetime(datetime('now', 'localtime'), (?) || ' seconds'), datetime('now', 'localtime'), datetime('now', 'localtime'))
+	ON CONFLICT DO UPDATE SET
+		nextretry = datetime(datetime('now', 'localtime'), (FLOOR(MIN(? * POW(2, attempts), ?))) || ' seconds'),
+		attempts = attempts + 1,
+		lasterror = excluded.lasterror,
+		updatedat = excluded.updatedat
+	`,
+	},
+	{
+		name: "greatest (activity.go applyActivity)",
+		in:   "UPDATE contracts SET txlast = GREATEST(txlast, ?), txcount = txcount + ? WHERE chain = ? AND address = ?",
+		want: "UPDATE contracts SET txlast = MAX(txlast, ?), txcount = txcount + ? WHERE chain = ? AND address = ?",
+	},
+	{
+		name: "if, greatest and values(col) (codehash.go saveCode)",
+		in: `
+	INSERT INTO contract_codes (code_hash, bytecode, source, isopensource, checked, firstchain, firstaddress, firstblock)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		source = IF(VALUES(isopensource) = 1 AND isopensource = 0, VALUES(source), source),
+		isopensource = GREATEST(isopensource, VALUES(isopensource)),
+		checked = GREATEST(checked, VALUES(checked))
+	`,
+		want: `
+	INSERT INTO contract_codes (code_hash, bytecode, source, isopensource, checked, firstchain, firstaddress, firstblock)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT DO UPDATE SET
+		source = IIF(excluded.isopensource = 1 AND isopensource = 0, excluded.source, source),
+		isopensource = MAX(isopensource, excluded.isopensource),
+		checked = MAX(checked, excluded.checked)
+	`,
+	},
+	{
+		name: "if nested in coalesce(nullif()) (kinds.go classifyStored)",
+		in: `
+	SELECT c.address, COALESCE(c.code_hash, ''), COALESCE(NULLIF(IF(c.isopensource = 0, c.contract, ''), ''), cc.bytecode, ''), COALESCE(m.abi, '')
+	FROM contracts c
+	LEFT JOIN contract_codes cc ON cc.code_hash = c.code_hash AND c.code_hash <> ''
+	LEFT JOIN contract_metadata m ON m.code_hash = c.code_hash AND c.code_hash <> ''
+	WHERE c.chain = ? AND c.address > ? ORDER BY c.address LIMIT 500`,
+		want: `
+	SELECT c.address, COALESCE(c.code_hash, ''), COALESCE(NULLIF(IIF(c.isopensource = 0, c.contract, ''), ''), cc.bytecode, ''), COALESCE(m.abi, '')
+	FROM contracts c
+	LEFT JOIN contract_codes cc ON cc.code_hash = c.code_hash AND c.code_hash <> ''
+	LEFT JOIN contract_metadata m ON m.code_hash = c.code_hash AND c.code_hash <> ''
+	WHERE c.chain = ? AND c.address > ? ORDER BY c.address LIMIT 500`,
+	},
+	{
+		name: "for update (progress.go saveProgressRange)",
+		in: `
+	SELECT startblock, endblock FROM download_progress
+	WHERE chain = ? AND startblock <= ? AND endblock >= ?
+	FOR UPDATE`,
+		want: `
+	SELECT startblock, endblock FROM download_progress
+	WHERE chain = ? AND startblock <= ? AND endblock >= ?`,
+	},
+	{
+		name: "cast as unsigned (solcmeta.go SolcVersionSQL)",
+		in:   "SELECT address FROM contracts WHERE (CAST(SUBSTRING_INDEX(solcversion, '.', 1) AS UNSIGNED) * 1000000 + CAST(SUBSTRING_INDEX(solcversion, '.', -1) AS UNSIGNED)) >= ?",
+		want: "SELECT address FROM contracts WHERE (CAST(SUBSTRING_INDEX(solcversion, '.', 1) AS INTEGER) * 1000000 + CAST(SUBSTRING_INDEX(solcversion, '.', -1) AS INTEGER)) >= ?",
+	},
+	{
+		name: "cast as char (archive.go token balances)",
+		in:   "SELECT address, token, COALESCE(symbol, ''), CAST(balance AS CHAR), COALESCE(valueusd, 0), updatedat FROM contract_token_balances WHERE chain = ?",
+		want: "SELECT address, token, COALESCE(symbol, ''), CAST(balance AS TEXT), COALESCE(valueusd, 0), updatedat FROM contract_token_balances WHERE chain = ?",
+	},
+	{
+		name: "cast as decimal with nested parens (prune.go PruneDupCode)",
+		in:   "SELECT address FROM contracts WHERE CAST(COALESCE(balance, 0) AS DECIMAL(65,0)) = CAST(0 AS DECIMAL(65,0))",
+		want: "SELECT address FROM contracts WHERE decimal_key(COALESCE(balance, 0)) = decimal_key(0)",
+	},
+	{
+		name: "cast as decimal inside exists (recheck.go)",
+		in:   "SELECT code_hash FROM contract_codes cc WHERE EXISTS (SELECT 1 FROM contracts b WHERE b.chain = ? AND b.code_hash = cc.code_hash AND CAST(b.balance AS DECIMAL(65,0)) >= CAST(? AS DECIMAL(65,0)))",
+		want: "SELECT code_hash FROM contract_codes cc WHERE EXISTS (SELECT 1 FROM contracts b WHERE b.chain = ? AND b.code_hash = cc.code_hash AND decimal_key(b.balance) >= decimal_key(?))",
+	},
+	{
+		name: "least around correlated subquery (follow.go rollbackActivity)",
+		in: `
+	UPDATE contracts SET
+		txcount = txcount - LEAST(txcount, COALESCE((SELECT SUM(a.txcount) FROM activity_contracts a
+			WHERE a.chain = contracts.chain AND a.address = contracts.address AND a.blocknumber >= ?), 0))
+	WHERE chain = ?`,
+		want: `
+	UPDATE contracts SET
+		txcount = txcount - MIN(txcount, COALESCE((SELECT SUM(a.txcount) FROM activity_contracts a
+			WHERE a.chain = contracts.chain AND a.address = contracts.address AND a.blocknumber >= ?), 0))
+	WHERE chain = ?`,
+	},
+	{
+		name: "plain statement unchanged",
+		in:   "SELECT code_hash FROM contracts WHERE chain = ? AND address = ?",
+		want: "SELECT code_hash FROM contracts WHERE chain = ? AND address = ?",
+	},
+}
+
+func TestTranslateMySQL(t *testing.T) {
+	for _, tc := range translateCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := translateMySQL(tc.in); got != tc.want {
+				t.Errorf("translateMySQL:\n got: %s\nwant: %s", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestTranslateMySQLPrepares 改写后的语句在迁移到最新版本的 SQLite 库上能通过语法与表结构检查
+func TestTranslateMySQLPrepares(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenStore("sqlite:" + filepath.Join(t.TempDir(), "translate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := CheckSchema(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range translateCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := store.DB().PrepareContext(ctx, tc.in)
+			if err != nil {
+				t.Fatalf("prepare %s: %v", translateMySQL(tc.in), err)
+			}
+			stmt.Close()
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import "strings"
+
+// TokenConfig 需要统计持仓的 ERC-20 代币
+type TokenConfig struct {
+	Symbol   string  `yaml:"symbol"`
+	Address  string  `yaml:"address"`
+	Decimals int     `yaml:"decimals"`
+	PriceUSD float64 `yaml:"price_usd"` // 近似美元价格，用于汇总持仓价值
+}
+
+// ChainTokens 某条链的代币列表与原生币价格
+type ChainTokens struct {
+	NativePriceUSD float64       `yaml:"native_price_usd"`
+	List           []TokenConfig `yaml:"list"`
+}
+
+// defaultTokens 未在 settings.yaml 中配置时使用的默认代币列表（价格为近似值，建议在配置中覆盖）
+var defaultTokens = map[string]ChainTokens{
+	"eth": {
+		NativePriceUSD: 3000,
+		List: []TokenConfig{
+			{Symbol: "WETH", Address: "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2", Decimals: 18, PriceUSD: 3000},
+			{Symbol: "USDT", Address: "0xdAC17F958D2ee523a2206206994597C13D831ec7", Decimals: 6, PriceUSD: 1},
+			{Symbol: "USDC", Address: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", Decimals: 6, PriceUSD: 1},
+			{Symbol: "DAI", Address: "0x6B175474E89094C44Da98b954EedeAC495271d0F", Decimals: 18, PriceUSD: 1},
+		},
+	},
+	"bsc": {
+		NativePriceUSD: 600,
+		List: []TokenConfig{
+			{Symbol: "WBNB", Address: "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c", Decimals: 18, PriceUSD: 600},
+			{Symbol: "USDT", Address: "0x55d398326f99059fF775485246999027B3197955", Decimals: 18, PriceUSD: 1},
+			{Symbol: "USDC", Address: "0x8AC76a51cc950d9822D68b83fE1Ad97B32Cd580d", Decimals: 18, PriceUSD: 1},
+			{Symbol: "BUSD", Address: "0xe9e7CEA3DedcA5984780Bafc599bD69ADd087D56", Decimals: 18, PriceUSD: 1},
+		},
+	},
+	"arb": {
+		NativePriceUSD: 3000,
+		List: []TokenConfig{
+			{Symbol: "WETH", Address: "0x82aF49447D8a07e3bd95BD0d56f35241523fBab1", Decimals: 18, PriceUSD: 3000},
+			{Symbol: "USDT", Address: "0xFd086bC7CD5C481DCC9C85ebE478A1C0b69FCbb9", Decimals: 6, PriceUSD: 1},
+			{Symbol: "USDC", Address: "0xaf88d065e77c8cC2239327C5EDb3A432268e5831", Decimals: 6, PriceUSD: 1},
+		},
+	},
+}
+
+// GetChainTokens 获取指定链的代币列表：优先 settings.yaml 的 tokens.<chain>，否则使用内置默认值
+func GetChainTokens(chain string) ChainTokens {
+	chain = strings.ToLower(strings.TrimSpace(chain))
+	if chain == "" {
+		chain = "eth"
+	}
+
+	if globalSettings == nil {
+		LoadSettings("")
+	}
+
+	out := defaultTokens[chain]
+	if globalSettings != nil {
+		if ct, ok := globalSettings.Tokens[chain]; ok {
+			if len(ct.List) > 0 {
+				out.List = ct.List
+			}
+			if ct.NativePriceUSD > 0 {
+				out.NativePriceUSD = ct.NativePriceUSD
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,273 @@
+package download
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// blockActivity 单个区块内已存储合约的交互情况
+type blockActivity struct {
+	time   time.Time
+	counts map[common.Address]int // 地址 -> 涉及该地址的交易数（作为 To 或发出日志）
+}
+
+// collectActivity 统计区块内每个地址参与的交易数：交易的 To 地址与发出日志的地址都算一次交互，
+// 同一交易内多次出现只计一次
+func (d *Downloader) collectActivity(ctx context.Context, block *types.Block) (*blockActivity, error) {
+	act := &blockActivity{
+		time:   time.Unix(int64(block.Time()), 0),
+		counts: make(map[common.Address]int),
+	}
+	if len(block.Transactions()) == 0 {
+		return act, nil
+	}
+
+	touched := make(map[common.Hash]map[common.Address]bool, len(block.Transactions()))
+	add := func(tx common.Hash, addr common.Address) {
+		m, ok := touched[tx]
+		if !ok {
+			m = make(map[common.Address]bool)
+			touched[tx] = m
+		}
+		m[addr] = true
+	}
+	for _, tx := range block.Transactions() {
+		if tx.To() != nil {
+			add(tx.Hash(), *tx.To())
+		}
+	}
+
+	hash := block.Hash()
+	logs, err := d.Client.FilterLogs(ctx, ethereum.FilterQuery{BlockHash: &hash})
+	if err != nil {
+		return nil, fmt.Errorf("获取区块日志失败: %w", err)
+	}
+	for _, l := range logs {
+		add(l.TxHash, l.Address)
+	}
+
+	for _, addrs := range touched {
+		for a := range addrs {
+			act.counts[a]++
+		}
+	}
+	return act, nil
+}
+
+// activityApplied 判断区块的交互统计是否已经计入
+func (d *Downloader) activityApplied(ctx context.Context, blockNum uint64) (bool, error) {
+	applied, _, err := d.activityState(ctx, blockNum)
+	return applied, err
+}
+
+// activityState 返回区块的交互统计是否已计入，以及是否为 0006 之前计入、没有按合约记录增量的区块
+func (d *Downloader) activityState(ctx context.Context, blockNum uint64) (applied, legacy bool, err error) {
+	err = d.db.QueryRowContext(ctx, "SELECT legacy FROM activity_blocks WHERE chain = ? AND blocknumber = ?", d.chain, int64(blockNum)).Scan(&legacy)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, legacy, nil
+}
+
+// applyActivity 在一个事务内把区块交互计入已存储合约的 txlast / txcount。
+// 每个合约的增量写入 activity_contracts（重组回滚时据此扣除），已有记录的合约跳过，
+// 同一区块重复处理（重试、回填）不会重复计数，区块计入后才入库的合约则会补计。
+// 0006 之前计入的区块（legacy）不知道当时计入了哪些合约，直接跳过。
+func (d *Downloader) applyActivity(ctx context.Context, blockNum uint64, act *blockActivity) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "INSERT IGNORE INTO activity_blocks (chain, blocknumber, touched) VALUES (?, ?, 0)", d.chain, int64(blockNum))
+	if err != nil {
+		return fmt.Errorf("记录区块交互统计失败: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		var legacy bool
+		if err := tx.QueryRowContext(ctx, "SELECT legacy FROM activity_blocks WHERE chain = ? AND blocknumber = ?", d.chain, int64(blockNum)).Scan(&legacy); err != nil {
+			return fmt.Errorf("查询区块交互统计失败: %w", err)
+		}
+		if legacy {
+			return nil
+		}
+	}
+
+	addrs := make([]string, 0, len(act.counts))
+	for a := range act.counts {
+		addrs = append(addrs, a.Hex())
+	}
+
+	// 只更新已存储的合约；分批查询避免 IN 过长
+	const chunk = 500
+	touched := 0
+	for i := 0; i < len(addrs); i += chunk {
+		j := i + chunk
+		if j > len(addrs) {
+			j = len(addrs)
+		}
+		placeholders := make([]string, j-i)
+		args := make([]interface{}, 0, j-i+1)
+		args = append(args, d.chain)
+		for k, a := range addrs[i:j] {
+			placeholders[k] = "?"
+			args = append(args, a)
+		}
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT address FROM contracts WHERE chain = ? AND address IN (%s)", strings.Join(placeholders, ",")), args...)
+		if err != nil {
+			return fmt.Errorf("查询已存储合约失败: %w", err)
+		}
+		var stored []string
+		for rows.Next() {
+			var a string
+			if err := rows.Scan(&a); err != nil {
+				rows.Close()
+				return err
+			}
+			stored = append(stored, a)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, a := range stored {
+			n := act.counts[common.HexToAddress(a)]
+			res, err := tx.ExecContext(ctx,
+				"INSERT IGNORE INTO activity_contracts (chain, blocknumber, address, txcount, txtime) VALUES (?, ?, ?, ?, ?)",
+				d.chain, int64(blockNum), a, n, act.time)
+			if err != nil {
+				return fmt.Errorf("记录合约 %s 交互增量失败: %w", a, err)
+			}
+			if inserted, err := res.RowsAffected(); err == nil && inserted == 0 {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx,
+				"UPDATE contracts SET txlast = GREATEST(txlast, ?), txcount = txcount + ? WHERE chain = ? AND address = ?",
+				act.time, n, d.chain, a); err != nil {
+				return fmt.Errorf("更新合约 %s 交互记录失败: %w", a, err)
+			}
+			touched++
+		}
+	}
+
+	if touched > 0 {
+		if _, err := tx.ExecContext(ctx, "UPDATE activity_blocks SET touched = touched + ? WHERE chain = ? AND blocknumber = ?", touched, d.chain, int64(blockNum)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// BackfillActivity 为已下载区间回填 txlast / txcount（已计入的区块自动跳过，可重复执行）。
+// 区块计入时只更新当时已入库的合约，之后才入库的合约（先下载了后面的区间、按地址下载）不会得到这些区块的交互；
+// force 为 true 时重新抓取已计入的区块，只补计尚未计入的合约（0006 之前计入的区块无法判断，仍然跳过）
+func (d *Downloader) BackfillActivity(ctx context.Context, start, end uint64, force bool) error {
+	if end < start {
+		return fmt.Errorf("结束区块必须大于等于开始区块")
+	}
+	opts := d.pipeline.normalize()
+	log.Printf("📈 开始回填交互记录: 区块 %d - %d（%d 个 worker）\n", start, end, opts.Workers)
+
+	jobs := make(chan uint64)
+	go func() {
+		defer close(jobs)
+		for n := start; n <= end; n++ {
+			select {
+			case jobs <- n:
+			case <-ctx.Done():
+				return
+			}
+			if n == ^uint64(0) {
+				return
+			}
+		}
+	}()
+
+	var done, skipped, failed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				applied, err := d.backfillBlock(ctx, n, force)
+				switch {
+				case err != nil:
+					if ctx.Err() == nil {
+						log.Printf("❌ 回填区块 %d 失败: %v\n", n, err)
+					}
+					failed.Add(1)
+				case !applied:
+					skipped.Add(1)
+				}
+				if total := done.Add(1); total%1000 == 0 {
+					log.Printf("📈 已处理 %d 个区块（跳过 %d，失败 %d）\n", total, skipped.Load(), failed.Load())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	log.Printf("\n✅ 交互记录回填完成!\n")
+	log.Printf("   - 已处理区块: %d\n", done.Load())
+	log.Printf("   - 已计入跳过: %d\n", skipped.Load())
+	log.Printf("   - 失败: %d（可重新执行回填）\n", failed.Load())
+	return nil
+}
+
+// BackfillDownloadedActivity 对 download_progress 中所有已下载区间回填交互记录，force 同 BackfillActivity
+func (d *Downloader) BackfillDownloadedActivity(ctx context.Context, force bool) error {
+	recs, err := d.loadProgress(ctx)
+	if err != nil {
+		return err
+	}
+	if len(recs) == 0 {
+		return fmt.Errorf("没有已下载区间记录，请使用 -d-range 指定回填范围")
+	}
+	for _, r := range recs {
+		if err := d.BackfillActivity(ctx, r.Start, r.End, force); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillBlock 回填单个区块，跳过时返回 false：已计入的区块（force 时只跳过 legacy 区块）
+func (d *Downloader) backfillBlock(ctx context.Context, blockNum uint64, force bool) (bool, error) {
+	applied, legacy, err := d.activityState(ctx, blockNum)
+	if err != nil {
+		return false, err
+	}
+	if applied && (!force || legacy) {
+		return false, nil
+	}
+
+	block, err := d.Client.BlockByNumber(ctx, new(big.Int).SetUint64(blockNum))
+	if err != nil {
+		return false, fmt.Errorf("获取区块失败: %w", err)
+	}
+	act, err := d.collectActivity(ctx, block)
+	if err != nil {
+		return false, err
+	}
+	return true, d.applyActivity(ctx, blockNum, act)
+}
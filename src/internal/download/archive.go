@@ -0,0 +1,948 @@
+package download
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 语料归档格式：目录下一个 manifest.json 加若干 gzip 压缩的 JSONL 分片。
+// contracts-*.jsonl.gz 每行一个合约（含代理关联、创建信息与代币持仓），codes-*.jsonl.gz 每行一个代码哈希（含字节码、源码与元数据），
+// initcodes-*.jsonl.gz 每行一个创建字节码（按哈希去重，旧归档没有该分片）
+const (
+	corpusVersion      = 1
+	corpusManifestFile = "manifest.json"
+	shardContracts     = "contracts"
+	shardCodes         = "codes"
+	shardInitCodes     = "initcodes"
+)
+
+// CorpusFilter 导出/导入的过滤条件
+type CorpusFilter struct {
+	BlockRange *BlockRangeRecord `json:"blockrange,omitempty"` // 只处理该创建区块范围内的合约
+	OpenSource *bool             `json:"opensource,omitempty"` // 只处理已开源（true）或未开源（false）的合约，nil 表示全部
+	MinBalance string            `json:"minbalance,omitempty"` // 只处理余额不低于该值（wei）的合约
+}
+
+// partial 是否按区块以外的条件过滤（此时区块区间内的合约不完整，不能当作已下载区间）
+func (f CorpusFilter) partial() bool {
+	return f.OpenSource != nil || f.MinBalance != ""
+}
+
+// match 判断合约是否满足过滤条件（导入时使用，导出时在 SQL 中过滤）
+func (f CorpusFilter) match(c *corpusContract) bool {
+	if f.BlockRange != nil && (c.CreateBlock < f.BlockRange.Start || c.CreateBlock > f.BlockRange.End) {
+		return false
+	}
+	if f.OpenSource != nil && (c.IsOpenSource == 1) != *f.OpenSource {
+		return false
+	}
+	if f.MinBalance != "" {
+		min, _ := new(big.Int).SetString(f.MinBalance, 10)
+		bal, ok := new(big.Int).SetString(strings.TrimSpace(c.Balance), 10)
+		if min != nil && (!ok || bal.Cmp(min) < 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// CorpusManifest 归档清单
+type CorpusManifest struct {
+	Version   int                `json:"version"`
+	Chain     string             `json:"chain"`
+	CreatedAt time.Time          `json:"createdat"`
+	Filter    CorpusFilter       `json:"filter"`
+	Ranges    []BlockRangeRecord `json:"ranges"` // 导出时已完整下载的区块区间（按过滤条件截取），导入后计入 download_progress
+	MinBlock  uint64             `json:"minblock"`
+	MaxBlock  uint64             `json:"maxblock"`
+	Counts    map[string]int     `json:"counts"` // contracts / codes / metadata / proxies / creations / initcodes / tokens
+	Shards    []CorpusShard      `json:"shards"`
+}
+
+// CorpusShard 单个分片文件
+type CorpusShard struct {
+	File   string `json:"file"`
+	Kind   string `json:"kind"`
+	Count  int    `json:"count"`
+	SHA256 string `json:"sha256"`
+}
+
+// corpusContract contracts 分片中的一行
+type corpusContract struct {
+	Address      string     `json:"address"`
+	Contract     string     `json:"contract"`
+	Balance      string     `json:"balance"`
+	BalanceTime  *time.Time `json:"balancetime,omitempty"`
+	IsOpenSource int        `json:"isopensource"`
+	CreateTime   time.Time  `json:"createtime"`
+	CreateBlock  uint64     `json:"createblock"`
+	TxLast       time.Time  `json:"txlast"`
+	TxCount      uint64     `json:"txcount"`
+	IsDecompiled int        `json:"isdecompiled"`
+	DedCode      string     `json:"dedcode,omitempty"`
+	Factory      string     `json:"factory,omitempty"`
+	CreationTx   string     `json:"creationtx,omitempty"`
+	Deployer     string     `json:"deployer,omitempty"`
+	Nonce        *uint64    `json:"nonce,omitempty"`
+	CodeHash     string     `json:"code_hash,omitempty"`
+	Proxy        *ProxyInfo `json:"proxy,omitempty"`
+
+	Creation *corpusCreation      `json:"creation,omitempty"`
+	Tokens   []corpusTokenBalance `json:"tokens,omitempty"`
+	Verified *corpusAddressMeta   `json:"verified,omitempty"`
+}
+
+// corpusAddressMeta 验证结果中属于该地址的部分（contract_address_metadata）
+type corpusAddressMeta struct {
+	ConstructorArgs string `json:"constructorargs,omitempty"`
+	Proxy           bool   `json:"proxy,omitempty"`
+	Implementation  string `json:"implementation,omitempty"`
+}
+
+// corpusCreation 合约的创建信息，创建字节码本身在 initcodes 分片中
+type corpusCreation struct {
+	InitCodeHash    string  `json:"initcodehash"`
+	ConstructorArgs *string `json:"constructorargs,omitempty"` // 未能拆分出构造参数时为空
+}
+
+// corpusTokenBalance 合约持有的一种代币
+type corpusTokenBalance struct {
+	Token     string    `json:"token"`
+	Symbol    string    `json:"symbol,omitempty"`
+	Balance   string    `json:"balance"`
+	ValueUSD  float64   `json:"valueusd"`
+	UpdatedAt time.Time `json:"updatedat"`
+}
+
+// corpusInitCode initcodes 分片中的一行
+type corpusInitCode struct {
+	InitCodeHash string `json:"initcodehash"`
+	InitCode     string `json:"initcode"`
+}
+
+// corpusCode codes 分片中的一行
+type corpusCode struct {
+	CodeHash     string            `json:"code_hash"`
+	Bytecode     string            `json:"bytecode"`
+	Source       string            `json:"source,omitempty"`
+	IsOpenSource int               `json:"isopensource"`
+	Checked      bool              `json:"checked"`
+	FirstChain   string            `json:"firstchain,omitempty"`
+	FirstAddress string            `json:"firstaddress"`
+	FirstBlock   uint64            `json:"firstblock"`
+	Metadata     *ContractMetadata `json:"metadata,omitempty"`
+}
+
+// ExportOptions 语料导出参数
+type ExportOptions struct {
+	Dir       string
+	Chain     string
+	Filter    CorpusFilter
+	ShardSize int // 每个分片的行数
+}
+
+// ImportOptions 语料导入参数
+type ImportOptions struct {
+	Dir    string
+	Chain  string
+	Filter CorpusFilter
+}
+
+// ExportCorpus 将 contracts 及关联的代码哈希、元数据、代理、创建信息与代币持仓导出为归档目录
+func ExportCorpus(ctx context.Context, db *sql.DB, opts ExportOptions) (*CorpusManifest, error) {
+	if opts.ShardSize <= 0 {
+		opts.ShardSize = 50000
+	}
+	if opts.Chain == "" {
+		opts.Chain = defaultChain
+	}
+	if _, err := os.Stat(filepath.Join(opts.Dir, corpusManifestFile)); err == nil {
+		return nil, fmt.Errorf("目录 %s 中已存在归档，请换一个目录", opts.Dir)
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建导出目录失败: %w", err)
+	}
+
+	m := &CorpusManifest{
+		Version:   corpusVersion,
+		Chain:     opts.Chain,
+		CreatedAt: time.Now().UTC(),
+		Filter:    opts.Filter,
+		Counts:    map[string]int{},
+	}
+
+	log.Printf("📤 开始导出合约到 %s ...\n", opts.Dir)
+	hashes, initHashes, err := exportContracts(ctx, db, opts, m)
+	if err != nil {
+		return nil, err
+	}
+	if err := exportCodes(ctx, db, opts, hashes, m); err != nil {
+		return nil, err
+	}
+	if err := exportInitCodes(ctx, db, opts, initHashes, m); err != nil {
+		return nil, err
+	}
+
+	if !opts.Filter.partial() {
+		ranges, err := queryProgress(ctx, db, opts.Chain)
+		if err != nil {
+			return nil, err
+		}
+		m.Ranges = clipRanges(ranges, opts.Filter.BlockRange)
+	}
+
+	bs, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(opts.Dir, corpusManifestFile), bs, 0o644); err != nil {
+		return nil, fmt.Errorf("写入 %s 失败: %w", corpusManifestFile, err)
+	}
+
+	log.Printf("\n✅ 导出完成!\n")
+	log.Printf("   - 合约: %d，代码哈希: %d，元数据: %d，代理: %d\n",
+		m.Counts["contracts"], m.Counts["codes"], m.Counts["metadata"], m.Counts["proxies"])
+	log.Printf("   - 创建信息: %d，创建字节码: %d，代币持仓: %d\n", m.Counts["creations"], m.Counts["initcodes"], m.Counts["tokens"])
+	log.Printf("   - 分片: %d 个\n", len(m.Shards))
+	return m, nil
+}
+
+// exportContracts 按地址分页导出合约，返回引用到的代码哈希与创建字节码哈希
+func exportContracts(ctx context.Context, db *sql.DB, opts ExportOptions, m *CorpusManifest) (map[string]bool, map[string]bool, error) {
+	conditions := []string{"c.chain = ?", "c.address > ?"}
+	var filterArgs []interface{}
+	if r := opts.Filter.BlockRange; r != nil {
+		cond, args := blockRangeCondition(*r)
+		conditions = append(conditions, "c."+cond)
+		filterArgs = append(filterArgs, args...)
+	}
+	if open := opts.Filter.OpenSource; open != nil {
+		v := 0
+		if *open {
+			v = 1
+		}
+		conditions = append(conditions, "c.isopensource = ?")
+		filterArgs = append(filterArgs, v)
+	}
+	if opts.Filter.MinBalance != "" {
+		conditions = append(conditions, "CAST(c.balance AS DECIMAL(65,0)) >= CAST(? AS DECIMAL(65,0))")
+		filterArgs = append(filterArgs, opts.Filter.MinBalance)
+	}
+	query := fmt.Sprintf(`
+	SELECT c.address, c.contract, CAST(COALESCE(c.balance, 0) AS CHAR), c.balancetime, c.isopensource, c.createtime, c.createblock,
+		c.txlast, c.txcount, c.isdecompiled, COALESCE(c.dedcode, ''), COALESCE(c.factory, ''), COALESCE(c.creationtx, ''),
+		COALESCE(c.code_hash, ''), COALESCE(c.deployer, ''), c.nonce, p.kind, p.implementation, p.beacon, p.admin,
+		cr.initcodehash, cr.constructorargs, am.constructorargs, am.proxy, am.implementation
+	FROM contracts c
+	LEFT JOIN contract_proxies p ON p.chain = c.chain AND p.address = c.address
+	LEFT JOIN contract_creations cr ON cr.chain = c.chain AND cr.address = c.address
+	LEFT JOIN contract_address_metadata am ON am.chain = c.chain AND am.address = c.address
+	WHERE %s ORDER BY c.address LIMIT 1000`, strings.Join(conditions, " AND "))
+
+	w := newShardWriter(opts.Dir, shardContracts, opts.ShardSize)
+	hashes := make(map[string]bool)
+	initHashes := make(map[string]bool)
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			w.abort()
+			return nil, nil, err
+		}
+		args := append([]interface{}{opts.Chain, cursor}, filterArgs...)
+		batch, err := queryCorpusContracts(ctx, db, query, args)
+		if err == nil {
+			err = loadCorpusTokens(ctx, db, opts.Chain, batch)
+		}
+		if err != nil {
+			w.abort()
+			return nil, nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		cursor = batch[len(batch)-1].Address
+
+		for _, c := range batch {
+			if err := w.write(c); err != nil {
+				w.abort()
+				return nil, nil, err
+			}
+			if c.CodeHash != "" {
+				hashes[c.CodeHash] = true
+			}
+			if c.Proxy != nil {
+				m.Counts["proxies"]++
+			}
+			if c.Creation != nil {
+				initHashes[c.Creation.InitCodeHash] = true
+				m.Counts["creations"]++
+			}
+			m.Counts["tokens"] += len(c.Tokens)
+			if m.Counts["contracts"] == 0 || c.CreateBlock < m.MinBlock {
+				m.MinBlock = c.CreateBlock
+			}
+			if c.CreateBlock > m.MaxBlock {
+				m.MaxBlock = c.CreateBlock
+			}
+			m.Counts["contracts"]++
+		}
+		log.Printf("📤 已导出 %d 个合约\n", m.Counts["contracts"])
+	}
+
+	shards, err := w.close()
+	if err != nil {
+		return nil, nil, err
+	}
+	m.Shards = append(m.Shards, shards...)
+	return hashes, initHashes, nil
+}
+
+func queryCorpusContracts(ctx context.Context, db *sql.DB, query string, args []interface{}) ([]*corpusContract, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询合约失败: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*corpusContract
+	for rows.Next() {
+		c := &corpusContract{}
+		var balanceTime sql.NullTime
+		var kind, impl, beacon, admin, initHash, args, verifiedArgs, verifiedImpl sql.NullString
+		var verifiedProxy sql.NullBool
+		var nonce sql.NullInt64
+		if err := rows.Scan(&c.Address, &c.Contract, &c.Balance, &balanceTime, &c.IsOpenSource, &c.CreateTime, &c.CreateBlock,
+			&c.TxLast, &c.TxCount, &c.IsDecompiled, &c.DedCode, &c.Factory, &c.CreationTx,
+			&c.CodeHash, &c.Deployer, &nonce, &kind, &impl, &beacon, &admin, &initHash, &args,
+			&verifiedArgs, &verifiedProxy, &verifiedImpl); err != nil {
+			return nil, err
+		}
+		if verifiedProxy.Valid {
+			c.Verified = &corpusAddressMeta{ConstructorArgs: verifiedArgs.String, Proxy: verifiedProxy.Bool, Implementation: verifiedImpl.String}
+		}
+		if nonce.Valid {
+			n := uint64(nonce.Int64)
+			c.Nonce = &n
+		}
+		if balanceTime.Valid {
+			t := balanceTime.Time
+			c.BalanceTime = &t
+		}
+		if kind.Valid {
+			c.Proxy = &ProxyInfo{Kind: kind.String, Implementation: impl.String, Beacon: beacon.String, Admin: admin.String}
+		}
+		if initHash.Valid {
+			c.Creation = &corpusCreation{InitCodeHash: initHash.String}
+			if args.Valid {
+				c.Creation.ConstructorArgs = &args.String
+			}
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// loadCorpusTokens 读取一批合约的代币持仓
+func loadCorpusTokens(ctx context.Context, db *sql.DB, chain string, batch []*corpusContract) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	byAddr := make(map[string]*corpusContract, len(batch))
+	addrs := make([]string, len(batch))
+	for i, c := range batch {
+		byAddr[strings.ToLower(c.Address)] = c
+		addrs[i] = c.Address
+	}
+	in, inArgs := inClause(addrs)
+	rows, err := db.QueryContext(ctx, `
+	SELECT address, token, COALESCE(symbol, ''), CAST(balance AS CHAR), COALESCE(valueusd, 0), updatedat
+	FROM contract_token_balances WHERE chain = ? AND address IN `+in+` ORDER BY address, token`,
+		append([]interface{}{chain}, inArgs...)...)
+	if err != nil {
+		return fmt.Errorf("查询代币持仓失败: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var addr string
+		var t corpusTokenBalance
+		if err := rows.Scan(&addr, &t.Token, &t.Symbol, &t.Balance, &t.ValueUSD, &t.UpdatedAt); err != nil {
+			return err
+		}
+		if c := byAddr[strings.ToLower(addr)]; c != nil {
+			c.Tokens = append(c.Tokens, t)
+		}
+	}
+	return rows.Err()
+}
+
+// exportCodes 导出被引用的代码哈希及其元数据
+func exportCodes(ctx context.Context, db *sql.DB, opts ExportOptions, hashes map[string]bool, m *CorpusManifest) error {
+	sorted := make([]string, 0, len(hashes))
+	for h := range hashes {
+		sorted = append(sorted, h)
+	}
+	sort.Strings(sorted)
+
+	w := newShardWriter(opts.Dir, shardCodes, opts.ShardSize)
+	for start := 0; start < len(sorted); start += 200 {
+		if err := ctx.Err(); err != nil {
+			w.abort()
+			return err
+		}
+		end := start + 200
+		if end > len(sorted) {
+			end = len(sorted)
+		}
+		batch, err := queryCorpusCodes(ctx, db, sorted[start:end])
+		if err != nil {
+			w.abort()
+			return err
+		}
+		for _, c := range batch {
+			if c.IsOpenSource == 1 {
+				if c.Metadata, err = loadMetadataByHash(ctx, db, c.CodeHash); err != nil {
+					w.abort()
+					return err
+				}
+				if c.Metadata != nil {
+					m.Counts["metadata"]++
+				}
+			}
+			if err := w.write(c); err != nil {
+				w.abort()
+				return err
+			}
+			m.Counts["codes"]++
+		}
+	}
+
+	shards, err := w.close()
+	if err != nil {
+		return err
+	}
+	m.Shards = append(m.Shards, shards...)
+	return nil
+}
+
+// exportInitCodes 导出被引用的创建字节码
+func exportInitCodes(ctx context.Context, db *sql.DB, opts ExportOptions, hashes map[string]bool, m *CorpusManifest) error {
+	sorted := make([]string, 0, len(hashes))
+	for h := range hashes {
+		sorted = append(sorted, h)
+	}
+	sort.Strings(sorted)
+
+	w := newShardWriter(opts.Dir, shardInitCodes, opts.ShardSize)
+	for _, chunk := range chunkStrings(sorted, 200) {
+		if err := ctx.Err(); err != nil {
+			w.abort()
+			return err
+		}
+		in, args := inClause(chunk)
+		rows, err := db.QueryContext(ctx,
+			"SELECT initcodehash, initcode FROM contract_initcodes WHERE initcodehash IN "+in+" ORDER BY initcodehash", args...)
+		if err != nil {
+			w.abort()
+			return fmt.Errorf("查询创建字节码失败: %w", err)
+		}
+		var batch []corpusInitCode
+		for rows.Next() {
+			var c corpusInitCode
+			if err := rows.Scan(&c.InitCodeHash, &c.InitCode); err != nil {
+				rows.Close()
+				w.abort()
+				return err
+			}
+			batch = append(batch, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			w.abort()
+			return err
+		}
+		for _, c := range batch {
+			if err := w.write(c); err != nil {
+				w.abort()
+				return err
+			}
+			m.Counts["initcodes"]++
+		}
+	}
+
+	shards, err := w.close()
+	if err != nil {
+		return err
+	}
+	m.Shards = append(m.Shards, shards...)
+	return nil
+}
+
+func queryCorpusCodes(ctx context.Context, db *sql.DB, hashes []string) ([]*corpusCode, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(hashes)), ",")
+	args := make([]interface{}, len(hashes))
+	for i, h := range hashes {
+		args[i] = h
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+	SELECT code_hash, bytecode, COALESCE(source, ''), isopensource, checked, firstchain, COALESCE(firstaddress, ''), COALESCE(firstblock, 0)
+	FROM contract_codes WHERE code_hash IN (%s) ORDER BY code_hash`, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询代码哈希失败: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*corpusCode
+	for rows.Next() {
+		c := &corpusCode{}
+		if err := rows.Scan(&c.CodeHash, &c.Bytecode, &c.Source, &c.IsOpenSource, &c.Checked, &c.FirstChain, &c.FirstAddress, &c.FirstBlock); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// ImportCorpus 导入归档目录：合约按 SaveContract 的规则 upsert，重复导入结果不变
+func ImportCorpus(ctx context.Context, db *sql.DB, opts ImportOptions) error {
+	if opts.Chain == "" {
+		opts.Chain = defaultChain
+	}
+	m, err := readCorpusManifest(opts.Dir)
+	if err != nil {
+		return err
+	}
+	if m.Chain != opts.Chain {
+		return fmt.Errorf("归档属于链 %s，与当前链 %s 不一致（使用 -c %s 导入）", m.Chain, opts.Chain, m.Chain)
+	}
+	for _, s := range m.Shards {
+		if err := verifyShard(opts.Dir, s); err != nil {
+			return err
+		}
+	}
+	log.Printf("📥 开始导入 %s（链 %s，%d 个合约，区块 %d - %d）...\n", opts.Dir, m.Chain, m.Counts["contracts"], m.MinBlock, m.MaxBlock)
+
+	// 先导入合约，记录需要的代码哈希与创建字节码，再只导入这些哈希
+	needed := make(map[string]bool)
+	neededInit := make(map[string]bool)
+	var imported, skipped, codes, initCodes int
+	for _, s := range m.Shards {
+		if s.Kind != shardContracts {
+			continue
+		}
+		err := readShard(ctx, opts.Dir, s, func(dec *json.Decoder, batch int) (int, error) {
+			var rows []*corpusContract
+			read := 0
+			for read < batch {
+				c := &corpusContract{}
+				if err := dec.Decode(c); err == io.EOF {
+					break
+				} else if err != nil {
+					return 0, err
+				}
+				read++
+				if !opts.Filter.match(c) {
+					skipped++
+					continue
+				}
+				rows = append(rows, c)
+			}
+			if err := importContracts(ctx, db, opts.Chain, rows); err != nil {
+				return 0, err
+			}
+			for _, c := range rows {
+				if c.CodeHash != "" {
+					needed[c.CodeHash] = true
+				}
+				if c.Creation != nil {
+					neededInit[c.Creation.InitCodeHash] = true
+				}
+			}
+			imported += len(rows)
+			return read, nil
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("📥 %s 导入完成（累计 %d 个合约）\n", s.File, imported)
+	}
+
+	for _, s := range m.Shards {
+		if s.Kind != shardCodes {
+			continue
+		}
+		err := readShard(ctx, opts.Dir, s, func(dec *json.Decoder, batch int) (int, error) {
+			var rows []*corpusCode
+			read := 0
+			for read < batch {
+				c := &corpusCode{}
+				if err := dec.Decode(c); err == io.EOF {
+					break
+				} else if err != nil {
+					return 0, err
+				}
+				read++
+				if needed[c.CodeHash] {
+					rows = append(rows, c)
+				}
+			}
+			if err := importCodes(ctx, db, opts.Chain, rows); err != nil {
+				return 0, err
+			}
+			codes += len(rows)
+			return read, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, s := range m.Shards {
+		if s.Kind != shardInitCodes {
+			continue
+		}
+		err := readShard(ctx, opts.Dir, s, func(dec *json.Decoder, batch int) (int, error) {
+			var rows []corpusInitCode
+			read := 0
+			for read < batch {
+				var c corpusInitCode
+				if err := dec.Decode(&c); err == io.EOF {
+					break
+				} else if err != nil {
+					return 0, err
+				}
+				read++
+				if neededInit[c.InitCodeHash] {
+					rows = append(rows, c)
+				}
+			}
+			if err := importInitCodes(ctx, db, rows); err != nil {
+				return 0, err
+			}
+			initCodes += len(rows)
+			return read, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// 合约先于代码导入，类型标签等 ABI 与字节码都入库后再补
+	if err := classifyStored(ctx, db, opts.Chain, ClassifyOptions{OnlyUntagged: true}); err != nil {
+		return fmt.Errorf("判断导入合约的类型失败: %w", err)
+	}
+
+	// 只有完整导入（未按开源/余额过滤）时，区块区间才能计入已下载进度
+	var marked int
+	if !opts.Filter.partial() {
+		for _, r := range clipRanges(m.Ranges, opts.Filter.BlockRange) {
+			if err := saveProgressRange(ctx, db, opts.Chain, r); err != nil {
+				return fmt.Errorf("写入下载进度失败: %w", err)
+			}
+			marked++
+		}
+	}
+
+	log.Printf("\n✅ 导入完成!\n")
+	log.Printf("   - 导入合约: %d（过滤跳过 %d）\n", imported, skipped)
+	log.Printf("   - 导入代码哈希: %d\n", codes)
+	log.Printf("   - 导入创建字节码: %d\n", initCodes)
+	log.Printf("   - 计入已下载区间: %d\n", marked)
+	return nil
+}
+
+// importContracts 在一个事务内 upsert 一批合约（写入 chain 链）
+func importContracts(ctx context.Context, db *sql.DB, chain string, rows []*corpusContract) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range rows {
+		info := &ContractInfo{
+			Address:      c.Address,
+			Contract:     c.Contract,
+			Balance:      c.Balance,
+			IsOpenSource: c.IsOpenSource,
+			CreateTime:   c.CreateTime,
+			CreateBlock:  c.CreateBlock,
+			TxLast:       c.TxLast,
+			IsDecompiled: c.IsDecompiled,
+			DedCode:      c.DedCode,
+			Factory:      c.Factory,
+			CreationTx:   c.CreationTx,
+			Deployer:     c.Deployer,
+			Nonce:        c.Nonce,
+			CodeHash:     c.CodeHash,
+		}
+		if err := saveContractRow(ctx, tx, chain, info); err != nil {
+			return fmt.Errorf("导入合约 %s 失败: %w", c.Address, err)
+		}
+		// 交互次数取较大值保证重复导入不累加；余额刷新时间保留导出时的值
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE contracts SET txcount = GREATEST(txcount, ?), balancetime = ? WHERE chain = ? AND address = ?",
+			c.TxCount, c.BalanceTime, chain, c.Address); err != nil {
+			return fmt.Errorf("导入合约 %s 失败: %w", c.Address, err)
+		}
+		if err := saveProxy(ctx, tx, chain, c.Address, c.Proxy); err != nil {
+			return err
+		}
+		if cr := c.Creation; cr != nil {
+			creation := &CreationInfo{InitCodeHash: cr.InitCodeHash, Split: cr.ConstructorArgs != nil}
+			if cr.ConstructorArgs != nil {
+				creation.ConstructorArgs = *cr.ConstructorArgs
+			}
+			if err := saveCreation(ctx, tx, chain, c.Address, creation); err != nil {
+				return err
+			}
+		}
+		if v := c.Verified; v != nil {
+			meta := &ContractMetadata{ConstructorArguments: v.ConstructorArgs, Proxy: v.Proxy, Implementation: v.Implementation}
+			if err := saveAddressMetadata(ctx, tx, chain, c.Address, meta); err != nil {
+				return err
+			}
+		}
+		for _, t := range c.Tokens {
+			if _, err := tx.ExecContext(ctx, tokenBalanceUpsert,
+				chain, c.Address, t.Token, t.Symbol, t.Balance, t.ValueUSD, t.UpdatedAt); err != nil {
+				return fmt.Errorf("导入合约 %s 的代币持仓失败: %w", c.Address, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// importInitCodes 在一个事务内写入一批创建字节码（已存在的跳过）
+func importInitCodes(ctx context.Context, db *sql.DB, rows []corpusInitCode) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range rows {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT IGNORE INTO contract_initcodes (initcodehash, initcode) VALUES (?, ?)", c.InitCodeHash, c.InitCode); err != nil {
+			return fmt.Errorf("导入创建字节码 %s 失败: %w", c.InitCodeHash, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// importCodes 在一个事务内 upsert 一批代码哈希与元数据（旧归档没有 firstchain 时按归档所属链 chain）
+func importCodes(ctx context.Context, db *sql.DB, chain string, rows []*corpusCode) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range rows {
+		info := &ContractInfo{
+			Address:       c.FirstAddress,
+			Contract:      c.Source,
+			IsOpenSource:  c.IsOpenSource,
+			SourceChecked: c.Checked,
+			CreateBlock:   c.FirstBlock,
+			CodeHash:      c.CodeHash,
+			Bytecode:      c.Bytecode,
+		}
+		firstChain := c.FirstChain
+		if firstChain == "" {
+			firstChain = chain
+		}
+		if err := saveCode(ctx, tx, firstChain, info); err != nil {
+			return fmt.Errorf("导入代码哈希 %s 失败: %w", c.CodeHash, err)
+		}
+		if c.Metadata != nil {
+			if c.Metadata.Provider == "" {
+				c.Metadata.Provider, c.Metadata.MatchType = ProviderEtherscan, MatchVerified
+			}
+			if err := saveCodeMetadata(ctx, tx, c.CodeHash, c.FirstAddress, c.Metadata); err != nil {
+				return err
+			}
+			// 旧归档的元数据中带有首个验证地址的构造参数与代理标记；新归档中这部分随合约导出
+			if m := c.Metadata; m.ConstructorArguments != "" || m.Proxy {
+				if err := saveAddressMetadata(ctx, tx, firstChain, c.FirstAddress, m); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// clipRanges 将区间截取到 r 内（r 为 nil 时原样返回）
+func clipRanges(ranges []BlockRangeRecord, r *BlockRangeRecord) []BlockRangeRecord {
+	if r == nil {
+		return ranges
+	}
+	var out []BlockRangeRecord
+	for _, x := range ranges {
+		if x.End < r.Start || x.Start > r.End {
+			continue
+		}
+		if x.Start < r.Start {
+			x.Start = r.Start
+		}
+		if x.End > r.End {
+			x.End = r.End
+		}
+		out = append(out, x)
+	}
+	return out
+}
+
+// readCorpusManifest 读取并检查归档清单
+func readCorpusManifest(dir string) (*CorpusManifest, error) {
+	bs, err := os.ReadFile(filepath.Join(dir, corpusManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %w", corpusManifestFile, err)
+	}
+	var m CorpusManifest
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", corpusManifestFile, err)
+	}
+	if m.Version != corpusVersion {
+		return nil, fmt.Errorf("不支持的归档版本: %d", m.Version)
+	}
+	return &m, nil
+}
+
+// verifyShard 校验分片文件的 sha256
+func verifyShard(dir string, s CorpusShard) error {
+	f, err := os.Open(filepath.Join(dir, s.File))
+	if err != nil {
+		return fmt.Errorf("打开分片 %s 失败: %w", s.File, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("读取分片 %s 失败: %w", s.File, err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != s.SHA256 {
+		return fmt.Errorf("分片 %s 校验失败（sha256 %s，清单中为 %s）", s.File, sum, s.SHA256)
+	}
+	return nil
+}
+
+// readShard 打开分片并反复调用 fn 按批处理，直到 fn 返回 0
+func readShard(ctx context.Context, dir string, s CorpusShard, fn func(dec *json.Decoder, batch int) (int, error)) error {
+	f, err := os.Open(filepath.Join(dir, s.File))
+	if err != nil {
+		return fmt.Errorf("打开分片 %s 失败: %w", s.File, err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("解压分片 %s 失败: %w", s.File, err)
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(gz)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := fn(dec, 500)
+		if err != nil {
+			return fmt.Errorf("读取分片 %s 失败: %w", s.File, err)
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+// shardWriter 按行数滚动写入 gzip JSONL 分片，同时计算 sha256
+type shardWriter struct {
+	dir, kind string
+	size      int
+
+	file   *os.File
+	gz     *gzip.Writer
+	hasher hash.Hash
+	enc    *json.Encoder
+	cur    CorpusShard
+	done   []CorpusShard
+}
+
+func newShardWriter(dir, kind string, size int) *shardWriter {
+	return &shardWriter{dir: dir, kind: kind, size: size}
+}
+
+func (w *shardWriter) write(v interface{}) error {
+	if w.file == nil {
+		w.cur = CorpusShard{File: fmt.Sprintf("%s-%05d.jsonl.gz", w.kind, len(w.done)), Kind: w.kind}
+		f, err := os.Create(filepath.Join(w.dir, w.cur.File))
+		if err != nil {
+			return fmt.Errorf("创建分片失败: %w", err)
+		}
+		w.file, w.hasher = f, sha256.New()
+		w.gz = gzip.NewWriter(io.MultiWriter(f, w.hasher))
+		w.enc = json.NewEncoder(w.gz)
+	}
+	if err := w.enc.Encode(v); err != nil {
+		return fmt.Errorf("写入分片 %s 失败: %w", w.cur.File, err)
+	}
+	w.cur.Count++
+	if w.cur.Count >= w.size {
+		return w.finish()
+	}
+	return nil
+}
+
+// finish 关闭当前分片并记录其校验和
+func (w *shardWriter) finish() error {
+	if w.file == nil {
+		return nil
+	}
+	err := errors.Join(w.gz.Close(), w.file.Close())
+	w.file = nil
+	if err != nil {
+		return fmt.Errorf("关闭分片 %s 失败: %w", w.cur.File, err)
+	}
+	w.cur.SHA256 = hex.EncodeToString(w.hasher.Sum(nil))
+	w.done = append(w.done, w.cur)
+	return nil
+}
+
+func (w *shardWriter) close() ([]CorpusShard, error) {
+	if err := w.finish(); err != nil {
+		return nil, err
+	}
+	return w.done, nil
+}
+
+// abort 出错时关闭未完成的分片（不写清单，目录中的分片不会被导入）
+func (w *shardWriter) abort() {
+	if w.file != nil {
+		w.gz.Close()
+		w.file.Close()
+		w.file = nil
+	}
+}
@@ -0,0 +1,171 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// BalanceRefreshOptions 余额刷新任务参数
+type BalanceRefreshOptions struct {
+	BatchSize    int               // 每批刷新的合约数
+	UseMulticall bool              // 通过 Multicall3.getEthBalance 批量读取，否则使用批量 JSON-RPC eth_getBalance
+	BlockRange   *BlockRangeRecord // 只刷新该创建区块范围内的合约，nil 表示全部
+	StaleAfter   time.Duration     // 只刷新从未刷新或距上次刷新超过该时长的合约，0 表示全部
+}
+
+// RefreshBalances 批量重新读取已存储合约的原生币余额，以 wei 全精度写回 balance 并记录刷新时间
+func (d *Downloader) RefreshBalances(ctx context.Context, opts BalanceRefreshOptions) error {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	conditions := []string{"chain = ?", "address > ?"}
+	var filterArgs []interface{}
+	if opts.BlockRange != nil {
+		cond, args := blockRangeCondition(*opts.BlockRange)
+		conditions = append(conditions, cond)
+		filterArgs = append(filterArgs, args...)
+	}
+	if opts.StaleAfter > 0 {
+		conditions = append(conditions, "(balancetime IS NULL OR balancetime < ?)")
+		filterArgs = append(filterArgs, time.Now().Add(-opts.StaleAfter))
+	}
+	query := fmt.Sprintf("SELECT address FROM contracts WHERE %s ORDER BY address LIMIT %d",
+		strings.Join(conditions, " AND "), opts.BatchSize)
+
+	method := "eth_getBalance 批量请求"
+	if opts.UseMulticall {
+		method = "Multicall3"
+	}
+	log.Printf("💰 开始刷新合约余额（每批 %d 个，%s）...\n", opts.BatchSize, method)
+
+	cursor := ""
+	refreshed, failed, funded := 0, 0, 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		args := append([]interface{}{d.chain, cursor}, filterArgs...)
+		addrs, err := queryStrings(ctx, d.db, query, args...)
+		if err != nil {
+			return fmt.Errorf("查询待刷新合约失败: %w", err)
+		}
+		if len(addrs) == 0 {
+			break
+		}
+		cursor = addrs[len(addrs)-1]
+
+		balances, err := d.fetchBalances(ctx, addrs, opts.UseMulticall)
+		if err != nil {
+			log.Printf("⚠️  获取余额失败（%s 起的 %d 个合约）: %v\n", addrs[0], len(addrs), err)
+			failed += len(addrs)
+			continue
+		}
+
+		n, nonZero, err := d.saveBalances(ctx, balances)
+		if err != nil {
+			return fmt.Errorf("写入余额失败: %w", err)
+		}
+		refreshed += n
+		funded += nonZero
+		failed += len(addrs) - len(balances)
+		log.Printf("💰 已刷新 %d 个合约余额（其中 %d 个非零），当前位置 %s\n", refreshed, funded, cursor)
+	}
+
+	log.Printf("\n✅ 余额刷新完成!\n")
+	log.Printf("   - 已刷新: %d\n", refreshed)
+	log.Printf("   - 余额非零: %d\n", funded)
+	log.Printf("   - 失败: %d\n", failed)
+	return nil
+}
+
+// fetchBalances 批量获取地址的最新余额（wei），单个地址失败时不出现在结果中
+func (d *Downloader) fetchBalances(ctx context.Context, addrs []string, useMulticall bool) (map[string]*big.Int, error) {
+	out := make(map[string]*big.Int, len(addrs))
+
+	if useMulticall {
+		calls := make([]mcCall, len(addrs))
+		for i, a := range addrs {
+			data, err := multicall3ABI.Pack("getEthBalance", common.HexToAddress(a))
+			if err != nil {
+				return nil, err
+			}
+			calls[i] = mcCall{Target: Multicall3Address, CallData: data}
+		}
+		results, err := d.multicall(ctx, calls, nil)
+		if err != nil {
+			return nil, err
+		}
+		for i, r := range results {
+			if r.Success && len(r.ReturnData) >= 32 {
+				out[addrs[i]] = new(big.Int).SetBytes(r.ReturnData[:32])
+			}
+		}
+		return out, nil
+	}
+
+	elems := make([]rpc.BatchElem, len(addrs))
+	results := make([]hexutil.Big, len(addrs))
+	for i, a := range addrs {
+		elems[i] = rpc.BatchElem{
+			Method: "eth_getBalance",
+			Args:   []interface{}{common.HexToAddress(a), "latest"},
+			Result: &results[i],
+		}
+	}
+	if err := d.Client.BatchCallContext(ctx, elems); err != nil {
+		return nil, err
+	}
+	for i, e := range elems {
+		if e.Error != nil {
+			log.Printf("⚠️  获取余额失败: %s -> %v\n", addrs[i], e.Error)
+			continue
+		}
+		out[addrs[i]] = results[i].ToInt()
+	}
+	return out, nil
+}
+
+// saveBalances 在一个事务内写回余额与刷新时间
+func (d *Downloader) saveBalances(ctx context.Context, balances map[string]*big.Int) (updated, nonZero int, err error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, "UPDATE contracts SET balance = ?, balancetime = ? WHERE chain = ? AND address = ?")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	for addr, bal := range balances {
+		if _, err := stmt.ExecContext(ctx, bal.String(), now, d.chain, addr); err != nil {
+			return 0, 0, err
+		}
+		updated++
+		if bal.Sign() > 0 {
+			nonZero++
+		}
+	}
+	return updated, nonZero, tx.Commit()
+}
+
+// blockRangeCondition 构造 createblock 过滤条件（End 为 max uint64 时表示开放结束）
+func blockRangeCondition(r BlockRangeRecord) (string, []interface{}) {
+	if r.End == ^uint64(0) {
+		return "createblock >= ?", []interface{}{int64(r.Start)}
+	}
+	return "createblock BETWEEN ? AND ?", []interface{}{int64(r.Start), int64(r.End)}
+}
@@ -0,0 +1,108 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// BlockscoutProvider 通过 Blockscout v2 API 查询（公共实例或自建实例）
+type BlockscoutProvider struct {
+	baseURL string
+	proxy   string
+}
+
+// NewBlockscoutProvider 创建 Blockscout 来源，baseURL 例如 https://eth.blockscout.com
+func NewBlockscoutProvider(baseURL, proxy string) *BlockscoutProvider {
+	return &BlockscoutProvider{baseURL: strings.TrimRight(baseURL, "/"), proxy: proxy}
+}
+
+// Name 来源名称
+func (p *BlockscoutProvider) Name() string { return ProviderBlockscout }
+
+// blockscoutContract /api/v2/smart-contracts/{address} 响应中用到的字段
+type blockscoutContract struct {
+	IsVerified          bool            `json:"is_verified"`
+	IsFullyVerified     bool            `json:"is_fully_verified"`
+	IsPartiallyVerified bool            `json:"is_partially_verified"`
+	Name                string          `json:"name"`
+	CompilerVersion     string          `json:"compiler_version"`
+	OptimizationEnabled bool            `json:"optimization_enabled"`
+	OptimizationRuns    int             `json:"optimization_runs"`
+	EVMVersion          string          `json:"evm_version"`
+	License             string          `json:"license_type"`
+	ConstructorArgs     string          `json:"constructor_args"`
+	ABI                 json.RawMessage `json:"abi"`
+	Language            string          `json:"language"`
+	CompilerSettings    json.RawMessage `json:"compiler_settings"`
+	FilePath            string          `json:"file_path"`
+	SourceCode          string          `json:"source_code"`
+	AdditionalSources   []struct {
+		FilePath   string `json:"file_path"`
+		SourceCode string `json:"source_code"`
+	} `json:"additional_sources"`
+}
+
+// FetchSource 查询已验证合约，is_verified 为 false 或 404 时视为未验证
+func (p *BlockscoutProvider) FetchSource(ctx context.Context, address string) (*ContractMetadata, error) {
+	url := fmt.Sprintf("%s/api/v2/smart-contracts/%s", p.baseURL, common.HexToAddress(address).Hex())
+	body, status, err := httpGet(ctx, p.proxy, url)
+	if err != nil {
+		return nil, fmt.Errorf("请求 Blockscout 失败: %w", err)
+	}
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("Blockscout 返回非 200 状态: %d", status)
+	}
+
+	var res blockscoutContract
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("解析 Blockscout 响应失败: %w", err)
+	}
+	if !res.IsVerified || strings.TrimSpace(res.SourceCode) == "" {
+		return nil, nil
+	}
+
+	meta := &ContractMetadata{
+		ContractName:         res.Name,
+		CompilerVersion:      res.CompilerVersion,
+		OptimizationUsed:     res.OptimizationEnabled,
+		Runs:                 res.OptimizationRuns,
+		EVMVersion:           res.EVMVersion,
+		License:              res.License,
+		ConstructorArguments: strings.TrimPrefix(res.ConstructorArgs, "0x"),
+		Language:             res.Language,
+		Provider:             ProviderBlockscout,
+		MatchType:            MatchVerified,
+	}
+	if len(res.ABI) > 0 && string(res.ABI) != "null" {
+		meta.ABI = string(res.ABI)
+	}
+	if len(res.CompilerSettings) > 0 && string(res.CompilerSettings) != "null" {
+		meta.Settings = string(res.CompilerSettings)
+	}
+	switch {
+	case res.IsFullyVerified:
+		meta.MatchType = MatchFull
+	case res.IsPartiallyVerified:
+		meta.MatchType = MatchPartial
+	}
+
+	mainPath := res.FilePath
+	if mainPath == "" {
+		mainPath = res.Name + ".sol"
+	}
+	meta.Sources = append(meta.Sources, SourceFile{Path: mainPath, Content: res.SourceCode})
+	for _, s := range res.AdditionalSources {
+		meta.Sources = append(meta.Sources, SourceFile{Path: s.FilePath, Content: s.SourceCode})
+	}
+	sortSourceFiles(meta.Sources)
+	meta.SourceCode = meta.FlattenSources()
+	return meta, nil
+}
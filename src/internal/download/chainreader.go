@@ -0,0 +1,84 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/admi-n/solidity-Excavator/src/config"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ChainReader 下载与扫描流程用到的全部链上查询。默认实现是连接节点的 RPCPool，
+// FixtureReader 回放录制的 JSON-RPC 响应，用于离线复现入库问题或跑完整流程
+type ChainReader interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	BlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]*types.Receipt, error)
+	TransactionSender(ctx context.Context, tx *types.Transaction, block common.Hash, index uint) (common.Address, error)
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+
+	// CallContext / BatchCallContext 原始 JSON-RPC 调用（trace、批量余额与存储槽读取）
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+	BatchCallContext(ctx context.Context, elems []rpc.BatchElem) error
+
+	Close()
+}
+
+var (
+	_ ChainReader = (*RPCPool)(nil)
+	_ ChainReader = (*FixtureReader)(nil)
+)
+
+// ChainReaderOptions 链访问方式，默认连接链注册表中的节点池
+type ChainReaderOptions struct {
+	Fixture string // 非空时回放该录制文件（或目录下全部 .jsonl）中的响应，不连接任何节点
+	Record  string // 非空时把节点的 JSON-RPC 响应追加录制到该文件，供之后用 Fixture 回放
+}
+
+// OpenChainReader 按选项创建链访问实现
+func OpenChainReader(chainCfg config.ChainConfig, opts ChainReaderOptions) (ChainReader, error) {
+	fixture := strings.TrimSpace(opts.Fixture)
+	record := strings.TrimSpace(opts.Record)
+	if fixture != "" && record != "" {
+		return nil, fmt.Errorf("回放与录制不能同时使用")
+	}
+
+	if fixture != "" {
+		reader, err := NewFixtureReader(fixture, chainCfg.ChainID)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("📼 回放录制的 %s 链响应: %s（%d 条）\n", chainCfg.Name, fixture, reader.Size())
+		return reader, nil
+	}
+
+	var rec *FixtureRecorder
+	if record != "" {
+		var err error
+		if rec, err = NewFixtureRecorder(record); err != nil {
+			return nil, err
+		}
+		log.Printf("⏺️  录制 %s 链的 RPC 响应到 %s\n", chainCfg.Name, record)
+	}
+	pool, err := NewRPCPool(chainCfg, DefaultPipelineOptions().RPCRate, rec)
+	if err != nil {
+		if rec != nil {
+			rec.Close()
+		}
+		return nil, err
+	}
+	log.Printf("✅ 成功连接到 %s 节点 (chain id %d): %s\n", chainCfg.Name, chainCfg.ChainID, pool.Names())
+	return pool, nil
+}
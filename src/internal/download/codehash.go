@@ -0,0 +1,136 @@
+package download
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// SplitMetadata 将 runtime 字节码拆分为可执行部分与 solc 追加的 CBOR 元数据尾部。
+// 尾部格式：<CBOR map> <2 字节大端长度>；识别失败时 meta 为 nil、code 原样返回。
+func SplitMetadata(code []byte) (runtime, meta []byte) {
+	if len(code) < 2 {
+		return code, nil
+	}
+	n := int(code[len(code)-2])<<8 | int(code[len(code)-1])
+	if n == 0 || n+2 > len(code) {
+		return code, nil
+	}
+	start := len(code) - 2 - n
+	// CBOR map 头：0xa1 - 0xbf（solc 通常为 0xa1 - 0xa5）
+	if code[start] < 0xa1 || code[start] > 0xbf {
+		return code, nil
+	}
+	return code[:start], code[start : len(code)-2]
+}
+
+// CodeHash 计算 runtime 字节码的 keccak256（0x 前缀十六进制）。
+// stripMetadata 为 true 时先去掉 CBOR 元数据尾部，使仅注释/路径不同的同源合约得到相同哈希。
+func CodeHash(code []byte, stripMetadata bool) string {
+	if len(code) == 0 {
+		return ""
+	}
+	if stripMetadata {
+		code, _ = SplitMetadata(code)
+	}
+	return crypto.Keccak256Hash(code).Hex()
+}
+
+// codeRecord contract_codes 表中按哈希去重的代码记录
+type codeRecord struct {
+	CodeHash     string
+	Source       string
+	IsOpenSource int
+	Checked      bool   // 验证状态已由源码来源确定
+	FirstChain   string // 确定验证状态的链：未验证的结论只对该链成立，其他链的浏览器可能已验证同一份代码
+}
+
+// checkedOn 代码在 chain 上的验证状态是否已确定（已开源对所有链成立）
+func (r *codeRecord) checkedOn(chain string) bool {
+	return r.IsOpenSource == 1 || (r.Checked && r.FirstChain == chain)
+}
+
+// codeCache 本次运行内已解析过的哈希，避免并发 worker 对同一份代码重复请求 Etherscan
+type codeCache struct {
+	mu sync.Mutex
+	m  map[string]*codeRecord
+}
+
+func newCodeCache() *codeCache {
+	return &codeCache{m: make(map[string]*codeRecord)}
+}
+
+func (c *codeCache) get(hash string) *codeRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.m[hash]
+}
+
+func (c *codeCache) put(rec *codeRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[rec.CodeHash] = rec
+}
+
+// lookupCode 查询已见过的代码哈希，返回其验证状态与源码；未见过返回 nil
+func (d *Downloader) lookupCode(ctx context.Context, hash string) (*codeRecord, error) {
+	if hash == "" {
+		return nil, nil
+	}
+	if rec := d.codes.get(hash); rec != nil {
+		return rec, nil
+	}
+
+	var rec codeRecord
+	var source sql.NullString
+	err := d.db.QueryRowContext(ctx,
+		"SELECT code_hash, source, isopensource, checked, firstchain FROM contract_codes WHERE code_hash = ?", hash,
+	).Scan(&rec.CodeHash, &source, &rec.IsOpenSource, &rec.Checked, &rec.FirstChain)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询代码哈希 %s 失败: %w", hash, err)
+	}
+	rec.Source = source.String
+	d.codes.put(&rec)
+	return &rec, nil
+}
+
+// saveCode 在事务内写入/升级 contract_codes：已验证的源码会覆盖未验证记录，反之不会降级；
+// checked 一旦确定不会回退。firstchain / firstaddress 为首次写入的链与地址。首次写入的哈希同时建立函数选择器索引
+func saveCode(ctx context.Context, tx *sql.Tx, chain string, info *ContractInfo) error {
+	if info.CodeHash == "" {
+		return nil
+	}
+	var source interface{}
+	if info.IsOpenSource == 1 {
+		source = info.Contract
+	}
+	_, err := tx.ExecContext(ctx, `
+	INSERT INTO contract_codes (code_hash, bytecode, source, isopensource, checked, firstchain, firstaddress, firstblock)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		source = IF(VALUES(isopensource) = 1 AND isopensource = 0, VALUES(source), source),
+		isopensource = GREATEST(isopensource, VALUES(isopensource)),
+		checked = GREATEST(checked, VALUES(checked))
+	`,
+		info.CodeHash,
+		strings.TrimSpace(info.Bytecode),
+		source,
+		info.IsOpenSource,
+		info.SourceChecked,
+		chain,
+		info.Address,
+		int64(info.CreateBlock),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = saveSelectors(ctx, tx, info.CodeHash, info.Bytecode)
+	return err
+}
@@ -0,0 +1,155 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// CreationInfo init code 拆分为创建字节码与构造参数的结果
+type CreationInfo struct {
+	InitCodeHash    string // 创建字节码的 keccak256（相同的创建字节码只存一份）
+	InitCode        string // 创建字节码（0x 十六进制）；未能拆分时为完整 init code
+	ConstructorArgs string // ABI 编码的构造参数（十六进制，无 0x）
+	Split           bool   // 是否成功拆分出构造参数（构造函数无参数时拆分成功且参数为空）
+}
+
+// newCreationInfo 拆分 init code；没有 init code（日志探测发现的合约）时返回 nil
+func newCreationInfo(initCode, runtime []byte, meta *ContractMetadata) *CreationInfo {
+	if len(initCode) == 0 {
+		return nil
+	}
+	var knownArgs string
+	if meta != nil {
+		knownArgs = meta.ConstructorArguments
+	}
+	creation, args, ok := splitInitCode(initCode, runtime, knownArgs)
+	return &CreationInfo{
+		InitCodeHash:    crypto.Keccak256Hash(creation).Hex(),
+		InitCode:        fmt.Sprintf("0x%x", creation),
+		ConstructorArgs: hex.EncodeToString(args),
+		Split:           ok,
+	}
+}
+
+// splitInitCode 把 init code 拆分为创建字节码与构造参数（构造参数按 ABI 编码追加在末尾）：
+//  1. 源码来源给出了构造参数且 init code 以其结尾时直接按其拆分；
+//  2. 否则找 runtime 字节码的 CBOR 元数据尾部在 init code 中最后出现的位置，之后的内容为构造参数
+//     （runtime 含 immutable 时在 init code 中的内容不同，但元数据尾部相同）；
+//  3. runtime 没有元数据尾部时按 runtime 字节码本身定位。
+//
+// 拆分出的参数长度不是 32 的整数倍时视为失败，此时 creation 为完整 init code
+func splitInitCode(initCode, runtime []byte, knownArgs string) (creation, args []byte, ok bool) {
+	if known := common.FromHex(strings.TrimSpace(knownArgs)); len(known) > 0 && bytes.HasSuffix(initCode, known) {
+		return initCode[:len(initCode)-len(known)], known, true
+	}
+
+	var marker []byte
+	if _, meta := SplitMetadata(runtime); meta != nil {
+		// 元数据 + 2 字节长度
+		marker = runtime[len(runtime)-len(meta)-2:]
+	} else if len(runtime) > 0 {
+		marker = runtime
+	}
+	if len(marker) == 0 {
+		return initCode, nil, false
+	}
+	idx := bytes.LastIndex(initCode, marker)
+	if idx < 0 {
+		return initCode, nil, false
+	}
+	cut := idx + len(marker)
+	if (len(initCode)-cut)%32 != 0 {
+		return initCode, nil, false
+	}
+	return initCode[:cut], initCode[cut:], true
+}
+
+// saveCreation 在事务内写入 contract_creations 与去重的 contract_initcodes
+func saveCreation(ctx context.Context, tx *sql.Tx, chain, address string, c *CreationInfo) error {
+	if c == nil {
+		return nil
+	}
+	// 语料导入时创建字节码在单独的分片中，这里只写 contract_creations
+	if c.InitCode != "" {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT IGNORE INTO contract_initcodes (initcodehash, initcode) VALUES (?, ?)",
+			c.InitCodeHash, c.InitCode); err != nil {
+			return fmt.Errorf("保存创建字节码失败: %w", err)
+		}
+	}
+	var args interface{}
+	if c.Split {
+		args = c.ConstructorArgs
+	}
+	if _, err := tx.ExecContext(ctx, `
+	INSERT INTO contract_creations (chain, address, initcodehash, constructorargs)
+	VALUES (?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		initcodehash = VALUES(initcodehash),
+		constructorargs = VALUES(constructorargs)
+	`, chain, address, c.InitCodeHash, args); err != nil {
+		return fmt.Errorf("保存创建信息失败: %w", err)
+	}
+	return nil
+}
+
+// nonceValue 未知的 nonce 写为 NULL
+func nonceValue(n *uint64) interface{} {
+	if n == nil {
+		return nil
+	}
+	return int64(*n)
+}
+
+// ContractsByDeployer 列出部署者在 chain 上的全部合约：直接部署的合约，以及这些合约（作为工厂）再创建的合约，逐层展开。
+// 旧数据没有 deployer 列时按 factory 匹配内部创建
+func ContractsByDeployer(ctx context.Context, db *sql.DB, chain, deployer string) ([]string, error) {
+	if !common.IsHexAddress(deployer) {
+		return nil, fmt.Errorf("无效的部署者地址: %s", deployer)
+	}
+	root := common.HexToAddress(deployer).Hex()
+	seen := map[string]bool{strings.ToLower(root): true}
+	var out []string
+	frontier := []string{root}
+
+	const batch = 500
+	for len(frontier) > 0 {
+		var next []string
+		for i := 0; i < len(frontier); i += batch {
+			end := i + batch
+			if end > len(frontier) {
+				end = len(frontier)
+			}
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", end-i), ", ")
+			batchArgs := make([]interface{}, 0, end-i)
+			for _, a := range frontier[i:end] {
+				batchArgs = append(batchArgs, a)
+			}
+			args := append([]interface{}{chain}, batchArgs...)
+			args = append(args, batchArgs...)
+			addrs, err := queryStrings(ctx, db, fmt.Sprintf(
+				"SELECT address FROM contracts WHERE chain = ? AND (deployer IN (%[1]s) OR factory IN (%[1]s)) ORDER BY createblock, address",
+				placeholders), args...)
+			if err != nil {
+				return nil, fmt.Errorf("按部署者查询合约失败: %w", err)
+			}
+			for _, a := range addrs {
+				if seen[strings.ToLower(a)] {
+					continue
+				}
+				seen[strings.ToLower(a)] = true
+				out = append(out, a)
+				next = append(next, a)
+			}
+		}
+		frontier = next
+	}
+	return out, nil
+}
@@ -0,0 +1,339 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// 按地址下载（-d -file / mode1 按需下载）的合约查找创建区块的方式
+const (
+	CreationAuto     = "auto"     // 先查浏览器 getcontractcreation，查不到或失败时在归档节点上二分查找
+	CreationExplorer = "explorer" // 只查浏览器
+	CreationArchive  = "archive"  // 按 CodeAt 在历史区块上二分查找首次出现代码的区块（需要归档节点）
+	CreationOff      = "off"      // 不查找，创建区块记为 0
+)
+
+// ValidateCreationLookup 校验 -creation-lookup 参数
+func ValidateCreationLookup(mode string) error {
+	switch mode {
+	case CreationAuto, CreationExplorer, CreationArchive, CreationOff:
+		return nil
+	}
+	return fmt.Errorf("不支持的创建区块查找方式: %s（可选: auto, explorer, archive, off）", mode)
+}
+
+// creationSite 合约的创建位置；Address 为零值时只知道区块（没有找到创建交易）
+type creationSite struct {
+	createdContract
+	Block uint64
+	Time  time.Time
+}
+
+// apply 用创建位置补全按地址下载的合约信息
+func (s *creationSite) apply(info *ContractInfo, code []byte, meta *ContractMetadata) {
+	info.CreateBlock = s.Block
+	info.CreateTime = s.Time
+	info.TxLast = s.Time
+	if s.TxHash != (common.Hash{}) {
+		info.CreationTx = s.TxHash.Hex()
+	}
+	if s.Factory != (common.Address{}) {
+		info.Factory = s.Factory.Hex()
+	}
+	if s.Deployer != (common.Address{}) {
+		info.Deployer = s.Deployer.Hex()
+	}
+	info.Nonce = s.Nonce
+	info.Creation = newCreationInfo(s.InitCode, code, meta)
+}
+
+// locateCreation 按 mode 查找合约的创建区块与创建交易；code 为当前字节码，hint 为已查到的浏览器结果（可为 nil）。
+// 找不到时返回 nil, nil
+func (d *Downloader) locateCreation(ctx context.Context, addr common.Address, code []byte, mode string, hint *etherscanCreation) (*creationSite, error) {
+	if mode == CreationOff {
+		return nil, nil
+	}
+
+	var explorerErr error
+	if mode == CreationAuto || mode == CreationExplorer {
+		if hint == nil {
+			found, err := d.explorerCreations(ctx, []string{addr.Hex()})
+			if err != nil && !errors.Is(err, ErrNoEtherscanKey) {
+				explorerErr = err
+			}
+			if h, ok := found[strings.ToLower(addr.Hex())]; ok {
+				hint = &h
+			}
+		}
+		if hint != nil {
+			site, err := d.creationFromExplorer(ctx, addr, *hint)
+			if err == nil {
+				return site, nil
+			}
+			explorerErr = err
+		}
+		if mode == CreationExplorer {
+			return nil, explorerErr
+		}
+	}
+
+	// 当前已无代码（自毁或 EOA）时无法二分
+	if len(code) == 0 {
+		return nil, explorerErr
+	}
+	block, err := d.searchCreationBlock(ctx, addr)
+	if err != nil {
+		if explorerErr != nil {
+			return nil, fmt.Errorf("浏览器: %v; 归档节点: %w", explorerErr, err)
+		}
+		return nil, err
+	}
+	return d.creationInBlock(ctx, addr, block, nil)
+}
+
+// explorerCreations 通过浏览器批量查询创建交易，限流、key 无效时换 key 重试
+func (d *Downloader) explorerCreations(ctx context.Context, addresses []string) (map[string]etherscanCreation, error) {
+	if d.etherscanKeys == nil || d.etherscanKeys.Size() == 0 {
+		return nil, ErrNoEtherscanKey
+	}
+	var lastErr error
+	for attempt := 0; attempt < d.etherscanKeys.Size()+2; attempt++ {
+		k, err := d.etherscanKeys.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cfg := d.etherscanConfig
+		cfg.APIKey = k.value
+		found, err := fetchContractCreations(ctx, addresses, cfg)
+		if err == nil {
+			return found, nil
+		}
+		d.etherscanKeys.Report(k, err)
+		lastErr = err
+		if !isRetryableEtherscanErr(err) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// creationFromExplorer 按浏览器给出的创建交易定位区块（旧接口不返回区块号时读取交易收据）
+func (d *Downloader) creationFromExplorer(ctx context.Context, addr common.Address, h etherscanCreation) (*creationSite, error) {
+	var block uint64
+	if n, err := strconv.ParseUint(strings.TrimSpace(h.BlockNumber), 10, 64); err == nil && n > 0 {
+		block = n
+	} else {
+		var receipt *types.Receipt
+		if err := d.Client.CallContext(ctx, &receipt, "eth_getTransactionReceipt", common.HexToHash(h.TxHash)); err != nil {
+			return nil, fmt.Errorf("获取创建交易 %s 的收据失败: %w", h.TxHash, err)
+		}
+		if receipt == nil || receipt.BlockNumber == nil {
+			return nil, fmt.Errorf("节点上找不到创建交易 %s", h.TxHash)
+		}
+		block = receipt.BlockNumber.Uint64()
+	}
+	return d.creationInBlock(ctx, addr, block, &h)
+}
+
+// searchCreationBlock 在 [0, 最新区块] 上二分查找首次出现代码的区块。
+// 非归档节点读取不到历史状态会直接报错；同一地址自毁后又经 CREATE2 重新部署时得到的是其中一次部署
+func (d *Downloader) searchCreationBlock(ctx context.Context, addr common.Address) (uint64, error) {
+	head, err := d.Client.BlockNumber(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("获取最新区块失败: %w", err)
+	}
+	lo, hi := uint64(0), head
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		code, err := d.Client.CodeAt(ctx, addr, new(big.Int).SetUint64(mid))
+		if err != nil {
+			return 0, fmt.Errorf("读取区块 %d 的历史代码失败（需要归档节点）: %w", mid, err)
+		}
+		if len(code) > 0 {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return hi, nil
+}
+
+// creationInBlock 在区块内找出创建该合约的交易：先看顶层创建交易，再按 -trace 方式查内部创建；
+// 都找不到时按浏览器结果（可为 nil）填写创建交易与创建者
+func (d *Downloader) creationInBlock(ctx context.Context, addr common.Address, blockNum uint64, hint *etherscanCreation) (*creationSite, error) {
+	block, err := d.Client.BlockByNumber(ctx, new(big.Int).SetUint64(blockNum))
+	if err != nil {
+		return nil, fmt.Errorf("获取区块 %d 失败: %w", blockNum, err)
+	}
+	site := &creationSite{Block: blockNum, Time: time.Unix(int64(block.Time()), 0)}
+
+	var creations []*types.Transaction
+	txIndex := make(map[common.Hash]int)
+	for i, tx := range block.Transactions() {
+		if tx.To() == nil {
+			creations = append(creations, tx)
+			txIndex[tx.Hash()] = i
+		}
+	}
+	if len(creations) > 0 {
+		receipts, err := d.fetchReceipts(ctx, blockNum, creations)
+		if err != nil {
+			return nil, fmt.Errorf("获取交易收据失败: %w", err)
+		}
+		for _, tx := range creations {
+			if r := receipts[tx.Hash()]; r == nil || r.ContractAddress != addr {
+				continue
+			}
+			from, err := d.Client.TransactionSender(ctx, tx, block.Hash(), uint(txIndex[tx.Hash()]))
+			if err != nil {
+				log.Printf("⚠️  获取创建交易 %s 的发送方失败: %v\n", tx.Hash().Hex(), err)
+			}
+			nonce := tx.Nonce()
+			site.createdContract = createdContract{Address: addr, TxHash: tx.Hash(), Deployer: from, Nonce: &nonce, InitCode: tx.Data()}
+			return site, nil
+		}
+	}
+
+	internals, err := d.discoverInternalCreations(ctx, block)
+	if err != nil {
+		log.Printf("⚠️  查找区块 %d 的内部创建失败: %v\n", blockNum, err)
+	}
+	for _, c := range internals {
+		if c.Address == addr {
+			site.createdContract = c
+			return site, nil
+		}
+	}
+
+	if hint != nil {
+		site.Address = addr
+		site.TxHash = common.HexToHash(hint.TxHash)
+		site.Deployer = common.HexToAddress(hint.ContractCreator)
+	}
+	return site, nil
+}
+
+// BackfillCreations 为创建区块为 0 的已入库合约（升级前按地址下载的合约）查找创建区块、创建交易与部署者，
+// 按 -creation-lookup 的方式查找；找不到的保持为 0，下次运行重新查找
+func (d *Downloader) BackfillCreations(ctx context.Context, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	if d.pipeline.CreationLookup == CreationOff {
+		return fmt.Errorf("-creation-lookup off 时无法回填创建区块")
+	}
+
+	log.Printf("🔎 开始回填创建区块为 0 的合约...\n")
+	var total, found, missing, failed int
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		addrs, err := queryStrings(ctx, d.db,
+			fmt.Sprintf("SELECT address FROM contracts WHERE chain = ? AND createblock = 0 AND address > ? ORDER BY address LIMIT %d", batchSize),
+			d.chain, cursor)
+		if err != nil {
+			return fmt.Errorf("查询待回填合约失败: %w", err)
+		}
+		if len(addrs) == 0 {
+			break
+		}
+		cursor = addrs[len(addrs)-1]
+
+		// 浏览器一次最多查询 5 个地址；批量查询成功后，没有结果的地址直接在归档节点上二分
+		mode := d.pipeline.CreationLookup
+		hints := make(map[string]etherscanCreation)
+		if mode != CreationArchive {
+			var explorerErr error
+			for _, chunk := range chunkStrings(addrs, 5) {
+				res, err := d.explorerCreations(ctx, chunk)
+				if err != nil {
+					explorerErr = err
+					if !errors.Is(err, ErrNoEtherscanKey) {
+						log.Printf("⚠️  浏览器查询创建交易失败: %v\n", err)
+					}
+					break
+				}
+				for k, v := range res {
+					hints[k] = v
+				}
+			}
+			if explorerErr == nil && mode == CreationAuto {
+				mode = CreationArchive
+			}
+		}
+
+		for _, addr := range addrs {
+			total++
+			var hint *etherscanCreation
+			if h, ok := hints[strings.ToLower(addr)]; ok {
+				hint = &h
+			}
+			site, err := d.backfillCreation(ctx, addr, mode, hint)
+			switch {
+			case err != nil:
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				failed++
+				log.Printf("⚠️  回填 %s 失败: %v\n", addr, err)
+			case site == nil:
+				missing++
+			default:
+				found++
+			}
+		}
+		log.Printf("🔎 已处理 %d 个合约（找到 %d，未找到 %d，失败 %d），当前位置 %s\n", total, found, missing, failed, cursor)
+	}
+
+	log.Printf("\n✅ 创建区块回填完成: 共 %d 个合约\n", total)
+	log.Printf("   - 已回填: %d\n", found)
+	log.Printf("   - 未找到: %d\n", missing)
+	log.Printf("   - 失败: %d\n", failed)
+	return nil
+}
+
+// backfillCreation 查找并写入单个合约的创建位置，找不到时返回 nil, nil
+func (d *Downloader) backfillCreation(ctx context.Context, address, mode string, hint *etherscanCreation) (*creationSite, error) {
+	addr := common.HexToAddress(address)
+	code, err := d.Client.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取合约字节码失败: %w", err)
+	}
+	if hint != nil && mode == CreationArchive {
+		mode = CreationAuto
+	}
+	site, err := d.locateCreation(ctx, addr, code, mode, hint)
+	if err != nil || site == nil || site.Block == 0 {
+		return nil, err
+	}
+
+	info := &ContractInfo{Address: address}
+	site.apply(info, code, nil)
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `
+	UPDATE contracts SET createblock = ?, createtime = ?, creationtx = ?, deployer = ?, factory = ?, nonce = ?
+	WHERE chain = ? AND address = ? AND createblock = 0`,
+		info.CreateBlock, info.CreateTime, info.CreationTx, info.Deployer, info.Factory, nonceValue(info.Nonce),
+		d.chain, address); err != nil {
+		return nil, fmt.Errorf("更新创建区块失败: %w", err)
+	}
+	if err := saveCreation(ctx, tx, d.chain, address, info.Creation); err != nil {
+		return nil, err
+	}
+	return site, tx.Commit()
+}
@@ -3,46 +3,67 @@ package download
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"log"
-	"math/big"
-	"os"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/admi-n/solidity-Excavator/src/config"
 	"github.com/admi-n/solidity-Excavator/src/internal"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
 )
 
 // ContractInfo 合约信息结构体
 type ContractInfo struct {
-	Address      string
-	Contract     string
-	Balance      string
-	IsOpenSource int
-	CreateTime   time.Time
-	CreateBlock  uint64
-	TxLast       time.Time
-	IsDecompiled int
-	DedCode      string
+	Address       string
+	Contract      string
+	Balance       string // 原生币余额（wei，十进制字符串）
+	IsOpenSource  int
+	SourceChecked bool // 验证状态是否已由源码来源确定（查询失败时为 false）
+	CreateTime    time.Time
+	CreateBlock   uint64
+	TxLast        time.Time
+	IsDecompiled  int
+	DedCode       string
+	Factory       string            // 工厂合约地址（由合约内部 CREATE/CREATE2 创建时），顶层创建为空
+	CreationTx    string            // 创建交易哈希
+	Deployer      string            // 部署者：顶层创建为交易发送方，内部创建为工厂合约
+	Nonce         *uint64           // 顶层创建交易的 nonce，未知为 nil
+	Creation      *CreationInfo     // init code 拆分结果，非 nil 时写入 contract_creations
+	CodeHash      string            // runtime 字节码 keccak256（可选去掉 CBOR 元数据尾部）
+	Bytecode      string            // runtime 字节码（0x 十六进制），写入去重的 contract_codes 表
+	Metadata      *ContractMetadata // 本次查询到的源码元数据，非 nil 时写入 contract_metadata / contract_sources / contract_address_metadata
+	Proxy         *ProxyInfo        // 识别出的代理 -> 实现关联，非 nil 时写入 contract_proxies
 }
 
 // Downloader 下载器
 type Downloader struct {
-	Client          *ethclient.Client
-	db              *sql.DB
-	etherscanConfig EtherscanConfig
-	rateLimiter     *RateLimiter
+	Client          ChainReader          // 链上查询：默认为该链的 RPC 节点池，也可以回放录制的响应
+	store           config.ContractStore // 合约库（MySQL / SQLite）
+	db              *sql.DB              // store 的连接池，辅助表直接执行 SQL
+	etherscanConfig EtherscanConfig      // BaseURL 与代理，APIKey 由 etherscanKeys 按请求分配
+	etherscanKeys   *KeyPool
+	chain           string             // 所属链名：写入的合约、下载进度与失败队列都按链区分
+	chainCfg        config.ChainConfig // 链注册表中的配置
+	providers       []SourceProvider   // 源码来源，按顺序尝试
+
+	pipeline        PipelineOptions // 并行下载参数
+	noBlockReceipts atomic.Bool     // 节点不支持 eth_getBlockReceipts 时置位
+	traceResolved   atomic.Value    // auto 模式下探测到的可用 trace 方式
+
+	stripMetadata bool       // 计算 code_hash 时是否去掉 CBOR 元数据尾部
+	codes         *codeCache // 本次运行已解析的代码哈希
+	recordHashes  bool       // 跟随模式下记录区块哈希用于重组检测
 }
 
-// NewDownloader 创建下载器（使用配置文件中的 RPC URL）
+// NewDownloader 创建下载器：按链注册表连接该链的 RPC 节点池（chain id 必须与注册表一致），
+// 或按 readerOpts 回放/录制节点响应；
+// 源码查询、下载进度与写入的合约都归属该链。
 // 新增 proxy 参数，若 proxy 非空，会设置全局 HTTP Transport 的代理并传入 etherscan 配置
-func NewDownloader(db *sql.DB, proxy string) (*Downloader, error) {
-	if db == nil {
+func NewDownloader(store config.ContractStore, chain, proxy string, readerOpts ChainReaderOptions) (*Downloader, error) {
+	if store == nil {
 		return nil, fmt.Errorf("数据库连接不能为 nil")
 	}
 
@@ -53,33 +74,53 @@ func NewDownloader(db *sql.DB, proxy string) (*Downloader, error) {
 		}
 	}
 
-	// 从配置文件获取 RPC URL
-	rpcURL, err := config.GetRPCURL()
+	chainCfg, err := config.GetChain(chain)
 	if err != nil {
-		return nil, fmt.Errorf("获取 RPC URL 失败: %w", err)
+		return nil, err
 	}
 
-	// 连接以太坊节点（使用默认 transport，若上面设置了 proxy，则会生效）
-	client, err := ethclient.Dial(rpcURL)
+	// 连接节点（使用默认 transport，若上面设置了 proxy，则会生效）
+	reader, err := OpenChainReader(chainCfg, readerOpts)
 	if err != nil {
-		return nil, fmt.Errorf("连接以太坊节点失败: %w", err)
+		return nil, err
 	}
 
-	log.Printf("✅ 成功连接到以太坊节点: %s\n", rpcURL)
-
-	// 初始化 etherscan 配置（从 config 常量读取），并注入 proxy
+	// 初始化 etherscan 配置与 key 池，并注入 proxy
 	ethersCfg := EtherscanConfig{
-		APIKey:  config.EtherscanAPIKey,
-		BaseURL: config.EtherscanBaseURL,
+		BaseURL: chainCfg.ExplorerAPI,
+		ChainID: chainCfg.ChainID,
 		Proxy:   strings.TrimSpace(proxy),
 	}
+	keys := NewKeyPool(config.GetEtherscanKeys(), config.GetEtherscanRatePerKey())
+	log.Printf("🔑 已加载 %d 个 Etherscan API key\n", keys.Size())
+
+	sources := config.GetSourceSettings()
+	sources.BlockscoutURL = chainCfg.BlockscoutURL
+	providers, err := newSourceProviders(sources, ethersCfg, keys, int64(chainCfg.ChainID))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("📚 源码来源: %s\n", providerNames(providers))
 
-	return &Downloader{
-		Client:          client,
-		db:              db,
+	d := &Downloader{
+		Client:          reader,
+		store:           store,
+		db:              store.DB(),
 		etherscanConfig: ethersCfg,
-		rateLimiter:     NewRateLimiter(5), // 可调整速率
-	}, nil
+		etherscanKeys:   keys,
+		providers:       providers,
+		chain:           chainCfg.Name,
+		chainCfg:        chainCfg,
+		stripMetadata:   true,
+		codes:           newCodeCache(),
+	}
+	d.SetPipelineOptions(DefaultPipelineOptions())
+	return d, nil
+}
+
+// Chain 返回下载器所属链的配置
+func (d *Downloader) Chain() config.ChainConfig {
+	return d.chainCfg
 }
 
 // GetCurrentBlock 获取当前最新区块号
@@ -89,42 +130,97 @@ func (d *Downloader) GetCurrentBlock(ctx context.Context) (uint64, error) {
 
 // GetLastDownloadedBlock 获取数据库中最后下载的区块号
 func (d *Downloader) GetLastDownloadedBlock(ctx context.Context) (uint64, error) {
-	var maxBlock sql.NullInt64
-	err := d.db.QueryRowContext(ctx, "SELECT MAX(createblock) FROM contracts").Scan(&maxBlock)
+	n, err := d.store.LastCreateBlock(ctx, d.chain)
 	if err != nil {
 		return 0, fmt.Errorf("查询最后下载区块失败: %w", err)
 	}
-	if !maxBlock.Valid {
-		return 0, nil
-	}
-	return uint64(maxBlock.Int64), nil
+	return n, nil
 }
 
 // ContractExists 检查合约是否已存在
 func (d *Downloader) ContractExists(ctx context.Context, address string) (bool, error) {
-	var count int
-	err := d.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM contracts WHERE address = ?", address).Scan(&count)
+	return d.store.ContractExists(ctx, d.chain, address)
+}
+
+// SetStripMetadata 设置计算 code_hash 时是否去掉 CBOR 元数据尾部（同一个库应保持一致）
+func (d *Downloader) SetStripMetadata(strip bool) {
+	d.stripMetadata = strip
+}
+
+// SaveContract 保存合约信息到数据库（同一事务内写入按哈希去重的 contract_codes）
+func (d *Downloader) SaveContract(ctx context.Context, info *ContractInfo) error {
+	return d.saveContracts(ctx, []*ContractInfo{info})
+}
+
+// saveContracts 在一个事务内保存一批合约（同一区块的合约要么全部入库，要么全部不入库）
+func (d *Downloader) saveContracts(ctx context.Context, infos []*ContractInfo) error {
+	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
-		return false, err
+		return err
 	}
-	return count > 0, nil
+	defer tx.Rollback()
+
+	for _, info := range infos {
+		if err := d.saveContractTx(ctx, tx, info); err != nil {
+			return fmt.Errorf("保存合约 %s 失败: %w", info.Address, err)
+		}
+	}
+	return tx.Commit()
 }
 
-// SaveContract 保存合约信息到数据库
-func (d *Downloader) SaveContract(ctx context.Context, info *ContractInfo) error {
+// saveContractTx 在事务内写入单个合约的各表记录
+func (d *Downloader) saveContractTx(ctx context.Context, tx *sql.Tx, info *ContractInfo) error {
+	if err := saveContractRow(ctx, tx, d.chain, info); err != nil {
+		return err
+	}
+	if err := saveCode(ctx, tx, d.chain, info); err != nil {
+		return fmt.Errorf("保存代码哈希失败: %w", err)
+	}
+	if err := saveMetadata(ctx, tx, d.chain, info.CodeHash, info.Address, info.Metadata); err != nil {
+		return err
+	}
+	if err := saveProxy(ctx, tx, d.chain, info.Address, info.Proxy); err != nil {
+		return err
+	}
+	if err := saveCreation(ctx, tx, d.chain, info.Address, info.Creation); err != nil {
+		return err
+	}
+	return classifyInfo(ctx, tx, d.chain, info)
+}
+
+// saveContractRow 在事务内插入或更新 contracts 表中 (chain, address) 对应的一行
+func saveContractRow(ctx context.Context, tx *sql.Tx, chain string, info *ContractInfo) error {
 	query := `
-	INSERT INTO contracts (address, contract, balance, isopensource, createtime, createblock, txlast, isdecompiled, dedcode)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO contracts (chain, address, contract, balance, balancetime, isopensource, createtime, createblock, txlast, isdecompiled, dedcode, decompiledat, factory, creationtx, code_hash,
+		solcversion, metahashkind, metahash, experimental, deployer, nonce)
+	VALUES (?, ?, ?, ?, NOW(), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	ON DUPLICATE KEY UPDATE 
 		contract = VALUES(contract),
 		balance = VALUES(balance),
+		balancetime = VALUES(balancetime),
 		isopensource = VALUES(isopensource),
-		txlast = VALUES(txlast),
+		txlast = GREATEST(txlast, VALUES(txlast)),
 		isdecompiled = VALUES(isdecompiled),
-		dedcode = VALUES(dedcode)
+		dedcode = VALUES(dedcode),
+		decompiledat = VALUES(decompiledat),
+		factory = COALESCE(NULLIF(VALUES(factory), ''), factory),
+		creationtx = COALESCE(NULLIF(VALUES(creationtx), ''), creationtx),
+		code_hash = COALESCE(NULLIF(VALUES(code_hash), ''), code_hash),
+		solcversion = IF(VALUES(metahashkind) IS NULL, solcversion, VALUES(solcversion)),
+		metahash = IF(VALUES(metahashkind) IS NULL, metahash, VALUES(metahash)),
+		experimental = IF(VALUES(metahashkind) IS NULL, experimental, VALUES(experimental)),
+		metahashkind = COALESCE(VALUES(metahashkind), metahashkind),
+		deployer = COALESCE(NULLIF(VALUES(deployer), ''), deployer),
+		nonce = COALESCE(VALUES(nonce), nonce)
 	`
 
-	_, err := d.db.ExecContext(ctx, query,
+	solc, kind, hash, experimental := bytecodeMetadataColumns(info)
+	var decompiledAt interface{}
+	if info.DedCode != "" {
+		decompiledAt = time.Now()
+	}
+	_, err := tx.ExecContext(ctx, query,
+		chain,
 		info.Address,
 		info.Contract,
 		info.Balance,
@@ -134,98 +230,84 @@ func (d *Downloader) SaveContract(ctx context.Context, info *ContractInfo) error
 		info.TxLast,
 		info.IsDecompiled,
 		info.DedCode,
+		decompiledAt,
+		info.Factory,
+		info.CreationTx,
+		info.CodeHash,
+		solc,
+		kind,
+		hash,
+		experimental,
+		info.Deployer,
+		nonceValue(info.Nonce),
 	)
-
 	return err
 }
 
-// IsBlockDownloaded 检查区块是否已下载
-func (d *Downloader) IsBlockDownloaded(ctx context.Context, blockNum uint64) (bool, error) {
-	var count int
-	err := d.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM contracts WHERE createblock = ?", int64(blockNum)).Scan(&count)
-	if err != nil {
-		return false, err
+// bytecodeMetadataColumns 由本行的 runtime 字节码（Bytecode，未开源时也可能在 Contract 中）解析 CBOR 元数据列。
+// 拿不到字节码时 metahashkind 为 NULL，表示尚未解析（见 -d -decode-metadata）；已解析但没有尾部时为空串
+func bytecodeMetadataColumns(info *ContractInfo) (solc, kind, hash interface{}, experimental int) {
+	code := strings.TrimSpace(info.Bytecode)
+	if code == "" && info.IsOpenSource == 0 && strings.HasPrefix(info.Contract, "0x") {
+		code = strings.TrimSpace(info.Contract)
 	}
-	return count > 0, nil
-}
-
-// helper: 将失败地址追加到文件（每行一个），忽略写入错误但记录日志
-func appendFailAddress(failFile, addr string) {
-	if strings.TrimSpace(failFile) == "" || strings.TrimSpace(addr) == "" {
-		return
+	if code == "" {
+		return nil, nil, nil, 0
 	}
-	f, err := os.OpenFile(failFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		log.Printf("⚠️  无法打开失败记录文件 %s: %v\n", failFile, err)
-		return
+	m := DecodeMetadata(common.FromHex(code))
+	if m == nil {
+		return nil, "", nil, 0
 	}
-	defer f.Close()
-	if _, err := f.WriteString(strings.TrimSpace(addr) + "\n"); err != nil {
-		log.Printf("⚠️  无法写入失败记录文件 %s: %v\n", failFile, err)
+	if m.SolcVersion != "" {
+		solc = m.SolcVersion
 	}
+	if m.Hash != "" {
+		hash = m.Hash
+	}
+	if m.Experimental {
+		experimental = 1
+	}
+	return solc, m.HashKind, hash, experimental
 }
 
-// 新增：记录已下载区块区间的结构与文件路径
-type BlockRangeRecord struct {
-	Start uint64 `json:"start"`
-	End   uint64 `json:"end"`
-}
-
-const blockedFile = "blocked.json" // 可修改为其他路径
-
-// loadBlockedRanges 从 blocked.json 读取已下载区间（若文件不存在，返回空切片）
-func loadBlockedRanges() ([]BlockRangeRecord, error) {
-	bs, err := os.ReadFile(blockedFile)
+// queryStrings 执行只返回单个字符串列的查询
+func queryStrings(ctx context.Context, db queryer, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("读取 %s 失败: %w", blockedFile, err)
+		return nil, err
 	}
-	var recs []BlockRangeRecord
-	if err := json.Unmarshal(bs, &recs); err != nil {
-		return nil, fmt.Errorf("解析 %s 失败: %w", blockedFile, err)
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
 	}
-	return recs, nil
+	return out, rows.Err()
 }
 
-// saveBlockedRanges 将合并后的区间写回 blocked.json
-func saveBlockedRanges(recs []BlockRangeRecord) error {
-	bs, err := json.MarshalIndent(recs, "", "  ")
-	if err != nil {
-		return fmt.Errorf("序列化 blocked ranges 失败: %w", err)
+// IsBlockDownloaded 检查区块是否已下载：落在 download_progress 的区间内（没有合约的区块也算），
+// 或数据库中已有该区块创建的合约
+func (d *Downloader) IsBlockDownloaded(ctx context.Context, blockNum uint64) (bool, error) {
+	covered, err := d.blockCovered(ctx, blockNum)
+	if err != nil || covered {
+		return covered, err
 	}
-	if err := os.WriteFile(blockedFile, bs, 0o644); err != nil {
-		return fmt.Errorf("写入 %s 失败: %w", blockedFile, err)
+	var count int
+	err = d.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM contracts WHERE chain = ? AND createblock = ?", d.chain, int64(blockNum)).Scan(&count)
+	if err != nil {
+		return false, err
 	}
-	return nil
+	return count > 0, nil
 }
 
-// mergeAndInsertRange 将 newRange 并入 existing 并返回合并后的区间列表（按 start 排序且不重叠）
-func mergeAndInsertRange(existing []BlockRangeRecord, newRange BlockRangeRecord) []BlockRangeRecord {
-	existing = append(existing, newRange)
-	if len(existing) == 0 {
-		return existing
-	}
-	// 按 Start 排序
-	sort.Slice(existing, func(i, j int) bool {
-		return existing[i].Start < existing[j].Start
-	})
-	merged := make([]BlockRangeRecord, 0, len(existing))
-	curr := existing[0]
-	for i := 1; i < len(existing); i++ {
-		r := existing[i]
-		if r.Start <= curr.End+1 { // 重叠或相邻 -> 合并
-			if r.End > curr.End {
-				curr.End = r.End
-			}
-		} else {
-			merged = append(merged, curr)
-			curr = r
-		}
-	}
-	merged = append(merged, curr)
-	return merged
+// BlockRangeRecord 区块区间（含两端）
+type BlockRangeRecord struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
 }
 
 // getUncoveredRanges 返回请求区间 requestRange 在 existingRanges 中未覆盖的子区间列表（按升序）
@@ -294,12 +376,12 @@ func minUint64(a, b uint64) uint64 {
 	return b
 }
 
-// DownloadBlockRange 下载指定区块范围的合约（改为按未覆盖子区间下载并记录 blocked.json）
+// DownloadBlockRange 下载指定区块范围的合约（按未覆盖子区间并行下载并记录 download_progress）
 func (d *Downloader) DownloadBlockRange(ctx context.Context, startBlock, endBlock uint64) error {
 	log.Printf("🔍 开始下载区块 %d 到 %d...\n", startBlock, endBlock)
 
 	// 读取已下载区间记录
-	existing, err := loadBlockedRanges()
+	existing, err := d.loadProgress(ctx)
 	if err != nil {
 		log.Printf("⚠️  读取已下载区间失败: %v（继续，但可能重复下载）\n", err)
 		// 继续使用 empty existing
@@ -312,157 +394,33 @@ func (d *Downloader) DownloadBlockRange(ctx context.Context, startBlock, endBloc
 		return nil
 	}
 
-	totalContracts := 0
-	skippedBlocks := 0
+	opts := d.pipeline.normalize()
+	log.Printf("⚙️  并发 worker: %d, RPC 预算: %d 次/秒\n", opts.Workers, opts.RPCRate)
 
-	// 对每个未覆盖的子区间依次下载，子区间完成后合并写入 blocked.json
+	var total pipelineStats
 	for _, sub := range uncovered {
 		log.Printf("🔁 处理未覆盖子区间: %d - %d\n", sub.Start, sub.End)
-		for blockNum := sub.Start; blockNum <= sub.End; blockNum++ {
-			// 检查区块是否已在数据库（谨慎双重判断）
-			downloaded, err := d.IsBlockDownloaded(ctx, blockNum)
-			if err != nil {
-				log.Printf("⚠️  检查区块 %d 状态失败: %v\n", blockNum, err)
-			} else if downloaded {
-				skippedBlocks++
-				if skippedBlocks%100 == 0 {
-					log.Printf("⏭️  已跳过 %d 个已下载的区块...\n", skippedBlocks)
-				}
-				continue
-			}
-
-			// 获取区块数据
-			block, err := d.Client.BlockByNumber(ctx, big.NewInt(int64(blockNum)))
-			if err != nil {
-				log.Printf("❌ 获取区块 %d 失败: %v\n", blockNum, err)
-				continue
-			}
-
-			txCount := len(block.Transactions())
-			if txCount > 0 {
-				log.Printf("📦 处理区块 %d (共 %d 笔交易)...\n", blockNum, txCount)
-			}
-
-			blockTime := time.Unix(int64(block.Time()), 0)
-			contractCount := 0
-
-			// 遍历交易查找合约创建
-			for _, tx := range block.Transactions() {
-				// 合约创建交易的 To 地址为 nil
-				if tx.To() == nil {
-					receipt, err := d.Client.TransactionReceipt(ctx, tx.Hash())
-					if err != nil {
-						log.Printf("⚠️  获取交易收据失败: %v\n", err)
-						continue
-					}
-
-					if receipt.ContractAddress != (common.Address{}) {
-						contractAddr := receipt.ContractAddress.Hex()
-
-						// 再次检查合约是否已存在
-						exists, err := d.ContractExists(ctx, contractAddr)
-						if err != nil {
-							log.Printf("❌ 检查合约存在失败: %v\n", err)
-							continue
-						}
-
-						if exists {
-							continue
-						}
-
-						// 获取合约字节码
-						code, err := d.Client.CodeAt(ctx, receipt.ContractAddress, nil)
-						if err != nil {
-							log.Printf("⚠️  获取合约代码失败: %v\n", err)
-							continue
-						}
-
-						// 声明用于保存的变量，确保在所有分支都有初始值
-						var contractCode string
-						var isOpenSource int
-
-						// 清理地址，去除可能的空格/换行/不可见字符，避免在 URL 拼接时出现问题
-						contractAddr = strings.TrimSpace(contractAddr)
-
-						// 检查 Etherscan 验证状态（若未配置 APIKey 则直接回退为字节码）
-						if d.etherscanConfig.APIKey != "" {
-							sourceCode, isVerified, err := GetContractSource(contractAddr, d.etherscanConfig)
-							if err != nil {
-								// 查询失败时回退为字节码并记录日志
-								log.Printf("⚠️  查询 Etherscan 失败: %v，回退保存字节码\n", err)
-								contractCode = fmt.Sprintf("0x%x", code)
-								isOpenSource = 0
-								// 记录到失败文件
-								appendFailAddress("eoferror.txt", contractAddr)
-							} else if isVerified {
-								contractCode = sourceCode // 保存源代码
-								isOpenSource = 1          // 标记为已开源
-							} else {
-								contractCode = fmt.Sprintf("0x%x", code) // 保存字节码
-								isOpenSource = 0                         // 标记为未开源
-							}
-						} else {
-							// 未配置 Etherscan API key，直接保存字节码
-							contractCode = fmt.Sprintf("0x%x", code)
-							isOpenSource = 0
-						}
-
-						// 获取合约余额
-						balance, err := d.Client.BalanceAt(ctx, receipt.ContractAddress, nil)
-						if err != nil {
-							log.Printf("⚠️  获取余额失败: %v\n", err)
-							balance = big.NewInt(0)
-						}
-
-						balanceEth := new(big.Float).Quo(
-							new(big.Float).SetInt(balance),
-							big.NewFloat(1e18),
-						)
-
-						// 构造合约信息（使用上面确定的 contractCode 与 isOpenSource）
-						info := &ContractInfo{
-							Address:      contractAddr,
-							Contract:     contractCode,
-							Balance:      balanceEth.Text('f', 6),
-							IsOpenSource: isOpenSource,
-							CreateTime:   blockTime,
-							CreateBlock:  blockNum,
-							TxLast:       blockTime,
-							IsDecompiled: 0,  // 默认未反编译
-							DedCode:      "", // 默认空
-						}
-
-						// 保存到数据库
-						if err := d.SaveContract(ctx, info); err != nil {
-							log.Printf("❌ 保存合约失败: %v\n", err)
-							continue
-						}
-
-						contractCount++
-						totalContracts++
-						log.Printf("✅ 发现合约: %s (区块 %d)\n", contractAddr, blockNum)
-					}
-				}
+		stats := d.runBlockPipeline(ctx, sub.Start, sub.End)
+		total.contracts += stats.contracts
+		total.skipped += stats.skipped
+		total.failed += stats.failed
+		total.done += stats.done
+
+		if ctx.Err() != nil {
+			if stats.done > 0 {
+				log.Printf("⏹️  下载被中断，已提交到区块 %d\n", sub.Start+stats.done-1)
+			} else {
+				log.Printf("⏹️  下载被中断，区间 %d - %d 尚未提交任何区块\n", sub.Start, sub.End)
 			}
-
-			// 避免请求过快
-			time.Sleep(50 * time.Millisecond)
-		} // end for blockNum in subrange
-
-		// 子区间完成后，将其合并写入 blocked.json
-		merged := mergeAndInsertRange(existing, BlockRangeRecord{Start: sub.Start, End: sub.End})
-		if err := saveBlockedRanges(merged); err != nil {
-			log.Printf("⚠️  保存已下载区间到 %s 失败: %v\n", blockedFile, err)
-		} else {
-			// 更新内存 existing 为最新（避免下一个子区间重复计算）
-			existing = merged
+			return ctx.Err()
 		}
-	} // end for each sub
+	}
 
 	log.Printf("\n✅ 下载完成!\n")
 	log.Printf("   - 区块范围: %d - %d\n", startBlock, endBlock)
-	log.Printf("   - 新增合约: %d\n", totalContracts)
-	log.Printf("   - 跳过区块: %d\n", skippedBlocks)
+	log.Printf("   - 新增合约: %d\n", total.contracts)
+	log.Printf("   - 跳过区块: %d\n", total.skipped)
+	log.Printf("   - 失败区块: %d（已计入失败队列，下次运行或 -d -retry-failures 重试）\n", total.failed)
 
 	return nil
 }
@@ -503,103 +461,110 @@ func (d *Downloader) DownloadFromLast(ctx context.Context) error {
 
 // Close 关闭连接
 func (d *Downloader) Close() {
+	if d.etherscanKeys != nil {
+		d.etherscanKeys.Stop()
+	}
 	if d.Client != nil {
 		d.Client.Close()
 	}
 }
 
-// 新增：按地址列表下载合约（用于 -d -file <file> 重试）
-func (d *Downloader) DownloadContractsByAddresses(ctx context.Context, addresses []string, failLog string) error {
+// DownloadContractsByAddresses 按地址列表下载合约（-d -file），失败的地址计入 download_failures
+func (d *Downloader) DownloadContractsByAddresses(ctx context.Context, addresses []string) error {
 	if len(addresses) == 0 {
 		return nil
 	}
 
 	seen := make(map[string]struct{})
 	for _, a := range addresses {
-		addr := strings.TrimSpace(a)
-		if addr == "" {
+		a = strings.TrimSpace(a)
+		if a == "" {
 			continue
 		}
-		// 去重
-		if _, ok := seen[strings.ToLower(addr)]; ok {
+		if !common.IsHexAddress(a) {
+			log.Printf("⚠️  跳过无效地址: %s\n", a)
 			continue
 		}
-		seen[strings.ToLower(addr)] = struct{}{}
-
-		// 检查是否已存在
-		exists, err := d.ContractExists(ctx, addr)
-		if err != nil {
-			log.Printf("⚠️  检查合约 %s 是否存在失败: %v\n", addr, err)
-			appendFailAddress(failLog, addr)
+		// 统一为校验和格式后去重
+		addr := common.HexToAddress(a).Hex()
+		if _, ok := seen[addr]; ok {
 			continue
 		}
-		if exists {
-			log.Printf("⏭️  合约已存在，跳过: %s\n", addr)
-			continue
+		seen[addr] = struct{}{}
+
+		if err := d.downloadAddress(ctx, addr); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("⚠️  下载合约失败: %s -> %v\n", addr, err)
+			d.recordFailure(ctx, FailAddress, addr, err)
 		}
+	}
 
-		// 转换为 common.Address
-		caddr := common.HexToAddress(addr)
+	return nil
+}
 
-		// 获取合约字节码
-		code, err := d.Client.CodeAt(ctx, caddr, nil)
-		if err != nil {
-			log.Printf("⚠️  获取合约字节码失败: %s -> %v\n", addr, err)
-			appendFailAddress(failLog, addr)
-			continue
-		}
+// downloadAddress 下载单个地址的合约并入库，已存在时跳过
+func (d *Downloader) downloadAddress(ctx context.Context, addr string) error {
+	// 与区块下载一致按校验和格式入库（SQLite 区分大小写，原样保存会查不到）
+	caddr := common.HexToAddress(strings.TrimSpace(addr))
+	addr = caddr.Hex()
 
-		// 默认值
-		contractCode := fmt.Sprintf("0x%x", code)
-		isOpenSource := 0
-
-		// 如果配置了 Etherscan APIKey，尝试获取源码；网络错误时将地址写入失败文件
-		if d.etherscanConfig.APIKey != "" {
-			sourceCode, isVerified, err := GetContractSource(addr, d.etherscanConfig)
-			if err != nil {
-				log.Printf("⚠️  查询 Etherscan 失败 for %s: %v，回退保存字节码并记录到失败文件\n", addr, err)
-				appendFailAddress(failLog, addr)
-				// 回退保存字节码（contractCode 已为字节码）
-			} else if isVerified {
-				contractCode = sourceCode
-				isOpenSource = 1
-			} else {
-				// 未验证，保持字节码
-			}
-		}
+	// 检查是否已存在
+	exists, err := d.ContractExists(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("检查合约是否存在失败: %w", err)
+	}
+	if exists {
+		log.Printf("⏭️  合约已存在，跳过: %s\n", addr)
+		return nil
+	}
 
-		// 获取余额（不阻塞主流程，失败则置零）
-		balance, err := d.Client.BalanceAt(ctx, caddr, nil)
-		if err != nil {
-			log.Printf("⚠️  获取余额失败: %s -> %v\n", addr, err)
-			balance = big.NewInt(0)
-		}
-		balanceEth := new(big.Float).Quo(new(big.Float).SetInt(balance), big.NewFloat(1e18))
-
-		info := &ContractInfo{
-			Address:      addr,
-			Contract:     contractCode,
-			Balance:      balanceEth.Text('f', 6),
-			IsOpenSource: isOpenSource,
-			CreateTime:   time.Now(),
-			CreateBlock:  0,
-			TxLast:       time.Now(),
-			IsDecompiled: 0,
-			DedCode:      "",
-		}
+	// 获取合约字节码
+	code, err := d.Client.CodeAt(ctx, caddr, nil)
+	if err != nil {
+		return fmt.Errorf("获取合约字节码失败: %w", err)
+	}
 
-		// 保存到数据库
-		if err := d.SaveContract(ctx, info); err != nil {
-			log.Printf("❌ 保存合约失败: %s -> %v\n", addr, err)
-			appendFailAddress(failLog, addr)
-			continue
-		}
+	// 相同代码哈希直接复用已知的验证状态；否则依次向源码来源查询，
+	// 查询失败时计入失败队列并回退保存字节码
+	rc := d.resolveCode(ctx, addr, code)
+	proxy, err := d.detectProxy(ctx, caddr, code, rc.Meta)
+	if err != nil {
+		log.Printf("⚠️  识别代理失败: %s -> %v\n", addr, err)
+	}
+
+	// 按地址下载的合约没有所在区块，通过浏览器或归档节点查找；找不到时创建区块记为 0，之后可用 -d -backfill-creation 补查
+	site, err := d.locateCreation(ctx, caddr, code, d.pipeline.CreationLookup, nil)
+	if err != nil {
+		log.Printf("⚠️  查找创建区块失败: %s -> %v\n", addr, err)
+	}
 
-		log.Printf("✅ 重试下载合约成功: %s\n", addr)
+	info := &ContractInfo{
+		Address:       addr,
+		Contract:      rc.Contract,
+		Balance:       d.fetchBalance(ctx, caddr),
+		IsOpenSource:  rc.IsOpenSource,
+		SourceChecked: rc.Checked,
+		CreateTime:    time.Now(),
+		CreateBlock:   0,
+		TxLast:        time.Now(),
+		IsDecompiled:  0,
+		DedCode:       "",
+		CodeHash:      rc.Hash,
+		Bytecode:      fmt.Sprintf("0x%x", code),
+		Metadata:      rc.Meta,
+		Proxy:         proxy,
+	}
+	if site != nil {
+		site.apply(info, code, rc.Meta)
+	}
 
-		// 为了避免速率过快，可在此加入短暂停顿或使用 d.rateLimiter.Wait()
-		time.Sleep(100 * time.Millisecond)
+	// 保存到数据库
+	if err := d.SaveContract(ctx, info); err != nil {
+		return fmt.Errorf("保存合约失败: %w", err)
 	}
 
+	log.Printf("✅ 下载合约成功: %s\n", addr)
 	return nil
 }
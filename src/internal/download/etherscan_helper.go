@@ -1,12 +1,15 @@
 package download
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,43 +20,76 @@ import (
 type EtherscanConfig struct {
 	APIKey  string
 	BaseURL string
+	ChainID uint64 // Etherscan v2 的 chainid 参数，0 时按以太坊主网查询
 	Proxy   string // 新增：可选的 HTTP 代理 URL（例如 http://127.0.0.1:7897）
 }
 
 // EtherscanResponse Etherscan API 响应结构
 type EtherscanResponse struct {
-	Status  string `json:"status"`
-	Message string `json:"message"`
-	Result  []struct {
-		SourceCode           string `json:"SourceCode"`
-		ABI                  string `json:"ABI"`
-		ContractName         string `json:"ContractName"`
-		CompilerVersion      string `json:"CompilerVersion"`
-		OptimizationUsed     string `json:"OptimizationUsed"`
-		Runs                 string `json:"Runs"`
-		ConstructorArguments string `json:"ConstructorArguments"`
-		EVMVersion           string `json:"EVMVersion"`
-		Library              string `json:"Library"`
-		LicenseType          string `json:"LicenseType"`
-		Proxy                string `json:"Proxy"`
-		Implementation       string `json:"Implementation"`
-		SwarmSource          string `json:"SwarmSource"`
-	} `json:"result"`
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"` // 成功时为结果数组，出错时为错误描述字符串
+}
+
+// Etherscan 业务层错误：调用方应换 key 或稍后重试，而不能当作"未验证"
+var (
+	ErrEtherscanRateLimited = errors.New("Etherscan 请求被限流")
+	ErrEtherscanInvalidKey  = errors.New("Etherscan API key 无效")
+)
+
+// classifyEtherscanError 将 status != "1" 的响应转换为错误（限流 / key 无效 / 其他）
+func classifyEtherscanError(message, result string) error {
+	text := strings.ToLower(message + " " + result)
+	switch {
+	case strings.Contains(text, "rate limit") || strings.Contains(text, "daily limit") || strings.Contains(text, "too many"):
+		return fmt.Errorf("%w: %s", ErrEtherscanRateLimited, result)
+	case strings.Contains(text, "invalid api key"):
+		return fmt.Errorf("%w: %s", ErrEtherscanInvalidKey, result)
+	default:
+		return fmt.Errorf("Etherscan 返回错误: %s %s", message, result)
+	}
+}
+
+// etherscanSourceResult getsourcecode 接口返回的单条结果
+type etherscanSourceResult struct {
+	SourceCode           string `json:"SourceCode"`
+	ABI                  string `json:"ABI"`
+	ContractName         string `json:"ContractName"`
+	CompilerVersion      string `json:"CompilerVersion"`
+	OptimizationUsed     string `json:"OptimizationUsed"`
+	Runs                 string `json:"Runs"`
+	ConstructorArguments string `json:"ConstructorArguments"`
+	EVMVersion           string `json:"EVMVersion"`
+	Library              string `json:"Library"`
+	LicenseType          string `json:"LicenseType"`
+	Proxy                string `json:"Proxy"`
+	Implementation       string `json:"Implementation"`
+	SwarmSource          string `json:"SwarmSource"`
 }
 
 // GetContractSource 从 Etherscan 获取合约源代码和验证状态
 func GetContractSource(address string, config EtherscanConfig) (sourceCode string, isVerified bool, err error) {
+	meta, err := FetchContractMetadata(address, config)
+	if err != nil || meta == nil {
+		return "", false, err
+	}
+	return meta.SourceCode, true, nil
+}
+
+// FetchContractMetadata 从 Etherscan 获取已验证合约的完整元数据（源码、ABI、编译参数等）；
+// 合约未验证时返回 nil, nil
+func FetchContractMetadata(address string, config EtherscanConfig) (*ContractMetadata, error) {
 	// 清理输入
 	address = strings.TrimSpace(address)
 	if address == "" {
-		return "", false, fmt.Errorf("空的地址传入 GetContractSource")
+		return nil, fmt.Errorf("空的地址传入 FetchContractMetadata")
 	}
 
 	// 构建 API URL 使用 url.Values 避免拼接错误
 	base := strings.TrimRight(config.BaseURL, "/")
 	u, err := url.Parse(base)
 	if err != nil {
-		return "", false, fmt.Errorf("解析 Etherscan BaseURL 失败: %w", err)
+		return nil, fmt.Errorf("解析 Etherscan BaseURL 失败: %w", err)
 	}
 	u.Path = strings.TrimRight(u.Path, "/") + "/api"
 
@@ -62,8 +98,12 @@ func GetContractSource(address string, config EtherscanConfig) (sourceCode strin
 	q.Set("action", "getsourcecode")
 	q.Set("address", address)
 	q.Set("apikey", strings.TrimSpace(config.APIKey))
-	// chainid 可选保留
-	q.Set("chainid", "1")
+	// v2 接口按 chainid 区分链
+	chainID := config.ChainID
+	if chainID == 0 {
+		chainID = 1
+	}
+	q.Set("chainid", strconv.FormatUint(chainID, 10))
 
 	u.RawQuery = q.Encode()
 	finalURL := u.String()
@@ -71,7 +111,7 @@ func GetContractSource(address string, config EtherscanConfig) (sourceCode strin
 	// 准备 HTTP 客户端（超时与可选代理）
 	client, err := internal.CreateProxyHTTPClient(config.Proxy, 20*time.Second)
 	if err != nil {
-		return "", false, fmt.Errorf("创建Etherscan HTTP客户端失败: %w", err)
+		return nil, fmt.Errorf("创建Etherscan HTTP客户端失败: %w", err)
 	}
 
 	// 重试逻辑：短暂网络错误/EOF/超时时重试
@@ -92,7 +132,7 @@ func GetContractSource(address string, config EtherscanConfig) (sourceCode strin
 				continue
 			}
 			// 非临时错误或最后一次尝试 -> 返回网络错误
-			return "", false, fmt.Errorf("请求 Etherscan API 失败: %w (url=%s)", err, finalURL)
+			return nil, fmt.Errorf("请求 Etherscan API 失败: %w (url=%s)", err, finalURL)
 		}
 
 		// 确保关闭响应体
@@ -105,17 +145,20 @@ func GetContractSource(address string, config EtherscanConfig) (sourceCode strin
 				time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
 				continue
 			}
-			return "", false, fmt.Errorf("读取 Etherscan 响应失败: %w (url=%s)", readErr, finalURL)
+			return nil, fmt.Errorf("读取 Etherscan 响应失败: %w (url=%s)", readErr, finalURL)
 		}
 
 		// 检查 HTTP 状态码
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: HTTP 429", ErrEtherscanRateLimited)
+		}
 		if resp.StatusCode != http.StatusOK {
 			// 返回 body 片段有助于定位错误
 			snippet := string(body)
 			if len(snippet) > 1024 {
 				snippet = snippet[:1024]
 			}
-			return "", false, fmt.Errorf("Etherscan 返回非 200 状态: %d, body: %s", resp.StatusCode, snippet)
+			return nil, fmt.Errorf("Etherscan 返回非 200 状态: %d, body: %s", resp.StatusCode, snippet)
 		}
 
 		// 解析 JSON
@@ -127,32 +170,40 @@ func GetContractSource(address string, config EtherscanConfig) (sourceCode strin
 				time.Sleep(time.Duration(attempt) * 300 * time.Millisecond)
 				continue
 			}
-			return "", false, fmt.Errorf("解析 Etherscan JSON 失败: %w (url=%s)", jerr, finalURL)
+			return nil, fmt.Errorf("解析 Etherscan JSON 失败: %w (url=%s)", jerr, finalURL)
 		}
 
-		// 如果 API 返回 status != "1"，则表示未验证或其它业务层面的问题（不是网络错误）
+		// status != "1" 是限流、key 无效等业务错误，不能当作未验证（getsourcecode 对未验证合约也返回 1）
 		if etherscanResp.Status != "1" {
-			return "", false, nil
+			var msg string
+			if json.Unmarshal(etherscanResp.Result, &msg) != nil {
+				msg = string(etherscanResp.Result)
+			}
+			return nil, classifyEtherscanError(etherscanResp.Message, msg)
 		}
 
 		// 找到结果并检查 SourceCode
-		if len(etherscanResp.Result) == 0 {
-			return "", false, nil
+		var results []etherscanSourceResult
+		if jerr := json.Unmarshal(etherscanResp.Result, &results); jerr != nil {
+			return nil, fmt.Errorf("解析 Etherscan 结果失败: %w", jerr)
 		}
-		res := etherscanResp.Result[0]
+		if len(results) == 0 {
+			return nil, nil
+		}
+		res := results[0]
 		if strings.TrimSpace(res.SourceCode) == "" {
 			// 合约未验证
-			return "", false, nil
+			return nil, nil
 		}
 		// 成功获取已验证源码
-		return res.SourceCode, true, nil
+		return newContractMetadata(res), nil
 	}
 
 	// 所有尝试失败，返回最后一个错误
 	if lastErr != nil {
-		return "", false, fmt.Errorf("请求 Etherscan 多次失败: %w (url=%s)", lastErr, finalURL)
+		return nil, fmt.Errorf("请求 Etherscan 多次失败: %w (url=%s)", lastErr, finalURL)
 	}
-	return "", false, fmt.Errorf("请求 Etherscan 未知错误 (url=%s)", finalURL)
+	return nil, fmt.Errorf("请求 Etherscan 未知错误 (url=%s)", finalURL)
 }
 
 // isTemporaryNetErr 判断是否为可重试的网络错误
@@ -190,7 +241,98 @@ func (r *RateLimiter) Wait() {
 	<-r.ticker.C
 }
 
+// WaitContext 等待直到可以发送下一个请求，ctx 取消时提前返回
+func (r *RateLimiter) WaitContext(ctx context.Context) error {
+	select {
+	case <-r.ticker.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Stop 停止速率限制器
 func (r *RateLimiter) Stop() {
 	r.ticker.Stop()
 }
+
+// etherscanCreation getcontractcreation 接口返回的单条结果（blockNumber 只有新版接口返回）
+type etherscanCreation struct {
+	ContractAddress string `json:"contractAddress"`
+	ContractCreator string `json:"contractCreator"`
+	TxHash          string `json:"txHash"`
+	BlockNumber     string `json:"blockNumber"`
+}
+
+// fetchContractCreations 通过 getcontractcreation 查询合约的创建者与创建交易（每次最多 5 个地址），
+// 结果按小写地址索引；浏览器未收录的地址不在结果中
+func fetchContractCreations(ctx context.Context, addresses []string, config EtherscanConfig) (map[string]etherscanCreation, error) {
+	base := strings.TrimRight(config.BaseURL, "/")
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("解析 Etherscan BaseURL 失败: %w", err)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/api"
+
+	chainID := config.ChainID
+	if chainID == 0 {
+		chainID = 1
+	}
+	q := url.Values{}
+	q.Set("module", "contract")
+	q.Set("action", "getcontractcreation")
+	q.Set("contractaddresses", strings.Join(addresses, ","))
+	q.Set("apikey", strings.TrimSpace(config.APIKey))
+	q.Set("chainid", strconv.FormatUint(chainID, 10))
+	u.RawQuery = q.Encode()
+
+	client, err := internal.CreateProxyHTTPClient(config.Proxy, 20*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("创建Etherscan HTTP客户端失败: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "solidity-excavator/1.0 (+https://github.com/)")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 Etherscan API 失败: %w", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("读取 Etherscan 响应失败: %w", err)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("%w: HTTP 429", ErrEtherscanRateLimited)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Etherscan 返回非 200 状态: %d", resp.StatusCode)
+	}
+
+	var etherscanResp EtherscanResponse
+	if err := json.Unmarshal(body, &etherscanResp); err != nil {
+		return nil, fmt.Errorf("解析 Etherscan JSON 失败: %w", err)
+	}
+	out := make(map[string]etherscanCreation)
+	if etherscanResp.Status != "1" {
+		var msg string
+		if json.Unmarshal(etherscanResp.Result, &msg) != nil {
+			msg = string(etherscanResp.Result)
+		}
+		// 全部地址都未收录（EOA、浏览器尚未索引）时返回 No data found
+		if strings.Contains(strings.ToLower(etherscanResp.Message+" "+msg), "no data found") {
+			return out, nil
+		}
+		return nil, classifyEtherscanError(etherscanResp.Message, msg)
+	}
+	var results []etherscanCreation
+	if err := json.Unmarshal(etherscanResp.Result, &results); err != nil {
+		return nil, fmt.Errorf("解析 Etherscan 结果失败: %w", err)
+	}
+	for _, r := range results {
+		out[strings.ToLower(r.ContractAddress)] = r
+	}
+	return out, nil
+}
@@ -0,0 +1,252 @@
+package download
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 失败队列中的条目类型
+const (
+	FailBlock   = "block"   // 区块处理失败，target 为十进制区块号
+	FailAddress = "address" // 合约下载或源码查询失败，target 为合约地址
+)
+
+// 失败重试的指数退避：首次 1 分钟后，每失败一次翻倍，最长 1 天
+const (
+	retryBaseDelay = time.Minute
+	retryMaxDelay  = 24 * time.Hour
+)
+
+// failureRecord download_failures 中的一条记录
+type failureRecord struct {
+	Kind      string
+	Target    string
+	Attempts  int
+	LastError string
+}
+
+// recordFailure 将失败写入 download_failures：已存在时累加次数并按指数退避推迟下次重试。
+// ctx 已取消导致的失败不记录
+func (d *Downloader) recordFailure(ctx context.Context, kind, target string, cause error) {
+	if ctx.Err() != nil || errors.Is(cause, context.Canceled) || strings.TrimSpace(target) == "" {
+		return
+	}
+	msg := "unknown error"
+	if cause != nil {
+		msg = cause.Error()
+	}
+	if len(msg) > 1000 {
+		msg = msg[:1000]
+	}
+	// nextretry 写在 attempts 之前，计算时使用的是累加前的次数
+	_, err := d.db.ExecContext(ctx, `
+	INSERT INTO download_failures (chain, kind, target, attempts, lasterror, nextretry, createdat, updatedat)
+	VALUES (?, ?, ?, 1, ?, DATE_ADD(NOW(), INTERVAL ? SECOND), NOW(), NOW())
+	ON DUPLICATE KEY UPDATE
+		nextretry = DATE_ADD(NOW(), INTERVAL FLOOR(LEAST(? * POW(2, attempts), ?)) SECOND),
+		attempts = attempts + 1,
+		lasterror = VALUES(lasterror),
+		updatedat = VALUES(updatedat)
+	`, d.chain, kind, strings.TrimSpace(target), msg, int64(retryBaseDelay.Seconds()),
+		int64(retryBaseDelay.Seconds()), int64(retryMaxDelay.Seconds()))
+	if err != nil {
+		log.Printf("⚠️  记录失败项 %s %s 失败: %v\n", kind, target, err)
+	}
+}
+
+// clearFailure 重试成功后移出失败队列
+func (d *Downloader) clearFailure(ctx context.Context, kind, target string) error {
+	_, err := d.db.ExecContext(ctx,
+		"DELETE FROM download_failures WHERE chain = ? AND kind = ? AND target = ?", d.chain, kind, target)
+	return err
+}
+
+// failedBlocksIn 返回 [start, end] 内仍在失败队列中的区块（下载成功时顺带移出队列）
+func (d *Downloader) failedBlocksIn(ctx context.Context, start, end uint64) (map[uint64]bool, error) {
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT target FROM download_failures WHERE chain = ? AND kind = ?", d.chain, FailBlock)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[uint64]bool)
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		if n, err := strconv.ParseUint(t, 10, 64); err == nil && n >= start && n <= end {
+			out[n] = true
+		}
+	}
+	return out, rows.Err()
+}
+
+// dueFailures 读取已到重试时间的失败项
+func (d *Downloader) dueFailures(ctx context.Context, limit int) ([]failureRecord, error) {
+	rows, err := d.db.QueryContext(ctx, fmt.Sprintf(`
+	SELECT kind, target, attempts, COALESCE(lasterror, '') FROM download_failures
+	WHERE chain = ? AND nextretry <= NOW()
+	ORDER BY nextretry LIMIT %d`, limit), d.chain)
+	if err != nil {
+		return nil, fmt.Errorf("查询失败队列失败: %w", err)
+	}
+	defer rows.Close()
+
+	var out []failureRecord
+	for rows.Next() {
+		var f failureRecord
+		if err := rows.Scan(&f.Kind, &f.Target, &f.Attempts, &f.LastError); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// RetryFailures 依次重试失败队列中已到重试时间的区块与地址，直到没有到期项。
+// 成功的项移出队列；再次失败的项累加次数并按指数退避推迟，留给下次运行
+func (d *Downloader) RetryFailures(ctx context.Context) error {
+	log.Printf("🔁 开始重试失败队列 (链: %s)...\n", d.chain)
+
+	var succeeded, failed int
+	tried := make(map[string]bool)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch, err := d.dueFailures(ctx, 100)
+		if err != nil {
+			return err
+		}
+		progressed := false
+		for _, f := range batch {
+			key := f.Kind + ":" + f.Target
+			if tried[key] {
+				continue
+			}
+			tried[key] = true
+			progressed = true
+
+			log.Printf("🔁 重试 %s %s（第 %d 次，上次错误: %s）\n", f.Kind, f.Target, f.Attempts+1, f.LastError)
+			ok, err := d.retryFailure(ctx, f)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				d.recordFailure(ctx, f.Kind, f.Target, err)
+			}
+			if !ok {
+				failed++
+				continue
+			}
+			if err := d.clearFailure(ctx, f.Kind, f.Target); err != nil {
+				return fmt.Errorf("移出失败队列失败: %w", err)
+			}
+			succeeded++
+		}
+		if !progressed {
+			break
+		}
+	}
+
+	var pending int
+	if err := d.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM download_failures WHERE chain = ?", d.chain).Scan(&pending); err != nil {
+		return fmt.Errorf("统计失败队列失败: %w", err)
+	}
+	log.Printf("\n✅ 失败队列重试完成!\n")
+	log.Printf("   - 成功: %d\n", succeeded)
+	log.Printf("   - 再次失败: %d\n", failed)
+	log.Printf("   - 队列剩余: %d（未到重试时间的项下次运行继续）\n", pending)
+	return nil
+}
+
+// retryFailure 重试单个失败项。ok 表示已成功；err 非 nil 时由调用方计入失败队列
+// （源码查询失败已由 resolveSource 自行计入，此时 ok 为 false 且 err 为 nil）
+func (d *Downloader) retryFailure(ctx context.Context, f failureRecord) (ok bool, err error) {
+	switch f.Kind {
+	case FailBlock:
+		n, err := strconv.ParseUint(f.Target, 10, 64)
+		if err != nil {
+			// 无法解析的记录直接移出队列
+			log.Printf("⚠️  无效的区块号 %q，移出失败队列\n", f.Target)
+			return true, nil
+		}
+		covered, err := d.blockCovered(ctx, n)
+		if err != nil {
+			return false, err
+		}
+		if covered {
+			return true, nil
+		}
+		// 区块下载失败时 runBlockPipeline 已计入失败队列
+		stats := d.runBlockPipeline(ctx, n, n)
+		return stats.failed == 0 && stats.done == 1, nil
+	case FailAddress:
+		return d.retryAddress(ctx, f.Target)
+	default:
+		log.Printf("⚠️  未知的失败类型 %q，移出失败队列\n", f.Kind)
+		return true, nil
+	}
+}
+
+// retryAddress 重试单个地址：未入库的合约重新下载；已入库但验证状态未确定的合约重新查询源码
+func (d *Downloader) retryAddress(ctx context.Context, addr string) (bool, error) {
+	addr = common.HexToAddress(addr).Hex()
+	var codeHash, bytecode string
+	var isOpenSource int
+	var createBlock uint64
+	err := d.db.QueryRowContext(ctx,
+		"SELECT COALESCE(code_hash, ''), contract, isopensource, createblock FROM contracts WHERE chain = ? AND address = ?", d.chain, addr).
+		Scan(&codeHash, &bytecode, &isOpenSource, &createBlock)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("查询合约失败: %w", err)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		if err := d.downloadAddress(ctx, addr); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if isOpenSource == 1 {
+		return true, nil
+	}
+
+	if codeHash != "" {
+		rec, err := d.lookupCode(ctx, codeHash)
+		if err != nil {
+			return false, err
+		}
+		if rec != nil && rec.checkedOn(d.chain) {
+			return true, nil
+		}
+		meta, queried := d.resolveSource(ctx, addr)
+		if !queried {
+			return false, nil
+		}
+		if err := d.settleCode(ctx, codeHash, addr, meta); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	meta, queried := d.resolveSource(ctx, addr)
+	if !queried {
+		return false, nil
+	}
+	info := &ContractInfo{Address: addr, Bytecode: bytecode, CreateBlock: createBlock}
+	if err := d.settleLegacy(ctx, info, meta); err != nil {
+		return false, err
+	}
+	return true, nil
+}
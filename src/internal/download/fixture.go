@@ -0,0 +1,385 @@
+package download
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// 录制文件为 JSON Lines，每行一次 JSON-RPC 调用：
+//
+//	{"method":"eth_getCode","params":["0x…","latest"],"result":"0x6080…"}
+//	{"method":"debug_traceBlockByNumber","params":["0x10",{"tracer":"callTracer"}],"error":{"code":-32601,"message":"…"}}
+//
+// 回放时按 method + params 匹配；同一请求录制了多次时按录制顺序依次返回，用完后重复最后一条
+// （例如跟随模式下逐次变化的 eth_blockNumber）
+
+// fixtureEntry 录制文件中的一行
+type fixtureEntry struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *jsonrpcError   `json:"error,omitempty"`
+}
+
+// jsonrpcError JSON-RPC 错误对象
+type jsonrpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// jsonrpcMessage JSON-RPC 请求或响应
+type jsonrpcMessage struct {
+	Version string          `json:"jsonrpc,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+}
+
+// fixtureKey 请求的匹配键：方法名 + 压缩后的参数
+func fixtureKey(method string, params json.RawMessage) string {
+	var buf bytes.Buffer
+	if len(params) == 0 || json.Compact(&buf, params) != nil {
+		return method + " []"
+	}
+	return method + " " + buf.String()
+}
+
+// parseJSONRPCBody 解析单个或批量的 JSON-RPC 消息
+func parseJSONRPCBody(body []byte) ([]jsonrpcMessage, bool, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var msgs []jsonrpcMessage
+		err := json.Unmarshal(body, &msgs)
+		return msgs, true, err
+	}
+	var msg jsonrpcMessage
+	err := json.Unmarshal(body, &msg)
+	return []jsonrpcMessage{msg}, false, err
+}
+
+// fixtureTransport 以 http.RoundTripper 的形式回放录制的响应，ethclient 的解码逻辑保持不变
+type fixtureTransport struct {
+	chainID uint64
+	mu      sync.Mutex
+	entries map[string][]fixtureEntry
+	next    map[string]int
+	total   int
+	misses  map[string]int // 录制中缺少的请求（按方法统计）
+}
+
+// loadFixture 读取录制文件；path 为目录时按文件名顺序读取其中全部 .jsonl
+func loadFixture(path string, chainID uint64) (*fixtureTransport, error) {
+	files := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("读取录制文件失败: %w", err)
+	} else if info.IsDir() {
+		matches, err := filepath.Glob(filepath.Join(path, "*.jsonl"))
+		if err != nil {
+			return nil, fmt.Errorf("列出录制文件失败: %w", err)
+		}
+		sort.Strings(matches)
+		files = matches
+	}
+
+	t := &fixtureTransport{
+		chainID: chainID,
+		entries: make(map[string][]fixtureEntry),
+		next:    make(map[string]int),
+		misses:  make(map[string]int),
+	}
+	for _, file := range files {
+		if err := t.loadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if t.total == 0 {
+		return nil, fmt.Errorf("录制文件 %s 中没有任何记录", path)
+	}
+	return t, nil
+}
+
+func (t *fixtureTransport) loadFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("打开录制文件失败: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 256*1024*1024) // 区块与 trace 响应可能很大
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var e fixtureEntry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return fmt.Errorf("解析录制文件 %s 第 %d 行失败: %w", file, line, err)
+		}
+		if e.Method == "" {
+			return fmt.Errorf("录制文件 %s 第 %d 行缺少 method", file, line)
+		}
+		key := fixtureKey(e.Method, e.Params)
+		t.entries[key] = append(t.entries[key], e)
+		t.total++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取录制文件 %s 失败: %w", file, err)
+	}
+	return nil
+}
+
+// reply 查找一次请求的录制响应
+func (t *fixtureTransport) reply(req jsonrpcMessage) jsonrpcMessage {
+	resp := jsonrpcMessage{Version: "2.0", ID: req.ID}
+	key := fixtureKey(req.Method, req.Params)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := t.entries[key]
+	if len(list) == 0 {
+		if req.Method == "eth_chainId" {
+			resp.Result, _ = json.Marshal(hexutil.Uint64(t.chainID))
+			return resp
+		}
+		t.misses[req.Method]++
+		resp.Error = &jsonrpcError{Code: -32000, Message: "录制中没有该请求: " + key}
+		return resp
+	}
+	i := t.next[key]
+	if i < len(list)-1 {
+		t.next[key] = i + 1
+	}
+	e := list[i]
+	if e.Error != nil {
+		resp.Error = e.Error
+	} else if len(e.Result) == 0 {
+		resp.Result = json.RawMessage("null")
+	} else {
+		resp.Result = e.Result
+	}
+	return resp
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	msgs, batch, err := parseJSONRPCBody(body)
+	if err != nil {
+		return nil, fmt.Errorf("解析 JSON-RPC 请求失败: %w", err)
+	}
+
+	replies := make([]jsonrpcMessage, 0, len(msgs))
+	for _, m := range msgs {
+		replies = append(replies, t.reply(m))
+	}
+	var out []byte
+	if batch {
+		out, err = json.Marshal(replies)
+	} else {
+		out, err = json.Marshal(replies[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(out)),
+		ContentLength: int64(len(out)),
+		Request:       req,
+	}, nil
+}
+
+// FixtureReader 回放录制响应的 ChainReader：在 ethclient 之下替换 HTTP 传输层，
+// 因此区块、收据等的解码与连接真实节点时完全一致
+type FixtureReader struct {
+	*ethclient.Client
+	fixture *fixtureTransport
+}
+
+// NewFixtureReader 加载录制文件（或目录）创建回放实现；录制中没有 eth_chainId 时按 chainID 应答
+func NewFixtureReader(path string, chainID uint64) (*FixtureReader, error) {
+	t, err := loadFixture(path, chainID)
+	if err != nil {
+		return nil, err
+	}
+	c, err := rpc.DialOptions(context.Background(), "http://fixture.invalid", rpc.WithHTTPClient(&http.Client{Transport: t}))
+	if err != nil {
+		return nil, fmt.Errorf("创建回放客户端失败: %w", err)
+	}
+	return &FixtureReader{Client: ethclient.NewClient(c), fixture: t}, nil
+}
+
+// Size 录制的调用条数
+func (r *FixtureReader) Size() int {
+	return r.fixture.total
+}
+
+// CallContext 原始 JSON-RPC 调用
+func (r *FixtureReader) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return r.Client.Client().CallContext(ctx, result, method, args...)
+}
+
+// BatchCallContext 批量 JSON-RPC 调用
+func (r *FixtureReader) BatchCallContext(ctx context.Context, elems []rpc.BatchElem) error {
+	return r.Client.Client().BatchCallContext(ctx, elems)
+}
+
+// Close 关闭客户端，并输出录制中缺少的请求，便于补录
+func (r *FixtureReader) Close() {
+	r.fixture.mu.Lock()
+	misses := r.fixture.misses
+	r.fixture.mu.Unlock()
+	if len(misses) > 0 {
+		methods := make([]string, 0, len(misses))
+		for m, n := range misses {
+			methods = append(methods, fmt.Sprintf("%s×%d", m, n))
+		}
+		sort.Strings(methods)
+		log.Printf("⚠️  录制中缺少 %s 的响应\n", strings.Join(methods, ", "))
+	}
+	r.Client.Close()
+}
+
+// FixtureRecorder 把节点的 JSON-RPC 请求与响应追加写入录制文件（JSON Lines），多个节点共用一个文件
+type FixtureRecorder struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+	n  int
+}
+
+// NewFixtureRecorder 以追加方式打开录制文件
+func NewFixtureRecorder(path string) (*FixtureRecorder, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建录制目录失败: %w", err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("打开录制文件失败: %w", err)
+	}
+	return &FixtureRecorder{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Transport 包装 base，经过它的请求都会被录制
+func (r *FixtureRecorder) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &recordingTransport{base: base, rec: r}
+}
+
+// record 按 id 配对请求与响应并写入（HTTP 层失败的请求不录制）
+func (r *FixtureRecorder) record(reqBody, respBody []byte) {
+	reqs, _, err := parseJSONRPCBody(reqBody)
+	if err != nil {
+		return
+	}
+	resps, _, err := parseJSONRPCBody(respBody)
+	if err != nil {
+		return
+	}
+	byID := make(map[string]jsonrpcMessage, len(resps))
+	for _, m := range resps {
+		byID[string(m.ID)] = m
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, req := range reqs {
+		resp, ok := byID[string(req.ID)]
+		if !ok || req.Method == "" {
+			continue
+		}
+		line, err := json.Marshal(fixtureEntry{Method: req.Method, Params: req.Params, Result: resp.Result, Error: resp.Error})
+		if err != nil {
+			continue
+		}
+		r.w.Write(line)
+		r.w.WriteByte('\n')
+		r.n++
+	}
+}
+
+// Close 刷新并关闭录制文件
+func (r *FixtureRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	log.Printf("⏺️  已录制 %d 次 RPC 调用\n", r.n)
+	err := r.w.Flush()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	r.f = nil
+	return err
+}
+
+// recordingTransport 转发请求并录制响应
+type recordingTransport struct {
+	base http.RoundTripper
+	rec  *FixtureRecorder
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	t.rec.record(reqBody, respBody)
+	return resp, nil
+}
@@ -0,0 +1,338 @@
+package download
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// FollowOptions 持续跟随模式参数
+type FollowOptions struct {
+	Confirmations uint64        // 确认深度：只下载 head - Confirmations 及以下的区块
+	PollInterval  time.Duration // 节点不支持订阅（纯 HTTP RPC）时的轮询间隔，0 为链的出块时间
+	KeepHashes    uint64        // block_hashes 表保留最近多少个区块的哈希
+	RecheckEvery  time.Duration // 每隔多久复查一次未开源合约的验证状态，0 表示不复查
+	Recheck       RecheckOptions
+}
+
+// DefaultFollowOptions 返回默认的跟随模式参数
+func DefaultFollowOptions() FollowOptions {
+	return FollowOptions{
+		Confirmations: 12,
+		KeepHashes:    1024,
+	}
+}
+
+// Follow 持续跟随链头：订阅新区块（不支持时轮询），下载达到确认深度的区块，
+// 并通过比对已存储的区块哈希检测重组，回滚孤块中的合约。ctx 取消时在 checkpoint 落盘后返回 nil。
+func (d *Downloader) Follow(ctx context.Context, opts FollowOptions) error {
+	def := DefaultFollowOptions()
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = d.blockInterval()
+	}
+	if opts.KeepHashes == 0 {
+		opts.KeepHashes = def.KeepHashes
+	}
+	if opts.KeepHashes < opts.Confirmations*2 {
+		opts.KeepHashes = opts.Confirmations * 2
+	}
+
+	d.recordHashes = true
+	defer func() { d.recordHashes = false }()
+
+	last, err := d.followStart(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("👀 进入跟随模式: 从区块 %d 之后开始，确认深度 %d\n", last, opts.Confirmations)
+
+	heads, stop := d.watchHeads(ctx, opts.PollInterval)
+	defer stop()
+	lastRecheck := time.Now()
+
+	for {
+		var head uint64
+		select {
+		case <-ctx.Done():
+			log.Printf("⏹️  跟随模式退出，已处理到区块 %d\n", last)
+			return nil
+		case h, ok := <-heads:
+			if !ok {
+				return fmt.Errorf("区块头订阅已关闭")
+			}
+			head = h
+		}
+
+		// 1. 检测重组
+		reorgAt, err := d.detectReorg(ctx)
+		if err != nil {
+			log.Printf("⚠️  重组检测失败: %v\n", err)
+		} else if reorgAt > 0 {
+			if err := d.rollbackFrom(ctx, reorgAt); err != nil {
+				log.Printf("❌ 回滚区块 %d 之后的数据失败: %v\n", reorgAt, err)
+				continue
+			}
+			if reorgAt-1 < last {
+				last = reorgAt - 1
+			}
+		}
+
+		// 2. 下载已确认的新区块
+		if head < opts.Confirmations {
+			continue
+		}
+		target := head - opts.Confirmations
+		if target <= last {
+			continue
+		}
+		if err := d.DownloadBlockRange(ctx, last+1, target); err != nil {
+			if errors.Is(err, context.Canceled) {
+				log.Printf("⏹️  跟随模式退出，checkpoint 已保存\n")
+				return nil
+			}
+			log.Printf("⚠️  下载区块 %d - %d 失败: %v\n", last+1, target, err)
+			continue
+		}
+		// 失败的区块在下载进度中留下空洞，last 只推进到连续写入的最后一个区块，下一轮从空洞处重试
+		done, err := d.coveredThrough(ctx, last+1)
+		if err != nil {
+			log.Printf("⚠️  读取下载进度失败: %v\n", err)
+			continue
+		}
+		if done < target {
+			log.Printf("⚠️  区块 %d - %d 未全部完成，已连续写入到 %d，下一轮重试\n", last+1, target, done)
+		}
+		last = done
+
+		if err := d.pruneBlockHashes(ctx, last, opts.KeepHashes); err != nil {
+			log.Printf("⚠️  清理旧区块哈希失败: %v\n", err)
+		}
+
+		// 3. 定期复查未开源合约（复查期间暂停下载，之后从 last 继续）
+		if opts.RecheckEvery > 0 && time.Since(lastRecheck) >= opts.RecheckEvery {
+			if _, err := d.RecheckVerification(ctx, opts.Recheck); err != nil {
+				if errors.Is(err, context.Canceled) {
+					log.Printf("⏹️  跟随模式退出，已处理到区块 %d\n", last)
+					return nil
+				}
+				log.Printf("⚠️  复查验证状态失败: %v\n", err)
+			}
+			lastRecheck = time.Now()
+		}
+	}
+}
+
+// followStart 确定跟随起点：download_progress 中最高的已下载区块，没有记录时退回数据库最大 createblock
+func (d *Downloader) followStart(ctx context.Context) (uint64, error) {
+	recs, err := d.loadProgress(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var last uint64
+	for _, r := range recs {
+		if r.End > last {
+			last = r.End
+		}
+	}
+	if last > 0 {
+		return last, nil
+	}
+	return d.GetLastDownloadedBlock(ctx)
+}
+
+// watchHeads 返回新区块号的通道：优先 SubscribeNewHead，失败（HTTP RPC）时回退为轮询 BlockNumber
+func (d *Downloader) watchHeads(ctx context.Context, interval time.Duration) (<-chan uint64, func()) {
+	out := make(chan uint64, 1)
+	ctx, cancel := context.WithCancel(ctx)
+
+	// 非阻塞投递，只保留最新的 head
+	push := func(n uint64) {
+		select {
+		case out <- n:
+		default:
+			select {
+			case <-out:
+			default:
+			}
+			out <- n
+		}
+	}
+
+	headers := make(chan *types.Header, 16)
+	sub, err := d.Client.SubscribeNewHead(ctx, headers)
+	if err != nil {
+		log.Printf("ℹ️  节点不支持订阅新区块（%v），改为每 %s 轮询\n", err, interval)
+		go pollHeads(ctx, d, interval, push)
+		return out, cancel
+	}
+
+	log.Println("📡 已订阅新区块头")
+	go func() {
+		defer sub.Unsubscribe()
+		// 订阅建立前的最新区块先投递一次
+		if n, err := d.Client.BlockNumber(ctx); err == nil {
+			push(n)
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-sub.Err():
+				log.Printf("⚠️  新区块订阅中断: %v，改为轮询\n", err)
+				pollHeads(ctx, d, interval, push)
+				return
+			case h := <-headers:
+				push(h.Number.Uint64())
+			}
+		}
+	}()
+	return out, cancel
+}
+
+// pollHeads 按固定间隔轮询最新区块号，直到 ctx 取消
+func pollHeads(ctx context.Context, d *Downloader, interval time.Duration, push func(uint64)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := d.Client.BlockNumber(ctx); err == nil {
+			push(n)
+		} else if ctx.Err() == nil {
+			log.Printf("⚠️  获取最新区块失败: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// blockInterval 链的平均出块时间，作为轮询间隔的默认值（至少 1 秒）
+func (d *Downloader) blockInterval() time.Duration {
+	iv := time.Duration(d.chainCfg.BlockTime * float64(time.Second))
+	if iv < time.Second {
+		iv = time.Second
+	}
+	return iv
+}
+
+// saveBlockHash 记录已处理区块的哈希，供重组检测使用
+func (d *Downloader) saveBlockHash(ctx context.Context, num uint64, hash, parent common.Hash) error {
+	_, err := d.db.ExecContext(ctx, `
+	INSERT INTO block_hashes (chain, blocknumber, blockhash, parenthash)
+	VALUES (?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE blockhash = VALUES(blockhash), parenthash = VALUES(parenthash)
+	`, d.chain, int64(num), hash.Hex(), parent.Hex())
+	return err
+}
+
+// detectReorg 比对已存储的区块哈希与当前链上哈希，返回最早的孤块号；无重组返回 0。
+// 最新存储的区块仍在主链上即说明其所有祖先都在主链上，因此只需从最新处往回找。
+func (d *Downloader) detectReorg(ctx context.Context) (uint64, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT blocknumber, blockhash FROM block_hashes WHERE chain = ? ORDER BY blocknumber DESC", d.chain)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var orphanFrom uint64
+	for rows.Next() {
+		var num int64
+		var stored string
+		if err := rows.Scan(&num, &stored); err != nil {
+			return 0, err
+		}
+		header, err := d.Client.HeaderByNumber(ctx, big.NewInt(num))
+		if err != nil {
+			return 0, fmt.Errorf("获取区块头 %d 失败: %w", num, err)
+		}
+		if header.Hash() == common.HexToHash(stored) {
+			break
+		}
+		orphanFrom = uint64(num)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if orphanFrom > 0 {
+		log.Printf("🔀 检测到链重组：区块 %d 及之后的已存储数据不在主链上\n", orphanFrom)
+	}
+	return orphanFrom, nil
+}
+
+// rollbackFrom 删除 from 及之后区块创建的合约（连同创建信息、代理、代币持仓与标签）与区块哈希，
+// 撤销孤块计入幸存合约的交互，并从 download_progress 中移除对应区间
+func (d *Downloader) rollbackFrom(ctx context.Context, from uint64) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	addrs, err := queryStrings(ctx, tx, "SELECT address FROM contracts WHERE chain = ? AND createblock >= ?", d.chain, int64(from))
+	if err != nil {
+		return fmt.Errorf("查询孤块合约失败: %w", err)
+	}
+	var n int64
+	for _, chunk := range chunkStrings(addrs, pruneChunk) {
+		deleted, err := deleteAddressRows(ctx, tx, d.chain, chunk)
+		if err != nil {
+			return fmt.Errorf("删除孤块合约失败: %w", err)
+		}
+		n += deleted
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM block_hashes WHERE chain = ? AND blocknumber >= ?", d.chain, int64(from)); err != nil {
+		return fmt.Errorf("删除孤块哈希失败: %w", err)
+	}
+	if err := d.rollbackActivity(ctx, tx, from); err != nil {
+		return err
+	}
+	if err := d.truncateProgress(ctx, tx, from); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("↩️  已回滚区块 %d 之后的数据（删除 %d 个合约）\n", from, n)
+	return nil
+}
+
+// rollbackActivity 在事务内从幸存合约中扣除 from 及之后区块计入的 txcount，txlast 取剩余交互记录中最晚的时间
+// （没有剩余记录时保持不变），再删除这些区块的交互记录，新链上的区块下载时重新计入
+func (d *Downloader) rollbackActivity(ctx context.Context, tx *sql.Tx, from uint64) error {
+	_, err := tx.ExecContext(ctx, `
+	UPDATE contracts SET
+		txcount = txcount - LEAST(txcount, COALESCE((SELECT SUM(a.txcount) FROM activity_contracts a
+			WHERE a.chain = contracts.chain AND a.address = contracts.address AND a.blocknumber >= ?), 0)),
+		txlast = COALESCE((SELECT MAX(a.txtime) FROM activity_contracts a
+			WHERE a.chain = contracts.chain AND a.address = contracts.address AND a.blocknumber < ?), txlast)
+	WHERE chain = ? AND address IN (SELECT address FROM activity_contracts WHERE chain = ? AND blocknumber >= ?)
+	`, int64(from), int64(from), d.chain, d.chain, int64(from))
+	if err != nil {
+		return fmt.Errorf("扣除孤块交互失败: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM activity_contracts WHERE chain = ? AND blocknumber >= ?", d.chain, int64(from)); err != nil {
+		return fmt.Errorf("删除孤块合约交互记录失败: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM activity_blocks WHERE chain = ? AND blocknumber >= ?", d.chain, int64(from)); err != nil {
+		return fmt.Errorf("删除孤块交互记录失败: %w", err)
+	}
+	return nil
+}
+
+// pruneBlockHashes 只保留最近 keep 个区块的哈希
+func (d *Downloader) pruneBlockHashes(ctx context.Context, last, keep uint64) error {
+	if last <= keep {
+		return nil
+	}
+	_, err := d.db.ExecContext(ctx, "DELETE FROM block_hashes WHERE chain = ? AND blocknumber < ?", d.chain, int64(last-keep))
+	return err
+}
@@ -0,0 +1,146 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 被限流的 key 的冷却时长
+const (
+	keyCooldown      = 2 * time.Second // 每秒限额被打满
+	keyDailyCooldown = time.Hour       // 每日额度用尽
+)
+
+// ErrNoEtherscanKey 没有可用的 Etherscan key（未配置或全部无效）
+var ErrNoEtherscanKey = errors.New("没有可用的 Etherscan API key")
+
+// etherscanKey 单个 key 及其限速状态
+type etherscanKey struct {
+	value    string
+	limiter  *RateLimiter
+	cooldown time.Time // 在此之前不使用该 key
+	disabled bool      // key 无效，本次运行不再使用
+}
+
+// KeyPool Etherscan API key 池：轮询分配，每个 key 单独限速，被限流的 key 冷却，无效 key 停用
+type KeyPool struct {
+	mu   sync.Mutex
+	keys []*etherscanKey
+	next int
+}
+
+// NewKeyPool 创建 key 池，ratePerKey 为每个 key 每秒请求数
+func NewKeyPool(keys []string, ratePerKey int) *KeyPool {
+	if ratePerKey <= 0 {
+		ratePerKey = 5
+	}
+	p := &KeyPool{}
+	for _, k := range keys {
+		if k = strings.TrimSpace(k); k != "" {
+			p.keys = append(p.keys, &etherscanKey{value: k, limiter: NewRateLimiter(ratePerKey)})
+		}
+	}
+	return p
+}
+
+// Size 返回 key 数量
+func (p *KeyPool) Size() int {
+	return len(p.keys)
+}
+
+// Acquire 取下一个可用 key 并等待其速率预算；所有 key 都在冷却时等待最早恢复的那个
+func (p *KeyPool) Acquire(ctx context.Context) (*etherscanKey, error) {
+	for {
+		k, wait, err := p.pick()
+		if err != nil {
+			return nil, err
+		}
+		if k != nil {
+			if err := k.limiter.WaitContext(ctx); err != nil {
+				return nil, err
+			}
+			return k, nil
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// pick 轮询选出未冷却的 key；都在冷却时返回需要等待的时长
+func (p *KeyPool) pick() (*etherscanKey, time.Duration, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var earliest time.Time
+	for i := 0; i < len(p.keys); i++ {
+		k := p.keys[(p.next+i)%len(p.keys)]
+		if k.disabled {
+			continue
+		}
+		if now.Before(k.cooldown) {
+			if earliest.IsZero() || k.cooldown.Before(earliest) {
+				earliest = k.cooldown
+			}
+			continue
+		}
+		p.next = (p.next + i + 1) % len(p.keys)
+		return k, 0, nil
+	}
+	if earliest.IsZero() {
+		return nil, 0, ErrNoEtherscanKey
+	}
+	return nil, time.Until(earliest), nil
+}
+
+// Report 根据请求结果更新 key 状态：限流则冷却，无效则停用
+func (p *KeyPool) Report(k *etherscanKey, err error) {
+	if k == nil || err == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case errors.Is(err, ErrEtherscanInvalidKey):
+		if !k.disabled {
+			k.disabled = true
+			log.Printf("🚫 Etherscan key %s 无效，已停用: %v\n", maskKey(k.value), err)
+		}
+	case errors.Is(err, ErrEtherscanRateLimited):
+		d := keyCooldown
+		if strings.Contains(strings.ToLower(err.Error()), "daily") {
+			d = keyDailyCooldown
+		}
+		k.cooldown = time.Now().Add(d)
+		log.Printf("⏳ Etherscan key %s 被限流，冷却 %s\n", maskKey(k.value), d)
+	}
+}
+
+// Stop 停止所有 key 的限速器
+func (p *KeyPool) Stop() {
+	for _, k := range p.keys {
+		k.limiter.Stop()
+	}
+}
+
+// maskKey 日志中只显示 key 的首尾
+func maskKey(k string) string {
+	if len(k) <= 8 {
+		return "****"
+	}
+	return fmt.Sprintf("%s...%s", k[:4], k[len(k)-4:])
+}
+
+// isRetryableEtherscanErr 换一个 key 或稍后重试可能成功的错误
+func isRetryableEtherscanErr(err error) bool {
+	return errors.Is(err, ErrEtherscanRateLimited) || errors.Is(err, ErrEtherscanInvalidKey)
+}
@@ -0,0 +1,413 @@
+package download
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 合约类型标签（contract_tags.tag）
+const (
+	KindERC20     = "erc20"
+	KindERC721    = "erc721"
+	KindERC1155   = "erc1155"
+	KindERC4626   = "erc4626"
+	KindUniV2Pair = "univ2-pair"
+	KindMultisig  = "multisig"
+	KindProxy     = "proxy"
+	KindUnknown   = "unknown"
+)
+
+// Kinds 全部类型标签
+var Kinds = []string{KindERC20, KindERC721, KindERC1155, KindERC4626, KindUniV2Pair, KindMultisig, KindProxy, KindUnknown}
+
+// kindAliases -t-kind 接受的别名
+var kindAliases = map[string]string{
+	"erc-20":          KindERC20,
+	"erc-721":         KindERC721,
+	"erc-1155":        KindERC1155,
+	"erc-4626":        KindERC4626,
+	"univ2":           KindUniV2Pair,
+	"uniswap-v2-pair": KindUniV2Pair,
+	"safe":            KindMultisig,
+}
+
+// kindSignatures 各类型必须具备的函数签名；一个类型有多种实现时任一组全部命中即可
+var kindSignatures = []struct {
+	kind     string
+	variants [][]string
+}{
+	{KindERC20, [][]string{{
+		"totalSupply()", "balanceOf(address)", "transfer(address,uint256)",
+		"transferFrom(address,address,uint256)", "approve(address,uint256)", "allowance(address,address)",
+	}}},
+	{KindERC721, [][]string{{
+		"balanceOf(address)", "ownerOf(uint256)", "transferFrom(address,address,uint256)",
+		"safeTransferFrom(address,address,uint256)", "approve(address,uint256)", "getApproved(uint256)",
+		"setApprovalForAll(address,bool)", "isApprovedForAll(address,address)",
+	}}},
+	{KindERC1155, [][]string{{
+		"balanceOf(address,uint256)", "balanceOfBatch(address[],uint256[])",
+		"safeTransferFrom(address,address,uint256,uint256,bytes)", "safeBatchTransferFrom(address,address,uint256[],uint256[],bytes)",
+		"setApprovalForAll(address,bool)", "isApprovedForAll(address,address)",
+	}}},
+	{KindERC4626, [][]string{{
+		"asset()", "totalAssets()", "convertToShares(uint256)", "convertToAssets(uint256)",
+		"deposit(uint256,address)", "mint(uint256,address)", "withdraw(uint256,address,address)", "redeem(uint256,address,address)",
+	}}},
+	{KindUniV2Pair, [][]string{{
+		"token0()", "token1()", "getReserves()", "swap(uint256,uint256,address,bytes)",
+		"mint(address)", "burn(address)", "skim(address)", "sync()",
+	}}},
+	{KindMultisig, [][]string{
+		// Safe (Gnosis Safe)
+		{"getOwners()", "getThreshold()", "execTransaction(address,uint256,bytes,uint8,uint256,uint256,uint256,address,address,bytes)"},
+		// Gnosis MultiSigWallet 及其衍生实现
+		{"getOwners()", "required()", "submitTransaction(address,uint256,bytes)", "confirmTransaction(uint256)", "executeTransaction(uint256)"},
+	}},
+}
+
+// kindSelectors kindSignatures 对应的选择器
+var kindSelectors = func() map[string][][]string {
+	out := make(map[string][][]string)
+	for _, k := range kindSignatures {
+		for _, sigs := range k.variants {
+			sels := make([]string, len(sigs))
+			for i, s := range sigs {
+				sels[i] = SelectorOf(s)
+			}
+			out[k.kind] = append(out[k.kind], sels)
+		}
+	}
+	return out
+}()
+
+// ClassifySelectors 按函数选择器集合判断合约类型（可能同时属于多个类型，如 ERC-4626 同时是 ERC-20）
+func ClassifySelectors(selectors []string) []string {
+	have := make(map[string]bool, len(selectors))
+	for _, s := range selectors {
+		have[strings.ToLower(s)] = true
+	}
+	var kinds []string
+	for _, k := range kindSignatures {
+		for _, sels := range kindSelectors[k.kind] {
+			if hasAll(have, sels) {
+				kinds = append(kinds, k.kind)
+				break
+			}
+		}
+	}
+	return kinds
+}
+
+// hasAll have 是否包含全部 sels
+func hasAll(have map[string]bool, sels []string) bool {
+	for _, s := range sels {
+		if !have[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// abiSelectors 解析 ABI JSON 中全部函数的选择器；未验证合约的 ABI 字段是提示文字，解析失败时返回 nil
+func abiSelectors(abiJSON string) []string {
+	abiJSON = strings.TrimSpace(abiJSON)
+	if !strings.HasPrefix(abiJSON, "[") {
+		return nil
+	}
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		return nil
+	}
+	out := make([]string, 0, len(parsed.Methods))
+	for _, m := range parsed.Methods {
+		out = append(out, "0x"+hex.EncodeToString(m.ID))
+	}
+	return out
+}
+
+// ParseKindList 解析 -t-kind 的逗号分隔列表：类型名表示只要这些类型（任一），前缀 ! 表示排除
+func ParseKindList(s string) ([]string, error) {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		neg := strings.HasPrefix(part, "!")
+		name := strings.TrimSpace(strings.TrimPrefix(part, "!"))
+		if alias, ok := kindAliases[name]; ok {
+			name = alias
+		}
+		known := false
+		for _, k := range Kinds {
+			if k == name {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown contract kind %q, must be one of: %s", name, strings.Join(Kinds, ", "))
+		}
+		if neg {
+			name = "!" + name
+		}
+		out = append(out, name)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("contract kind list is empty")
+	}
+	return out, nil
+}
+
+// KindFilterSQL 返回按类型标签过滤的 SQL 条件，chainCol / addrCol 为合约表的链与地址列；
+// kinds 为 ParseKindList 的结果：命中任一包含类型，且不带任何排除类型
+func KindFilterSQL(chainCol, addrCol string, kinds []string) (string, []interface{}) {
+	var include, exclude []interface{}
+	for _, k := range kinds {
+		if strings.HasPrefix(k, "!") {
+			exclude = append(exclude, strings.TrimPrefix(k, "!"))
+		} else {
+			include = append(include, k)
+		}
+	}
+	exists := func(values []interface{}) string {
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM contract_tags kt WHERE kt.chain = %s AND kt.address = %s AND kt.tag IN (%s))",
+			chainCol, addrCol, strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", "))
+	}
+	var conds []string
+	var args []interface{}
+	if len(include) > 0 {
+		conds = append(conds, exists(include))
+		args = append(args, include...)
+	}
+	if len(exclude) > 0 {
+		conds = append(conds, "NOT "+exists(exclude))
+		args = append(args, exclude...)
+	}
+	return "(" + strings.Join(conds, " AND ") + ")", args
+}
+
+// queryer *sql.DB 与 *sql.Tx 共有的查询方法
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// classifyContract 判断合约类型：已验证合约按 ABI，否则按字节码提取的选择器（没有字节码时读选择器索引）。
+// 代理合约标记 proxy，并按已入库的实现合约的选择器补充类型（如代理后的 ERC-20）
+func classifyContract(ctx context.Context, q queryer, chain, address, codeHash, abiJSON string, code []byte) ([]string, error) {
+	sels := abiSelectors(abiJSON)
+	if sels == nil && len(code) > 0 {
+		sels = ExtractSelectors(code)
+	}
+	if sels == nil && codeHash != "" {
+		var err error
+		if sels, err = storedSelectors(ctx, q, codeHash); err != nil {
+			return nil, err
+		}
+	}
+	kinds := ClassifySelectors(sels)
+
+	var impl string
+	err := q.QueryRowContext(ctx,
+		"SELECT implementation FROM contract_proxies WHERE chain = ? AND address = ?", chain, address).Scan(&impl)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("查询代理关联失败: %w", err)
+	}
+	if err == nil {
+		kinds = append(kinds, KindProxy)
+		var implHash sql.NullString
+		err := q.QueryRowContext(ctx,
+			"SELECT code_hash FROM contracts WHERE chain = ? AND address = ?", chain, common.HexToAddress(impl).Hex()).Scan(&implHash)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("查询实现合约失败: %w", err)
+		}
+		if implHash.String != "" {
+			implSels, err := storedSelectors(ctx, q, implHash.String)
+			if err != nil {
+				return nil, err
+			}
+			kinds = append(kinds, ClassifySelectors(implSels)...)
+		}
+	}
+
+	if len(kinds) == 0 {
+		return []string{KindUnknown}, nil
+	}
+	seen := make(map[string]bool, len(kinds))
+	out := kinds[:0]
+	for _, k := range kinds {
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// storedSelectors 读取代码哈希的选择器索引
+func storedSelectors(ctx context.Context, q queryer, codeHash string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, "SELECT selector FROM contract_selectors WHERE code_hash = ?", codeHash)
+	if err != nil {
+		return nil, fmt.Errorf("查询选择器失败: %w", err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// saveKinds 在事务内替换合约的类型标签
+func saveKinds(ctx context.Context, tx *sql.Tx, chain, address string, kinds []string) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(Kinds)), ", ")
+	args := []interface{}{chain, address}
+	for _, k := range Kinds {
+		args = append(args, k)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM contract_tags WHERE chain = ? AND address = ? AND tag IN ("+placeholders+")", args...); err != nil {
+		return fmt.Errorf("清除类型标签失败: %w", err)
+	}
+	for _, k := range kinds {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT IGNORE INTO contract_tags (chain, address, tag) VALUES (?, ?, ?)", chain, address, k); err != nil {
+			return fmt.Errorf("写入类型标签失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// classifyInfo 入库时按本次下载的信息判断类型并写入标签（在 saveCode / saveMetadata / saveProxy 之后调用）
+func classifyInfo(ctx context.Context, tx *sql.Tx, chain string, info *ContractInfo) error {
+	abiJSON := ""
+	if info.Metadata != nil {
+		abiJSON = info.Metadata.ABI
+	}
+	code := strings.TrimSpace(info.Bytecode)
+	if code == "" && info.IsOpenSource == 0 && strings.HasPrefix(info.Contract, "0x") {
+		code = strings.TrimSpace(info.Contract)
+	}
+	kinds, err := classifyContract(ctx, tx, chain, info.Address, info.CodeHash, abiJSON, common.FromHex(code))
+	if err != nil {
+		return err
+	}
+	return saveKinds(ctx, tx, chain, info.Address, kinds)
+}
+
+// ClassifyOptions 已入库合约的类型回填参数
+type ClassifyOptions struct {
+	BatchSize    int               // 每批处理的合约数
+	BlockRange   *BlockRangeRecord // 只处理该创建区块范围内的合约，nil 表示全部
+	OnlyUntagged bool              // 只处理还没有类型标签的合约
+}
+
+// ClassifyStored 为已入库合约判断类型并写入标签（ABI 来自 contract_metadata，选择器来自索引或 contracts 中的字节码）
+func (d *Downloader) ClassifyStored(ctx context.Context, opts ClassifyOptions) error {
+	return classifyStored(ctx, d.db, d.chain, opts)
+}
+
+// classifyStored 见 ClassifyStored
+func classifyStored(ctx context.Context, db *sql.DB, chain string, opts ClassifyOptions) error {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	conditions := []string{"c.chain = ?", "c.address > ?"}
+	var filterArgs []interface{}
+	if opts.BlockRange != nil {
+		cond, args := blockRangeCondition(*opts.BlockRange)
+		conditions = append(conditions, "c."+cond)
+		filterArgs = append(filterArgs, args...)
+	}
+	if opts.OnlyUntagged {
+		conditions = append(conditions, "NOT EXISTS (SELECT 1 FROM contract_tags kt WHERE kt.chain = c.chain AND kt.address = c.address)")
+	}
+	query := fmt.Sprintf(`
+	SELECT c.address, COALESCE(c.code_hash, ''), COALESCE(NULLIF(IF(c.isopensource = 0, c.contract, ''), ''), cc.bytecode, ''), COALESCE(m.abi, '')
+	FROM contracts c
+	LEFT JOIN contract_codes cc ON cc.code_hash = c.code_hash AND c.code_hash <> ''
+	LEFT JOIN contract_metadata m ON m.code_hash = c.code_hash AND c.code_hash <> ''
+	WHERE %s ORDER BY c.address LIMIT %d`, strings.Join(conditions, " AND "), opts.BatchSize)
+
+	log.Printf("🏷️  开始判断已入库合约的类型...\n")
+	counts := make(map[string]int)
+	total := 0
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		args := append([]interface{}{chain, cursor}, filterArgs...)
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("查询待分类合约失败: %w", err)
+		}
+		type row struct{ address, codeHash, code, abi string }
+		var batch []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.address, &r.codeHash, &r.code, &r.abi); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		cursor = batch[len(batch)-1].address
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		for _, r := range batch {
+			var code []byte
+			if strings.HasPrefix(r.code, "0x") {
+				code = common.FromHex(r.code)
+			}
+			kinds, err := classifyContract(ctx, tx, chain, r.address, r.codeHash, r.abi, code)
+			if err == nil {
+				err = saveKinds(ctx, tx, chain, r.address, kinds)
+			}
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("合约 %s: %w", r.address, err)
+			}
+			for _, k := range kinds {
+				counts[k]++
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		total += len(batch)
+		log.Printf("🏷️  已分类 %d 个合约，当前位置 %s\n", total, cursor)
+	}
+
+	log.Printf("\n✅ 类型判断完成: %d 个合约\n", total)
+	for _, k := range Kinds {
+		if counts[k] > 0 {
+			log.Printf("   - %s: %d\n", k, counts[k])
+		}
+	}
+	return nil
+}
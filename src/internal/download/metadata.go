@@ -0,0 +1,300 @@
+package download
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContractMetadata 已验证合约的元数据（按代码哈希存入 contract_metadata / contract_sources；
+// 构造参数与代理标记属于验证的地址，按地址存入 contract_address_metadata）
+type ContractMetadata struct {
+	ContractName         string       `json:"contractname"`
+	CompilerVersion      string       `json:"compilerversion"`
+	OptimizationUsed     bool         `json:"optimizationused"`
+	Runs                 int          `json:"runs"`
+	EVMVersion           string       `json:"evmversion"`
+	License              string       `json:"license"`
+	ConstructorArguments string       `json:"constructorargs"` // 验证时提交的构造参数（十六进制，按地址保存）
+	ABI                  string       `json:"abi"`
+	Library              string       `json:"library"`
+	Proxy                bool         `json:"proxy"`          // Etherscan 标记的代理（按地址保存）
+	Implementation       string       `json:"implementation"` // Etherscan 标记的实现合约（按地址保存）
+	SwarmSource          string       `json:"swarmsource"`
+	Language             string       `json:"language"`             // Solidity / Vyper，Standard JSON 输入中的 language
+	Settings             string       `json:"settings"`             // Standard JSON 输入中的 settings（原样 JSON）
+	SourceCode           string       `json:"sourcecode,omitempty"` // Etherscan 返回的原始 SourceCode 字段（其他来源为拼接后的源码）
+	Sources              []SourceFile `json:"sources"`
+	Provider             string       `json:"provider"`  // 提供源码的来源：etherscan | sourcify | sourcify-local | blockscout
+	MatchType            string       `json:"matchtype"` // 匹配程度：full | partial | verified
+}
+
+// SourceFile 单个源文件
+type SourceFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// newContractMetadata 将 Etherscan 返回结果转换为元数据并拆分多文件源码
+func newContractMetadata(res etherscanSourceResult) *ContractMetadata {
+	runs, _ := strconv.Atoi(strings.TrimSpace(res.Runs))
+	meta := &ContractMetadata{
+		ContractName:         strings.TrimSpace(res.ContractName),
+		CompilerVersion:      strings.TrimSpace(res.CompilerVersion),
+		OptimizationUsed:     strings.TrimSpace(res.OptimizationUsed) == "1",
+		Runs:                 runs,
+		EVMVersion:           strings.TrimSpace(res.EVMVersion),
+		License:              strings.TrimSpace(res.LicenseType),
+		ConstructorArguments: strings.TrimSpace(res.ConstructorArguments),
+		ABI:                  res.ABI,
+		Library:              strings.TrimSpace(res.Library),
+		Proxy:                strings.TrimSpace(res.Proxy) == "1",
+		Implementation:       strings.TrimSpace(res.Implementation),
+		SwarmSource:          strings.TrimSpace(res.SwarmSource),
+		SourceCode:           res.SourceCode,
+	}
+	meta.Language, meta.Settings, meta.Sources = parseSourceFiles(meta.ContractName, res.SourceCode)
+	return meta
+}
+
+// parseSourceFiles 拆分 Etherscan 的 SourceCode 字段，支持三种格式：
+//   - {{ ... }}：Standard JSON 输入（外层多一对花括号）
+//   - { "a.sol": {"content": ...}, ... }：旧版多文件格式
+//   - 其他：单文件源码，以 <ContractName>.sol 命名
+func parseSourceFiles(contractName, raw string) (language, settings string, files []SourceFile) {
+	trimmed := strings.TrimSpace(raw)
+	if strings.HasPrefix(trimmed, "{{") && strings.HasSuffix(trimmed, "}}") {
+		var input struct {
+			Language string `json:"language"`
+			Sources  map[string]struct {
+				Content string `json:"content"`
+			} `json:"sources"`
+			Settings json.RawMessage `json:"settings"`
+		}
+		if err := json.Unmarshal([]byte(trimmed[1:len(trimmed)-1]), &input); err == nil && len(input.Sources) > 0 {
+			for path, src := range input.Sources {
+				files = append(files, SourceFile{Path: path, Content: src.Content})
+			}
+			sortSourceFiles(files)
+			return input.Language, string(input.Settings), files
+		}
+	}
+	if strings.HasPrefix(trimmed, "{") {
+		var sources map[string]struct {
+			Content string `json:"content"`
+		}
+		if err := json.Unmarshal([]byte(trimmed), &sources); err == nil && len(sources) > 0 {
+			for path, src := range sources {
+				files = append(files, SourceFile{Path: path, Content: src.Content})
+			}
+			sortSourceFiles(files)
+			return "Solidity", "", files
+		}
+	}
+
+	name := contractName
+	if name == "" {
+		name = "Contract"
+	}
+	return "Solidity", "", []SourceFile{{Path: name + ".sol", Content: raw}}
+}
+
+func sortSourceFiles(files []SourceFile) {
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+}
+
+// MainSource 返回声明了 ContractName 的源文件（找不到时返回第一个文件）
+func (m *ContractMetadata) MainSource() *SourceFile {
+	if len(m.Sources) == 0 {
+		return nil
+	}
+	if m.ContractName != "" {
+		decl := regexp.MustCompile(`(?m)^\s*(abstract\s+)?contract\s+` + regexp.QuoteMeta(m.ContractName) + `\b`)
+		for i := range m.Sources {
+			if decl.MatchString(m.Sources[i].Content) {
+				return &m.Sources[i]
+			}
+		}
+		for i := range m.Sources {
+			base := m.Sources[i].Path[strings.LastIndex(m.Sources[i].Path, "/")+1:]
+			if strings.TrimSuffix(base, ".sol") == m.ContractName {
+				return &m.Sources[i]
+			}
+		}
+	}
+	return &m.Sources[0]
+}
+
+// FlattenSources 将多文件源码拼接为单个文本（主合约文件在前，其余按路径排序），供 AI 分析使用
+func (m *ContractMetadata) FlattenSources() string {
+	if len(m.Sources) == 1 {
+		return m.Sources[0].Content
+	}
+	main := m.MainSource()
+	if main == nil {
+		return m.SourceCode
+	}
+
+	var b strings.Builder
+	write := func(f *SourceFile) {
+		fmt.Fprintf(&b, "// File: %s\n%s\n\n", f.Path, strings.TrimSpace(f.Content))
+	}
+	write(main)
+	for i := range m.Sources {
+		if m.Sources[i].Path != main.Path {
+			write(&m.Sources[i])
+		}
+	}
+	return b.String()
+}
+
+// saveMetadata 在事务内写入代码哈希对应的元数据与源文件，以及 chain 链上 address 自己的构造参数与代理标记
+func saveMetadata(ctx context.Context, tx *sql.Tx, chain, codeHash, address string, m *ContractMetadata) error {
+	if codeHash == "" || m == nil {
+		return nil
+	}
+	if err := saveCodeMetadata(ctx, tx, codeHash, address, m); err != nil {
+		return err
+	}
+	return saveAddressMetadata(ctx, tx, chain, address, m)
+}
+
+// saveCodeMetadata 在事务内写入代码哈希对应的元数据与源文件（同一哈希重复验证时覆盖为最新结果，address 保留首个验证地址）
+func saveCodeMetadata(ctx context.Context, tx *sql.Tx, codeHash, address string, m *ContractMetadata) error {
+	_, err := tx.ExecContext(ctx, `
+	INSERT INTO contract_metadata (code_hash, address, contractname, compilerversion, optimizationused, runs, evmversion, license,
+		abi, library, swarmsource, language, settings, provider, matchtype, updatedat)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())
+	ON DUPLICATE KEY UPDATE
+		contractname = VALUES(contractname),
+		compilerversion = VALUES(compilerversion),
+		optimizationused = VALUES(optimizationused),
+		runs = VALUES(runs),
+		evmversion = VALUES(evmversion),
+		license = VALUES(license),
+		abi = VALUES(abi),
+		library = VALUES(library),
+		swarmsource = VALUES(swarmsource),
+		language = VALUES(language),
+		settings = VALUES(settings),
+		provider = VALUES(provider),
+		matchtype = VALUES(matchtype),
+		updatedat = VALUES(updatedat)
+	`,
+		codeHash, address, m.ContractName, m.CompilerVersion, m.OptimizationUsed, m.Runs, m.EVMVersion, m.License,
+		m.ABI, m.Library, m.SwarmSource, m.Language, m.Settings, m.Provider, m.MatchType,
+	)
+	if err != nil {
+		return fmt.Errorf("写入合约元数据失败: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM contract_sources WHERE code_hash = ?", codeHash); err != nil {
+		return fmt.Errorf("清理旧源文件失败: %w", err)
+	}
+	for _, f := range m.Sources {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO contract_sources (code_hash, path, content) VALUES (?, ?, ?)",
+			codeHash, f.Path, f.Content); err != nil {
+			return fmt.Errorf("写入源文件 %s 失败: %w", f.Path, err)
+		}
+	}
+	return nil
+}
+
+// saveAddressMetadata 在事务内写入验证结果中属于该地址的部分（构造参数、Etherscan 代理标记），重复验证时覆盖
+func saveAddressMetadata(ctx context.Context, tx *sql.Tx, chain, address string, m *ContractMetadata) error {
+	if address == "" || m == nil {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+	INSERT INTO contract_address_metadata (chain, address, constructorargs, proxy, implementation, updatedat)
+	VALUES (?, ?, ?, ?, ?, NOW())
+	ON DUPLICATE KEY UPDATE
+		constructorargs = VALUES(constructorargs),
+		proxy = VALUES(proxy),
+		implementation = VALUES(implementation),
+		updatedat = VALUES(updatedat)
+	`, chain, address, m.ConstructorArguments, m.Proxy, m.Implementation); err != nil {
+		return fmt.Errorf("写入合约 %s 的验证信息失败: %w", address, err)
+	}
+	return nil
+}
+
+// LoadContractMetadata 按链与地址读取已存储的合约元数据（通过 contracts.code_hash 关联），没有记录时返回 nil。
+// 构造参数与代理标记只取该地址自己的验证结果，同哈希的其他地址的不会带过来
+func LoadContractMetadata(ctx context.Context, db *sql.DB, chain, address string) (*ContractMetadata, error) {
+	address = strings.TrimSpace(address)
+	var codeHash sql.NullString
+	err := db.QueryRowContext(ctx, "SELECT code_hash FROM contracts WHERE chain = ? AND address = ?", chain, address).Scan(&codeHash)
+	if err == sql.ErrNoRows || (err == nil && codeHash.String == "") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询合约代码哈希失败: %w", err)
+	}
+	m, err := loadMetadataByHash(ctx, db, codeHash.String)
+	if err != nil || m == nil {
+		return m, err
+	}
+	if err := loadAddressMetadata(ctx, db, chain, address, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// loadAddressMetadata 读取地址自己的构造参数与代理标记填入 m，没有记录时保持为空
+func loadAddressMetadata(ctx context.Context, db queryer, chain, address string, m *ContractMetadata) error {
+	var args, impl sql.NullString
+	var proxy sql.NullBool
+	err := db.QueryRowContext(ctx,
+		"SELECT constructorargs, proxy, implementation FROM contract_address_metadata WHERE chain = ? AND address = ?",
+		chain, address).Scan(&args, &proxy, &impl)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("查询合约 %s 的验证信息失败: %w", address, err)
+	}
+	m.ConstructorArguments, m.Proxy, m.Implementation = args.String, proxy.Bool, impl.String
+	return nil
+}
+
+// loadMetadataByHash 按代码哈希读取元数据与源文件（不含按地址保存的部分），没有记录时返回 nil
+func loadMetadataByHash(ctx context.Context, db *sql.DB, codeHash string) (*ContractMetadata, error) {
+	m := &ContractMetadata{}
+	var settings, library, swarm, provider, match sql.NullString
+	err := db.QueryRowContext(ctx, `
+	SELECT contractname, compilerversion, optimizationused, runs, evmversion, license,
+		abi, library, swarmsource, language, settings, provider, matchtype
+	FROM contract_metadata WHERE code_hash = ?`, codeHash).Scan(
+		&m.ContractName, &m.CompilerVersion, &m.OptimizationUsed, &m.Runs, &m.EVMVersion, &m.License,
+		&m.ABI, &library, &swarm, &m.Language, &settings, &provider, &match,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询合约元数据失败: %w", err)
+	}
+	m.Library, m.SwarmSource, m.Settings = library.String, swarm.String, settings.String
+	m.Provider, m.MatchType = provider.String, match.String
+
+	rows, err := db.QueryContext(ctx, "SELECT path, content FROM contract_sources WHERE code_hash = ? ORDER BY path", codeHash)
+	if err != nil {
+		return nil, fmt.Errorf("查询合约源文件失败: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f SourceFile
+		if err := rows.Scan(&f.Path, &f.Content); err != nil {
+			return nil, err
+		}
+		m.Sources = append(m.Sources, f)
+	}
+	return m, rows.Err()
+}
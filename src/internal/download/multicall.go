@@ -0,0 +1,77 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Multicall3Address Multicall3 在各主流 EVM 链上的统一部署地址
+var Multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+const multicall3ABIJSON = `[
+{"name":"aggregate3","type":"function","stateMutability":"payable",
+ "inputs":[{"name":"calls","type":"tuple[]","components":[
+   {"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}]}],
+ "outputs":[{"name":"returnData","type":"tuple[]","components":[
+   {"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}]}]},
+{"name":"getEthBalance","type":"function","stateMutability":"view",
+ "inputs":[{"name":"addr","type":"address"}],
+ "outputs":[{"name":"balance","type":"uint256"}]}
+]`
+
+var multicall3ABI = mustParseABI(multicall3ABIJSON)
+
+func mustParseABI(s string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// mcCall Multicall3 子调用
+type mcCall struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+// mcResult Multicall3 子调用结果
+type mcResult struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// multicall 通过 Multicall3.aggregate3 一次 eth_call 执行多个只读调用（允许单个子调用失败）
+func (d *Downloader) multicall(ctx context.Context, calls []mcCall, block *big.Int) ([]mcResult, error) {
+	if len(calls) == 0 {
+		return nil, nil
+	}
+	for i := range calls {
+		calls[i].AllowFailure = true
+	}
+	data, err := multicall3ABI.Pack("aggregate3", calls)
+	if err != nil {
+		return nil, fmt.Errorf("编码 multicall 失败: %w", err)
+	}
+
+	raw, err := d.Client.CallContract(ctx, ethereum.CallMsg{To: &Multicall3Address, Data: data}, block)
+	if err != nil {
+		return nil, fmt.Errorf("multicall 调用失败: %w", err)
+	}
+	out, err := multicall3ABI.Unpack("aggregate3", raw)
+	if err != nil {
+		return nil, fmt.Errorf("解码 multicall 结果失败: %w", err)
+	}
+	results := *abi.ConvertType(out[0], new([]mcResult)).(*[]mcResult)
+	if len(results) != len(calls) {
+		return nil, fmt.Errorf("multicall 返回 %d 个结果，期望 %d 个", len(results), len(calls))
+	}
+	return results, nil
+}
@@ -0,0 +1,600 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// PipelineOptions 区块并行下载参数
+type PipelineOptions struct {
+	Workers         int    // 并发抓取区块的 worker 数
+	RPCRate         int    // 每个 RPC 节点每秒请求预算（chains.<chain>.rpc[].rate 可单独覆盖）
+	CheckpointEvery int    // 每顺序提交多少个区块就写入一次 download_progress
+	Trace           string // 内部创建发现方式：auto | debug | parity | logs | off
+	CreationLookup  string // 按地址下载的合约查找创建区块的方式：auto | explorer | archive | off
+}
+
+// DefaultPipelineOptions 返回默认的并行下载参数
+func DefaultPipelineOptions() PipelineOptions {
+	return PipelineOptions{
+		Workers:         4,
+		RPCRate:         20,
+		CheckpointEvery: 100,
+		Trace:           TraceAuto,
+		CreationLookup:  CreationAuto,
+	}
+}
+
+// normalize 补全非法/缺省值
+func (o PipelineOptions) normalize() PipelineOptions {
+	def := DefaultPipelineOptions()
+	if o.Workers <= 0 {
+		o.Workers = def.Workers
+	}
+	if o.RPCRate <= 0 {
+		o.RPCRate = def.RPCRate
+	}
+	if o.CheckpointEvery <= 0 {
+		o.CheckpointEvery = def.CheckpointEvery
+	}
+	if o.Trace == "" {
+		o.Trace = def.Trace
+	}
+	if o.CreationLookup == "" {
+		o.CreationLookup = def.CreationLookup
+	}
+	return o
+}
+
+// SetPipelineOptions 设置并行下载参数（worker 数与每个 RPC 节点的请求预算）
+func (d *Downloader) SetPipelineOptions(opts PipelineOptions) {
+	opts = opts.normalize()
+	d.pipeline = opts
+	if pool, ok := d.Client.(*RPCPool); ok {
+		pool.SetDefaultRate(opts.RPCRate)
+	}
+}
+
+// blockResult worker 处理单个区块的结果
+type blockResult struct {
+	num       uint64
+	hash      common.Hash // 区块哈希（跟随模式下用于重组检测）
+	parent    common.Hash
+	contracts []*ContractInfo
+	activity  *blockActivity // 区块内的合约交互，nil 表示已计入或未抓取
+	skipped   bool           // 区块已在数据库中，跳过
+	err       error          // 非 nil 表示该区块处理失败，checkpoint 不能覆盖它
+}
+
+// runBlockPipeline 并发抓取 [start, end] 内的区块，由单个有序写入者按区块号顺序提交合约，
+// 并且仅当某区块之下的所有区块都已完成时才推进 download_progress。
+// 失败的区块不会写入进度（留下空洞，下次运行会自动重试），同时计入 download_failures。
+func (d *Downloader) runBlockPipeline(ctx context.Context, start, end uint64) pipelineStats {
+	opts := d.pipeline.normalize()
+
+	// 区间内此前失败过的区块，本次成功后移出失败队列
+	retried, err := d.failedBlocksIn(ctx, start, end)
+	if err != nil {
+		log.Printf("⚠️  查询失败队列失败: %v\n", err)
+	}
+
+	// window 限制在途区块数，避免写入者缓冲无限增长
+	window := make(chan struct{}, opts.Workers*16)
+	jobs := make(chan uint64)
+	results := make(chan *blockResult, opts.Workers)
+
+	// 分派者
+	go func() {
+		defer close(jobs)
+		for n := start; n <= end; n++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- n:
+			case <-ctx.Done():
+				return
+			}
+			if n == ^uint64(0) {
+				return
+			}
+		}
+	}()
+
+	// worker 池
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				results <- d.processBlock(ctx, n, retried[n])
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// 有序写入者
+	var stats pipelineStats
+	pending := make(map[uint64]*blockResult)
+	next := start
+	segStart := start // 当前连续成功区间的起点
+	sinceFlush := 0
+
+	// flush 将 [segStart, segEnd] 写入 download_progress，成功后推进 segStart。
+	// ctx 取消后仍需落盘已完成的区间，因此不跟随 ctx 取消
+	saveCtx := context.WithoutCancel(ctx)
+	flush := func(segEnd uint64) {
+		if segEnd < segStart {
+			return
+		}
+		if err := d.markProgress(saveCtx, BlockRangeRecord{Start: segStart, End: segEnd}); err != nil {
+			log.Printf("⚠️  保存下载进度失败: %v\n", err)
+			return
+		}
+		segStart = segEnd + 1
+		sinceFlush = 0
+	}
+
+	for res := range results {
+		pending[res.num] = res
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+
+			failed := r.err != nil
+			if !failed && len(r.contracts) > 0 {
+				// 同一区块的合约在一个事务内写入，失败时整块重试，不会留下只保存了一部分的区块
+				if err := d.saveContracts(ctx, r.contracts); err != nil {
+					log.Printf("❌ 保存区块 %d 的合约失败: %v\n", r.num, err)
+					failed = true
+				} else {
+					for _, info := range r.contracts {
+						log.Printf("✅ 发现合约: %s (区块 %d)\n", info.Address, r.num)
+					}
+					stats.contracts += len(r.contracts)
+				}
+			}
+
+			// 合约入库后再计入交互，同区块创建并被调用的合约也能统计到
+			if !failed && r.activity != nil {
+				if err := d.applyActivity(ctx, r.num, r.activity); err != nil {
+					log.Printf("❌ 更新区块 %d 交互记录失败: %v\n", r.num, err)
+					failed = true
+				}
+			}
+
+			if !failed && d.recordHashes && r.hash != (common.Hash{}) {
+				if err := d.saveBlockHash(ctx, r.num, r.hash, r.parent); err != nil {
+					log.Printf("⚠️  记录区块 %d 哈希失败: %v\n", r.num, err)
+				}
+			}
+
+			switch {
+			case failed:
+				// ctx 取消导致的失败不刷屏，也不计入失败队列
+				if r.err != nil && !errors.Is(r.err, context.Canceled) {
+					log.Printf("❌ 处理区块 %d 失败: %v\n", r.num, r.err)
+				}
+				cause := r.err
+				if cause == nil {
+					cause = errors.New("保存区块数据失败")
+				}
+				d.recordFailure(ctx, FailBlock, strconv.FormatUint(r.num, 10), cause)
+				stats.failed++
+				// 失败区块前的连续区间可以落盘，失败区块本身留作空洞
+				if r.num > segStart {
+					flush(r.num - 1)
+				}
+				segStart = r.num + 1
+			case r.skipped:
+				stats.skipped++
+				if stats.skipped%100 == 0 {
+					log.Printf("⏭️  已跳过 %d 个已下载的区块...\n", stats.skipped)
+				}
+			}
+			if !failed && retried[r.num] {
+				if err := d.clearFailure(saveCtx, FailBlock, strconv.FormatUint(r.num, 10)); err != nil {
+					log.Printf("⚠️  移出失败队列失败: 区块 %d -> %v\n", r.num, err)
+				}
+			}
+
+			next++
+			sinceFlush++
+			<-window
+			if sinceFlush >= opts.CheckpointEvery {
+				flush(next - 1)
+			}
+		}
+	}
+
+	// 收尾：写入最后一段已连续完成的区间（ctx 取消时也会走到这里）
+	if next > segStart {
+		flush(next - 1)
+	}
+	if len(pending) > 0 {
+		log.Printf("⚠️  有 %d 个区块已抓取但其之前存在未完成区块，未写入下载进度\n", len(pending))
+	}
+	stats.done = next - start
+	return stats
+}
+
+// pipelineStats 下载统计
+type pipelineStats struct {
+	contracts int
+	skipped   int
+	failed    int
+	done      uint64 // 已顺序提交的区块数
+}
+
+// processBlock worker 处理单个区块：抓取区块、批量获取收据、组装合约信息（不写库）。
+// retried 为此前失败过的区块，可能只保存了部分合约，只按 download_progress 判断是否已下载（已存在的合约在组装时跳过）
+func (d *Downloader) processBlock(ctx context.Context, blockNum uint64, retried bool) *blockResult {
+	res := &blockResult{num: blockNum}
+
+	// 检查区块是否已在数据库（谨慎双重判断）；合约已存在但交互尚未计入时仍需抓取区块
+	var downloaded bool
+	var err error
+	if retried {
+		downloaded, err = d.blockCovered(ctx, blockNum)
+	} else {
+		downloaded, err = d.IsBlockDownloaded(ctx, blockNum)
+	}
+	if err != nil {
+		log.Printf("⚠️  检查区块 %d 状态失败: %v\n", blockNum, err)
+	} else if downloaded {
+		applied, err := d.activityApplied(ctx, blockNum)
+		if err != nil {
+			log.Printf("⚠️  检查区块 %d 交互统计状态失败: %v\n", blockNum, err)
+		}
+		if err != nil || applied {
+			res.skipped = true
+			return res
+		}
+	}
+
+	block, err := d.Client.BlockByNumber(ctx, new(big.Int).SetUint64(blockNum))
+	if err != nil {
+		res.err = fmt.Errorf("获取区块失败: %w", err)
+		return res
+	}
+	res.hash = block.Hash()
+	res.parent = block.ParentHash()
+
+	res.activity, err = d.collectActivity(ctx, block)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	if downloaded {
+		res.skipped = true
+		return res
+	}
+
+	// 顶层合约创建交易的 To 地址为 nil
+	var creations []*types.Transaction
+	txIndex := make(map[common.Hash]int)
+	for i, tx := range block.Transactions() {
+		if tx.To() == nil {
+			creations = append(creations, tx)
+			txIndex[tx.Hash()] = i
+		}
+	}
+
+	var found []createdContract
+	if len(creations) > 0 {
+		receipts, err := d.fetchReceipts(ctx, blockNum, creations)
+		if err != nil {
+			res.err = fmt.Errorf("获取交易收据失败: %w", err)
+			return res
+		}
+		for _, tx := range creations {
+			receipt := receipts[tx.Hash()]
+			if receipt == nil || receipt.ContractAddress == (common.Address{}) {
+				continue
+			}
+			// 发送方在 BlockByNumber 时已由节点返回并缓存，通常不需要额外请求
+			from, err := d.Client.TransactionSender(ctx, tx, block.Hash(), uint(txIndex[tx.Hash()]))
+			if err != nil {
+				log.Printf("⚠️  获取创建交易 %s 的发送方失败: %v\n", tx.Hash().Hex(), err)
+			}
+			nonce := tx.Nonce()
+			found = append(found, createdContract{
+				Address:  receipt.ContractAddress,
+				TxHash:   tx.Hash(),
+				Deployer: from,
+				Nonce:    &nonce,
+				InitCode: tx.Data(),
+			})
+		}
+	}
+
+	// 工厂合约内部 CREATE/CREATE2 创建的合约
+	if len(block.Transactions()) > 0 {
+		internals, err := d.discoverInternalCreations(ctx, block)
+		if err != nil {
+			res.err = fmt.Errorf("发现内部创建失败: %w", err)
+			return res
+		}
+		found = append(found, internals...)
+	}
+	if len(found) == 0 {
+		return res
+	}
+	log.Printf("📦 处理区块 %d (共 %d 笔交易, %d 个新合约)...\n", blockNum, len(block.Transactions()), len(found))
+
+	blockTime := time.Unix(int64(block.Time()), 0)
+	seen := make(map[common.Address]bool, len(found))
+	for _, c := range found {
+		if seen[c.Address] {
+			continue
+		}
+		seen[c.Address] = true
+
+		info, err := d.buildContractInfo(ctx, c, blockNum, blockTime)
+		if err != nil {
+			res.err = err
+			return res
+		}
+		if info != nil {
+			res.contracts = append(res.contracts, info)
+		}
+	}
+	return res
+}
+
+// buildContractInfo 读取字节码、源码与余额并组装 ContractInfo；合约已存在时返回 nil
+func (d *Downloader) buildContractInfo(ctx context.Context, c createdContract, blockNum uint64, blockTime time.Time) (*ContractInfo, error) {
+	addr := c.Address
+	contractAddr := addr.Hex()
+
+	// 再次检查合约是否已存在
+	exists, err := d.ContractExists(ctx, contractAddr)
+	if err != nil {
+		return nil, fmt.Errorf("检查合约存在失败: %w", err)
+	}
+	if exists {
+		return nil, nil
+	}
+
+	// 获取合约字节码
+	code, err := d.Client.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取合约 %s 代码失败: %w", contractAddr, err)
+	}
+	// 内部创建的合约若当前已无代码（同交易内自毁等），不收录
+	if len(code) == 0 && c.Factory != (common.Address{}) {
+		return nil, nil
+	}
+
+	var factory, deployer string
+	if c.Factory != (common.Address{}) {
+		factory = c.Factory.Hex()
+	}
+	if c.Deployer != (common.Address{}) {
+		deployer = c.Deployer.Hex()
+	}
+
+	rc := d.resolveCode(ctx, contractAddr, code)
+
+	// 识别代理失败不影响合约入库
+	proxy, err := d.detectProxy(ctx, addr, code, rc.Meta)
+	if err != nil {
+		log.Printf("⚠️  识别代理失败: %s -> %v\n", contractAddr, err)
+	}
+
+	return &ContractInfo{
+		Address:       contractAddr,
+		Contract:      rc.Contract,
+		Balance:       d.fetchBalance(ctx, addr),
+		IsOpenSource:  rc.IsOpenSource,
+		SourceChecked: rc.Checked,
+		CreateTime:    blockTime,
+		CreateBlock:   blockNum,
+		TxLast:        blockTime,
+		IsDecompiled:  0,  // 默认未反编译
+		DedCode:       "", // 默认空
+		Factory:       factory,
+		CreationTx:    c.TxHash.Hex(),
+		Deployer:      deployer,
+		Nonce:         c.Nonce,
+		Creation:      newCreationInfo(c.InitCode, code, rc.Meta),
+		CodeHash:      rc.Hash,
+		Bytecode:      fmt.Sprintf("0x%x", code),
+		Metadata:      rc.Meta,
+		Proxy:         proxy,
+	}, nil
+}
+
+// resolvedCode resolveCode 的结果
+type resolvedCode struct {
+	Hash         string
+	Contract     string // 已验证为源码，否则为字节码
+	IsOpenSource int
+	Checked      bool              // 验证状态是否确定（源码查询失败时为 false，之后会重新查询）
+	Meta         *ContractMetadata // 仅在本次新查询到已验证源码时非 nil（复用的哈希其元数据已在库中）；代理标记只来自本地址的查询
+}
+
+// resolveCode 计算代码哈希；哈希的验证状态已确定时直接复用其源码，否则依次查询各源码来源
+func (d *Downloader) resolveCode(ctx context.Context, address string, code []byte) resolvedCode {
+	res := resolvedCode{
+		Hash:     CodeHash(code, d.stripMetadata),
+		Contract: fmt.Sprintf("0x%x", code),
+	}
+	rec, err := d.lookupCode(ctx, res.Hash)
+	if err != nil {
+		log.Printf("⚠️  %v\n", err)
+	}
+	if rec != nil && rec.IsOpenSource == 1 && rec.Source != "" {
+		res.Contract, res.IsOpenSource, res.Checked = rec.Source, 1, true
+		return res
+	}
+	if rec != nil && rec.checkedOn(d.chain) {
+		res.Checked = true
+		return res
+	}
+
+	meta, queried := d.resolveSource(ctx, address)
+	if meta == nil && queried {
+		meta = d.matchMetadataHash(ctx, address, code)
+	}
+	res.Checked = queried
+	if meta != nil {
+		res.Contract, res.IsOpenSource, res.Meta = meta.SourceCode, 1, meta
+	}
+	// 只缓存确定的结果，源码查询失败的哈希下次仍会重新查询
+	if queried && res.Hash != "" {
+		rec := &codeRecord{CodeHash: res.Hash, IsOpenSource: res.IsOpenSource, Checked: true, FirstChain: d.chain}
+		if res.IsOpenSource == 1 {
+			rec.Source = res.Contract
+		}
+		d.codes.put(rec)
+	}
+	return res
+}
+
+// matchMetadataHash 地址未验证时，按字节码中的 IPFS 元数据哈希在支持该查找的来源中找同一份 metadata.json；
+// 查找失败只记录日志，不影响"未验证"的结论
+func (d *Downloader) matchMetadataHash(ctx context.Context, address string, code []byte) *ContractMetadata {
+	bm := DecodeMetadata(code)
+	if bm == nil || bm.HashKind != MetaHashIPFS {
+		return nil
+	}
+	for _, p := range d.providers {
+		src, ok := p.(MetadataHashSource)
+		if !ok {
+			continue
+		}
+		meta, err := src.FetchByMetadataHash(ctx, bm.Hash)
+		if err != nil {
+			log.Printf("⚠️  按元数据哈希查找源码失败: %s (%s) -> %v\n", address, bm.Hash, err)
+			continue
+		}
+		if meta != nil {
+			log.Printf("🧩 %s 未验证，但元数据哈希 %s 与本地 Sourcify 仓库中的合约一致，已取回源码\n", address, bm.Hash)
+			// 构造参数与代理标记属于仓库中的那个地址，不能记到本地址上
+			meta.ConstructorArguments, meta.Proxy, meta.Implementation = "", false, ""
+			return meta
+		}
+	}
+	return nil
+}
+
+// resolveSource 按配置顺序依次向各源码来源查询，第一个返回已验证结果的来源胜出；
+// queried 表示是否拿到了确定的验证结果：所有来源都明确答复"未验证"才算确定，
+// 任一来源查询失败且其余来源都未命中时视为未确定，之后会重新查询
+func (d *Downloader) resolveSource(ctx context.Context, address string) (meta *ContractMetadata, queried bool) {
+	// 未配置任何可用来源，直接保存字节码
+	if len(d.providers) == 0 {
+		return nil, false
+	}
+
+	var failed []string
+	for _, p := range d.providers {
+		m, err := p.FetchSource(ctx, address)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, false
+			}
+			failed = append(failed, fmt.Sprintf("%s: %v", p.Name(), err))
+			continue
+		}
+		if m != nil {
+			return m, true
+		}
+	}
+	if len(failed) == 0 {
+		return nil, true
+	}
+
+	// 查询失败时回退为字节码并计入失败队列（-d -retry-failures 重试）
+	log.Printf("⚠️  查询源码失败 for %s: %s，回退保存字节码\n", address, strings.Join(failed, "; "))
+	d.recordFailure(ctx, FailAddress, address, errors.New(strings.Join(failed, "; ")))
+	return nil, false
+}
+
+// fetchBalance 获取合约余额（wei，全精度十进制字符串），失败时记为 0
+func (d *Downloader) fetchBalance(ctx context.Context, addr common.Address) string {
+	balance, err := d.Client.BalanceAt(ctx, addr, nil)
+	if err != nil {
+		log.Printf("⚠️  获取余额失败: %s -> %v\n", addr.Hex(), err)
+		return "0"
+	}
+	return balance.String()
+}
+
+// fetchReceipts 获取合约创建交易的收据：优先 eth_getBlockReceipts（一次请求整块），
+// 节点不支持时回退为批量 JSON-RPC eth_getTransactionReceipt。
+func (d *Downloader) fetchReceipts(ctx context.Context, blockNum uint64, txs []*types.Transaction) (map[common.Hash]*types.Receipt, error) {
+	out := make(map[common.Hash]*types.Receipt, len(txs))
+
+	if !d.noBlockReceipts.Load() {
+		receipts, err := d.Client.BlockReceipts(ctx, rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(blockNum)))
+		if err == nil {
+			for _, r := range receipts {
+				if r != nil {
+					out[r.TxHash] = r
+				}
+			}
+			return out, nil
+		}
+		if isMethodNotSupported(err) {
+			log.Printf("ℹ️  节点不支持 eth_getBlockReceipts，改用批量收据请求: %v\n", err)
+			d.noBlockReceipts.Store(true)
+		}
+	}
+
+	elems := make([]rpc.BatchElem, len(txs))
+	receipts := make([]*types.Receipt, len(txs))
+	for i, tx := range txs {
+		elems[i] = rpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args:   []interface{}{tx.Hash()},
+			Result: &receipts[i],
+		}
+	}
+	if err := d.Client.BatchCallContext(ctx, elems); err != nil {
+		return nil, err
+	}
+	for i, e := range elems {
+		if e.Error != nil {
+			return nil, fmt.Errorf("交易 %s: %w", txs[i].Hash().Hex(), e.Error)
+		}
+		if receipts[i] != nil {
+			out[txs[i].Hash()] = receipts[i]
+		}
+	}
+	return out, nil
+}
+
+// isMethodNotSupported 判断 RPC 错误是否为节点不支持该方法
+func isMethodNotSupported(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601 {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "method not found") ||
+		strings.Contains(msg, "does not exist") ||
+		strings.Contains(msg, "not supported") ||
+		strings.Contains(msg, "unsupported method")
+}
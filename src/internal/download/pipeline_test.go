@@ -0,0 +1,113 @@
+package download
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/admi-n/solidity-Excavator/src/config"
+)
+
+// testdata/pipeline_blocks.jsonl 由 FixtureRecorder（即 -rpc-record）在本地 geth 开发链（chain id 1337）上录制：
+// 区块 1 部署 A（每次调用发出一条 LOG0），区块 2 调用 A、部署 B（附带 1000 wei）并向普通地址转账，区块 3 各调用一次 A 与 B
+const (
+	fixtureDeployer = "0x71562b71999873DB5b286dF957af199Ec94617F7"
+	fixtureA        = "0x3A220f351252089D385b29beca14e27F204c296A"
+	fixtureB        = "0x537e697c7AB75A26f9ECF0Ce810e3154dFcaaf44"
+)
+
+func TestRunBlockPipelineFixture(t *testing.T) {
+	ctx := context.Background()
+	reader, err := NewFixtureReader(filepath.Join("testdata", "pipeline_blocks.jsonl"), 1337)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	store, err := config.OpenStore("sqlite:" + filepath.Join(t.TempDir(), "pipeline.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := config.CheckSchema(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Downloader{Client: reader, store: store, db: store.DB(), chain: "eth", stripMetadata: true, codes: newCodeCache()}
+	d.SetPipelineOptions(PipelineOptions{Workers: 2, Trace: TraceOff, CreationLookup: CreationOff})
+
+	stats := d.runBlockPipeline(ctx, 1, 3)
+	if stats.contracts != 2 || stats.failed != 0 || stats.done != 3 {
+		t.Fatalf("stats = %+v, want 2 contracts, 0 failed, 3 done", stats)
+	}
+	if len(reader.fixture.misses) > 0 {
+		t.Fatalf("requests missing from fixture: %v", reader.fixture.misses)
+	}
+
+	want := map[string]struct {
+		createBlock int64
+		txCount     int64
+		balance     string
+		runtime     string
+	}{
+		fixtureA: {createBlock: 1, txCount: 2, balance: "0", runtime: "60006000a000"},
+		fixtureB: {createBlock: 2, txCount: 1, balance: "1000", runtime: "600160005500"},
+	}
+	rows, err := store.DB().QueryContext(ctx,
+		"SELECT address, createblock, deployer, txcount, CAST(balance AS CHAR), contract, code_hash FROM contracts WHERE chain = ?", "eth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	seen := 0
+	for rows.Next() {
+		var addr, deployer, balance, code, codeHash string
+		var createBlock, txCount int64
+		if err := rows.Scan(&addr, &createBlock, &deployer, &txCount, &balance, &code, &codeHash); err != nil {
+			t.Fatal(err)
+		}
+		w, ok := want[addr]
+		if !ok {
+			t.Errorf("unexpected contract %s", addr)
+			continue
+		}
+		seen++
+		if createBlock != w.createBlock || txCount != w.txCount || balance != w.balance {
+			t.Errorf("%s: createblock=%d txcount=%d balance=%s, want %d %d %s", addr, createBlock, txCount, balance, w.createBlock, w.txCount, w.balance)
+		}
+		if deployer != fixtureDeployer {
+			t.Errorf("%s: deployer = %s, want %s", addr, deployer, fixtureDeployer)
+		}
+		if !strings.EqualFold(code, "0x"+w.runtime) || codeHash == "" {
+			t.Errorf("%s: contract = %s code_hash = %q, want runtime 0x%s", addr, code, codeHash, w.runtime)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if seen != len(want) {
+		t.Fatalf("saved %d contracts, want %d", seen, len(want))
+	}
+
+	recs, err := d.loadProgress(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].Start != 1 || recs[0].End != 3 {
+		t.Fatalf("download_progress = %+v, want [1-3]", recs)
+	}
+
+	// 再次运行时全部区块已下载且交互已计入，不重复计数
+	again := d.runBlockPipeline(ctx, 1, 3)
+	if again.skipped != 3 || again.contracts != 0 {
+		t.Fatalf("second run stats = %+v, want 3 skipped", again)
+	}
+	var total int64
+	if err := store.DB().QueryRowContext(ctx, "SELECT SUM(txcount) FROM contracts WHERE chain = ?", "eth").Scan(&total); err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 {
+		t.Fatalf("txcount sum after second run = %d, want 3", total)
+	}
+}
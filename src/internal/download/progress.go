@@ -0,0 +1,185 @@
+package download
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// defaultChain 未指定链时使用的链名
+const defaultChain = "eth"
+
+// legacyBlockedFile 旧版本记录已下载区间的文件，数据库中没有进度时导入一次
+const legacyBlockedFile = "blocked.json"
+
+// loadProgress 读取本链已下载的区块区间（按起点升序）。
+// 数据库中还没有记录时，若当前目录存在旧版 blocked.json 则导入
+func (d *Downloader) loadProgress(ctx context.Context) ([]BlockRangeRecord, error) {
+	recs, err := queryProgress(ctx, d.db, d.chain)
+	if err != nil || len(recs) > 0 {
+		return recs, err
+	}
+
+	legacy, err := loadLegacyBlockedRanges()
+	if err != nil {
+		log.Printf("⚠️  读取旧版 %s 失败: %v（忽略）\n", legacyBlockedFile, err)
+		return nil, nil
+	}
+	for _, r := range legacy {
+		if err := d.markProgress(ctx, r); err != nil {
+			return nil, fmt.Errorf("导入 %s 失败: %w", legacyBlockedFile, err)
+		}
+	}
+	if len(legacy) > 0 {
+		log.Printf("📥 已从 %s 导入 %d 个已下载区间到 download_progress（该文件不再使用，可删除）\n", legacyBlockedFile, len(legacy))
+		return queryProgress(ctx, d.db, d.chain)
+	}
+	return nil, nil
+}
+
+// queryProgress 读取链的已下载区间（按起点升序）
+func queryProgress(ctx context.Context, db *sql.DB, chain string) ([]BlockRangeRecord, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT startblock, endblock FROM download_progress WHERE chain = ? ORDER BY startblock", chain)
+	if err != nil {
+		return nil, fmt.Errorf("查询下载进度失败: %w", err)
+	}
+	defer rows.Close()
+
+	var recs []BlockRangeRecord
+	for rows.Next() {
+		var r BlockRangeRecord
+		if err := rows.Scan(&r.Start, &r.End); err != nil {
+			return nil, err
+		}
+		recs = append(recs, r)
+	}
+	return recs, rows.Err()
+}
+
+// markProgress 记录本链 [r.Start, r.End] 已下载
+func (d *Downloader) markProgress(ctx context.Context, r BlockRangeRecord) error {
+	return saveProgressRange(ctx, d.db, d.chain, r)
+}
+
+// saveProgressRange 在事务内锁定与 r 重叠或相邻的区间，合并为一条记录。
+// 只锁相邻区间，多个下载器处理不同区段时互不阻塞
+func saveProgressRange(ctx context.Context, db *sql.DB, chain string, r BlockRangeRecord) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// endblock + 1 >= start 写成 endblock >= start - 1，start 为 0 时不会下溢
+	lo := r.Start
+	if lo > 0 {
+		lo--
+	}
+	rows, err := tx.QueryContext(ctx, `
+	SELECT startblock, endblock FROM download_progress
+	WHERE chain = ? AND startblock <= ? AND endblock >= ?
+	FOR UPDATE`, chain, r.End+1, lo)
+	if err != nil {
+		return fmt.Errorf("查询相邻区间失败: %w", err)
+	}
+	merged := r
+	var starts []uint64
+	for rows.Next() {
+		var s, e uint64
+		if err := rows.Scan(&s, &e); err != nil {
+			rows.Close()
+			return err
+		}
+		starts = append(starts, s)
+		if s < merged.Start {
+			merged.Start = s
+		}
+		if e > merged.End {
+			merged.End = e
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range starts {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM download_progress WHERE chain = ? AND startblock = ?", chain, s); err != nil {
+			return fmt.Errorf("合并区间失败: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO download_progress (chain, startblock, endblock, updatedat) VALUES (?, ?, ?, NOW())",
+		chain, merged.Start, merged.End); err != nil {
+		return fmt.Errorf("写入下载进度失败: %w", err)
+	}
+	return tx.Commit()
+}
+
+// truncateProgress 在事务内去掉 from 及之后的已下载区间（重组回滚时使用）
+func (d *Downloader) truncateProgress(ctx context.Context, tx *sql.Tx, from uint64) error {
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM download_progress WHERE chain = ? AND startblock >= ?", d.chain, from); err != nil {
+		return fmt.Errorf("删除回滚区间失败: %w", err)
+	}
+	if from == 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE download_progress SET endblock = ?, updatedat = NOW() WHERE chain = ? AND endblock >= ?",
+		from-1, d.chain, from); err != nil {
+		return fmt.Errorf("截断回滚区间失败: %w", err)
+	}
+	return nil
+}
+
+// blockCovered 区块是否落在已下载区间内
+func (d *Downloader) blockCovered(ctx context.Context, blockNum uint64) (bool, error) {
+	var one int
+	err := d.db.QueryRowContext(ctx, `
+	SELECT 1 FROM download_progress
+	WHERE chain = ? AND startblock <= ? AND endblock >= ?
+	LIMIT 1`, d.chain, blockNum, blockNum).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// coveredThrough 返回从 from 起在已下载区间内连续覆盖到的最后一个区块；from 本身未覆盖时返回 from-1
+func (d *Downloader) coveredThrough(ctx context.Context, from uint64) (uint64, error) {
+	recs, err := queryProgress(ctx, d.db, d.chain)
+	if err != nil {
+		return 0, err
+	}
+	last := from - 1
+	for _, r := range recs {
+		if r.Start > last+1 {
+			break
+		}
+		if r.End > last {
+			last = r.End
+		}
+	}
+	return last, nil
+}
+
+// loadLegacyBlockedRanges 读取旧版 blocked.json（文件不存在时返回空）
+func loadLegacyBlockedRanges() ([]BlockRangeRecord, error) {
+	bs, err := os.ReadFile(legacyBlockedFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var recs []BlockRangeRecord
+	if err := json.Unmarshal(bs, &recs); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", legacyBlockedFile, err)
+	}
+	return recs, nil
+}
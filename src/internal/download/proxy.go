@@ -0,0 +1,189 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// 代理类型
+const (
+	ProxyEIP1167     = "eip1167"     // 最小代理（clone），实现地址写死在字节码中
+	ProxyEIP1967     = "eip1967"     // EIP-1967 实现槽（UUPS 等）
+	ProxyTransparent = "transparent" // EIP-1967 实现槽 + admin 槽（OpenZeppelin TransparentUpgradeableProxy）
+	ProxyBeacon      = "beacon"      // EIP-1967 beacon 槽，实现地址来自 beacon.implementation()
+	ProxyEIP1822     = "eip1822"     // EIP-1822 PROXIABLE 槽
+	ProxyZeppelinOS  = "zeppelinos"  // 旧版 ZeppelinOS 实现槽
+	ProxyEtherscan   = "etherscan"   // 仅由 Etherscan 的 Proxy/Implementation 字段识别
+)
+
+// 代理相关的知名存储槽
+var (
+	slotEIP1967Impl   = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	slotEIP1967Beacon = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50")
+	slotEIP1967Admin  = common.HexToHash("0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103")
+	slotEIP1822       = common.HexToHash("0xc5f16f0fcc639fa48a6947836d9850f504798523bf8c9a3a87d5876cf622bcf7")
+	slotZeppelinOS    = common.HexToHash("0x7050c9e0f4ca769c69bd3a8ef740bc37934f8e2c036e5a723fd8ee048ed3f8c3")
+
+	// beaconImplementationSelector implementation()
+	beaconImplementationSelector = []byte{0x5c, 0x60, 0xda, 0x1b}
+
+	// EIP-1167 runtime：363d3d373d3d3d363d73 <20 字节地址> 5af43d82803e903d91602b57fd5bf3
+	eip1167Prefix = common.FromHex("0x363d3d373d3d3d363d73")
+	eip1167Suffix = common.FromHex("0x5af43d82803e903d91602b57fd5bf3")
+)
+
+// ProxyInfo 代理合约与其实现合约的关联
+type ProxyInfo struct {
+	Kind           string `json:"kind"`
+	Implementation string `json:"implementation"`
+	Beacon         string `json:"beacon"` // beacon 代理的 beacon 地址
+	Admin          string `json:"admin"`  // transparent 代理的 admin 地址
+}
+
+// detectProxy 依次通过 EIP-1167 字节码、知名存储槽与 Etherscan 元数据识别代理；不是代理时返回 nil。
+// meta 只能是 addr 自己的验证结果：同哈希其他地址或元数据哈希匹配来的实现地址不可信，不作为回退
+func (d *Downloader) detectProxy(ctx context.Context, addr common.Address, code []byte, meta *ContractMetadata) (*ProxyInfo, error) {
+	if len(code) == 0 {
+		return nil, nil
+	}
+	if impl, ok := parseEIP1167(code); ok {
+		return &ProxyInfo{Kind: ProxyEIP1167, Implementation: impl.Hex()}, nil
+	}
+
+	// 一次批量请求读取所有候选槽
+	slots := []common.Hash{slotEIP1967Impl, slotEIP1967Beacon, slotEIP1967Admin, slotEIP1822, slotZeppelinOS}
+	values := make([]hexutil.Bytes, len(slots))
+	elems := make([]rpc.BatchElem, len(slots))
+	for i, slot := range slots {
+		elems[i] = rpc.BatchElem{
+			Method: "eth_getStorageAt",
+			Args:   []interface{}{addr, slot, "latest"},
+			Result: &values[i],
+		}
+	}
+	if err := d.Client.BatchCallContext(ctx, elems); err != nil {
+		return nil, fmt.Errorf("读取代理存储槽失败: %w", err)
+	}
+	slotAddr := func(i int) common.Address {
+		if elems[i].Error != nil || len(values[i]) == 0 {
+			return common.Address{}
+		}
+		return common.BytesToAddress(values[i])
+	}
+
+	if impl := slotAddr(0); impl != (common.Address{}) {
+		info := &ProxyInfo{Kind: ProxyEIP1967, Implementation: impl.Hex()}
+		if admin := slotAddr(2); admin != (common.Address{}) {
+			info.Kind = ProxyTransparent
+			info.Admin = admin.Hex()
+		}
+		return info, nil
+	}
+	if beacon := slotAddr(1); beacon != (common.Address{}) {
+		impl, err := d.beaconImplementation(ctx, beacon)
+		if err != nil {
+			return nil, err
+		}
+		return &ProxyInfo{Kind: ProxyBeacon, Implementation: impl.Hex(), Beacon: beacon.Hex()}, nil
+	}
+	if impl := slotAddr(3); impl != (common.Address{}) {
+		return &ProxyInfo{Kind: ProxyEIP1822, Implementation: impl.Hex()}, nil
+	}
+	if impl := slotAddr(4); impl != (common.Address{}) {
+		return &ProxyInfo{Kind: ProxyZeppelinOS, Implementation: impl.Hex()}, nil
+	}
+
+	if impl := explorerImplementation(meta); impl != "" {
+		return &ProxyInfo{Kind: ProxyEtherscan, Implementation: impl}, nil
+	}
+	return nil, nil
+}
+
+// explorerImplementation 返回浏览器为该地址记录的实现地址，没有记录或不是合法地址时返回空
+func explorerImplementation(meta *ContractMetadata) string {
+	if meta == nil || !meta.Proxy || !common.IsHexAddress(meta.Implementation) {
+		return ""
+	}
+	return common.HexToAddress(meta.Implementation).Hex()
+}
+
+// parseEIP1167 解析 EIP-1167 最小代理字节码中的实现地址
+func parseEIP1167(code []byte) (common.Address, bool) {
+	if len(code) != len(eip1167Prefix)+common.AddressLength+len(eip1167Suffix) {
+		return common.Address{}, false
+	}
+	if !bytes.HasPrefix(code, eip1167Prefix) || !bytes.HasSuffix(code, eip1167Suffix) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(code[len(eip1167Prefix) : len(eip1167Prefix)+common.AddressLength]), true
+}
+
+// beaconImplementation 调用 beacon.implementation() 获取当前实现地址
+func (d *Downloader) beaconImplementation(ctx context.Context, beacon common.Address) (common.Address, error) {
+	out, err := d.Client.CallContract(ctx, ethereum.CallMsg{To: &beacon, Data: beaconImplementationSelector}, nil)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("调用 beacon %s 失败: %w", beacon.Hex(), err)
+	}
+	if len(out) < 32 {
+		return common.Address{}, fmt.Errorf("beacon %s 返回数据长度异常: %d", beacon.Hex(), len(out))
+	}
+	return common.BytesToAddress(out[:32]), nil
+}
+
+// saveProxy 在事务内写入代理 -> 实现关联（实现地址升级后覆盖为最新值）
+func saveProxy(ctx context.Context, tx *sql.Tx, chain, address string, p *ProxyInfo) error {
+	if p == nil {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `
+	INSERT INTO contract_proxies (chain, address, kind, implementation, beacon, admin, detectedat)
+	VALUES (?, ?, ?, ?, ?, ?, NOW())
+	ON DUPLICATE KEY UPDATE
+		kind = VALUES(kind),
+		implementation = VALUES(implementation),
+		beacon = VALUES(beacon),
+		admin = VALUES(admin),
+		detectedat = VALUES(detectedat)
+	`, chain, address, p.Kind, p.Implementation, p.Beacon, p.Admin)
+	if err != nil {
+		return fmt.Errorf("写入代理关联失败: %w", err)
+	}
+	return nil
+}
+
+// ResolveProxy 返回地址的代理信息：读取链上最新状态（实现可能已升级）并更新 contract_proxies；
+// 不是代理时返回 nil
+func (d *Downloader) ResolveProxy(ctx context.Context, address string) (*ProxyInfo, error) {
+	addr := common.HexToAddress(strings.TrimSpace(address))
+	code, err := d.Client.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取合约 %s 代码失败: %w", addr.Hex(), err)
+	}
+	// 只取该地址自己记录的验证结果，不经代码哈希借用其他地址的实现
+	meta := &ContractMetadata{}
+	if err := loadAddressMetadata(ctx, d.db, d.chain, strings.TrimSpace(address), meta); err != nil {
+		return nil, err
+	}
+	p, err := d.detectProxy(ctx, addr, code, meta)
+	if err != nil || p == nil {
+		return nil, err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := saveProxy(ctx, tx, d.chain, strings.TrimSpace(address), p); err != nil {
+		return nil, err
+	}
+	return p, tx.Commit()
+}
@@ -0,0 +1,515 @@
+package download
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// 语料清理策略（db prune -policy）
+const (
+	PruneDupCode        = "dup-code"       // 零余额重复代码：清空 contracts.contract 中的字节码正文，保留地址 -> code_hash
+	PruneSelfDestructed = "selfdestructed" // 链上已无代码的合约：删除合约行及不再被引用的代码
+	PruneDecompiled     = "decompiled"     // 清空早于 N 天写入的反编译输出（dedcode）
+)
+
+// prunePolicies 执行顺序：先删除自毁合约，其余策略不再计入已删除的行
+var prunePolicies = []string{PruneSelfDestructed, PruneDupCode, PruneDecompiled}
+
+// pruneChunk 按地址批量读写时每批的数量
+const pruneChunk = 500
+
+// PruneOptions 清理参数
+type PruneOptions struct {
+	Chain          string
+	Policies       []string          // 见 Prune* 常量
+	DecompiledDays int               // decompiled：只清理早于该天数写入的反编译输出，0 表示全部
+	BlockRange     *BlockRangeRecord // 只处理该创建区块范围内的合约，nil 表示全部
+	BatchSize      int               // selfdestructed：每批 eth_getCode 请求的合约数
+}
+
+// PruneStat 单个策略的清理统计（字节数按列长度估算）
+type PruneStat struct {
+	Policy string
+	Rows   int64 // 受影响的合约行
+	Bytes  int64 // 预计释放的字节数
+	Codes  int64 // selfdestructed：随之删除的、不再被任何合约引用的代码哈希数
+}
+
+// PrunePlan 预览结果：ApplyPrune 按它执行，自毁合约不再重复查询节点
+type PrunePlan struct {
+	Options PruneOptions
+	Stats   []PruneStat
+
+	destroyed []string          // 链上已无代码的地址
+	hashes    map[string]string // destroyed 地址 -> code_hash
+	orphans   []string          // 删除 destroyed 后不再被引用的代码哈希
+}
+
+// Total 全部策略合计
+func (p *PrunePlan) Total() PruneStat {
+	t := PruneStat{Policy: "total"}
+	for _, s := range p.Stats {
+		t.Rows += s.Rows
+		t.Bytes += s.Bytes
+		t.Codes += s.Codes
+	}
+	return t
+}
+
+// ParsePrunePolicies 解析逗号分隔的策略列表，返回按执行顺序排列的去重结果
+func ParsePrunePolicies(s string) ([]string, error) {
+	want := make(map[string]bool)
+	for _, p := range strings.Split(s, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		known := false
+		for _, k := range prunePolicies {
+			if p == k {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown prune policy %q, must be: %s", p, strings.Join(prunePolicies, " | "))
+		}
+		want[p] = true
+	}
+	var out []string
+	for _, k := range prunePolicies {
+		if want[k] {
+			out = append(out, k)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no prune policy given, must be: %s", strings.Join(prunePolicies, " | "))
+	}
+	return out, nil
+}
+
+// PlanPrune 统计各策略会清理的行数与字节数，不修改数据。
+// selfdestructed 需要 reader 逐批查询链上代码，其余策略只读数据库（reader 可为 nil）
+func PlanPrune(ctx context.Context, db *sql.DB, reader ChainReader, opts PruneOptions) (*PrunePlan, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	plan := &PrunePlan{Options: opts, hashes: make(map[string]string)}
+	for _, policy := range opts.Policies {
+		var stat PruneStat
+		var err error
+		switch policy {
+		case PruneSelfDestructed:
+			if reader == nil {
+				return nil, fmt.Errorf("%s 需要连接节点", PruneSelfDestructed)
+			}
+			stat, err = plan.findDestroyed(ctx, db, reader)
+		case PruneDupCode, PruneDecompiled:
+			cond, args, bytesExpr := plan.condition(policy)
+			stat, err = plan.measure(ctx, db, policy, cond, args, bytesExpr)
+		default:
+			err = fmt.Errorf("未知的清理策略: %s", policy)
+		}
+		if err != nil {
+			return nil, err
+		}
+		plan.Stats = append(plan.Stats, stat)
+	}
+	return plan, nil
+}
+
+// condition 策略对 contracts 行的过滤条件与释放字节数的表达式
+func (p *PrunePlan) condition(policy string) (string, []interface{}, string) {
+	conditions := []string{"chain = ?"}
+	args := []interface{}{p.Options.Chain}
+	if p.Options.BlockRange != nil {
+		cond, rangeArgs := blockRangeCondition(*p.Options.BlockRange)
+		conditions = append(conditions, cond)
+		args = append(args, rangeArgs...)
+	}
+
+	bytesExpr := "LENGTH(contract)"
+	switch policy {
+	case PruneDupCode:
+		// 只清理元数据已解析的未开源合约（CBOR 尾部各地址不同，字节码正文清空后无法再解析），
+		// 且 contract_codes 中保存了同哈希的字节码、本行不是该哈希的首个合约，没有原生币与代币余额
+		conditions = append(conditions,
+			"isopensource = 0",
+			"contract <> ''",
+			"code_hash <> ''",
+			"metahashkind IS NOT NULL",
+			"CAST(COALESCE(balance, 0) AS DECIMAL(65,0)) = CAST(0 AS DECIMAL(65,0))",
+			`EXISTS (SELECT 1 FROM contract_codes cc WHERE cc.code_hash = contracts.code_hash AND cc.bytecode <> ''
+				AND NOT (cc.firstchain = contracts.chain AND cc.firstaddress = contracts.address))`,
+			`NOT EXISTS (SELECT 1 FROM contract_token_balances t WHERE t.chain = contracts.chain AND t.address = contracts.address AND CAST(t.balance AS DECIMAL(65,0)) > CAST(0 AS DECIMAL(65,0)))`)
+	case PruneDecompiled:
+		conditions = append(conditions, "dedcode IS NOT NULL", "dedcode <> ''")
+		if p.Options.DecompiledDays > 0 {
+			conditions = append(conditions, "decompiledat < ?")
+			args = append(args, time.Now().AddDate(0, 0, -p.Options.DecompiledDays))
+		}
+		bytesExpr = "LENGTH(dedcode)"
+	}
+	return strings.Join(conditions, " AND "), args, bytesExpr
+}
+
+// measure 统计满足条件的行数与字节数，扣除已计入 selfdestructed 的地址
+func (p *PrunePlan) measure(ctx context.Context, db *sql.DB, policy, cond string, args []interface{}, bytesExpr string) (PruneStat, error) {
+	stat := PruneStat{Policy: policy}
+	query := fmt.Sprintf("SELECT COUNT(*), COALESCE(SUM(%s), 0) FROM contracts WHERE %s", bytesExpr, cond)
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&stat.Rows, &stat.Bytes); err != nil {
+		return stat, fmt.Errorf("统计 %s 失败: %w", policy, err)
+	}
+	for _, chunk := range chunkStrings(p.destroyed, pruneChunk) {
+		in, inArgs := inClause(chunk)
+		var rows, bytes int64
+		if err := db.QueryRowContext(ctx, query+" AND address IN "+in, append(append([]interface{}{}, args...), inArgs...)...).
+			Scan(&rows, &bytes); err != nil {
+			return stat, fmt.Errorf("统计 %s 失败: %w", policy, err)
+		}
+		stat.Rows -= rows
+		stat.Bytes -= bytes
+	}
+	return stat, nil
+}
+
+// findDestroyed 逐批查询链上代码，记录已无代码的合约及删除后不再被引用的代码哈希
+func (p *PrunePlan) findDestroyed(ctx context.Context, db *sql.DB, reader ChainReader) (PruneStat, error) {
+	stat := PruneStat{Policy: PruneSelfDestructed}
+	conditions := []string{"chain = ?", "address > ?"}
+	var filterArgs []interface{}
+	if p.Options.BlockRange != nil {
+		cond, args := blockRangeCondition(*p.Options.BlockRange)
+		conditions = append(conditions, cond)
+		filterArgs = append(filterArgs, args...)
+	}
+	query := fmt.Sprintf("SELECT address, COALESCE(code_hash, '') FROM contracts WHERE %s ORDER BY address LIMIT %d",
+		strings.Join(conditions, " AND "), p.Options.BatchSize)
+
+	log.Printf("💀 查询链上代码以识别已自毁的合约（每批 %d 个）...\n", p.Options.BatchSize)
+	cursor := ""
+	checked, failed := 0, 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return stat, err
+		}
+		args := append([]interface{}{p.Options.Chain, cursor}, filterArgs...)
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return stat, fmt.Errorf("查询合约失败: %w", err)
+		}
+		var addrs []string
+		hashes := make(map[string]string)
+		for rows.Next() {
+			var addr, hash string
+			if err := rows.Scan(&addr, &hash); err != nil {
+				rows.Close()
+				return stat, err
+			}
+			addrs = append(addrs, addr)
+			hashes[addr] = hash
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return stat, err
+		}
+		if len(addrs) == 0 {
+			break
+		}
+		cursor = addrs[len(addrs)-1]
+
+		empty, errs, err := fetchCodeEmpty(ctx, reader, addrs)
+		if err != nil {
+			log.Printf("⚠️  查询代码失败（%s 起的 %d 个合约）: %v\n", addrs[0], len(addrs), err)
+			failed += len(addrs)
+			continue
+		}
+		failed += errs
+		for _, a := range empty {
+			p.destroyed = append(p.destroyed, a)
+			p.hashes[a] = hashes[a]
+		}
+		checked += len(addrs)
+		if checked%(p.Options.BatchSize*50) == 0 {
+			log.Printf("💀 已检查 %d 个合约，已自毁 %d 个，当前位置 %s\n", checked, len(p.destroyed), cursor)
+		}
+	}
+	log.Printf("💀 检查完成: %d 个合约，已自毁 %d 个，查询失败 %d 个（失败的不会被删除）\n", checked, len(p.destroyed), failed)
+
+	for _, chunk := range chunkStrings(p.destroyed, pruneChunk) {
+		in, inArgs := inClause(chunk)
+		var rows, bytes int64
+		if err := db.QueryRowContext(ctx,
+			"SELECT COUNT(*), COALESCE(SUM(LENGTH(contract) + COALESCE(LENGTH(dedcode), 0)), 0) FROM contracts WHERE chain = ? AND address IN "+in,
+			append([]interface{}{p.Options.Chain}, inArgs...)...).Scan(&rows, &bytes); err != nil {
+			return stat, fmt.Errorf("统计自毁合约失败: %w", err)
+		}
+		stat.Rows += rows
+		stat.Bytes += bytes
+	}
+
+	orphans, err := p.findOrphans(ctx, db)
+	if err != nil {
+		return stat, err
+	}
+	p.orphans = orphans
+	stat.Codes = int64(len(orphans))
+	for _, chunk := range chunkStrings(orphans, pruneChunk) {
+		in, inArgs := inClause(chunk)
+		var codeBytes, sourceBytes int64
+		if err := db.QueryRowContext(ctx,
+			"SELECT COALESCE(SUM(LENGTH(bytecode) + COALESCE(LENGTH(source), 0)), 0) FROM contract_codes WHERE code_hash IN "+in, inArgs...).
+			Scan(&codeBytes); err != nil {
+			return stat, fmt.Errorf("统计代码大小失败: %w", err)
+		}
+		if err := db.QueryRowContext(ctx,
+			"SELECT COALESCE(SUM(LENGTH(content)), 0) FROM contract_sources WHERE code_hash IN "+in, inArgs...).
+			Scan(&sourceBytes); err != nil {
+			return stat, fmt.Errorf("统计源文件大小失败: %w", err)
+		}
+		stat.Bytes += codeBytes + sourceBytes
+	}
+	return stat, nil
+}
+
+// findOrphans 删除 destroyed 后不再被任何链上的合约引用的代码哈希
+func (p *PrunePlan) findOrphans(ctx context.Context, db *sql.DB) ([]string, error) {
+	removing := make(map[string]int64)
+	for _, h := range p.hashes {
+		if h != "" {
+			removing[h]++
+		}
+	}
+	hashes := make([]string, 0, len(removing))
+	for h := range removing {
+		hashes = append(hashes, h)
+	}
+
+	var orphans []string
+	for _, chunk := range chunkStrings(hashes, pruneChunk) {
+		in, inArgs := inClause(chunk)
+		rows, err := db.QueryContext(ctx, "SELECT code_hash, COUNT(*) FROM contracts WHERE code_hash IN "+in+" GROUP BY code_hash", inArgs...)
+		if err != nil {
+			return nil, fmt.Errorf("统计代码引用失败: %w", err)
+		}
+		for rows.Next() {
+			var h string
+			var refs int64
+			if err := rows.Scan(&h, &refs); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if refs <= removing[h] {
+				orphans = append(orphans, h)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return orphans, nil
+}
+
+// fetchCodeEmpty 批量 eth_getCode，返回链上已无代码的地址；单个地址查询失败时计入 errs 且不视为已自毁
+func fetchCodeEmpty(ctx context.Context, reader ChainReader, addrs []string) (empty []string, errs int, err error) {
+	elems := make([]rpc.BatchElem, len(addrs))
+	results := make([]hexutil.Bytes, len(addrs))
+	for i, a := range addrs {
+		elems[i] = rpc.BatchElem{
+			Method: "eth_getCode",
+			Args:   []interface{}{common.HexToAddress(a), "latest"},
+			Result: &results[i],
+		}
+	}
+	if err := reader.BatchCallContext(ctx, elems); err != nil {
+		return nil, 0, err
+	}
+	for i, e := range elems {
+		if e.Error != nil {
+			errs++
+			continue
+		}
+		if len(results[i]) == 0 {
+			empty = append(empty, addrs[i])
+		}
+	}
+	return empty, errs, nil
+}
+
+// ApplyPrune 按预览结果执行清理，返回实际影响的行数（数据在预览后发生变化时会与预览不同）
+func ApplyPrune(ctx context.Context, db *sql.DB, plan *PrunePlan) ([]PruneStat, error) {
+	var out []PruneStat
+	for _, policy := range plan.Options.Policies {
+		var stat PruneStat
+		var err error
+		switch policy {
+		case PruneSelfDestructed:
+			stat, err = plan.deleteDestroyed(ctx, db)
+		case PruneDupCode:
+			stat, err = plan.update(ctx, db, policy, "contract = ''")
+		case PruneDecompiled:
+			stat, err = plan.update(ctx, db, policy, "dedcode = NULL, isdecompiled = 0, decompiledat = NULL")
+		}
+		out = append(out, stat)
+		if err != nil {
+			return out, err
+		}
+		log.Printf("🧹 %s: 已处理 %d 行\n", policy, stat.Rows)
+	}
+	return out, nil
+}
+
+// update 按地址分批更新满足策略条件的行（每批重新检查条件）
+func (p *PrunePlan) update(ctx context.Context, db *sql.DB, policy, set string) (PruneStat, error) {
+	stat := PruneStat{Policy: policy}
+	cond, args, _ := p.condition(policy)
+	selectQuery := fmt.Sprintf("SELECT address FROM contracts WHERE %s AND address > ? ORDER BY address LIMIT %d", cond, pruneChunk)
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return stat, err
+		}
+		addrs, err := queryStrings(ctx, db, selectQuery, append(append([]interface{}{}, args...), cursor)...)
+		if err != nil {
+			return stat, fmt.Errorf("查询待清理合约失败: %w", err)
+		}
+		if len(addrs) == 0 {
+			return stat, nil
+		}
+		cursor = addrs[len(addrs)-1]
+
+		in, inArgs := inClause(addrs)
+		res, err := db.ExecContext(ctx, fmt.Sprintf("UPDATE contracts SET %s WHERE %s AND address IN %s", set, cond, in),
+			append(append([]interface{}{}, args...), inArgs...)...)
+		if err != nil {
+			return stat, fmt.Errorf("清理 %s 失败: %w", policy, err)
+		}
+		n, _ := res.RowsAffected()
+		stat.Rows += n
+	}
+}
+
+// deleteDestroyed 删除已自毁合约的各表记录，以及删除后仍无引用的代码哈希
+func (p *PrunePlan) deleteDestroyed(ctx context.Context, db *sql.DB) (PruneStat, error) {
+	stat := PruneStat{Policy: PruneSelfDestructed}
+	for _, chunk := range chunkStrings(p.destroyed, pruneChunk) {
+		n, err := deleteContracts(ctx, db, p.Options.Chain, chunk)
+		if err != nil {
+			return stat, err
+		}
+		stat.Rows += n
+	}
+	for _, chunk := range chunkStrings(p.orphans, pruneChunk) {
+		n, err := deleteOrphanCodes(ctx, db, chunk)
+		if err != nil {
+			return stat, err
+		}
+		stat.Codes += n
+	}
+	return stat, nil
+}
+
+// addressTables 按 (chain, address) 区分的表，删除合约时一并删除
+var addressTables = []string{"contracts", "contract_creations", "contract_proxies", "contract_token_balances", "contract_tags", "contract_address_metadata", "activity_contracts"}
+
+// deleteContracts 在一个事务内删除一批合约在按地址区分的各表中的记录
+func deleteContracts(ctx context.Context, db *sql.DB, chain string, addrs []string) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	deleted, err := deleteAddressRows(ctx, tx, chain, addrs)
+	if err != nil {
+		return 0, err
+	}
+	return deleted, tx.Commit()
+}
+
+// deleteAddressRows 在事务内删除一批地址在 addressTables 中的记录，返回删除的合约数
+func deleteAddressRows(ctx context.Context, tx *sql.Tx, chain string, addrs []string) (int64, error) {
+	in, inArgs := inClause(addrs)
+	args := append([]interface{}{chain}, inArgs...)
+	var deleted int64
+	for _, table := range addressTables {
+		res, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE chain = ? AND address IN "+in, args...)
+		if err != nil {
+			return 0, fmt.Errorf("删除 %s 失败: %w", table, err)
+		}
+		if table == "contracts" {
+			deleted, _ = res.RowsAffected()
+		}
+	}
+	return deleted, nil
+}
+
+// deleteOrphanCodes 删除一批代码哈希中确实已无合约引用的代码、选择器、元数据与源文件
+func deleteOrphanCodes(ctx context.Context, db *sql.DB, hashes []string) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	in, inArgs := inClause(hashes)
+	rows, err := tx.QueryContext(ctx, "SELECT code_hash FROM contract_codes cc WHERE code_hash IN "+in+
+		" AND NOT EXISTS (SELECT 1 FROM contracts c WHERE c.code_hash = cc.code_hash)", inArgs...)
+	if err != nil {
+		return 0, fmt.Errorf("确认代码引用失败: %w", err)
+	}
+	var orphans []string
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		orphans = append(orphans, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(orphans) == 0 {
+		return 0, nil
+	}
+
+	in, inArgs = inClause(orphans)
+	for _, table := range []string{"contract_selectors", "contract_metadata", "contract_sources", "contract_codes"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE code_hash IN "+in, inArgs...); err != nil {
+			return 0, fmt.Errorf("删除 %s 失败: %w", table, err)
+		}
+	}
+	return int64(len(orphans)), tx.Commit()
+}
+
+// inClause 构造 IN 子句的占位符与参数
+func inClause(values []string) (string, []interface{}) {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return "(" + strings.TrimSuffix(strings.Repeat("?,", len(values)), ",") + ")", args
+}
+
+// chunkStrings 按 size 切分
+func chunkStrings(values []string, size int) [][]string {
+	var out [][]string
+	for len(values) > size {
+		out = append(out, values[:size])
+		values = values[size:]
+	}
+	if len(values) > 0 {
+		out = append(out, values)
+	}
+	return out
+}
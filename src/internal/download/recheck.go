@@ -0,0 +1,147 @@
+package download
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// DefaultRecheckSchedule 未开源代码的复查时间点（相对首个合约的创建时间）：合约常在部署后几天内才在浏览器上验证
+var DefaultRecheckSchedule = []time.Duration{24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}
+
+// RecheckOptions 未开源合约复查参数
+type RecheckOptions struct {
+	BatchSize  int             // 每批查询的代码哈希数
+	Schedule   []time.Duration // 复查时间点（升序），nil 为 DefaultRecheckSchedule
+	MinBalance string          // 本链同哈希的合约余额不低于该值（wei）时每次都复查，空表示不按余额复查
+}
+
+// RecheckStats 一次复查的结果
+type RecheckStats struct {
+	Flipped    int // 改判为已开源的代码哈希
+	Unverified int // 仍未开源
+	Failed     int // 查询失败，下次继续
+}
+
+// RecheckVerification 按衰减的时间表复查已确认未开源（checked = 1）的代码哈希：
+// 首个合约创建后满 1 天、1 周、1 月时各查询一次代表地址，本链同哈希合约余额达到 MinBalance 时每次都查询；
+// 已验证时改判同哈希的全部合约为已开源。recheckstage 记录已经过的时间点，错过的时间点只补查一次。
+// 首个合约在其他链上的代码哈希，用本链上同哈希的合约作为代表地址查询本链的浏览器；
+// 时间表仍按首个合约计算，各链共用同一个 recheckstage，先到期的链查询后其他链不再重复查询该时间点
+func (d *Downloader) RecheckVerification(ctx context.Context, opts RecheckOptions) (RecheckStats, error) {
+	var stats RecheckStats
+	if len(d.providers) == 0 {
+		return stats, ErrNoSourceProvider
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Schedule == nil {
+		opts.Schedule = DefaultRecheckSchedule
+	}
+
+	now := time.Now()
+	created := "COALESCE(c.createtime, cc.createdat)"
+	var due []string
+	var dueArgs []interface{}
+	for i, after := range opts.Schedule {
+		due = append(due, fmt.Sprintf("(cc.recheckstage = %d AND %s <= ?)", i, created))
+		dueArgs = append(dueArgs, now.Add(-after))
+	}
+	if opts.MinBalance != "" {
+		due = append(due, "EXISTS (SELECT 1 FROM contracts b WHERE b.chain = ? AND b.code_hash = cc.code_hash AND CAST(b.balance AS DECIMAL(65,0)) >= CAST(? AS DECIMAL(65,0)))")
+		dueArgs = append(dueArgs, d.chain, opts.MinBalance)
+	}
+	// 代表地址：首个合约在本链时用它，否则取本链上同哈希的任一合约
+	query := fmt.Sprintf(`
+	SELECT cc.code_hash,
+		CASE WHEN cc.firstchain = ? THEN cc.firstaddress
+			ELSE (SELECT MIN(o.address) FROM contracts o WHERE o.chain = ? AND o.code_hash = cc.code_hash) END,
+		c.createtime, cc.createdat
+	FROM contract_codes cc LEFT JOIN contracts c ON c.chain = cc.firstchain AND c.address = cc.firstaddress
+	WHERE cc.isopensource = 0 AND cc.checked = 1 AND cc.code_hash > ?
+		AND (cc.firstchain = ? OR EXISTS (SELECT 1 FROM contracts o WHERE o.chain = ? AND o.code_hash = cc.code_hash))
+		AND (%s)
+	ORDER BY cc.code_hash LIMIT %d`, strings.Join(due, " OR "), opts.BatchSize)
+
+	log.Printf("🔁 开始复查未开源合约的验证状态...\n")
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		args := append([]interface{}{d.chain, d.chain, cursor, d.chain, d.chain}, dueArgs...)
+		rows, err := d.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return stats, fmt.Errorf("查询待复查的代码哈希失败: %w", err)
+		}
+		type codeRow struct {
+			hash, address string
+			created       time.Time
+		}
+		var batch []codeRow
+		for rows.Next() {
+			var r codeRow
+			var createTime, createdAt sql.NullTime
+			if err := rows.Scan(&r.hash, &r.address, &createTime, &createdAt); err != nil {
+				rows.Close()
+				return stats, err
+			}
+			// 首个合约已被清理时按代码哈希的入库时间计算
+			r.created = createTime.Time
+			if !createTime.Valid {
+				r.created = createdAt.Time
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return stats, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		cursor = batch[len(batch)-1].hash
+
+		for _, r := range batch {
+			meta, queried := d.resolveSource(ctx, r.address)
+			if !queried {
+				stats.Failed++
+				continue
+			}
+			if meta != nil {
+				if err := d.markVerified(ctx, r.hash, r.address, meta); err != nil {
+					return stats, err
+				}
+				stats.Flipped++
+				log.Printf("✅ %s 已开源 (%s, %s/%s)，已更新同哈希的全部合约\n", r.address, meta.ContractName, meta.Provider, meta.MatchType)
+				continue
+			}
+			if _, err := d.db.ExecContext(ctx,
+				"UPDATE contract_codes SET recheckstage = ?, recheckedat = ? WHERE code_hash = ?",
+				recheckStage(opts.Schedule, now.Sub(r.created)), now, r.hash); err != nil {
+				return stats, fmt.Errorf("更新代码哈希 %s 失败: %w", r.hash, err)
+			}
+			stats.Unverified++
+		}
+		log.Printf("🔁 已复查 %d 个代码哈希（改判已开源 %d，仍未开源 %d，失败 %d）\n",
+			stats.Flipped+stats.Unverified+stats.Failed, stats.Flipped, stats.Unverified, stats.Failed)
+	}
+
+	log.Printf("\n✅ 复查完成: %d 个代码哈希改判为已开源（仍未开源 %d，查询失败 %d）\n", stats.Flipped, stats.Unverified, stats.Failed)
+	return stats, nil
+}
+
+// recheckStage 合约年龄已经过的时间点个数
+func recheckStage(schedule []time.Duration, age time.Duration) int {
+	n := 0
+	for _, after := range schedule {
+		if age >= after {
+			n++
+		}
+	}
+	return n
+}
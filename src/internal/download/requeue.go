@@ -0,0 +1,236 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// RequeueOptions 未开源合约重新查询参数
+type RequeueOptions struct {
+	BatchSize  int               // 每批查询的代码哈希/合约数
+	BlockRange *BlockRangeRecord // 只处理该创建区块范围内的合约，nil 表示全部
+}
+
+// RequeueUnverified 重新查询验证状态未确定的未开源合约：
+// 旧版本把 Etherscan 限流/key 无效的响应当成"未验证"，这些合约以字节码入库且哈希被复用。
+// 先按代码哈希处理 contract_codes 中 checked = 0 的记录（每个哈希查询一次代表地址），
+// 再处理没有 code_hash 的旧数据（按地址查询，同时补算 code_hash）。
+func (d *Downloader) RequeueUnverified(ctx context.Context, opts RequeueOptions) error {
+	if len(d.providers) == 0 {
+		return ErrNoSourceProvider
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	log.Printf("🔁 开始重新查询未确定验证状态的合约...\n")
+	verified, unverified, failed, err := d.requeueCodes(ctx, opts)
+	if err != nil {
+		return err
+	}
+	v2, u2, f2, err := d.requeueLegacy(ctx, opts)
+	if err != nil {
+		return err
+	}
+	verified, unverified, failed = verified+v2, unverified+u2, failed+f2
+
+	log.Printf("\n✅ 重新查询完成!\n")
+	log.Printf("   - 改判为已开源: %d\n", verified)
+	log.Printf("   - 确认未开源: %d\n", unverified)
+	log.Printf("   - 查询失败（下次继续）: %d\n", failed)
+	return nil
+}
+
+// requeueCodes 按代码哈希重新查询
+func (d *Downloader) requeueCodes(ctx context.Context, opts RequeueOptions) (verified, unverified, failed int, err error) {
+	conditions := []string{"firstchain = ?", "isopensource = 0", "checked = 0", "code_hash > ?"}
+	var filterArgs []interface{}
+	if opts.BlockRange != nil {
+		cond, args := blockRangeCondition(*opts.BlockRange)
+		conditions = append(conditions, strings.Replace(cond, "createblock", "firstblock", 1))
+		filterArgs = append(filterArgs, args...)
+	}
+	query := fmt.Sprintf("SELECT code_hash, firstaddress FROM contract_codes WHERE %s ORDER BY code_hash LIMIT %d",
+		strings.Join(conditions, " AND "), opts.BatchSize)
+
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return verified, unverified, failed, err
+		}
+		args := append([]interface{}{d.chain, cursor}, filterArgs...)
+		rows, err := d.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return verified, unverified, failed, fmt.Errorf("查询待重新查询的代码哈希失败: %w", err)
+		}
+		var hashes, addrs []string
+		for rows.Next() {
+			var h, a string
+			if err := rows.Scan(&h, &a); err != nil {
+				rows.Close()
+				return verified, unverified, failed, err
+			}
+			hashes = append(hashes, h)
+			addrs = append(addrs, a)
+		}
+		rows.Close()
+		if len(hashes) == 0 {
+			break
+		}
+		cursor = hashes[len(hashes)-1]
+
+		for i, h := range hashes {
+			meta, queried := d.resolveSource(ctx, addrs[i])
+			if !queried {
+				failed++
+				continue
+			}
+			if err := d.settleCode(ctx, h, addrs[i], meta); err != nil {
+				return verified, unverified, failed, err
+			}
+			if meta == nil {
+				unverified++
+				continue
+			}
+			verified++
+			log.Printf("✅ %s 已开源 (%s, %s/%s)，已更新同哈希的全部合约\n", addrs[i], meta.ContractName, meta.Provider, meta.MatchType)
+		}
+		log.Printf("🔁 已处理 %d 个代码哈希（已开源 %d，未开源 %d，失败 %d）\n", verified+unverified+failed, verified, unverified, failed)
+	}
+	return verified, unverified, failed, nil
+}
+
+// requeueLegacy 处理没有 code_hash 的旧数据：字节码保存在 contract 列中，可据此补算哈希
+func (d *Downloader) requeueLegacy(ctx context.Context, opts RequeueOptions) (verified, unverified, failed int, err error) {
+	conditions := []string{"chain = ?", "isopensource = 0", "(code_hash IS NULL OR code_hash = '')", "address > ?"}
+	var filterArgs []interface{}
+	if opts.BlockRange != nil {
+		cond, args := blockRangeCondition(*opts.BlockRange)
+		conditions = append(conditions, cond)
+		filterArgs = append(filterArgs, args...)
+	}
+	query := fmt.Sprintf("SELECT address, contract, createblock FROM contracts WHERE %s ORDER BY address LIMIT %d",
+		strings.Join(conditions, " AND "), opts.BatchSize)
+
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return verified, unverified, failed, err
+		}
+		args := append([]interface{}{d.chain, cursor}, filterArgs...)
+		rows, err := d.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return verified, unverified, failed, fmt.Errorf("查询旧版未开源合约失败: %w", err)
+		}
+		var batch []*ContractInfo
+		for rows.Next() {
+			info := &ContractInfo{}
+			if err := rows.Scan(&info.Address, &info.Bytecode, &info.CreateBlock); err != nil {
+				rows.Close()
+				return verified, unverified, failed, err
+			}
+			batch = append(batch, info)
+		}
+		rows.Close()
+		if len(batch) == 0 {
+			break
+		}
+		cursor = batch[len(batch)-1].Address
+
+		for _, info := range batch {
+			meta, queried := d.resolveSource(ctx, info.Address)
+			if !queried {
+				failed++
+				continue
+			}
+			if err := d.settleLegacy(ctx, info, meta); err != nil {
+				return verified, unverified, failed, err
+			}
+			if meta != nil {
+				verified++
+			} else {
+				unverified++
+			}
+		}
+		log.Printf("🔁 已处理 %d 个旧版合约（已开源 %d，未开源 %d，失败 %d）\n", verified+unverified+failed, verified, unverified, failed)
+	}
+	return verified, unverified, failed, nil
+}
+
+// settleCode 回写代码哈希确定的验证状态：未验证时标记为已确定，已验证时改判为已开源
+func (d *Downloader) settleCode(ctx context.Context, codeHash, address string, meta *ContractMetadata) error {
+	if meta != nil {
+		return d.markVerified(ctx, codeHash, address, meta)
+	}
+	if _, err := d.db.ExecContext(ctx, "UPDATE contract_codes SET checked = 1 WHERE code_hash = ?", codeHash); err != nil {
+		return fmt.Errorf("更新代码哈希 %s 失败: %w", codeHash, err)
+	}
+	d.codes.put(&codeRecord{CodeHash: codeHash, Checked: true, FirstChain: d.chain})
+	return nil
+}
+
+// settleLegacy 回写没有 code_hash 的旧数据：由 contract 列中的字节码补算哈希，并写入确定的验证状态
+func (d *Downloader) settleLegacy(ctx context.Context, info *ContractInfo, meta *ContractMetadata) error {
+	info.CodeHash = CodeHash(common.FromHex(strings.TrimSpace(info.Bytecode)), d.stripMetadata)
+	info.SourceChecked = true
+	info.Contract = info.Bytecode
+	if meta != nil {
+		info.Contract, info.IsOpenSource, info.Metadata = meta.SourceCode, 1, meta
+	}
+	return d.updateLegacy(ctx, info)
+}
+
+// markVerified 把代码哈希改判为已开源：更新 contract_codes、同哈希的全部合约并写入元数据
+func (d *Downloader) markVerified(ctx context.Context, codeHash, address string, meta *ContractMetadata) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE contract_codes SET source = ?, isopensource = 1, checked = 1 WHERE code_hash = ?",
+		meta.SourceCode, codeHash); err != nil {
+		return fmt.Errorf("更新代码哈希 %s 失败: %w", codeHash, err)
+	}
+	// 同一份代码在各链上的合约都改判（已验证的源码与链无关）
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE contracts SET contract = ?, isopensource = 1 WHERE code_hash = ?",
+		meta.SourceCode, codeHash); err != nil {
+		return fmt.Errorf("更新代码哈希 %s 的合约失败: %w", codeHash, err)
+	}
+	if err := saveMetadata(ctx, tx, d.chain, codeHash, address, meta); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	d.codes.put(&codeRecord{CodeHash: codeHash, Source: meta.SourceCode, IsOpenSource: 1, Checked: true})
+	return nil
+}
+
+// updateLegacy 回写旧版合约的验证状态与补算的 code_hash
+func (d *Downloader) updateLegacy(ctx context.Context, info *ContractInfo) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE contracts SET contract = ?, isopensource = ?, code_hash = ? WHERE chain = ? AND address = ?",
+		info.Contract, info.IsOpenSource, info.CodeHash, d.chain, info.Address); err != nil {
+		return fmt.Errorf("更新合约 %s 失败: %w", info.Address, err)
+	}
+	if err := saveCode(ctx, tx, d.chain, info); err != nil {
+		return fmt.Errorf("保存代码哈希失败: %w", err)
+	}
+	if err := saveMetadata(ctx, tx, d.chain, info.CodeHash, info.Address, info.Metadata); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
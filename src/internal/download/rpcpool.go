@@ -0,0 +1,592 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/admi-n/solidity-Excavator/src/config"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// 节点健康评分与剔除参数
+const (
+	rpcEWMAAlpha      = 0.2              // 延迟与错误率的指数滑动平均系数
+	rpcEjectFailures  = 3                // 连续失败达到该次数时剔除
+	rpcEjectErrorRate = 0.5              // 错误率（滑动平均）超过该值时剔除
+	rpcMinSamples     = 10               // 按错误率剔除前至少需要的请求数
+	rpcBaseCooldown   = 10 * time.Second // 首次剔除的冷却时长，之后每次加倍
+	rpcMaxCooldown    = 5 * time.Minute
+	rpcProbeInterval  = 5 * time.Second // 健康检查间隔：冷却结束的节点探测通过后重新加入
+	rpcProbeTimeout   = 5 * time.Second
+	rpcDialTimeout    = 10 * time.Second
+	rpcCallTimeout    = 60 * time.Second // 单次请求的默认超时（节点未配置 timeout 时），debug_trace* 大区块较慢，不宜过短
+	rpcMinHealth      = 0.05             // 有效权重的下限，慢节点仍会分到少量请求以便恢复评分
+)
+
+// ErrNoRPCEndpoint 没有可用的 RPC 节点
+var ErrNoRPCEndpoint = errors.New("没有可用的 RPC 节点")
+
+// rpcEndpoint 池中的单个节点及其健康状态（状态字段由 RPCPool.mu 保护）
+type rpcEndpoint struct {
+	name    string // 日志中使用的名字（不含路径中的 key）
+	client  *ethclient.Client
+	weight  float64       // 配置的权重
+	rate    int           // 配置的每秒请求数，0 表示使用池的默认值
+	timeout time.Duration // 单次请求的超时，超时计为节点故障并换下一个节点
+	limiter *RateLimiter
+
+	current      float64   // 平滑加权轮询的当前值
+	latency      float64   // 延迟滑动平均（毫秒）
+	errRate      float64   // 错误率滑动平均
+	failures     int       // 连续失败次数
+	ejections    int       // 已被剔除的次数，决定下次冷却时长
+	ejected      bool      // 已剔除，等待健康检查恢复
+	ejectedUntil time.Time // 冷却结束时间
+	requests     uint64
+	errs         uint64
+}
+
+// RPCPool 一条链的 RPC 节点池：按"权重 × 健康度"平滑加权轮询，每个节点单独限速；
+// 连续失败或错误率过高的节点被剔除，冷却后由健康检查探测恢复。节点故障类错误会换下一个节点重试，
+// 业务错误（合约 revert、数据不存在等）直接返回
+type RPCPool struct {
+	chain       config.ChainConfig
+	mu          sync.Mutex
+	endpoints   []*rpcEndpoint
+	defaultRate int
+	recorder    *FixtureRecorder // 非 nil 时录制 HTTP 节点的响应
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewRPCPool 连接链配置中的全部节点并校验 chain id：chain id 不一致的节点直接丢弃，
+// 暂时连不上的节点以剔除状态加入，由健康检查恢复。一个可用节点都没有时返回错误。
+// rec 非 nil 时录制经过 HTTP 节点的全部请求，Close 时一并关闭
+func NewRPCPool(chainCfg config.ChainConfig, defaultRate int, rec *FixtureRecorder) (*RPCPool, error) {
+	if defaultRate <= 0 {
+		defaultRate = DefaultPipelineOptions().RPCRate
+	}
+	p := &RPCPool{chain: chainCfg, defaultRate: defaultRate, recorder: rec, stop: make(chan struct{})}
+
+	type dialed struct {
+		ep  *rpcEndpoint
+		err error
+	}
+	results := make([]dialed, len(chainCfg.RPC))
+	var wg sync.WaitGroup
+	for i, cfg := range chainCfg.RPC {
+		if strings.TrimSpace(cfg.URL) == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, cfg config.RPCEndpoint) {
+			defer wg.Done()
+			ep, err := dialEndpoint(cfg, chainCfg.ChainID, rec)
+			results[i] = dialed{ep, err}
+		}(i, cfg)
+	}
+	wg.Wait()
+
+	healthy := 0
+	var lastErr error
+	for _, r := range results {
+		switch {
+		case r.ep == nil && r.err == nil:
+			continue
+		case r.ep == nil:
+			// chain id 不一致等配置错误，不加入池
+			log.Printf("⚠️  %v\n", r.err)
+			lastErr = r.err
+			continue
+		case r.err != nil:
+			log.Printf("⚠️  RPC 节点 %s 暂不可用，稍后重试: %v\n", r.ep.name, r.err)
+			r.ep.ejected = true
+			r.ep.ejections = 1
+			r.ep.ejectedUntil = time.Now().Add(rpcBaseCooldown)
+			lastErr = r.err
+		default:
+			healthy++
+		}
+		r.ep.limiter = NewRateLimiter(p.rateOf(r.ep))
+		p.endpoints = append(p.endpoints, r.ep)
+	}
+	if healthy == 0 {
+		for _, ep := range p.endpoints {
+			ep.limiter.Stop()
+			ep.client.Close()
+		}
+		if lastErr == nil {
+			lastErr = ErrNoRPCEndpoint
+		}
+		return nil, fmt.Errorf("连接链 %s 的节点失败: %w", chainCfg.Name, lastErr)
+	}
+
+	p.wg.Add(1)
+	go p.healthLoop()
+	return p, nil
+}
+
+// dialEndpoint 连接单个节点并校验 chain id。chain id 不一致时返回 nil 节点；
+// 连接或查询失败时返回节点与错误（节点稍后可能恢复）
+func dialEndpoint(cfg config.RPCEndpoint, chainID uint64, rec *FixtureRecorder) (*rpcEndpoint, error) {
+	name := cfg.Name()
+	client, err := dialClient(strings.TrimSpace(cfg.URL), rec)
+	if err != nil {
+		return nil, fmt.Errorf("连接 %s 失败: %w", name, err)
+	}
+	weight := float64(cfg.Weight)
+	if weight <= 0 {
+		weight = 1
+	}
+	timeout := time.Duration(cfg.Timeout * float64(time.Second))
+	if timeout <= 0 {
+		timeout = rpcCallTimeout
+	}
+	ep := &rpcEndpoint{name: name, client: client, weight: weight, rate: cfg.Rate, timeout: timeout}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcDialTimeout)
+	defer cancel()
+	start := time.Now()
+	id, err := client.ChainID(ctx)
+	if err != nil {
+		return ep, fmt.Errorf("查询 chain id 失败: %w", err)
+	}
+	if id.Uint64() != chainID {
+		client.Close()
+		return nil, fmt.Errorf("RPC 节点 %s 的 chain id 为 %d，与配置的 %d 不一致，已忽略", name, id.Uint64(), chainID)
+	}
+	ep.latency = float64(time.Since(start).Milliseconds())
+	return ep, nil
+}
+
+// dialClient 连接节点；录制时 HTTP 节点的请求经由录制传输层（WebSocket/IPC 不录制）
+func dialClient(rawURL string, rec *FixtureRecorder) (*ethclient.Client, error) {
+	if rec == nil || !(strings.HasPrefix(rawURL, "http://") || strings.HasPrefix(rawURL, "https://")) {
+		return ethclient.Dial(rawURL)
+	}
+	c, err := rpc.DialOptions(context.Background(), rawURL, rpc.WithHTTPClient(&http.Client{Transport: rec.Transport(http.DefaultTransport)}))
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(c), nil
+}
+
+// rateOf 节点的每秒请求数（调用方持有锁或在初始化阶段）
+func (p *RPCPool) rateOf(ep *rpcEndpoint) int {
+	if ep.rate > 0 {
+		return ep.rate
+	}
+	return p.defaultRate
+}
+
+// SetDefaultRate 修改未单独配置 rate 的节点的每秒请求数（-rpc-rate）
+func (p *RPCPool) SetDefaultRate(rate int) {
+	if rate <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if rate == p.defaultRate {
+		return
+	}
+	p.defaultRate = rate
+	for _, ep := range p.endpoints {
+		if ep.rate > 0 {
+			continue
+		}
+		ep.limiter.Stop()
+		ep.limiter = NewRateLimiter(rate)
+	}
+}
+
+// Size 返回池中的节点数
+func (p *RPCPool) Size() int {
+	return len(p.endpoints)
+}
+
+// Names 返回节点名（用于日志）
+func (p *RPCPool) Names() string {
+	names := make([]string, len(p.endpoints))
+	for i, ep := range p.endpoints {
+		names[i] = ep.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// pick 平滑加权轮询选出一个未剔除且本次调用未试过的节点；有效权重 = 配置权重 × (1 - 错误率) × 相对延迟。
+// 全部节点都被剔除时退而选冷却最早结束的节点，避免整个下载停住
+func (p *RPCPool) pick(tried map[*rpcEndpoint]bool) (*rpcEndpoint, *RateLimiter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	best := 0.0
+	for _, ep := range p.endpoints {
+		if !ep.ejected && ep.latency > 0 && (best == 0 || ep.latency < best) {
+			best = ep.latency
+		}
+	}
+
+	var chosen, fallback *rpcEndpoint
+	total := 0.0
+	for _, ep := range p.endpoints {
+		if tried[ep] {
+			continue
+		}
+		if ep.ejected {
+			if fallback == nil || ep.ejectedUntil.Before(fallback.ejectedUntil) {
+				fallback = ep
+			}
+			continue
+		}
+		health := 1 - ep.errRate
+		if best > 0 && ep.latency > best {
+			health *= best / ep.latency
+		}
+		if health < rpcMinHealth {
+			health = rpcMinHealth
+		}
+		eff := ep.weight * health
+		ep.current += eff
+		total += eff
+		if chosen == nil || ep.current > chosen.current {
+			chosen = ep
+		}
+	}
+	if chosen == nil {
+		chosen = fallback
+	} else {
+		chosen.current -= total
+	}
+	if chosen == nil {
+		return nil, nil
+	}
+	return chosen, chosen.limiter
+}
+
+// report 记录一次调用结果并更新健康评分；节点故障累计到阈值时剔除
+func (p *RPCPool) report(ep *rpcEndpoint, elapsed time.Duration, fault bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ep.requests++
+	if !fault {
+		ep.failures = 0
+		ep.errRate *= 1 - rpcEWMAAlpha
+		ms := float64(elapsed.Milliseconds())
+		if ep.latency == 0 {
+			ep.latency = ms
+		} else {
+			ep.latency = ep.latency*(1-rpcEWMAAlpha) + ms*rpcEWMAAlpha
+		}
+		return
+	}
+
+	ep.errs++
+	ep.failures++
+	ep.errRate = ep.errRate*(1-rpcEWMAAlpha) + rpcEWMAAlpha
+	if ep.ejected {
+		return
+	}
+	if ep.failures >= rpcEjectFailures || (ep.requests >= rpcMinSamples && ep.errRate > rpcEjectErrorRate) {
+		cooldown := rpcBaseCooldown << ep.ejections
+		if cooldown > rpcMaxCooldown || cooldown <= 0 {
+			cooldown = rpcMaxCooldown
+		}
+		ep.ejections++
+		ep.ejected = true
+		ep.ejectedUntil = time.Now().Add(cooldown)
+		log.Printf("🚫 RPC 节点 %s 连续失败 %d 次（错误率 %.0f%%），剔除 %s\n", ep.name, ep.failures, ep.errRate*100, cooldown)
+	}
+}
+
+// healthLoop 定期探测冷却结束的节点，恢复正常的重新加入轮询
+func (p *RPCPool) healthLoop() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(rpcProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		var due []*rpcEndpoint
+		now := time.Now()
+		for _, ep := range p.endpoints {
+			if ep.ejected && !now.Before(ep.ejectedUntil) {
+				due = append(due, ep)
+			}
+		}
+		p.mu.Unlock()
+
+		for _, ep := range due {
+			p.probe(ep)
+		}
+	}
+}
+
+// probe 用 eth_chainId 探测节点：成功则恢复并清零失败计数，失败则按剔除次数加倍冷却
+func (p *RPCPool) probe(ep *rpcEndpoint) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcProbeTimeout)
+	defer cancel()
+	start := time.Now()
+	id, err := ep.client.ChainID(ctx)
+	elapsed := time.Since(start)
+	if err == nil && id.Uint64() != p.chain.ChainID {
+		err = fmt.Errorf("chain id 为 %d", id.Uint64())
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		cooldown := rpcBaseCooldown << ep.ejections
+		if cooldown > rpcMaxCooldown || cooldown <= 0 {
+			cooldown = rpcMaxCooldown
+		}
+		ep.ejections++
+		ep.ejectedUntil = time.Now().Add(cooldown)
+		return
+	}
+	ep.ejected = false
+	ep.failures = 0
+	ep.errRate = 0
+	ep.current = 0
+	ep.latency = float64(elapsed.Milliseconds())
+	log.Printf("♻️  RPC 节点 %s 已恢复，重新加入轮询\n", ep.name)
+}
+
+// isEndpointFault 判断错误是否由节点本身引起（连接失败、超时、HTTP 429/5xx、节点限流），
+// 这类错误换节点重试并计入健康评分；JSON-RPC 业务错误与数据不存在不算
+func isEndpointFault(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ethereum.NotFound) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == 429 || httpErr.StatusCode >= 500
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		msg := strings.ToLower(rpcErr.Error())
+		return rpcErr.ErrorCode() == -32005 || strings.Contains(msg, "rate limit") ||
+			strings.Contains(msg, "too many requests") || strings.Contains(msg, "limit exceeded")
+	}
+	return true
+}
+
+// do 选节点、等待其速率预算并执行调用；节点故障时换下一个节点，每个节点最多试一次。
+// 每次尝试使用带该节点超时的 ctx，call 必须使用传入的 ctx 发请求
+func (p *RPCPool) do(ctx context.Context, call func(ctx context.Context, c *ethclient.Client) error) error {
+	return p.call(ctx, true, call)
+}
+
+// call 同 do，wait 为 false 时不占用速率预算（用于通常命中本地缓存、不发请求的调用）
+func (p *RPCPool) call(ctx context.Context, wait bool, call func(ctx context.Context, c *ethclient.Client) error) error {
+	tried := make(map[*rpcEndpoint]bool, len(p.endpoints))
+	lastErr := ErrNoRPCEndpoint
+	for range p.endpoints {
+		ep, limiter := p.pick(tried)
+		if ep == nil {
+			break
+		}
+		tried[ep] = true
+		if wait {
+			if err := limiter.WaitContext(ctx); err != nil {
+				return err
+			}
+		}
+		start := time.Now()
+		attemptCtx, cancel := context.WithTimeout(ctx, ep.timeout)
+		err := call(attemptCtx, ep.client)
+		timedOut := errors.Is(attemptCtx.Err(), context.DeadlineExceeded)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// 外层 ctx 仍有效时，本次尝试超时是节点的问题：计入故障并换下一个节点
+		if err != nil && timedOut {
+			err = fmt.Errorf("请求超时（%s）: %w", ep.timeout, context.DeadlineExceeded)
+		}
+		fault := isEndpointFault(err)
+		p.report(ep, time.Since(start), fault)
+		if !fault {
+			return err
+		}
+		lastErr = fmt.Errorf("%s: %w", ep.name, err)
+	}
+	return lastErr
+}
+
+// Close 停止健康检查与限速器并关闭全部连接，多个节点时输出各节点的统计
+func (p *RPCPool) Close() {
+	close(p.stop)
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ep := range p.endpoints {
+		if len(p.endpoints) > 1 && ep.requests > 0 {
+			log.Printf("📡 RPC 节点 %s: 请求 %d，失败 %d，平均延迟 %.0fms\n", ep.name, ep.requests, ep.errs, ep.latency)
+		}
+		ep.limiter.Stop()
+		ep.client.Close()
+	}
+	if p.recorder != nil {
+		if err := p.recorder.Close(); err != nil {
+			log.Printf("⚠️  关闭录制文件失败: %v\n", err)
+		}
+	}
+}
+
+// BlockNumber 最新区块号
+func (p *RPCPool) BlockNumber(ctx context.Context) (uint64, error) {
+	var out uint64
+	err := p.do(ctx, func(ctx context.Context, c *ethclient.Client) (err error) {
+		out, err = c.BlockNumber(ctx)
+		return err
+	})
+	return out, err
+}
+
+// BlockByNumber 按区块号获取完整区块
+func (p *RPCPool) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	var out *types.Block
+	err := p.do(ctx, func(ctx context.Context, c *ethclient.Client) (err error) {
+		out, err = c.BlockByNumber(ctx, number)
+		return err
+	})
+	return out, err
+}
+
+// HeaderByNumber 按区块号获取区块头
+func (p *RPCPool) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	var out *types.Header
+	err := p.do(ctx, func(ctx context.Context, c *ethclient.Client) (err error) {
+		out, err = c.HeaderByNumber(ctx, number)
+		return err
+	})
+	return out, err
+}
+
+// BlockReceipts 获取区块内全部交易收据
+func (p *RPCPool) BlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]*types.Receipt, error) {
+	var out []*types.Receipt
+	err := p.do(ctx, func(ctx context.Context, c *ethclient.Client) (err error) {
+		out, err = c.BlockReceipts(ctx, blockNrOrHash)
+		return err
+	})
+	return out, err
+}
+
+// TransactionSender 交易发送方（区块解码时已缓存的直接返回，不发请求）
+func (p *RPCPool) TransactionSender(ctx context.Context, tx *types.Transaction, block common.Hash, index uint) (common.Address, error) {
+	var out common.Address
+	err := p.call(ctx, false, func(ctx context.Context, c *ethclient.Client) (err error) {
+		out, err = c.TransactionSender(ctx, tx, block, index)
+		return err
+	})
+	return out, err
+}
+
+// CodeAt 读取合约字节码，blockNumber 为 nil 表示最新区块
+func (p *RPCPool) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	var out []byte
+	err := p.do(ctx, func(ctx context.Context, c *ethclient.Client) (err error) {
+		out, err = c.CodeAt(ctx, account, blockNumber)
+		return err
+	})
+	return out, err
+}
+
+// BalanceAt 读取原生币余额
+func (p *RPCPool) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	var out *big.Int
+	err := p.do(ctx, func(ctx context.Context, c *ethclient.Client) (err error) {
+		out, err = c.BalanceAt(ctx, account, blockNumber)
+		return err
+	})
+	return out, err
+}
+
+// StorageAt 读取存储槽
+func (p *RPCPool) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	var out []byte
+	err := p.do(ctx, func(ctx context.Context, c *ethclient.Client) (err error) {
+		out, err = c.StorageAt(ctx, account, key, blockNumber)
+		return err
+	})
+	return out, err
+}
+
+// CallContract 执行 eth_call
+func (p *RPCPool) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	var out []byte
+	err := p.do(ctx, func(ctx context.Context, c *ethclient.Client) (err error) {
+		out, err = c.CallContract(ctx, msg, blockNumber)
+		return err
+	})
+	return out, err
+}
+
+// FilterLogs 查询日志
+func (p *RPCPool) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	var out []types.Log
+	err := p.do(ctx, func(ctx context.Context, c *ethclient.Client) (err error) {
+		out, err = c.FilterLogs(ctx, q)
+		return err
+	})
+	return out, err
+}
+
+// CallContext 原始 JSON-RPC 调用（debug_* / trace_* 等 ethclient 未封装的方法）
+func (p *RPCPool) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return p.do(ctx, func(ctx context.Context, c *ethclient.Client) error {
+		return c.Client().CallContext(ctx, result, method, args...)
+	})
+}
+
+// BatchCallContext 批量 JSON-RPC 调用，单个元素的错误写在 elem.Error 中
+func (p *RPCPool) BatchCallContext(ctx context.Context, elems []rpc.BatchElem) error {
+	return p.do(ctx, func(ctx context.Context, c *ethclient.Client) error {
+		return c.Client().BatchCallContext(ctx, elems)
+	})
+}
+
+// SubscribeNewHead 订阅新区块头：依次尝试未剔除的节点，只有 WebSocket/IPC 节点支持
+func (p *RPCPool) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	p.mu.Lock()
+	candidates := make([]*rpcEndpoint, 0, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		if !ep.ejected {
+			candidates = append(candidates, ep)
+		}
+	}
+	p.mu.Unlock()
+
+	lastErr := ErrNoRPCEndpoint
+	for _, ep := range candidates {
+		sub, err := ep.client.SubscribeNewHead(ctx, ch)
+		if err == nil {
+			return sub, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,431 @@
+package download
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// EVM 操作码（选择器提取用到的部分）
+const (
+	opLT     = 0x10
+	opGT     = 0x11
+	opEQ     = 0x14
+	opXOR    = 0x18
+	opJUMPI  = 0x57
+	opPUSH1  = 0x60
+	opPUSH3  = 0x62
+	opPUSH4  = 0x63
+	opPUSH32 = 0x7f
+	opDUP2   = 0x81
+)
+
+// evmOp 解析出的一条指令
+type evmOp struct {
+	code byte
+	arg  []byte
+}
+
+// disassemble 按操作码顺序拆分字节码（跳过 PUSH 数据）
+func disassemble(code []byte) []evmOp {
+	ops := make([]evmOp, 0, len(code)/2)
+	for i := 0; i < len(code); i++ {
+		op := evmOp{code: code[i]}
+		if op.code >= opPUSH1 && op.code <= opPUSH32 {
+			n := int(op.code-opPUSH1) + 1
+			end := i + 1 + n
+			if end > len(code) {
+				end = len(code)
+			}
+			op.arg = code[i+1 : end]
+			i += n
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// ExtractSelectors 从 runtime 字节码的函数分发器中提取 4 字节选择器（0x 前缀小写，升序）。
+// 识别形如 PUSH4 sel [DUP2] EQ|GT|LT|XOR PUSHn dest JUMPI 的比较跳转：
+// EQ 为 solc 的逐个匹配，GT / LT 为函数较多时的二分分发，XOR 为 Vyper 的写法；
+// 高位为 0 的选择器会被优化为 PUSH3
+func ExtractSelectors(code []byte) []string {
+	runtime, _ := SplitMetadata(code)
+	ops := disassemble(runtime)
+
+	seen := make(map[string]bool)
+	for i, op := range ops {
+		if op.code != opPUSH4 && op.code != opPUSH3 {
+			continue
+		}
+		j := i + 1
+		if j < len(ops) && ops[j].code == opDUP2 {
+			j++
+		}
+		if j+2 >= len(ops) {
+			continue
+		}
+		switch ops[j].code {
+		case opEQ, opGT, opLT, opXOR:
+		default:
+			continue
+		}
+		if ops[j+1].code < opPUSH1 || ops[j+1].code > opPUSH4 || ops[j+2].code != opJUMPI {
+			continue
+		}
+		var sel [4]byte
+		copy(sel[4-len(op.arg):], op.arg)
+		if sel == [4]byte{0xff, 0xff, 0xff, 0xff} {
+			continue
+		}
+		seen["0x"+hex.EncodeToString(sel[:])] = true
+	}
+
+	out := make([]string, 0, len(seen))
+	for s := range seen {
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// SelectorOf 计算函数签名的选择器，如 transfer(address,uint256) -> 0xa9059cbb
+func SelectorOf(signature string) string {
+	sig := strings.Join(strings.Fields(signature), "")
+	return "0x" + hex.EncodeToString(crypto.Keccak256([]byte(sig))[:4])
+}
+
+var selectorRe = regexp.MustCompile(`^0x[0-9a-fA-F]{8}$`)
+
+// ParseSelectorList 解析逗号分隔的选择器或函数签名列表，
+// 如 "transferOwnership(address),0xa9059cbb"（签名括号内的逗号不作分隔）
+func ParseSelectorList(s string) ([]string, error) {
+	var items []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	items = append(items, s[start:])
+
+	seen := make(map[string]bool)
+	var out []string
+	for _, it := range items {
+		it = strings.TrimSpace(it)
+		var sel string
+		switch {
+		case it == "":
+			continue
+		case selectorRe.MatchString(it):
+			sel = strings.ToLower(it)
+		case strings.Contains(it, "(") && strings.HasSuffix(it, ")"):
+			sel = SelectorOf(it)
+		default:
+			return nil, fmt.Errorf("无效的选择器 %q（应为 0x 加 8 位十六进制，或函数签名如 transfer(address,uint256)）", it)
+		}
+		if !seen[sel] {
+			seen[sel] = true
+			out = append(out, sel)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("选择器列表为空")
+	}
+	return out, nil
+}
+
+// SelectorFilterSQL 返回"代码包含全部选择器"的 SQL 条件，codeHashCol 为 code_hash 列名
+func SelectorFilterSQL(codeHashCol string, selectors []string) (string, []interface{}) {
+	placeholders := make([]string, len(selectors))
+	args := make([]interface{}, 0, len(selectors)+1)
+	for i, s := range selectors {
+		placeholders[i] = "?"
+		args = append(args, s)
+	}
+	args = append(args, len(selectors))
+	cond := fmt.Sprintf(`%s IN (SELECT code_hash FROM contract_selectors WHERE selector IN (%s)
+		GROUP BY code_hash HAVING COUNT(*) = ?)`, codeHashCol, strings.Join(placeholders, ", "))
+	return cond, args
+}
+
+// saveSelectors 在事务内为尚未建立索引的代码哈希写入选择器，返回写入的数量；
+// selectorcount 从 NULL 改为选择器数量的那次写入负责插入，同一哈希不会重复处理
+func saveSelectors(ctx context.Context, tx *sql.Tx, codeHash, bytecode string) (int, error) {
+	bytecode = strings.TrimSpace(bytecode)
+	if codeHash == "" || bytecode == "" {
+		return 0, nil
+	}
+	sels := ExtractSelectors(common.FromHex(bytecode))
+	res, err := tx.ExecContext(ctx,
+		"UPDATE contract_codes SET selectorcount = ? WHERE code_hash = ? AND selectorcount IS NULL", len(sels), codeHash)
+	if err != nil {
+		return 0, fmt.Errorf("更新选择器数量失败: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, nil
+	}
+
+	const batch = 200
+	for i := 0; i < len(sels); i += batch {
+		end := i + batch
+		if end > len(sels) {
+			end = len(sels)
+		}
+		values := make([]string, 0, end-i)
+		args := make([]interface{}, 0, 2*(end-i))
+		for _, s := range sels[i:end] {
+			values = append(values, "(?, ?)")
+			args = append(args, codeHash, s)
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT IGNORE INTO contract_selectors (code_hash, selector) VALUES "+strings.Join(values, ", "), args...); err != nil {
+			return 0, fmt.Errorf("写入选择器失败: %w", err)
+		}
+	}
+	return len(sels), nil
+}
+
+// IndexStoredSelectors 为尚未建立选择器索引（selectorcount 为 NULL）的已入库代码哈希提取选择器
+func (d *Downloader) IndexStoredSelectors(ctx context.Context, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	query := fmt.Sprintf(`SELECT code_hash, bytecode FROM contract_codes
+	WHERE selectorcount IS NULL AND code_hash > ? ORDER BY code_hash LIMIT %d`, batchSize)
+
+	log.Printf("🔎 开始为已入库代码建立函数选择器索引...\n")
+	var indexed, total int
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rows, err := d.db.QueryContext(ctx, query, cursor)
+		if err != nil {
+			return fmt.Errorf("查询待建立索引的代码失败: %w", err)
+		}
+		var hashes, codes []string
+		for rows.Next() {
+			var h, c string
+			if err := rows.Scan(&h, &c); err != nil {
+				rows.Close()
+				return err
+			}
+			hashes = append(hashes, h)
+			codes = append(codes, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(hashes) == 0 {
+			break
+		}
+		cursor = hashes[len(hashes)-1]
+
+		tx, err := d.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		for i, h := range hashes {
+			n, err := saveSelectors(ctx, tx, h, codes[i])
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("代码哈希 %s: %w", h, err)
+			}
+			total += n
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		indexed += len(hashes)
+		log.Printf("🔎 已处理 %d 个代码哈希（选择器 %d 个）\n", indexed, total)
+	}
+
+	log.Printf("\n✅ 选择器索引完成: %d 个代码哈希，%d 个选择器\n", indexed, total)
+	return nil
+}
+
+// FindBySelectors 查询 chain 上代码包含全部选择器的合约地址（按地址排序）
+func FindBySelectors(ctx context.Context, db *sql.DB, chain string, selectors []string) ([]string, error) {
+	cond, args := SelectorFilterSQL("code_hash", selectors)
+	args = append([]interface{}{chain}, args...)
+	addrs, err := queryStrings(ctx, db, "SELECT address FROM contracts WHERE chain = ? AND "+cond+" ORDER BY address", args...)
+	if err != nil {
+		return nil, fmt.Errorf("按选择器查询合约失败: %w", err)
+	}
+	return addrs, nil
+}
+
+// SelectorSignatures 合约的一个选择器及其已知的文本签名（4byte 库中可能有多个碰撞）
+type SelectorSignatures struct {
+	Selector   string
+	Signatures []string
+}
+
+// ContractSelectors 列出 chain 上已入库合约的选择器，并按 function_signatures 解析为文本签名
+func ContractSelectors(ctx context.Context, db *sql.DB, chain, address string) ([]SelectorSignatures, error) {
+	var codeHash string
+	var count sql.NullInt64
+	err := db.QueryRowContext(ctx, `
+	SELECT COALESCE(c.code_hash, ''), cc.selectorcount FROM contracts c
+	LEFT JOIN contract_codes cc ON cc.code_hash = c.code_hash
+	WHERE c.chain = ? AND c.address = ?`, chain, address).Scan(&codeHash, &count)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("合约 %s 不在数据库中", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询合约失败: %w", err)
+	}
+	if codeHash == "" || !count.Valid {
+		return nil, fmt.Errorf("合约 %s 尚未建立选择器索引（先执行 -d -index-selectors）", address)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+	SELECT s.selector, COALESCE(f.signature, '') FROM contract_selectors s
+	LEFT JOIN function_signatures f ON f.selector = s.selector
+	WHERE s.code_hash = ? ORDER BY s.selector, f.signature`, codeHash)
+	if err != nil {
+		return nil, fmt.Errorf("查询选择器失败: %w", err)
+	}
+	defer rows.Close()
+
+	var out []SelectorSignatures
+	for rows.Next() {
+		var sel, sig string
+		if err := rows.Scan(&sel, &sig); err != nil {
+			return nil, err
+		}
+		if len(out) == 0 || out[len(out)-1].Selector != sel {
+			out = append(out, SelectorSignatures{Selector: sel})
+		}
+		if sig != "" {
+			last := &out[len(out)-1]
+			last.Signatures = append(last.Signatures, sig)
+		}
+	}
+	return out, rows.Err()
+}
+
+// signatureRe 合法的文本签名：函数名 + 参数类型列表（不含空格与参数名）
+var signatureRe = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*\([A-Za-z0-9_\[\](),]*\)$`)
+
+// extractSignature 从一行中找出文本签名：从第一个 '(' 向左取函数名，向右取到配对的 ')'。
+// 兼容 "0xa9059cbb transfer(address,uint256)"、4byte 导出的 CSV 与只有签名的行
+func extractSignature(line string) string {
+	open := strings.Index(line, "(")
+	if open <= 0 {
+		return ""
+	}
+	start := open
+	for start > 0 {
+		c := line[start-1]
+		if c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			start--
+			continue
+		}
+		break
+	}
+	depth := 0
+	for i := open; i < len(line); i++ {
+		switch line[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				sig := strings.Join(strings.Fields(line[start:i+1]), "")
+				if signatureRe.MatchString(sig) {
+					return sig
+				}
+				return ""
+			}
+		}
+	}
+	return ""
+}
+
+// ImportSignatures 从 4byte 风格的签名库文件导入 function_signatures（每行一个签名，可带选择器）。
+// 选择器总是由签名计算，行内给出的选择器与之不符时跳过该行；重复导入结果不变
+func ImportSignatures(ctx context.Context, db *sql.DB, path string) (imported, skipped int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("打开签名库失败: %w", err)
+	}
+	defer f.Close()
+
+	var pending []string
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		values := make([]string, 0, len(pending))
+		args := make([]interface{}, 0, 2*len(pending))
+		for _, sig := range pending {
+			values = append(values, "(?, ?)")
+			args = append(args, SelectorOf(sig), sig)
+		}
+		pending = pending[:0]
+		_, err := db.ExecContext(ctx,
+			"INSERT IGNORE INTO function_signatures (selector, signature) VALUES "+strings.Join(values, ", "), args...)
+		if err != nil {
+			return fmt.Errorf("写入签名失败: %w", err)
+		}
+		return nil
+	}
+
+	selInLine := regexp.MustCompile(`0x[0-9a-fA-F]{8}\b`)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return imported, skipped, err
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sig := extractSignature(line)
+		if sig == "" {
+			skipped++
+			continue
+		}
+		if given := selInLine.FindString(line); given != "" && !strings.EqualFold(given, SelectorOf(sig)) {
+			skipped++
+			continue
+		}
+		pending = append(pending, sig)
+		imported++
+		if len(pending) >= 500 {
+			if err := flush(); err != nil {
+				return imported, skipped, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return imported, skipped, fmt.Errorf("读取签名库失败: %w", err)
+	}
+	if err := flush(); err != nil {
+		return imported, skipped, err
+	}
+	return imported, skipped, nil
+}
@@ -0,0 +1,403 @@
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 元数据哈希类型
+const (
+	MetaHashIPFS  = "ipfs"  // IPFS CIDv0（base58，Qm 开头），solc >= 0.6.0 默认
+	MetaHashBzzr0 = "bzzr0" // Swarm，solc 0.4.7 - 0.5.8
+	MetaHashBzzr1 = "bzzr1" // Swarm，solc 0.5.9 - 0.5.17
+)
+
+// BytecodeMetadata 从 runtime 字节码 CBOR 元数据尾部解析出的编译信息
+type BytecodeMetadata struct {
+	SolcVersion  string // 编译器版本，如 0.8.19；预发布版本为 solc 写入的完整字符串；0.5.9 之前的编译器不写入，为空
+	HashKind     string // ipfs | bzzr0 | bzzr1，未写入哈希时为空
+	Hash         string // ipfs 为 base58 CID，bzzr 为 32 字节十六进制
+	Experimental bool   // 使用了 pragma experimental
+}
+
+// DecodeMetadata 解析 solc 追加在 runtime 字节码末尾的 CBOR 元数据；没有可识别的尾部时返回 nil
+func DecodeMetadata(code []byte) *BytecodeMetadata {
+	_, raw := SplitMetadata(code)
+	if raw == nil {
+		return nil
+	}
+	m, err := decodeCBORMap(raw)
+	if err != nil {
+		return nil
+	}
+
+	out := &BytecodeMetadata{}
+	switch v := m["solc"].(type) {
+	case []byte:
+		if len(v) == 3 {
+			out.SolcVersion = fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+		}
+	case string:
+		out.SolcVersion = v
+	}
+	if b, ok := m["experimental"].(bool); ok {
+		out.Experimental = b
+	}
+	if b, ok := m["ipfs"].([]byte); ok && len(b) > 0 {
+		out.HashKind, out.Hash = MetaHashIPFS, base58Encode(b)
+	} else if b, ok := m["bzzr1"].([]byte); ok && len(b) > 0 {
+		out.HashKind, out.Hash = MetaHashBzzr1, hex.EncodeToString(b)
+	} else if b, ok := m["bzzr0"].([]byte); ok && len(b) > 0 {
+		out.HashKind, out.Hash = MetaHashBzzr0, hex.EncodeToString(b)
+	}
+	// 既没有版本也没有哈希的尾部多半是误识别（字节码恰好以类似 CBOR 的数据结尾）
+	if out.SolcVersion == "" && out.HashKind == "" {
+		return nil
+	}
+	return out
+}
+
+// SolcVersionNumber 把 x.y.z（忽略 -/+ 后缀，缺省的部分为 0）换算为可比较的整数 x*1e6 + y*1e3 + z
+func SolcVersionNumber(v string) (uint64, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if v == "" || len(parts) > 3 {
+		return 0, false
+	}
+	var n uint64
+	for i := 0; i < 3; i++ {
+		n *= 1000
+		if i >= len(parts) {
+			continue
+		}
+		p, err := strconv.ParseUint(parts[i], 10, 64)
+		if err != nil || p >= 1000 {
+			return 0, false
+		}
+		n += p
+	}
+	return n, true
+}
+
+// SolcVersionSQL 返回把 solcversion 列换算为 SolcVersionNumber 同样整数的 SQL 表达式
+func SolcVersionSQL(col string) string {
+	base := fmt.Sprintf("SUBSTRING_INDEX(SUBSTRING_INDEX(%s, '+', 1), '-', 1)", col)
+	return fmt.Sprintf("(CAST(SUBSTRING_INDEX(%[1]s, '.', 1) AS UNSIGNED) * 1000000 + "+
+		"CAST(SUBSTRING_INDEX(SUBSTRING_INDEX(%[1]s, '.', 2), '.', -1) AS UNSIGNED) * 1000 + "+
+		"CAST(SUBSTRING_INDEX(%[1]s, '.', -1) AS UNSIGNED))", base)
+}
+
+// ParseSolcConstraint 解析编译器版本条件，如 "<0.8.0"、">=0.6"、"=0.7.6"（不带运算符视为 =）
+func ParseSolcConstraint(s string) (op string, version uint64, err error) {
+	s = strings.TrimSpace(s)
+	for _, o := range []string{"<=", ">=", "!=", "<", ">", "="} {
+		if strings.HasPrefix(s, o) {
+			op, s = o, s[len(o):]
+			break
+		}
+	}
+	if op == "" {
+		op = "="
+	}
+	version, ok := SolcVersionNumber(s)
+	if !ok {
+		return "", 0, fmt.Errorf("无效的编译器版本条件 %q（示例: <0.8.0、>=0.6、=0.7.6）", s)
+	}
+	return op, version, nil
+}
+
+// cborReader solc 元数据用到的 CBOR 子集解码器（定长 map / array、整数、字节串、文本串、bool / null）
+type cborReader struct {
+	b   []byte
+	pos int
+}
+
+var errCBOR = errors.New("无效的 CBOR 数据")
+
+// decodeCBORMap 解码顶层 map，键必须是文本串
+func decodeCBORMap(b []byte) (map[string]interface{}, error) {
+	r := &cborReader{b: b}
+	v, err := r.item(0)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok || r.pos != len(b) {
+		return nil, errCBOR
+	}
+	return m, nil
+}
+
+// head 读取数据项头部：主类型与参数
+func (r *cborReader) head() (major byte, arg uint64, err error) {
+	if r.pos >= len(r.b) {
+		return 0, 0, errCBOR
+	}
+	c := r.b[r.pos]
+	r.pos++
+	major, info := c>>5, c&0x1f
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	if info > 27 {
+		// 不定长编码与保留值，solc 不会生成
+		return 0, 0, errCBOR
+	}
+	n := 1 << (info - 24)
+	if r.pos+n > len(r.b) {
+		return 0, 0, errCBOR
+	}
+	for _, x := range r.b[r.pos : r.pos+n] {
+		arg = arg<<8 | uint64(x)
+	}
+	r.pos += n
+	return major, arg, nil
+}
+
+// item 读取一个完整的数据项
+func (r *cborReader) item(depth int) (interface{}, error) {
+	if depth > 8 {
+		return nil, errCBOR
+	}
+	major, arg, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		return arg, nil
+	case 1:
+		return -1 - int64(arg), nil
+	case 2, 3:
+		if arg > uint64(len(r.b)-r.pos) {
+			return nil, errCBOR
+		}
+		s := r.b[r.pos : r.pos+int(arg)]
+		r.pos += int(arg)
+		if major == 3 {
+			return string(s), nil
+		}
+		return s, nil
+	case 4:
+		if arg > uint64(len(r.b)-r.pos) {
+			return nil, errCBOR
+		}
+		arr := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, err := r.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case 5:
+		if arg > uint64(len(r.b)-r.pos) {
+			return nil, errCBOR
+		}
+		m := make(map[string]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, err := r.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, errCBOR
+			}
+			v, err := r.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+		}
+		return m, nil
+	case 7:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		}
+	}
+	return nil, errCBOR
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58Encode Bitcoin 字母表的 base58 编码（IPFS CIDv0 使用）
+func base58Encode(b []byte) string {
+	x := new(big.Int).SetBytes(b)
+	base, mod := big.NewInt(58), new(big.Int)
+	var out []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, base, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// ipfsChunkSize ipfs add 的默认分块大小，超过后文件会拆成多层 DAG
+const ipfsChunkSize = 256 * 1024
+
+// ipfsFileHash 计算单块文件（不超过 256KiB）在 ipfs add 默认参数下的 CIDv0，
+// 即 solc 写入字节码的 metadata.json 哈希；超过一个分块时返回 false
+func ipfsFileHash(content []byte) (string, bool) {
+	if len(content) == 0 || len(content) > ipfsChunkSize {
+		return "", false
+	}
+	// UnixFS Data{Type: File, Data: content, filesize}
+	var unixfs []byte
+	unixfs = append(unixfs, 0x08, 0x02, 0x12)
+	unixfs = appendUvarint(unixfs, uint64(len(content)))
+	unixfs = append(unixfs, content...)
+	unixfs = append(unixfs, 0x18)
+	unixfs = appendUvarint(unixfs, uint64(len(content)))
+	// dag-pb PBNode{Data: unixfs}，无链接
+	node := []byte{0x0a}
+	node = appendUvarint(node, uint64(len(unixfs)))
+	node = append(node, unixfs...)
+
+	sum := sha256.Sum256(node)
+	return base58Encode(append([]byte{0x12, 0x20}, sum[:]...)), true
+}
+
+// appendUvarint 追加 protobuf varint
+func appendUvarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// DecodeMetadataOptions 回填 CBOR 元数据列的参数
+type DecodeMetadataOptions struct {
+	BatchSize  int               // 每批处理的合约数
+	BlockRange *BlockRangeRecord // 只处理该创建区块范围内的合约，nil 表示全部
+}
+
+// DecodeStoredMetadata 为尚未解析 CBOR 元数据（metahashkind 为 NULL）的已入库合约回填编译器版本与元数据哈希。
+// 未开源合约直接解析 contract 列中的字节码；已开源合约优先使用 contract_codes 中本地址的字节码，否则通过 RPC 读取。
+// 配置了本地 Sourcify 仓库时，未开源合约还会按 IPFS 元数据哈希查找源码，找到则改判为已开源
+func (d *Downloader) DecodeStoredMetadata(ctx context.Context, opts DecodeMetadataOptions) error {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	conditions := []string{"c.chain = ?", "c.metahashkind IS NULL", "c.address > ?"}
+	var filterArgs []interface{}
+	if opts.BlockRange != nil {
+		cond, args := blockRangeCondition(*opts.BlockRange)
+		conditions = append(conditions, "c."+cond)
+		filterArgs = append(filterArgs, args...)
+	}
+	query := fmt.Sprintf(`
+	SELECT c.address, c.isopensource, COALESCE(c.code_hash, ''), IF(c.isopensource = 0, c.contract, ''), COALESCE(cc.bytecode, '')
+	FROM contracts c
+	LEFT JOIN contract_codes cc ON cc.code_hash = c.code_hash AND cc.firstchain = c.chain AND cc.firstaddress = c.address
+	WHERE %s ORDER BY c.address LIMIT %d`, strings.Join(conditions, " AND "), opts.BatchSize)
+
+	log.Printf("🧬 开始解析已入库合约的 CBOR 元数据...\n")
+	var decoded, withHash, recovered, failed int
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		args := append([]interface{}{d.chain, cursor}, filterArgs...)
+		rows, err := d.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("查询待解析元数据的合约失败: %w", err)
+		}
+		var batch []*ContractInfo
+		for rows.Next() {
+			info := &ContractInfo{}
+			var stored string
+			if err := rows.Scan(&info.Address, &info.IsOpenSource, &info.CodeHash, &info.Contract, &stored); err != nil {
+				rows.Close()
+				return err
+			}
+			if info.IsOpenSource == 0 && strings.HasPrefix(info.Contract, "0x") {
+				info.Bytecode = info.Contract
+			} else if stored != "" {
+				info.Bytecode = stored
+			}
+			batch = append(batch, info)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		cursor = batch[len(batch)-1].Address
+
+		for _, info := range batch {
+			if info.Bytecode == "" {
+				code, err := d.Client.CodeAt(ctx, common.HexToAddress(info.Address), nil)
+				if err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					log.Printf("⚠️  获取合约 %s 代码失败: %v\n", info.Address, err)
+					failed++
+					continue
+				}
+				info.Bytecode = fmt.Sprintf("0x%x", code)
+			}
+
+			solc, kind, hash, experimental := bytecodeMetadataColumns(info)
+			if _, err := d.db.ExecContext(ctx,
+				"UPDATE contracts SET solcversion = ?, metahashkind = ?, metahash = ?, experimental = ? WHERE chain = ? AND address = ?",
+				solc, kind, hash, experimental, d.chain, info.Address); err != nil {
+				return fmt.Errorf("更新合约 %s 的元数据列失败: %w", info.Address, err)
+			}
+			decoded++
+			if hash != nil {
+				withHash++
+			}
+
+			if info.IsOpenSource == 0 && info.CodeHash != "" && kind == MetaHashIPFS {
+				meta := d.matchMetadataHash(ctx, info.Address, common.FromHex(info.Bytecode))
+				if meta == nil {
+					continue
+				}
+				if err := d.markVerified(ctx, info.CodeHash, info.Address, meta); err != nil {
+					return err
+				}
+				recovered++
+			}
+		}
+		log.Printf("🧬 已解析 %d 个合约（含元数据哈希 %d，按哈希取回源码 %d，失败 %d）\n", decoded, withHash, recovered, failed)
+	}
+
+	log.Printf("\n✅ CBOR 元数据解析完成!\n")
+	log.Printf("   - 已解析: %d（含元数据哈希 %d）\n", decoded, withHash)
+	log.Printf("   - 按元数据哈希取回源码: %d\n", recovered)
+	log.Printf("   - 读取字节码失败（下次继续）: %d\n", failed)
+	return nil
+}
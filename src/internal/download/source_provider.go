@@ -0,0 +1,128 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/admi-n/solidity-Excavator/src/config"
+)
+
+// 源码来源名称
+const (
+	ProviderEtherscan     = "etherscan"
+	ProviderSourcify      = "sourcify"
+	ProviderSourcifyLocal = "sourcify-local"
+	ProviderBlockscout    = "blockscout"
+)
+
+// 源码匹配程度
+const (
+	MatchFull     = "full"     // 元数据哈希也一致（Sourcify full match / Blockscout 完全验证）
+	MatchPartial  = "partial"  // 仅可执行字节码一致，注释/路径等可能不同
+	MatchVerified = "verified" // 来源未给出匹配程度（Etherscan）
+	MatchMetadata = "metadata" // 地址本身未验证，按字节码中的元数据哈希在本地 Sourcify 仓库找到同一份 metadata.json
+)
+
+// ErrNoSourceProvider 没有配置任何源码来源
+var ErrNoSourceProvider = errors.New("没有可用的源码来源")
+
+// SourceProvider 合约源码来源。合约未验证时返回 nil, nil；
+// 返回 error 表示本次没有得到确定结果（网络错误、限流等），调用方之后会重新查询
+type SourceProvider interface {
+	Name() string
+	FetchSource(ctx context.Context, address string) (*ContractMetadata, error)
+}
+
+// MetadataHashSource 可按 solc 写入字节码的 IPFS 元数据哈希查找源码的来源（目前只有本地 Sourcify 仓库）。
+// 未找到时返回 nil, nil
+type MetadataHashSource interface {
+	FetchByMetadataHash(ctx context.Context, ipfsHash string) (*ContractMetadata, error)
+}
+
+// EtherscanProvider 通过 Etherscan getsourcecode 接口查询，key 由 KeyPool 轮询分配
+type EtherscanProvider struct {
+	config EtherscanConfig
+	keys   *KeyPool
+}
+
+// NewEtherscanProvider 创建 Etherscan 来源
+func NewEtherscanProvider(cfg EtherscanConfig, keys *KeyPool) *EtherscanProvider {
+	return &EtherscanProvider{config: cfg, keys: keys}
+}
+
+// Name 来源名称
+func (p *EtherscanProvider) Name() string { return ProviderEtherscan }
+
+// FetchSource 查询源码，限流、key 无效时换 key 重试
+func (p *EtherscanProvider) FetchSource(ctx context.Context, address string) (*ContractMetadata, error) {
+	if p.keys == nil || p.keys.Size() == 0 {
+		return nil, ErrNoEtherscanKey
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < p.keys.Size()+2; attempt++ {
+		k, err := p.keys.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cfg := p.config
+		cfg.APIKey = k.value
+		meta, err := FetchContractMetadata(strings.TrimSpace(address), cfg)
+		if err == nil {
+			if meta != nil {
+				meta.Provider, meta.MatchType = ProviderEtherscan, MatchVerified
+			}
+			return meta, nil
+		}
+		p.keys.Report(k, err)
+		lastErr = err
+		if !isRetryableEtherscanErr(err) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// newSourceProviders 按配置顺序创建源码来源，未知名称报错
+func newSourceProviders(settings config.SourceSettings, ethersCfg EtherscanConfig, keys *KeyPool, chainID int64) ([]SourceProvider, error) {
+	var out []SourceProvider
+	for _, name := range settings.Order {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case ProviderEtherscan:
+			if keys == nil || keys.Size() == 0 {
+				log.Printf("⚠️  未配置 Etherscan API key，跳过 etherscan 来源\n")
+				continue
+			}
+			out = append(out, NewEtherscanProvider(ethersCfg, keys))
+		case ProviderSourcify:
+			out = append(out, NewSourcifyProvider(settings.SourcifyURL, ethersCfg.Proxy, chainID))
+		case ProviderSourcifyLocal:
+			if settings.SourcifyRepo == "" {
+				return nil, fmt.Errorf("使用 sourcify-local 需要配置 sources.sourcify_repo")
+			}
+			out = append(out, NewLocalSourcifyProvider(settings.SourcifyRepo, chainID))
+		case ProviderBlockscout:
+			if settings.BlockscoutURL == "" {
+				log.Printf("⚠️  当前链未配置 Blockscout 地址，跳过 blockscout 来源\n")
+				continue
+			}
+			out = append(out, NewBlockscoutProvider(settings.BlockscoutURL, ethersCfg.Proxy))
+		case "":
+		default:
+			return nil, fmt.Errorf("未知的源码来源: %s（可选 etherscan | sourcify | sourcify-local | blockscout）", name)
+		}
+	}
+	return out, nil
+}
+
+// providerNames 返回来源名称列表（用于日志）
+func providerNames(providers []SourceProvider) string {
+	names := make([]string, len(providers))
+	for i, p := range providers {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, " -> ")
+}
@@ -0,0 +1,310 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/admi-n/solidity-Excavator/src/internal"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SourcifyProvider 通过 Sourcify 服务查询（full / partial match 均可）
+type SourcifyProvider struct {
+	baseURL string
+	proxy   string
+	chainID int64
+}
+
+// NewSourcifyProvider 创建 Sourcify 来源，baseURL 例如 https://sourcify.dev/server
+func NewSourcifyProvider(baseURL, proxy string, chainID int64) *SourcifyProvider {
+	return &SourcifyProvider{baseURL: strings.TrimRight(baseURL, "/"), proxy: proxy, chainID: chainID}
+}
+
+// Name 来源名称
+func (p *SourcifyProvider) Name() string { return ProviderSourcify }
+
+// FetchSource 调用 /files/any/{chainId}/{address}，优先返回 full match
+func (p *SourcifyProvider) FetchSource(ctx context.Context, address string) (*ContractMetadata, error) {
+	url := fmt.Sprintf("%s/files/any/%d/%s", p.baseURL, p.chainID, common.HexToAddress(address).Hex())
+	body, status, err := httpGet(ctx, p.proxy, url)
+	if err != nil {
+		return nil, fmt.Errorf("请求 Sourcify 失败: %w", err)
+	}
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("Sourcify 返回非 200 状态: %d", status)
+	}
+
+	var resp struct {
+		Status string `json:"status"`
+		Files  []struct {
+			Name    string `json:"name"`
+			Path    string `json:"path"`
+			Content string `json:"content"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析 Sourcify 响应失败: %w", err)
+	}
+
+	files := make(map[string]string, len(resp.Files))
+	for _, f := range resp.Files {
+		files[sourcifyRelPath(f.Path, f.Name)] = f.Content
+	}
+	return buildSourcifyMetadata(ProviderSourcify, resp.Status, files)
+}
+
+// LocalSourcifyProvider 读取本地 Sourcify 仓库（离线），目录结构：
+// <repo>/contracts/{full_match,partial_match}/<chainId>/<address>/{metadata.json,sources/...}
+type LocalSourcifyProvider struct {
+	root    string
+	chainID int64
+
+	indexOnce sync.Once
+	index     map[string]string // metadata.json 的 IPFS 哈希 -> 合约目录，首次按哈希查找时建立
+	indexErr  error
+}
+
+// NewLocalSourcifyProvider 创建本地 Sourcify 仓库来源
+func NewLocalSourcifyProvider(root string, chainID int64) *LocalSourcifyProvider {
+	return &LocalSourcifyProvider{root: root, chainID: chainID}
+}
+
+// Name 来源名称
+func (p *LocalSourcifyProvider) Name() string { return ProviderSourcifyLocal }
+
+// FetchSource 依次查找 full_match、partial_match 目录
+func (p *LocalSourcifyProvider) FetchSource(ctx context.Context, address string) (*ContractMetadata, error) {
+	addr := common.HexToAddress(address)
+	for _, match := range []string{MatchFull, MatchPartial} {
+		dir := p.contractDir(match, addr)
+		if dir == "" {
+			continue
+		}
+		files, err := readSourcifyDir(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		return buildSourcifyMetadata(ProviderSourcifyLocal, match, files)
+	}
+	return nil, nil
+}
+
+// FetchByMetadataHash 按 metadata.json 的 IPFS 哈希查找本链已验证的合约（同一份源码与编译设置部署在别的地址）。
+// 首次调用时扫描仓库中本链全部 metadata.json 建立索引
+func (p *LocalSourcifyProvider) FetchByMetadataHash(ctx context.Context, ipfsHash string) (*ContractMetadata, error) {
+	p.indexOnce.Do(func() { p.index, p.indexErr = p.buildMetadataIndex(ctx) })
+	if p.indexErr != nil {
+		return nil, p.indexErr
+	}
+	dir, ok := p.index[ipfsHash]
+	if !ok {
+		return nil, nil
+	}
+	files, err := readSourcifyDir(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	return buildSourcifyMetadata(ProviderSourcifyLocal, MatchMetadata, files)
+}
+
+// buildMetadataIndex 计算本链 full_match / partial_match 下每个 metadata.json 的 IPFS 哈希（full match 优先）
+func (p *LocalSourcifyProvider) buildMetadataIndex(ctx context.Context) (map[string]string, error) {
+	start := time.Now()
+	index := make(map[string]string)
+	for _, match := range []string{MatchFull, MatchPartial} {
+		base := filepath.Join(p.root, "contracts", match+"_match", fmt.Sprint(p.chainID))
+		entries, err := os.ReadDir(base)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("读取本地 Sourcify 仓库失败: %w", err)
+		}
+		for _, e := range entries {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if !e.IsDir() {
+				continue
+			}
+			dir := filepath.Join(base, e.Name())
+			content, err := os.ReadFile(filepath.Join(dir, "metadata.json"))
+			if err != nil {
+				continue
+			}
+			hash, ok := ipfsFileHash(content)
+			if !ok {
+				continue
+			}
+			if _, exists := index[hash]; !exists {
+				index[hash] = dir
+			}
+		}
+	}
+	log.Printf("📚 本地 Sourcify 元数据哈希索引已建立: %d 条 (耗时 %s)\n", len(index), time.Since(start).Round(time.Millisecond))
+	return index, nil
+}
+
+// readSourcifyDir 读取仓库中一个合约目录下的全部文件（相对路径 -> 内容）
+func readSourcifyDir(ctx context.Context, dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.IsDir() {
+			return ctx.Err()
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[sourcifyRelPath(filepath.ToSlash(rel), e.Name())] = string(content)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取本地 Sourcify 仓库失败: %w", err)
+	}
+	return files, nil
+}
+
+// contractDir 返回合约目录（仓库中地址目录一般为校验和格式，也兼容小写），不存在时返回空
+func (p *LocalSourcifyProvider) contractDir(match string, addr common.Address) string {
+	base := filepath.Join(p.root, "contracts", match+"_match", fmt.Sprint(p.chainID))
+	for _, name := range []string{addr.Hex(), strings.ToLower(addr.Hex())} {
+		dir := filepath.Join(base, name)
+		if st, err := os.Stat(dir); err == nil && st.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+// sourcifyRelPath 把仓库中的文件路径转换为相对路径：sources/ 下的源文件保留原始路径，其余只保留文件名
+func sourcifyRelPath(path, name string) string {
+	path = filepath.ToSlash(path)
+	if i := strings.Index(path, "/sources/"); i >= 0 {
+		return "sources/" + path[i+len("/sources/"):]
+	}
+	if strings.HasPrefix(path, "sources/") {
+		return path
+	}
+	if name == "" {
+		name = path[strings.LastIndex(path, "/")+1:]
+	}
+	return name
+}
+
+// buildSourcifyMetadata 由 metadata.json 与 sources/ 下的文件组装元数据
+func buildSourcifyMetadata(provider, match string, files map[string]string) (*ContractMetadata, error) {
+	raw, ok := files["metadata.json"]
+	if !ok {
+		return nil, fmt.Errorf("%s 结果缺少 metadata.json", provider)
+	}
+	var md struct {
+		Compiler struct {
+			Version string `json:"version"`
+		} `json:"compiler"`
+		Language string `json:"language"`
+		Output   struct {
+			ABI json.RawMessage `json:"abi"`
+		} `json:"output"`
+		Settings json.RawMessage `json:"settings"`
+		Sources  map[string]struct {
+			License string `json:"license"`
+		} `json:"sources"`
+	}
+	if err := json.Unmarshal([]byte(raw), &md); err != nil {
+		return nil, fmt.Errorf("解析 metadata.json 失败: %w", err)
+	}
+	var settings struct {
+		CompilationTarget map[string]string `json:"compilationTarget"`
+		EVMVersion        string            `json:"evmVersion"`
+		Optimizer         struct {
+			Enabled bool `json:"enabled"`
+			Runs    int  `json:"runs"`
+		} `json:"optimizer"`
+		Libraries map[string]string `json:"libraries"`
+	}
+	_ = json.Unmarshal(md.Settings, &settings)
+
+	meta := &ContractMetadata{
+		CompilerVersion:      md.Compiler.Version,
+		OptimizationUsed:     settings.Optimizer.Enabled,
+		Runs:                 settings.Optimizer.Runs,
+		EVMVersion:           settings.EVMVersion,
+		ConstructorArguments: strings.TrimSpace(files["constructor-args.txt"]),
+		ABI:                  string(md.Output.ABI),
+		Language:             md.Language,
+		Settings:             string(md.Settings),
+		Provider:             provider,
+		MatchType:            match,
+	}
+	for target, name := range settings.CompilationTarget {
+		meta.ContractName = name
+		if src, ok := md.Sources[target]; ok {
+			meta.License = src.License
+		}
+	}
+	if len(settings.Libraries) > 0 {
+		libs := make([]string, 0, len(settings.Libraries))
+		for k, v := range settings.Libraries {
+			libs = append(libs, k+":"+v)
+		}
+		sort.Strings(libs)
+		meta.Library = strings.Join(libs, ";")
+	}
+
+	for path, content := range files {
+		if strings.HasPrefix(path, "sources/") {
+			meta.Sources = append(meta.Sources, SourceFile{Path: strings.TrimPrefix(path, "sources/"), Content: content})
+		}
+	}
+	if len(meta.Sources) == 0 {
+		return nil, fmt.Errorf("%s 结果没有源文件", provider)
+	}
+	sortSourceFiles(meta.Sources)
+	meta.SourceCode = meta.FlattenSources()
+	return meta, nil
+}
+
+// httpGet 发送 GET 请求并返回响应体与状态码
+func httpGet(ctx context.Context, proxy, url string) ([]byte, int, error) {
+	client, err := internal.CreateProxyHTTPClient(proxy, 30*time.Second)
+	if err != nil {
+		return nil, 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("User-Agent", "solidity-excavator/1.0 (+https://github.com/)")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return body, resp.StatusCode, nil
+}
@@ -0,0 +1,170 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/admi-n/solidity-Excavator/src/config"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// erc20BalanceOfSelector balanceOf(address)
+var erc20BalanceOfSelector = []byte{0x70, 0xa0, 0x82, 0x31}
+
+// TokenRefreshOptions 代币持仓刷新任务参数
+type TokenRefreshOptions struct {
+	Tokens     []config.TokenConfig // 需要统计的代币
+	BatchSize  int                  // 每次 multicall 的子调用数上限（合约数 × 代币数）
+	BlockRange *BlockRangeRecord    // 只刷新该创建区块范围内的合约，nil 表示全部
+}
+
+// RefreshTokenBalances 通过 Multicall3 批量调用 balanceOf，统计已存储合约持有的代币，
+// 非零持仓写入 contract_token_balances，已清零的持仓删除
+func (d *Downloader) RefreshTokenBalances(ctx context.Context, opts TokenRefreshOptions) error {
+	if len(opts.Tokens) == 0 {
+		return fmt.Errorf("代币列表为空")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	perBatch := opts.BatchSize / len(opts.Tokens)
+	if perBatch < 1 {
+		perBatch = 1
+	}
+
+	conditions := []string{"chain = ?", "address > ?"}
+	var filterArgs []interface{}
+	if opts.BlockRange != nil {
+		cond, args := blockRangeCondition(*opts.BlockRange)
+		conditions = append(conditions, cond)
+		filterArgs = append(filterArgs, args...)
+	}
+	query := fmt.Sprintf("SELECT address FROM contracts WHERE %s ORDER BY address LIMIT %d",
+		strings.Join(conditions, " AND "), perBatch)
+
+	symbols := make([]string, len(opts.Tokens))
+	for i, t := range opts.Tokens {
+		symbols[i] = t.Symbol
+	}
+	log.Printf("🪙 开始统计代币持仓: %s（每批 %d 个合约）\n", strings.Join(symbols, ", "), perBatch)
+
+	cursor := ""
+	scanned, holders, failed := 0, 0, 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		args := append([]interface{}{d.chain, cursor}, filterArgs...)
+		addrs, err := queryStrings(ctx, d.db, query, args...)
+		if err != nil {
+			return fmt.Errorf("查询待统计合约失败: %w", err)
+		}
+		if len(addrs) == 0 {
+			break
+		}
+		cursor = addrs[len(addrs)-1]
+
+		calls := make([]mcCall, 0, len(addrs)*len(opts.Tokens))
+		for _, a := range addrs {
+			owner := common.LeftPadBytes(common.HexToAddress(a).Bytes(), 32)
+			for _, t := range opts.Tokens {
+				calls = append(calls, mcCall{
+					Target:   common.HexToAddress(t.Address),
+					CallData: append(append([]byte{}, erc20BalanceOfSelector...), owner...),
+				})
+			}
+		}
+		results, err := d.multicall(ctx, calls, nil)
+		if err != nil {
+			log.Printf("⚠️  统计代币持仓失败（%s 起的 %d 个合约）: %v\n", addrs[0], len(addrs), err)
+			failed += len(addrs)
+			continue
+		}
+
+		n, err := d.saveTokenBalances(ctx, addrs, opts.Tokens, results)
+		if err != nil {
+			return fmt.Errorf("写入代币持仓失败: %w", err)
+		}
+		scanned += len(addrs)
+		holders += n
+		log.Printf("🪙 已统计 %d 个合约，其中 %d 个持有代币，当前位置 %s\n", scanned, holders, cursor)
+	}
+
+	log.Printf("\n✅ 代币持仓统计完成!\n")
+	log.Printf("   - 已统计: %d\n", scanned)
+	log.Printf("   - 持有代币: %d\n", holders)
+	log.Printf("   - 失败: %d\n", failed)
+	return nil
+}
+
+// tokenBalanceUpsert 写入一个合约的一种代币持仓
+const tokenBalanceUpsert = `
+	INSERT INTO contract_token_balances (chain, address, token, symbol, balance, valueusd, updatedat)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE symbol = VALUES(symbol), balance = VALUES(balance), valueusd = VALUES(valueusd), updatedat = VALUES(updatedat)
+	`
+
+// saveTokenBalances 写入一批结果（results 按 地址 × 代币 顺序排列），返回持有任一代币的合约数
+func (d *Downloader) saveTokenBalances(ctx context.Context, addrs []string, tokens []config.TokenConfig, results []mcResult) (int, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	upsert, err := tx.PrepareContext(ctx, tokenBalanceUpsert)
+	if err != nil {
+		return 0, err
+	}
+	defer upsert.Close()
+
+	del, err := tx.PrepareContext(ctx, "DELETE FROM contract_token_balances WHERE chain = ? AND address = ? AND token = ?")
+	if err != nil {
+		return 0, err
+	}
+	defer del.Close()
+
+	now := time.Now()
+	holders := 0
+	for i, addr := range addrs {
+		holds := false
+		for j, t := range tokens {
+			r := results[i*len(tokens)+j]
+			// 调用失败（非标准代币等）时保留原记录
+			if !r.Success || len(r.ReturnData) < 32 {
+				continue
+			}
+			bal := new(big.Int).SetBytes(r.ReturnData[:32])
+			token := common.HexToAddress(t.Address).Hex()
+			if bal.Sign() == 0 {
+				if _, err := del.ExecContext(ctx, d.chain, addr, token); err != nil {
+					return 0, err
+				}
+				continue
+			}
+			holds = true
+			if _, err := upsert.ExecContext(ctx, d.chain, addr, token, t.Symbol, bal.String(), tokenValueUSD(bal, t.Decimals, t.PriceUSD), now); err != nil {
+				return 0, err
+			}
+		}
+		if holds {
+			holders++
+		}
+	}
+	return holders, tx.Commit()
+}
+
+// tokenValueUSD 按精度与近似价格换算持仓美元价值
+func tokenValueUSD(amount *big.Int, decimals int, price float64) float64 {
+	if price <= 0 {
+		return 0
+	}
+	v, _ := new(big.Float).Quo(new(big.Float).SetInt(amount), big.NewFloat(math.Pow10(decimals))).Float64()
+	return v * price
+}
@@ -0,0 +1,288 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// 内部创建（工厂合约 CREATE/CREATE2）的发现方式
+const (
+	TraceAuto   = "auto"   // 依次尝试 debug -> parity -> logs
+	TraceDebug  = "debug"  // debug_traceBlockByNumber + callTracer（geth 系节点）
+	TraceParity = "parity" // trace_block（Erigon / Nethermind / OpenEthereum）
+	TraceLogs   = "logs"   // 启发式：对区块内发出日志的未知地址探测历史 CodeAt（需要归档节点）
+	TraceOff    = "off"    // 只处理顶层创建交易
+)
+
+// ValidateTraceMode 校验 -trace 参数
+func ValidateTraceMode(mode string) error {
+	switch mode {
+	case TraceAuto, TraceDebug, TraceParity, TraceLogs, TraceOff:
+		return nil
+	}
+	return fmt.Errorf("不支持的 trace 模式: %s（可选: auto, debug, parity, logs, off）", mode)
+}
+
+// createdContract 区块内新建的一个合约
+type createdContract struct {
+	Address  common.Address
+	Factory  common.Address // 由合约内部 CREATE/CREATE2 创建时为工厂地址，顶层创建交易为空
+	TxHash   common.Hash    // 创建所在交易
+	Deployer common.Address // 部署者：顶层创建为交易发送方，内部创建为工厂合约
+	Nonce    *uint64        // 顶层创建交易的 nonce，内部创建未知
+	InitCode []byte         // init code（创建字节码 + 构造参数），日志探测发现的合约没有
+}
+
+// callFrame callTracer 的调用帧
+type callFrame struct {
+	Type  string      `json:"type"`
+	From  string      `json:"from"`
+	To    string      `json:"to"`
+	Input string      `json:"input,omitempty"`
+	Error string      `json:"error,omitempty"`
+	Calls []callFrame `json:"calls,omitempty"`
+}
+
+// txTraceResult debug_traceBlockByNumber 的单笔交易结果
+type txTraceResult struct {
+	TxHash string     `json:"txHash"`
+	Result *callFrame `json:"result"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// parityTrace trace_block 的单条 trace
+type parityTrace struct {
+	Type   string `json:"type"`
+	Action struct {
+		From string `json:"from"`
+		Init string `json:"init"`
+	} `json:"action"`
+	Result *struct {
+		Address string `json:"address"`
+	} `json:"result"`
+	TransactionHash string `json:"transactionHash"`
+	TraceAddress    []int  `json:"traceAddress"`
+	Error           string `json:"error,omitempty"`
+}
+
+// discoverInternalCreations 按配置的 trace 模式发现区块内由合约创建的合约。
+// auto 模式下某种方式不被节点支持时会自动降级，并记住结果避免重复探测。
+func (d *Downloader) discoverInternalCreations(ctx context.Context, block *types.Block) ([]createdContract, error) {
+	mode := d.pipeline.Trace
+	if mode == "" {
+		mode = TraceAuto
+	}
+	if mode == TraceAuto {
+		if m, ok := d.traceResolved.Load().(string); ok && m != "" {
+			mode = m
+		}
+	}
+
+	switch mode {
+	case TraceOff:
+		return nil, nil
+	case TraceDebug:
+		return d.traceDebug(ctx, block)
+	case TraceParity:
+		return d.traceParity(ctx, block)
+	case TraceLogs:
+		return d.probeLogEmitters(ctx, block)
+	}
+
+	// auto：逐个尝试
+	out, err := d.traceDebug(ctx, block)
+	if err == nil {
+		d.traceResolved.Store(TraceDebug)
+		return out, nil
+	}
+	if !isMethodNotSupported(err) {
+		return nil, err
+	}
+	out, err = d.traceParity(ctx, block)
+	if err == nil {
+		log.Println("ℹ️  节点不支持 debug_traceBlockByNumber，改用 trace_block 发现内部创建")
+		d.traceResolved.Store(TraceParity)
+		return out, nil
+	}
+	if !isMethodNotSupported(err) {
+		return nil, err
+	}
+	log.Println("ℹ️  节点不支持 trace API，改用日志地址探测发现内部创建（可能漏掉不发日志的合约，非归档节点上无法判断）")
+	d.traceResolved.Store(TraceLogs)
+	return d.probeLogEmitters(ctx, block)
+}
+
+// traceDebug 使用 debug_traceBlockByNumber + callTracer 收集 CREATE/CREATE2 帧
+func (d *Downloader) traceDebug(ctx context.Context, block *types.Block) ([]createdContract, error) {
+	var traces []txTraceResult
+	tracerCfg := map[string]interface{}{"tracer": "callTracer"}
+	if err := d.Client.CallContext(ctx, &traces, "debug_traceBlockByNumber", hexutil.EncodeUint64(block.NumberU64()), tracerCfg); err != nil {
+		return nil, err
+	}
+
+	txs := block.Transactions()
+	var out []createdContract
+	for i, t := range traces {
+		// 根帧出错时整笔交易回滚，其中的创建同样无效
+		if t.Result == nil || t.Error != "" || t.Result.Error != "" {
+			continue
+		}
+		// 旧版本 geth 不返回 txHash，按交易顺序对应
+		txHash := common.HexToHash(t.TxHash)
+		if t.TxHash == "" && i < len(txs) {
+			txHash = txs[i].Hash()
+		}
+		// 根帧是交易本身，顶层创建交易已由主流程处理，这里只看子调用
+		for _, c := range t.Result.Calls {
+			collectCreateFrames(c, txHash, &out)
+		}
+	}
+	return out, nil
+}
+
+// collectCreateFrames 递归收集成功的 CREATE/CREATE2 帧（出错帧及其子调用均已回滚，跳过）
+func collectCreateFrames(f callFrame, txHash common.Hash, out *[]createdContract) {
+	if f.Error != "" {
+		return
+	}
+	t := strings.ToUpper(f.Type)
+	if (t == "CREATE" || t == "CREATE2") && common.IsHexAddress(f.To) {
+		factory := common.HexToAddress(f.From)
+		*out = append(*out, createdContract{
+			Address:  common.HexToAddress(f.To),
+			Factory:  factory,
+			TxHash:   txHash,
+			Deployer: factory,
+			InitCode: common.FromHex(f.Input),
+		})
+	}
+	for _, c := range f.Calls {
+		collectCreateFrames(c, txHash, out)
+	}
+}
+
+// traceParity 使用 trace_block 收集 create 类型的子 trace
+func (d *Downloader) traceParity(ctx context.Context, block *types.Block) ([]createdContract, error) {
+	var traces []parityTrace
+	if err := d.Client.CallContext(ctx, &traces, "trace_block", hexutil.EncodeUint64(block.NumberU64())); err != nil {
+		return nil, err
+	}
+
+	// 记录出错的 trace 前缀，其子 trace 同样被回滚
+	reverted := make(map[string]bool)
+	var out []createdContract
+	for _, t := range traces {
+		key := t.TransactionHash + ":" + traceAddressKey(t.TraceAddress)
+		if t.Error != "" {
+			reverted[key] = true
+			continue
+		}
+		if isRevertedTrace(reverted, t.TransactionHash, t.TraceAddress) {
+			continue
+		}
+		// traceAddress 为空表示顶层调用，已由主流程处理
+		if len(t.TraceAddress) == 0 || t.Type != "create" || t.Result == nil {
+			continue
+		}
+		if !common.IsHexAddress(t.Result.Address) {
+			continue
+		}
+		factory := common.HexToAddress(t.Action.From)
+		out = append(out, createdContract{
+			Address:  common.HexToAddress(t.Result.Address),
+			Factory:  factory,
+			TxHash:   common.HexToHash(t.TransactionHash),
+			Deployer: factory,
+			InitCode: common.FromHex(t.Action.Init),
+		})
+	}
+	return out, nil
+}
+
+func traceAddressKey(path []int) string {
+	parts := make([]string, len(path))
+	for i, p := range path {
+		parts[i] = fmt.Sprint(p)
+	}
+	return strings.Join(parts, ",")
+}
+
+// isRevertedTrace 检查 trace 的任一祖先是否出错
+func isRevertedTrace(reverted map[string]bool, txHash string, path []int) bool {
+	for i := 0; i < len(path); i++ {
+		if reverted[txHash+":"+traceAddressKey(path[:i])] {
+			return true
+		}
+	}
+	return false
+}
+
+// probeLogEmitters 启发式发现：对区块内发出日志但数据库中不存在的地址探测 CodeAt，
+// 本区块有代码而上一区块没有代码，即视为本区块内创建（工厂地址取交易的 To）。
+// 需要读取历史状态：任一区块的代码读取失败（非归档节点）时跳过该地址，避免把早已存在的合约记为本区块创建
+func (d *Downloader) probeLogEmitters(ctx context.Context, block *types.Block) ([]createdContract, error) {
+	txs := block.Transactions()
+	if len(txs) == 0 {
+		return nil, nil
+	}
+	receipts, err := d.fetchReceipts(ctx, block.NumberU64(), txs)
+	if err != nil {
+		return nil, err
+	}
+
+	txTo := make(map[common.Hash]common.Address, len(txs))
+	for _, tx := range txs {
+		if tx.To() != nil {
+			txTo[tx.Hash()] = *tx.To()
+		}
+	}
+
+	seen := make(map[common.Address]bool)
+	var out []createdContract
+	num := new(big.Int).SetUint64(block.NumberU64())
+	prev := new(big.Int).Sub(num, big.NewInt(1))
+	for _, tx := range txs {
+		r := receipts[tx.Hash()]
+		if r == nil {
+			continue
+		}
+		for _, lg := range r.Logs {
+			addr := lg.Address
+			// 跳过本交易直接调用的地址（已存在的合约）与已探测过的地址
+			if seen[addr] || addr == txTo[tx.Hash()] {
+				continue
+			}
+			seen[addr] = true
+
+			exists, err := d.ContractExists(ctx, addr.Hex())
+			if err != nil || exists {
+				continue
+			}
+			code, err := d.Client.CodeAt(ctx, addr, num)
+			if err != nil || len(code) == 0 {
+				continue
+			}
+			if num.Sign() > 0 {
+				prevCode, err := d.Client.CodeAt(ctx, addr, prev)
+				if err != nil || len(prevCode) > 0 {
+					// 读取不到上一区块的代码，或上一区块已有代码（不是本区块创建的）
+					continue
+				}
+			}
+			out = append(out, createdContract{
+				Address:  addr,
+				Factory:  txTo[tx.Hash()],
+				TxHash:   tx.Hash(),
+				Deployer: txTo[tx.Hash()],
+			})
+		}
+	}
+	return out, nil
+}
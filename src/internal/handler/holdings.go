@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/admi-n/solidity-Excavator/src/config"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// holding 合约的资产汇总（原生币 + 已统计的 ERC-20 代币）
+type holding struct {
+	USD   float64  // 按配置近似价格换算的美元总价值
+	Parts []string // 例如 "1.5000 ETH"、"20000.0000 USDT"
+}
+
+// tokenHoldingsJoin 关联代币持仓汇总的 JOIN 子句（contracts 别名 c）
+const tokenHoldingsJoin = ` LEFT JOIN (
+	SELECT chain, address, SUM(valueusd) AS tokenusd FROM contract_token_balances GROUP BY chain, address
+) t ON t.chain = c.chain AND t.address = c.address`
+
+// holdingsExpr 总持仓美元价值的 SQL 表达式（原生币价格直接内联，来自配置而非用户输入）
+func holdingsExpr(nativePriceUSD float64) string {
+	price := strconv.FormatFloat(nativePriceUSD, 'f', -1, 64)
+	return fmt.Sprintf("(c.balance / 1e18 * %s + COALESCE(t.tokenusd, 0))", price)
+}
+
+// nativeSymbol 链的原生币符号（来自链注册表）
+func nativeSymbol(chain string) string {
+	c, err := config.GetChain(chain)
+	if err != nil {
+		return "ETH"
+	}
+	return c.NativeSymbol
+}
+
+// loadHoldings 查询一批地址的原生币余额与代币持仓；代币表不存在等错误时只返回原生币部分
+func loadHoldings(db *sql.DB, addresses []string, chain string) (map[string]*holding, error) {
+	out := make(map[string]*holding, len(addresses))
+	if len(addresses) == 0 {
+		return out, nil
+	}
+	tokens := config.GetChainTokens(chain)
+
+	placeholders := make([]string, len(addresses))
+	args := make([]interface{}, 0, len(addresses)+1)
+	args = append(args, chain)
+	for i, a := range addresses {
+		placeholders[i] = "?"
+		args = append(args, a)
+	}
+	in := strings.Join(placeholders, ",")
+
+	rows, err := db.Query(fmt.Sprintf("SELECT address, balance FROM contracts WHERE chain = ? AND address IN (%s)", in), args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var addr, bal string
+		if err := rows.Scan(&addr, &bal); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		wei, ok := new(big.Int).SetString(strings.TrimSpace(bal), 10)
+		if !ok || wei.Sign() == 0 {
+			continue
+		}
+		amount := formatUnits(wei, 18)
+		h := getHolding(out, addr)
+		h.USD += amount * tokens.NativePriceUSD
+		h.Parts = append(h.Parts, fmt.Sprintf("%.4f %s", amount, nativeSymbol(chain)))
+	}
+	rows.Close()
+
+	decimals := make(map[string]int, len(tokens.List))
+	for _, t := range tokens.List {
+		decimals[common.HexToAddress(t.Address).Hex()] = t.Decimals
+	}
+
+	rows, err = db.Query(fmt.Sprintf("SELECT address, token, symbol, balance, valueusd FROM contract_token_balances WHERE chain = ? AND address IN (%s) ORDER BY valueusd DESC", in), args...)
+	if err != nil {
+		// 未执行过 -refresh-tokens 的旧库没有该表
+		return out, nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var addr, token, symbol, bal string
+		var usd float64
+		if err := rows.Scan(&addr, &token, &symbol, &bal, &usd); err != nil {
+			return nil, err
+		}
+		raw, ok := new(big.Int).SetString(strings.TrimSpace(bal), 10)
+		if !ok {
+			continue
+		}
+		dec, ok := decimals[common.HexToAddress(token).Hex()]
+		if !ok {
+			dec = 18
+		}
+		h := getHolding(out, addr)
+		h.USD += usd
+		h.Parts = append(h.Parts, fmt.Sprintf("%.4f %s", formatUnits(raw, dec), symbol))
+	}
+	return out, rows.Err()
+}
+
+func getHolding(m map[string]*holding, addr string) *holding {
+	key := strings.ToLower(addr)
+	h, ok := m[key]
+	if !ok {
+		h = &holding{}
+		m[key] = h
+	}
+	return h
+}
+
+// formatUnits 按精度换算为浮点数量（仅用于展示与排序）
+func formatUnits(v *big.Int, decimals int) float64 {
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(v), big.NewFloat(math.Pow10(decimals))).Float64()
+	return f
+}
@@ -23,12 +23,13 @@ import (
 func RunMode1Targeted(cfg internal.ScanConfig) error {
 	fmt.Println("🎯 启动 Mode1 定向漏洞扫描...")
 
-	// 1. 初始化数据库
-	db, err := config.InitDB()
+	// 1. 初始化数据库（按 database.dsn 选择 MySQL / SQLite）
+	store, err := config.InitDB()
 	if err != nil {
 		return fmt.Errorf("初始化数据库失败: %w", err)
 	}
-	defer db.Close()
+	defer store.Close()
+	db := store.DB()
 
 	// 2. 创建 AI 管理器
 	aiManager, err := ai.NewManager(ai.ManagerConfig{
@@ -65,9 +66,11 @@ func RunMode1Targeted(cfg internal.ScanConfig) error {
 
 	// 5. 获取目标合约地址
 	var targetAddresses []string
+	// duplicates: 代表地址 -> 与其代码哈希相同的其他地址（仅 -t db 时按哈希去重）
+	var duplicates map[string][]string
 	switch strings.ToLower(cfg.TargetSource) {
 	case "db":
-		targetAddresses, err = getAddressesFromDB(db, cfg.BlockRange)
+		targetAddresses, duplicates, err = getAddressesFromDB(db, cfg)
 		if err != nil {
 			return fmt.Errorf("从数据库获取地址失败: %w", err)
 		}
@@ -76,6 +79,12 @@ func RunMode1Targeted(cfg internal.ScanConfig) error {
 		if err != nil {
 			return fmt.Errorf("从文件获取地址失败: %w", err)
 		}
+	case "deployer":
+		// 部署者的全部合约（含其工厂合约再创建的合约）
+		targetAddresses, err = download.ContractsByDeployer(ctx, db, cfg.Chain, strings.TrimSpace(cfg.TargetAddress))
+		if err != nil {
+			return fmt.Errorf("按部署者获取地址失败: %w", err)
+		}
 	case "contract", "address", "single":
 		if strings.TrimSpace(cfg.TargetAddress) == "" {
 			return fmt.Errorf("缺少目标合约地址: -t-address")
@@ -91,9 +100,15 @@ func RunMode1Targeted(cfg internal.ScanConfig) error {
 	}
 
 	fmt.Printf("📋 共找到 %d 个目标合约\n", len(targetAddresses))
+	if n := countDuplicates(duplicates); n > 0 {
+		fmt.Printf("♻️  另有 %d 个合约与目标字节码相同，将复用代表合约的分析结果\n", n)
+	}
 
-	// 6. 创建下载器（用于获取合约代码）
-	downloader, err := download.NewDownloader(db, cfg.Proxy)
+	// 6. 创建下载器（用于获取合约代码，连接 -c 指定链的节点）
+	downloader, err := download.NewDownloader(store, cfg.Chain, cfg.Proxy, download.ChainReaderOptions{
+		Fixture: cfg.RPCFixture,
+		Record:  cfg.RPCRecord,
+	})
 	if err != nil {
 		return fmt.Errorf("创建下载器失败: %w", err)
 	}
@@ -108,11 +123,29 @@ func RunMode1Targeted(cfg internal.ScanConfig) error {
 	successCount := 0
 	failCount := 0
 
-	for i, address := range targetAddresses {
+	// 按索引遍历：新识别出的代理合约会把同字节码地址追加为独立目标
+	for i := 0; i < len(targetAddresses); i++ {
+		address := targetAddresses[i]
 		fmt.Printf("\n[%d/%d] 处理合约: %s\n", i+1, len(targetAddresses), address)
 
-		// 7.1 获取合约代码
-		contractCode, err := getOrDownloadContract(ctx, db, downloader, address)
+		// 7.1 代理合约改为分析实现合约的源码（存储与余额仍属于代理地址）
+		analyzeAddress := address
+		proxy, err := downloader.ResolveProxy(ctx, address)
+		if err != nil {
+			fmt.Printf("  ⚠️  识别代理失败: %v，按普通合约处理\n", err)
+		}
+		if proxy != nil {
+			fmt.Printf("  🔀 代理合约 (%s)，实现合约: %s\n", proxy.Kind, proxy.Implementation)
+			analyzeAddress = proxy.Implementation
+			// 字节码相同的代理可能指向不同实现，不能复用结果
+			if dups := duplicates[address]; len(dups) > 0 {
+				targetAddresses = append(targetAddresses, dups...)
+				delete(duplicates, address)
+			}
+		}
+
+		// 7.2 获取合约代码
+		contractCode, err := getOrDownloadContract(ctx, store, downloader, analyzeAddress)
 		if err != nil {
 			fmt.Printf("⚠️  获取合约代码失败: %v，跳过\n", err)
 			failCount++
@@ -126,13 +159,37 @@ func RunMode1Targeted(cfg internal.ScanConfig) error {
 			continue
 		}
 
-		// 7.2 构建 prompt
+		// 有验证元数据时按源文件拼接（主合约在前），并提供合约名与编译器信息
+		var contractName, compilerVersion string
+		meta, err := download.LoadContractMetadata(ctx, db, cfg.Chain, analyzeAddress)
+		if err != nil {
+			fmt.Printf("  ⚠️  读取合约元数据失败: %v\n", err)
+		}
+		if meta != nil {
+			contractName, compilerVersion = meta.ContractName, meta.CompilerVersion
+			if len(meta.Sources) > 0 {
+				contractCode = meta.FlattenSources()
+			}
+			fmt.Printf("  📄 主合约: %s (%s, %d 个源文件)\n", contractName, compilerVersion, len(meta.Sources))
+		}
+
+		var implementation, proxyKind string
+		if proxy != nil {
+			implementation, proxyKind = proxy.Implementation, proxy.Kind
+			contractCode = fmt.Sprintf("// 目标 %s 是 %s 代理合约，以下为其实现合约 %s 的源码；状态与资产属于代理地址\n\n%s",
+				address, proxy.Kind, proxy.Implementation, contractCode)
+		}
+
+		// 7.3 构建 prompt
 		var prompt string
 		if cfg.InputFile != "" && inputFileContent != "" {
 			// 使用输入文件内容构建prompt
 			prompt = prompts.BuildPrompt(promptTemplate, map[string]string{
 				"ContractAddress":  address,
 				"ContractCode":     contractCode,
+				"ContractName":     contractName,
+				"CompilerVersion":  compilerVersion,
+				"Implementation":   implementation,
 				"Strategy":         cfg.Strategy,
 				"InputFileContent": inputFileContent, // 使用输入文件内容替换模板中的占位符
 			})
@@ -140,11 +197,14 @@ func RunMode1Targeted(cfg internal.ScanConfig) error {
 			prompt = prompts.BuildPrompt(promptTemplate, map[string]string{
 				"ContractAddress": address,
 				"ContractCode":    contractCode,
+				"ContractName":    contractName,
+				"CompilerVersion": compilerVersion,
+				"Implementation":  implementation,
 				"Strategy":        cfg.Strategy,
 			})
 		}
 
-		// 7.3 调用 AI 分析
+		// 7.4 调用 AI 分析
 		analysisResult, err := aiManager.AnalyzeContract(ctx, contractCode, prompt)
 		if err != nil {
 			fmt.Printf("⚠️  AI 分析失败: %v，跳过\n", err)
@@ -152,13 +212,17 @@ func RunMode1Targeted(cfg internal.ScanConfig) error {
 			continue
 		}
 
-		// 7.4 保存结果
+		// 7.5 保存结果
 		scanResult := &ScanResult{
-			Address:        address,
-			AnalysisResult: analysisResult,
-			Timestamp:      time.Now(),
-			Mode:           cfg.Mode,
-			Strategy:       cfg.Strategy,
+			Address:         address,
+			AnalysisResult:  analysisResult,
+			Timestamp:       time.Now(),
+			Mode:            cfg.Mode,
+			Strategy:        cfg.Strategy,
+			ContractName:    contractName,
+			CompilerVersion: compilerVersion,
+			Implementation:  implementation,
+			ProxyKind:       proxyKind,
 		}
 		results = append(results, scanResult)
 		successCount++
@@ -168,6 +232,23 @@ func RunMode1Targeted(cfg internal.ScanConfig) error {
 		printVulnerabilitySummary(scanResult)
 		fmt.Printf("%s\n", strings.Repeat("=", 50))
 
+		// 字节码相同的合约直接复用分析结果
+		for _, dup := range duplicates[address] {
+			results = append(results, &ScanResult{
+				Address:         dup,
+				AnalysisResult:  analysisResult,
+				Timestamp:       scanResult.Timestamp,
+				Mode:            cfg.Mode,
+				Strategy:        cfg.Strategy,
+				DuplicateOf:     address,
+				ContractName:    contractName,
+				CompilerVersion: compilerVersion,
+			})
+		}
+		if n := len(duplicates[address]); n > 0 {
+			fmt.Printf("  ♻️  结果已复用到 %d 个字节码相同的合约\n", n)
+		}
+
 		// 避免请求过快
 		time.Sleep(100 * time.Millisecond)
 	}
@@ -183,7 +264,7 @@ func RunMode1Targeted(cfg internal.ScanConfig) error {
 
 	// 9. 生成报告
 	if len(results) > 0 {
-		if err := generateReport(results, cfg); err != nil {
+		if err := generateReport(db, results, cfg); err != nil {
 			return fmt.Errorf("生成报告失败: %w", err)
 		}
 	}
@@ -210,11 +291,10 @@ func isOnlyBytecode(code string) bool {
 }
 
 // getOrDownloadContract 从数据库获取合约代码，如果不存在则下载
-func getOrDownloadContract(ctx context.Context, db *sql.DB, downloader *download.Downloader, address string) (string, error) {
-	// 先尝试从数据库获取（注意：字段名是 contract）
-	var contractCode string
-	query := "SELECT contract FROM contracts WHERE address = ? AND contract IS NOT NULL AND contract != ''"
-	err := db.QueryRow(query, address).Scan(&contractCode)
+func getOrDownloadContract(ctx context.Context, store config.ContractStore, downloader *download.Downloader, address string) (string, error) {
+	// 先尝试从数据库获取（注意：字段名是 contract），只读下载器所属链的记录
+	chain := downloader.Chain().Name
+	contractCode, err := store.GetContractCode(ctx, chain, address)
 	if err == nil && contractCode != "" {
 		fmt.Println("  ✓ 从数据库读取合约代码")
 		return contractCode, nil
@@ -222,7 +302,7 @@ func getOrDownloadContract(ctx context.Context, db *sql.DB, downloader *download
 
 	// 数据库中不存在，尝试下载（下载器会把源码写入 DB，如果可用）
 	fmt.Println("  ↓ 合约不在数据库中，正在下载...")
-	if err := downloader.DownloadContractsByAddresses(ctx, []string{address}, ""); err != nil {
+	if err := downloader.DownloadContractsByAddresses(ctx, []string{address}); err != nil {
 		// 回退为从链上读取字节码
 		codeBytes, rcErr := downloader.Client.CodeAt(ctx, common.HexToAddress(address), nil)
 		if rcErr != nil {
@@ -232,7 +312,7 @@ func getOrDownloadContract(ctx context.Context, db *sql.DB, downloader *download
 	}
 
 	// 尝试再次从数据库读取
-	err = db.QueryRow(query, address).Scan(&contractCode)
+	contractCode, err = store.GetContractCode(ctx, chain, address)
 	if err == nil && contractCode != "" {
 		return contractCode, nil
 	}
@@ -240,39 +320,154 @@ func getOrDownloadContract(ctx context.Context, db *sql.DB, downloader *download
 	return "", fmt.Errorf("未能获取合约源码，仅存在字节码或不存在")
 }
 
-// getAddressesFromDB 从数据库读取地址列表，支持按区间查询
-func getAddressesFromDB(db *sql.DB, blockRange *internal.BlockRange) ([]string, error) {
-	var query string
-	var args []interface{}
-
-	// 构建基础查询条件
-	baseConditions := "isopensource = 1 AND contract IS NOT NULL AND contract != ''"
+// getAddressesFromDB 从数据库读取地址列表，支持按区间、总持仓过滤以及按总持仓排序。
+// 同一 code_hash 只返回一个代表地址，其余地址通过 duplicates（代表地址 -> 其他地址）返回以复用分析结果。
+func getAddressesFromDB(db *sql.DB, cfg internal.ScanConfig) ([]string, map[string][]string, error) {
+	// 构建基础查询条件（只取 -c 指定的链）；代理合约字节码相同但实现不同，不参与按哈希去重
+	from := "contracts c LEFT JOIN contract_proxies p ON p.chain = c.chain AND p.address = c.address"
+	conditions := "c.chain = ? AND c.isopensource = 1 AND c.contract IS NOT NULL AND c.contract != ''"
+	args := []interface{}{cfg.Chain}
 
-	if blockRange != nil {
+	if cfg.BlockRange != nil {
 		// 如果有区块范围限制，添加区块条件
-		query = fmt.Sprintf(`SELECT DISTINCT address FROM contracts WHERE %s AND createblock BETWEEN ? AND ? LIMIT 1000`, baseConditions)
-		args = []interface{}{blockRange.Start, blockRange.End}
-	} else {
-		// 默认返回前 1000 个开源合约
-		query = fmt.Sprintf(`SELECT DISTINCT address FROM contracts WHERE %s LIMIT 1000`, baseConditions)
-		args = []interface{}{}
+		conditions += " AND c.createblock BETWEEN ? AND ?"
+		args = append(args, cfg.BlockRange.Start, cfg.BlockRange.End)
+	}
+
+	if cfg.SolcVersion != "" {
+		// 编译器版本来自字节码 CBOR 元数据，未解析或未写入版本的合约不参与
+		op, version, err := download.ParseSolcConstraint(cfg.SolcVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+		conditions += " AND c.solcversion IS NOT NULL AND c.solcversion != '' AND " + download.SolcVersionSQL("c.solcversion") + " " + op + " ?"
+		args = append(args, version)
+	}
+
+	if len(cfg.Selectors) > 0 {
+		cond, selArgs := download.SelectorFilterSQL("c.code_hash", cfg.Selectors)
+		conditions += " AND " + cond
+		args = append(args, selArgs...)
 	}
 
+	if len(cfg.Kinds) > 0 {
+		cond, kindArgs := download.KindFilterSQL("c.chain", "c.address", cfg.Kinds)
+		conditions += " AND " + cond
+		args = append(args, kindArgs...)
+	}
+
+	// 需要按持仓过滤/排序时关联代币持仓表
+	byHoldings := cfg.SortBy == "holdings"
+	order := ""
+	selectHoldings := "0"
+	if cfg.MinHoldingsUSD > 0 || byHoldings {
+		from += tokenHoldingsJoin
+		expr := holdingsExpr(config.GetChainTokens(cfg.Chain).NativePriceUSD)
+		selectHoldings = "MAX(" + expr + ")"
+		if cfg.MinHoldingsUSD > 0 {
+			conditions += " AND " + expr + " >= ?"
+			args = append(args, cfg.MinHoldingsUSD)
+		}
+		if byHoldings {
+			order = " ORDER BY holdings DESC"
+		}
+	}
+
+	// 每个代码哈希取一个代表地址（无哈希的旧数据按地址自成一组），默认最多 1000 个
+	query := fmt.Sprintf(`SELECT MIN(c.address), IF(MAX(p.address) IS NULL, MAX(c.code_hash), ''), %s AS holdings FROM %s WHERE %s
+		GROUP BY COALESCE(IF(p.address IS NULL, NULLIF(c.code_hash, ''), NULL), c.address)%s LIMIT 1000`, selectHoldings, from, conditions, order)
+
 	rows, err := db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	addrs := make([]string, 0)
+	repByHash := make(map[string]string)
 	for rows.Next() {
 		var a string
-		if err := rows.Scan(&a); err != nil {
+		var h sql.NullString
+		var holdings sql.NullFloat64
+		if err := rows.Scan(&a, &h, &holdings); err != nil {
+			return nil, nil, err
+		}
+		a = strings.TrimSpace(a)
+		addrs = append(addrs, a)
+		if h.Valid && h.String != "" {
+			repByHash[h.String] = a
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	duplicates, err := getDuplicateAddresses(db, from, conditions, args, repByHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return addrs, duplicates, nil
+}
+
+// getDuplicateAddresses 查询与代表地址代码哈希相同的其他地址（同样受区块范围等条件约束）
+func getDuplicateAddresses(db *sql.DB, from, conditions string, baseArgs []interface{}, repByHash map[string]string) (map[string][]string, error) {
+	out := make(map[string][]string)
+	if len(repByHash) == 0 {
+		return out, nil
+	}
+
+	hashes := make([]string, 0, len(repByHash))
+	for h := range repByHash {
+		hashes = append(hashes, h)
+	}
+
+	// 分批构造 IN 查询，避免占位符过多
+	const batch = 500
+	for i := 0; i < len(hashes); i += batch {
+		end := i + batch
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		placeholders := make([]string, 0, end-i)
+		args := append([]interface{}{}, baseArgs...)
+		for _, h := range hashes[i:end] {
+			placeholders = append(placeholders, "?")
+			args = append(args, h)
+		}
+
+		query := fmt.Sprintf("SELECT c.address, c.code_hash FROM %s WHERE %s AND p.address IS NULL AND c.code_hash IN (%s)",
+			from, conditions, strings.Join(placeholders, ","))
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var a, h string
+			if err := rows.Scan(&a, &h); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			a = strings.TrimSpace(a)
+			if rep := repByHash[h]; rep != "" && rep != a {
+				out[rep] = append(out[rep], a)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
 			return nil, err
 		}
-		addrs = append(addrs, strings.TrimSpace(a))
 	}
-	return addrs, nil
+	return out, nil
+}
+
+// countDuplicates 统计复用结果的合约数量
+func countDuplicates(duplicates map[string][]string) int {
+	n := 0
+	for _, d := range duplicates {
+		n += len(d)
+	}
+	return n
 }
 
 // getAddressesFromFile 从文件获取地址列表
@@ -309,6 +504,12 @@ type ScanResult struct {
 	Timestamp      time.Time
 	Mode           string
 	Strategy       string
+	DuplicateOf    string // 非空表示字节码与该地址相同，复用其分析结果
+
+	ContractName    string // Etherscan 验证的主合约名（未验证为空）
+	CompilerVersion string // 编译器版本
+	Implementation  string // 目标为代理合约时实际分析的实现合约地址
+	ProxyKind       string // 代理类型
 }
 
 // printVulnerabilitySummary 打印漏洞摘要
@@ -362,16 +563,34 @@ func countVulnerableContracts(results []*ScanResult) int {
 }
 
 // generateReport 生成扫描报告并写入文件
-func generateReport(results []*ScanResult, cfg internal.ScanConfig) error {
+func generateReport(db *sql.DB, results []*ScanResult, cfg internal.ScanConfig) error {
 	fmt.Println("\n📄 生成扫描报告...")
 
 	// 创建报告实例
 	reportInstance := report.NewReport(cfg.Mode, cfg.Strategy, cfg.AIProvider)
 
+	// 查询合约资产（原生币 + 代币），失败不影响报告生成
+	addrs := make([]string, 0, len(results))
+	for _, r := range results {
+		addrs = append(addrs, r.Address)
+	}
+	holdings, err := loadHoldings(db, addrs, cfg.Chain)
+	if err != nil {
+		fmt.Printf("⚠️  查询合约资产失败: %v\n", err)
+	}
+
 	// 转换扫描结果
 	for _, result := range results {
 		scanResult := report.NewScanResult(result.Address)
 		scanResult.SetStatus(fmt.Sprintf("⚠️ 发现 %d 个漏洞", len(result.AnalysisResult.Vulnerabilities)))
+		scanResult.DuplicateOf = result.DuplicateOf
+		scanResult.ContractName = result.ContractName
+		scanResult.CompilerVersion = result.CompilerVersion
+		scanResult.Implementation = result.Implementation
+		scanResult.ProxyKind = result.ProxyKind
+		if h := holdings[strings.ToLower(result.Address)]; h != nil {
+			scanResult.SetHoldings(h.USD, h.Parts)
+		}
 
 		if result.AnalysisResult != nil {
 			// 设置分析摘要
@@ -398,6 +617,10 @@ func generateReport(results []*ScanResult, cfg internal.ScanConfig) error {
 		reportInstance.AddScanResult(scanResult)
 	}
 
+	if cfg.SortBy == "holdings" {
+		reportInstance.SortByHoldings()
+	}
+
 	// 创建报告器
 	generator := report.NewMarkdownGenerator()
 	storage := report.NewFileStorage(cfg.ReportDir)
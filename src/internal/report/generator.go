@@ -2,6 +2,7 @@ package report
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -13,6 +14,13 @@ type ScanResult struct {
 	Vulnerabilities []Vulnerability
 	AnalysisSummary string
 	RawResponse     string
+	DuplicateOf     string   // 非空表示字节码与该地址相同，分析结果复用自该地址
+	HoldingsUSD     float64  // 资产总价值（按配置近似价格换算的美元）
+	Holdings        []string // 资产明细，例如 "1.5000 ETH"
+	ContractName    string   // Etherscan 验证的主合约名
+	CompilerVersion string   // 编译器版本
+	Implementation  string   // 目标为代理合约时实际分析的实现合约地址
+	ProxyKind       string   // 代理类型
 }
 
 // Vulnerability 表示发现的漏洞
@@ -79,7 +87,26 @@ func (g *MarkdownGenerator) Generate(report *Report) (string, error) {
 		// 合约地址作为一级标题
 		result += fmt.Sprintf("# 合约地址: %s\n\n", scanResult.ContractAddress)
 		result += fmt.Sprintf("**扫描时间**: %s\n", scanResult.ScanTime.Format("2006-01-02 15:04:05"))
-		result += fmt.Sprintf("**状态**: %s\n\n", scanResult.Status)
+		result += fmt.Sprintf("**状态**: %s\n", scanResult.Status)
+		if scanResult.Implementation != "" {
+			result += fmt.Sprintf("**代理**: %s 代理，分析基于实现合约 %s 的源码\n", scanResult.ProxyKind, scanResult.Implementation)
+		}
+		if scanResult.ContractName != "" {
+			result += fmt.Sprintf("**合约名**: %s (%s)\n", scanResult.ContractName, scanResult.CompilerVersion)
+		}
+		if len(scanResult.Holdings) > 0 {
+			result += fmt.Sprintf("**资产**: ~$%.2f (%s)\n", scanResult.HoldingsUSD, strings.Join(scanResult.Holdings, ", "))
+		}
+		result += "\n"
+
+		// 字节码相同的合约只列出引用，不重复输出分析内容
+		if scanResult.DuplicateOf != "" {
+			result += fmt.Sprintf("> 字节码与 %s 相同，分析结果复用自该合约\n\n", scanResult.DuplicateOf)
+			if i < len(report.Results)-1 {
+				result += fmt.Sprintf("---\n\n")
+			}
+			continue
+		}
 
 		// AI分析摘要
 		if scanResult.AnalysisSummary != "" {
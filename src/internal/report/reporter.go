@@ -2,6 +2,7 @@ package report
 
 import (
 	"fmt"
+	"sort"
 	"time"
 )
 
@@ -65,6 +66,13 @@ func (r *Report) AddScanResult(result ScanResult) {
 	}
 }
 
+// SortByHoldings 按资产总价值从高到低排列扫描结果
+func (r *Report) SortByHoldings() {
+	sort.SliceStable(r.Results, func(i, j int) bool {
+		return r.Results[i].HoldingsUSD > r.Results[j].HoldingsUSD
+	})
+}
+
 // NewScanResult 创建新的扫描结果
 func NewScanResult(contractAddress string) ScanResult {
 	return ScanResult{
@@ -90,6 +98,12 @@ func (s *ScanResult) SetAnalysisSummary(summary string) {
 	s.AnalysisSummary = summary
 }
 
+// SetHoldings 设置资产汇总
+func (s *ScanResult) SetHoldings(usd float64, parts []string) {
+	s.HoldingsUSD = usd
+	s.Holdings = parts
+}
+
 // SetRawResponse 设置原始响应
 func (s *ScanResult) SetRawResponse(response string) {
 	s.RawResponse = response
@@ -16,7 +16,15 @@ type ScanConfig struct {
 	BlockRange    *BlockRange
 	InputFile     string // 输入文件路径（-i参数）
 	Proxy         string // HTTP 代理
+	RPCFixture    string // 回放录制的 RPC 响应（文件或目录），不连接节点
+	RPCRecord     string // 把节点的 RPC 响应录制到该文件
 	ReportDir     string // 报告输出目录（-r参数）
+
+	MinHoldingsUSD float64  // -t db 时只扫描总持仓（原生币+代币，美元）不低于该值的合约
+	SortBy         string   // -t db 目标与报告排序方式：空（默认）| holdings
+	SolcVersion    string   // -t db 时按 CBOR 元数据中的编译器版本过滤，如 <0.8.0
+	Selectors      []string // -t db 时只扫描代码包含全部这些选择器（0x 加 8 位十六进制）的合约
+	Kinds          []string // -t db 时按合约类型标签过滤：任一命中，! 前缀表示排除
 }
 
 type BlockRange struct {